@@ -0,0 +1,302 @@
+package stex
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrEmptyBook is returned by OrderBookAnalytics when a needed side of the book has no levels
+var ErrEmptyBook = errors.New("stex: order book side is empty")
+
+// Digits after the point of intermediate results when precision is not set
+const analyticsPlaces = 18
+
+// OrderBookView is an order book analytics are computed on, implemented by OrderBook and LiveOrderBook
+type OrderBookView interface {
+	// Levels returns up to n best levels of each side best first, n <= 0 means all
+	Levels(n int) (bids, asks []Order)
+}
+
+// Levels returns up to n best levels of each side best first with recalculated cumulative amounts, n <= 0 means all
+func (ob *OrderBook) Levels(n int) (bids, asks []Order) {
+	bids = sortLevels(append([]Order{}, ob.Bid...), true, n)
+	asks = sortLevels(append([]Order{}, ob.Ask...), false, n)
+	return bids, asks
+}
+
+// FillEstimate define result of walking the book with a market order
+type FillEstimate struct {
+	// Side of the order, BUY takes asks and SELL takes bids
+	Side TradeType
+	// Base currency amount filled
+	Amount Decimal
+	// Market currency amount spent by BUY or received by SELL
+	Quote Decimal
+	// Volume weighted average price of the fill
+	AveragePrice Decimal
+	// Best and worst prices of the levels taken
+	BestPrice  Decimal
+	WorstPrice Decimal
+	// Adverse difference between average and best price in basis points
+	SlippageBps Decimal
+	// Adverse difference between worst and best price in basis points, i.e. how far the order moves the price
+	ImpactBps Decimal
+	// Number of levels taken, the last one may be taken partially
+	Levels int
+	// Part (0..1) of the side amount taken
+	BookShare Decimal
+	// Complete is false when the book is too thin for the whole order
+	Complete bool
+}
+
+// OrderBookAnalytics computes fill prices, slippage and book shape of an order book.
+// All arithmetic is decimal. With precision of the pair set amounts are rounded to CurrencyPrecision
+// and prices and market currency amounts to MarketPrecision.
+type OrderBookAnalytics struct {
+	book OrderBookView
+
+	amount_precision *int
+	price_precision  *int
+}
+
+func NewOrderBookAnalytics(book OrderBookView) *OrderBookAnalytics {
+	return &OrderBookAnalytics{book: book}
+}
+
+// Precision takes amount and price precision from pair
+func (a *OrderBookAnalytics) Precision(pair CurrencyPair) *OrderBookAnalytics {
+	a.AmountPrecision(pair.CurrencyPrecision)
+	a.PricePrecision(pair.MarketPrecision)
+	return a
+}
+
+// AmountPrecision sets digits after the point of base currency amounts
+func (a *OrderBookAnalytics) AmountPrecision(precision int) *OrderBookAnalytics {
+	a.amount_precision = &precision
+	return a
+}
+
+// PricePrecision sets digits after the point of prices and market currency amounts
+func (a *OrderBookAnalytics) PricePrecision(precision int) *OrderBookAnalytics {
+	a.price_precision = &precision
+	return a
+}
+
+func (a *OrderBookAnalytics) amountPlaces() int32 {
+	if a.amount_precision == nil {
+		return analyticsPlaces
+	}
+	return int32(*a.amount_precision)
+}
+
+func (a *OrderBookAnalytics) pricePlaces() int32 {
+	if a.price_precision == nil {
+		return analyticsPlaces
+	}
+	return int32(*a.price_precision)
+}
+
+func (a *OrderBookAnalytics) roundPrice(price Decimal) Decimal {
+	if a.price_precision == nil {
+		return price
+	}
+	return price.Round(int32(*a.price_precision))
+}
+
+// levels returns up to depth best levels of each side, depth <= 0 means all.
+// Levels with non-positive price or amount are skipped before the depth is applied.
+func (a *OrderBookAnalytics) levels(depth int) (bids, asks []Order) {
+	bids, asks = a.book.Levels(0)
+	return sortLevels(validLevels(bids), true, depth), sortLevels(validLevels(asks), false, depth)
+}
+
+func validLevels(levels []Order) []Order {
+	res := levels[:0]
+	for _, level := range levels {
+		if level.Price.IsPositive() && level.Amount.IsPositive() {
+			res = append(res, level)
+		}
+	}
+	return res
+}
+
+// side returns levels taken by order of side best first
+func (a *OrderBookAnalytics) side(side TradeType) ([]Order, error) {
+	bids, asks := a.levels(0)
+
+	switch side {
+	case TradeType_BUY:
+		return asks, nil
+	case TradeType_SELL:
+		return bids, nil
+	}
+	return nil, fmt.Errorf("unknown trade type %q", side)
+}
+
+// FillAmount estimates market order of side for amount of base currency
+func (a *OrderBookAnalytics) FillAmount(side TradeType, amount Decimal) (*FillEstimate, error) {
+	amount = amount.Truncate(a.amountPlaces())
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	levels, err := a.side(side)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.fill(side, levels, func(level Order, filled, quote Decimal) Decimal {
+		return MinDecimal(level.Amount, amount.Sub(filled))
+	})
+}
+
+// FillQuote estimates market order of side spending (BUY) or receiving (SELL) quote of market currency
+func (a *OrderBookAnalytics) FillQuote(side TradeType, quote Decimal) (*FillEstimate, error) {
+	if !quote.IsPositive() {
+		return nil, fmt.Errorf("quote must be positive")
+	}
+
+	levels, err := a.side(side)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.fill(side, levels, func(level Order, filled, spent Decimal) Decimal {
+		left := quote.Sub(spent)
+		if level.Amount.Mul(level.Price).LessThanOrEqual(left) {
+			return level.Amount
+		}
+		return left.Div(level.Price, analyticsPlaces).Truncate(a.amountPlaces())
+	})
+}
+
+// fill walks levels while take returns a positive amount to take from the level
+func (a *OrderBookAnalytics) fill(side TradeType, levels []Order, take func(level Order, filled, quote Decimal) Decimal) (*FillEstimate, error) {
+	if len(levels) == 0 {
+		return nil, ErrEmptyBook
+	}
+
+	e := &FillEstimate{
+		Side:      side,
+		BestPrice: levels[0].Price,
+	}
+
+	total := Decimal{}
+	for _, level := range levels {
+		total = total.Add(level.Amount)
+	}
+
+	filled, quote := Decimal{}, Decimal{}
+	stopped := false
+	for _, level := range levels {
+		amount := take(level, filled, quote)
+		if !amount.IsPositive() {
+			stopped = true
+			break
+		}
+
+		filled = filled.Add(amount)
+		quote = quote.Add(amount.Mul(level.Price))
+		e.WorstPrice = level.Price
+		e.Levels++
+
+		if amount.LessThan(level.Amount) {
+			stopped = true
+			break
+		}
+	}
+
+	// With the book taken whole the order is complete if a deeper level would not be taken
+	last := levels[len(levels)-1]
+	e.Complete = stopped || !take(Order{Price: last.Price, Amount: total}, filled, quote).IsPositive()
+
+	if filled.IsZero() {
+		e.Complete = false
+		return e, nil
+	}
+
+	e.Amount = filled.Truncate(a.amountPlaces())
+	average := quote.Div(filled, analyticsPlaces)
+	e.AveragePrice = a.roundPrice(average)
+
+	// Spent quote is rounded against the buyer, received quote against the seller
+	e.Quote = quote
+	if a.price_precision != nil {
+		if side == TradeType_BUY {
+			e.Quote = quote.Ceil(a.pricePlaces())
+		} else {
+			e.Quote = quote.Floor(a.pricePlaces())
+		}
+	}
+
+	e.SlippageBps = adverseBps(side, e.BestPrice, average)
+	e.ImpactBps = adverseBps(side, e.BestPrice, e.WorstPrice)
+	if total.IsPositive() {
+		e.BookShare = filled.Div(total, 8)
+	}
+
+	return e, nil
+}
+
+// adverseBps returns how much worse than ref price is for side in basis points
+func adverseBps(side TradeType, ref, price Decimal) Decimal {
+	if ref.IsZero() {
+		return Decimal{}
+	}
+
+	diff := price.Sub(ref)
+	if side == TradeType_SELL {
+		diff = diff.Neg()
+	}
+	return diff.Mul(NewDecimalFromInt(10000)).Div(ref, 2)
+}
+
+// MidPrice returns average of best bid and best ask
+func (a *OrderBookAnalytics) MidPrice() (Decimal, error) {
+	bids, asks := a.levels(1)
+	if len(bids) == 0 || len(asks) == 0 {
+		return Decimal{}, ErrEmptyBook
+	}
+
+	mid := bids[0].Price.Add(asks[0].Price).Div(NewDecimalFromInt(2), analyticsPlaces)
+	return a.roundPrice(mid.Normalize()), nil
+}
+
+// MicroPrice returns best bid and ask prices weighted by amount of the opposite side,
+// it leans towards the side that is likely to be taken first
+func (a *OrderBookAnalytics) MicroPrice() (Decimal, error) {
+	bids, asks := a.levels(1)
+	if len(bids) == 0 || len(asks) == 0 {
+		return Decimal{}, ErrEmptyBook
+	}
+
+	bid, ask := bids[0], asks[0]
+	volume := bid.Amount.Add(ask.Amount)
+	if !volume.IsPositive() {
+		return Decimal{}, ErrEmptyBook
+	}
+
+	weighted := bid.Price.Mul(ask.Amount).Add(ask.Price.Mul(bid.Amount))
+	return a.roundPrice(weighted.Div(volume, analyticsPlaces).Normalize()), nil
+}
+
+// Imbalance returns (bids - asks) / (bids + asks) of amounts of up to depth best levels, depth <= 0 means all.
+// The result is between -1 (only asks) and 1 (only bids).
+func (a *OrderBookAnalytics) Imbalance(depth int) (Decimal, error) {
+	bids, asks := a.levels(depth)
+
+	bidAmount, askAmount := Decimal{}, Decimal{}
+	if len(bids) > 0 {
+		bidAmount = bids[len(bids)-1].CumulativeAmount
+	}
+	if len(asks) > 0 {
+		askAmount = asks[len(asks)-1].CumulativeAmount
+	}
+
+	volume := bidAmount.Add(askAmount)
+	if !volume.IsPositive() {
+		return Decimal{}, ErrEmptyBook
+	}
+
+	return bidAmount.Sub(askAmount).Div(volume, 8), nil
+}
@@ -0,0 +1,113 @@
+package stex
+
+import (
+	"testing"
+)
+
+func bookLevel(price, amount string) Order {
+	return Order{Price: MustParseDecimal(price), Amount: MustParseDecimal(amount)}
+}
+
+func TestOrderBookAnalyticsFill(t *testing.T) {
+	book := &OrderBook{
+		Ask: []Order{bookLevel("0.03", "2"), bookLevel("0", "5"), bookLevel("0.02", "1"), bookLevel("0.025", "0")},
+		Bid: []Order{bookLevel("0.009", "1"), bookLevel("0.01", "1"), bookLevel("-0.01", "3")},
+	}
+	a := NewOrderBookAnalytics(book)
+
+	tests := []struct {
+		name     string
+		fill     func() (*FillEstimate, error)
+		amount   string
+		quote    string
+		average  string
+		levels   int
+		complete bool
+	}{
+		{
+			name:   "quote buy skips zero price level",
+			fill:   func() (*FillEstimate, error) { return a.FillQuote(TradeType_BUY, MustParseDecimal("0.05")) },
+			amount: "2", quote: "0.05", average: "0.025", levels: 2, complete: true,
+		},
+		{
+			name:   "quote buy larger than book",
+			fill:   func() (*FillEstimate, error) { return a.FillQuote(TradeType_BUY, MustParseDecimal("1")) },
+			amount: "3", quote: "0.08", average: "0.026666666666666667", levels: 2,
+		},
+		{
+			name:   "quote sell skips negative price level",
+			fill:   func() (*FillEstimate, error) { return a.FillQuote(TradeType_SELL, MustParseDecimal("0.0145")) },
+			amount: "1.5", quote: "0.0145", average: "0.009666666666666667", levels: 2, complete: true,
+		},
+		{
+			name:   "amount sell",
+			fill:   func() (*FillEstimate, error) { return a.FillAmount(TradeType_SELL, MustParseDecimal("1")) },
+			amount: "1", quote: "0.01", average: "0.01", levels: 1, complete: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := tt.fill()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !e.Amount.Equal(MustParseDecimal(tt.amount)) || !e.Quote.Equal(MustParseDecimal(tt.quote)) ||
+				!e.AveragePrice.Equal(MustParseDecimal(tt.average)) || e.Levels != tt.levels || e.Complete != tt.complete {
+				t.Errorf("estimate = %+v", e)
+			}
+		})
+	}
+}
+
+func TestOrderBookAnalyticsInvalidLevels(t *testing.T) {
+	book := &OrderBook{
+		Ask: []Order{bookLevel("0", "5")},
+		Bid: []Order{bookLevel("0.01", "0")},
+	}
+	a := NewOrderBookAnalytics(book)
+
+	if _, err := a.FillQuote(TradeType_BUY, MustParseDecimal("1")); err != ErrEmptyBook {
+		t.Errorf("FillQuote on zero price levels = %v, want ErrEmptyBook", err)
+	}
+	if _, err := a.FillAmount(TradeType_SELL, MustParseDecimal("1")); err != ErrEmptyBook {
+		t.Errorf("FillAmount on zero amount levels = %v, want ErrEmptyBook", err)
+	}
+	if _, err := a.MidPrice(); err != ErrEmptyBook {
+		t.Errorf("MidPrice on invalid levels = %v, want ErrEmptyBook", err)
+	}
+	if _, err := a.Imbalance(0); err != ErrEmptyBook {
+		t.Errorf("Imbalance on invalid levels = %v, want ErrEmptyBook", err)
+	}
+}
+
+func TestOrderBookAnalyticsShape(t *testing.T) {
+	book := &OrderBook{
+		Ask: []Order{bookLevel("0", "5"), bookLevel("0.03", "1"), bookLevel("0.02", "3"), bookLevel("0.019", "0")},
+		Bid: []Order{bookLevel("0.011", "0"), bookLevel("0.01", "1"), bookLevel("-1", "2")},
+	}
+	a := NewOrderBookAnalytics(book)
+
+	tests := []struct {
+		name  string
+		value func() (Decimal, error)
+		want  string
+	}{
+		{name: "mid price", value: a.MidPrice, want: "0.015"},
+		{name: "micro price", value: a.MicroPrice, want: "0.0125"},
+		{name: "imbalance of best levels", value: func() (Decimal, error) { return a.Imbalance(1) }, want: "-0.5"},
+		{name: "imbalance of all levels", value: func() (Decimal, error) { return a.Imbalance(0) }, want: "-0.6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := tt.value()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !v.Equal(MustParseDecimal(tt.want)) {
+				t.Errorf("value = %s, want %s", v, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+)
+
+type EventType string
+
+const (
+	EventCandle EventType = "candle"
+	EventTrade  EventType = "trade"
+)
+
+// Event define one replayed market event, Candle or Trade is set by Type
+type Event struct {
+	Type EventType
+	// Time is the close time for candles and the trade time for trades
+	Time time.Time
+
+	CandleType stex.CandleType
+	Candle     *stex.Candle
+	Trade      *stex.CurrencyPairTrades
+}
+
+// Strategy receives replayed events in time order.
+// c is bound to the simulated account: orders placed with c.NewCreateOrderService() are checked
+// against the pair rules and filled from the following ticks, public services return the market as of ev.Time.
+type Strategy interface {
+	OnEvent(ctx context.Context, c *stex.Client, ev Event) error
+}
+
+// StrategyFunc is an adapter to use ordinary functions as Strategy
+type StrategyFunc func(ctx context.Context, c *stex.Client, ev Event) error
+
+func (f StrategyFunc) OnEvent(ctx context.Context, c *stex.Client, ev Event) error {
+	return f(ctx, c, ev)
+}
+
+// Backtest replays a Dataset into a Strategy
+type Backtest struct {
+	data     *Dataset
+	strategy Strategy
+
+	balances      map[string]stex.Decimal
+	fees          *stex.Fees
+	candle_types  []stex.CandleType
+	trades        bool
+	sharpe_period time.Duration
+}
+
+// New returns backtest of strategy on data with empty balances
+func New(data *Dataset, strategy Strategy) *Backtest {
+	return &Backtest{
+		data:          data,
+		strategy:      strategy,
+		balances:      map[string]stex.Decimal{},
+		trades:        true,
+		sharpe_period: 24 * time.Hour,
+	}
+}
+
+// Balance sets starting balance of currency code
+func (b *Backtest) Balance(code string, amount stex.Decimal) *Backtest {
+	b.balances[strings.ToUpper(code)] = amount
+	return b
+}
+
+// Fees sets fee fractions of the pair, by default the pair BuyFeePercent and SellFeePercent are used
+func (b *Backtest) Fees(fees stex.Fees) *Backtest {
+	b.fees = &fees
+	return b
+}
+
+// CandleTypes sets candle sizes sent to the strategy, default is all sizes of the dataset
+func (b *Backtest) CandleTypes(candle_types ...stex.CandleType) *Backtest {
+	b.candle_types = candle_types
+	return b
+}
+
+// Trades sets whether trades are sent to the strategy, default is true
+func (b *Backtest) Trades(deliver bool) *Backtest {
+	b.trades = deliver
+	return b
+}
+
+// SharpePeriod sets the period of returns of Report.Sharpe, default is one day
+func (b *Backtest) SharpePeriod(period time.Duration) *Backtest {
+	b.sharpe_period = period
+	return b
+}
+
+// replayEvent is an event of the replay, tick is set when it moves the market
+type replayEvent struct {
+	ev      Event
+	tick    *stex.CurrencyPairTrades
+	deliver bool
+	// order of events at the same time: candles from the smallest, then ticks,
+	// a candle closing at a time is complete before trades of that time that belong to the next one
+	rank int
+}
+
+// Rank of ticks, after candles of all sizes
+var tickRank = len(CandleTypes)
+
+// events returns all events of the dataset in replay order.
+// Ticks are the trades of the dataset or, without trades, open, low, high and close prices of the smallest candles.
+func (b *Backtest) events() ([]replayEvent, error) {
+	deliver := map[stex.CandleType]bool{}
+	for _, candle_type := range b.candle_types {
+		if _, ok := b.data.Candles[candle_type]; !ok {
+			return nil, fmt.Errorf("candle type %q not loaded", candle_type)
+		}
+		deliver[candle_type] = true
+	}
+
+	res := []replayEvent{}
+	smallest := stex.CandleType("")
+	for rank, candle_type := range CandleTypes {
+		candles, ok := b.data.Candles[candle_type]
+		if !ok {
+			continue
+		}
+		if smallest == "" && len(candles) > 0 {
+			smallest = candle_type
+		}
+
+		size := candleSizes[candle_type]
+		for i := range candles {
+			res = append(res, replayEvent{
+				ev: Event{
+					Type:       EventCandle,
+					Time:       candles[i].Time.Add(size),
+					CandleType: candle_type,
+					Candle:     &candles[i],
+				},
+				deliver: len(deliver) == 0 || deliver[candle_type],
+				rank:    rank,
+			})
+		}
+	}
+
+	for i := range b.data.Trades {
+		t := &b.data.Trades[i]
+		res = append(res, replayEvent{
+			ev:      Event{Type: EventTrade, Time: t.Timestamp.Time, Trade: t},
+			tick:    t,
+			deliver: b.trades,
+			rank:    tickRank,
+		})
+	}
+
+	if len(b.data.Trades) == 0 && smallest != "" {
+		res = append(res, candleTicks(b.data.Candles[smallest], candleSizes[smallest])...)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if !res[i].ev.Time.Equal(res[j].ev.Time) {
+			return res[i].ev.Time.Before(res[j].ev.Time)
+		}
+		return res[i].rank < res[j].rank
+	})
+	return res, nil
+}
+
+// candleTicks makes four ticks of every candle sharing its volume: open, low, high, close for rising
+// candles and open, high, low, close for falling ones
+func candleTicks(candles []stex.Candle, size time.Duration) []replayEvent {
+	res := []replayEvent{}
+	four := stex.NewDecimalFromInt(4)
+	var id int64
+
+	for _, c := range candles {
+		prices := []stex.Decimal{c.Open, c.Low, c.High, c.Close}
+		if c.Close.LessThan(c.Open) {
+			prices[1], prices[2] = c.High, c.Low
+		}
+		amount := c.Volume.Div(four, 18).Normalize()
+
+		for i, price := range prices {
+			id++
+			t := &stex.CurrencyPairTrades{
+				Id:        id,
+				Price:     price,
+				Amount:    amount,
+				Timestamp: stex.NewTime(c.Time.Add(size * time.Duration(i) / 4)),
+			}
+			res = append(res, replayEvent{ev: Event{Type: EventTrade, Time: t.Timestamp.Time, Trade: t}, tick: t, rank: tickRank})
+		}
+	}
+	return res
+}
+
+// Run replays the dataset and returns results of the strategy
+func (b *Backtest) Run(ctx context.Context) (*Report, error) {
+	if b.strategy == nil {
+		return nil, fmt.Errorf("strategy not init")
+	}
+
+	events, err := b.events()
+	if err != nil {
+		return nil, err
+	}
+
+	// The pair is replayed as it was trading even if it is inactive now
+	data := *b.data
+	data.Pair.Active = true
+	data.Pair.Delisted = false
+
+	fees := stex.Fees{
+		BuyFee:  data.Pair.BuyFeePercent.Div(stex.NewDecimalFromInt(100), 18).Normalize(),
+		SellFee: data.Pair.SellFeePercent.Div(stex.NewDecimalFromInt(100), 18).Normalize(),
+	}
+	if b.fees != nil {
+		fees = *b.fees
+	}
+
+	m := newMarket(&data, fees)
+	p := stex.NewPaperTrading(b.balances).Clock(m.clock)
+
+	c := stex.NewClient("")
+	c.BaseURL = "http://backtest"
+	c.HTTPClient = &http.Client{Transport: m}
+	c.PaperTrade(p)
+	c.Validator = stex.NewOrderValidator(c).Source(&data).TTL(365 * 24 * time.Hour)
+
+	// The simulated account is loaded on its first request, balances are known from the first tick then
+	if _, err := c.NewProfileWalletListService().Do(ctx); err != nil {
+		return nil, err
+	}
+
+	r := &recorder{report: &Report{Start: data.From, End: data.Till}}
+
+	for _, e := range events {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		m.advance(e.ev.Time)
+
+		if e.tick != nil {
+			m.tick(*e.tick)
+			if err := p.Sync(ctx); err != nil {
+				return nil, err
+			}
+			if r.report.InitialEquity.IsZero() {
+				r.report.InitialEquity = b.equity(p.Balances(), e.tick.Price)
+			}
+		}
+
+		if e.deliver {
+			if err := b.strategy.OnEvent(ctx, c, e.ev); err != nil {
+				return nil, err
+			}
+		}
+
+		if last, ok := m.last(); ok {
+			r.equity(e.ev.Time, b.equity(p.Balances(), last.Price))
+		}
+	}
+
+	err = r.fills(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	r.report.Balances = p.Balances()
+	r.finish(b.sharpe_period)
+	return r.report, nil
+}
+
+// equity values balances of the pair currencies in the market currency
+func (b *Backtest) equity(balances map[string]stex.Balance, price stex.Decimal) stex.Decimal {
+	currency := balances[b.data.Currency.Code]
+	market := balances[b.data.Market.Code]
+	return market.TotalBalance.Add(currency.TotalBalance.Mul(price))
+}
@@ -0,0 +1,132 @@
+package backtest_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+	"github.com/vladivolo/stex-api/backtest"
+)
+
+func testDataset(start time.Time, prices ...string) *backtest.Dataset {
+	data := &backtest.Dataset{
+		Pair: stex.CurrencyPair{
+			Id: 1, CurrencyId: 2, MarketCurrencyId: 1, Symbol: "ETH_BTC", Active: true,
+			MinOrderAmount: stex.MustParseDecimal("0.001"), MinBuyPrice: stex.MustParseDecimal("0.00000001"), MinSellPrice: stex.MustParseDecimal("0.00000001"),
+			BuyFeePercent: stex.MustParseDecimal("0.2"), SellFeePercent: stex.MustParseDecimal("0.2"), CurrencyPrecision: 8, MarketPrecision: 8,
+		},
+		Currency: stex.CurrencyInfo{Id: 2, Code: "ETH", Precision: 8, Active: true},
+		Market:   stex.CurrencyInfo{Id: 1, Code: "BTC", Precision: 8, Active: true},
+		From:     start,
+		Till:     start.Add(time.Duration(len(prices)) * time.Minute),
+	}
+	for i, price := range prices {
+		data.Trades = append(data.Trades, stex.CurrencyPairTrades{
+			Id:        int64(i + 1),
+			Price:     stex.MustParseDecimal(price),
+			Amount:    stex.MustParseDecimal("10"),
+			Type:      "BUY",
+			Timestamp: stex.NewTime(start.Add(time.Duration(i) * time.Minute)),
+		})
+	}
+	return data
+}
+
+func TestBacktestRun(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := testDataset(start, "0.02", "0.018", "0.025")
+
+	// Buys below the first price, sells what it got above the second one
+	strategy := backtest.StrategyFunc(func(ctx context.Context, c *stex.Client, ev backtest.Event) error {
+		var err error
+		switch ev.Trade.Id {
+		case 1:
+			_, err = c.NewCreateOrderService().CurrencyPairId(1).OrderType(stex.OrderType_BUY).
+				Amount(stex.MustParseDecimal("1")).Price(stex.MustParseDecimal("0.019")).Do(ctx)
+		case 2:
+			_, err = c.NewCreateOrderService().CurrencyPairId(1).OrderType(stex.OrderType_SELL).
+				Amount(stex.MustParseDecimal("0.998")).Price(stex.MustParseDecimal("0.024")).Do(ctx)
+		}
+		return err
+	})
+
+	report, err := backtest.New(data, strategy).Balance("BTC", stex.MustParseDecimal("1")).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Orders != 2 || len(report.Fills) != 2 {
+		t.Fatalf("orders %d, fills %+v", report.Orders, report.Fills)
+	}
+	buy, sell := report.Fills[0], report.Fills[1]
+	if buy.Side != stex.TradeType_BUY || !buy.Price.Equal(stex.MustParseDecimal("0.019")) || !buy.Amount.Equal(stex.MustParseDecimal("1")) ||
+		!buy.Fee.Equal(stex.MustParseDecimal("0.002")) || buy.FeeCurrencyId != 2 || !buy.Time.Equal(start.Add(time.Minute)) {
+		t.Errorf("buy fill = %+v", buy)
+	}
+	if sell.Side != stex.TradeType_SELL || !sell.Price.Equal(stex.MustParseDecimal("0.024")) || !sell.Amount.Equal(stex.MustParseDecimal("0.998")) ||
+		!sell.Fee.Equal(stex.MustParseDecimal("0.0000479")) || sell.FeeCurrencyId != 1 {
+		t.Errorf("sell fill = %+v", sell)
+	}
+
+	if btc := report.Balances["BTC"]; !btc.Balance.Equal(stex.MustParseDecimal("1.0049041")) {
+		t.Errorf("BTC balance = %+v", btc)
+	}
+	if !report.InitialEquity.Equal(stex.MustParseDecimal("1")) || !report.FinalEquity.Equal(stex.MustParseDecimal("1.0049041")) {
+		t.Errorf("equity %s -> %s", report.InitialEquity, report.FinalEquity)
+	}
+	if !report.Turnover.Equal(stex.MustParseDecimal("0.042952")) {
+		t.Errorf("turnover = %s", report.Turnover)
+	}
+	if len(report.Equity) != 3 || report.Return <= 0 {
+		t.Errorf("equity curve %+v, return %f", report.Equity, report.Return)
+	}
+}
+
+func TestBacktestEventOrder(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := testDataset(start, "0.02", "0.021", "0.022")
+	data.Candles = map[stex.CandleType][]stex.Candle{}
+	for i := 0; i < 2; i++ {
+		price := stex.MustParseDecimal("0.02")
+		data.Candles[stex.CandleType1m] = append(data.Candles[stex.CandleType1m], stex.Candle{
+			Time: stex.NewTime(start.Add(time.Duration(i) * time.Minute)), Open: price, Close: price, Low: price, High: price,
+		})
+	}
+
+	// A candle closing at the time of a trade is delivered first, the trade belongs to the next candle
+	events := []string{}
+	strategy := backtest.StrategyFunc(func(ctx context.Context, c *stex.Client, ev backtest.Event) error {
+		if ev.Type == backtest.EventCandle {
+			events = append(events, "candle "+ev.Candle.Time.Format("15:04"))
+		} else {
+			events = append(events, "trade "+ev.Time.Format("15:04"))
+		}
+		return nil
+	})
+
+	if _, err := backtest.New(data, strategy).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"trade 00:00", "candle 00:00", "trade 00:01", "candle 00:01", "trade 00:02"}
+	if strings.Join(events, ", ") != strings.Join(want, ", ") {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+func TestBacktestStrategyError(t *testing.T) {
+	data := testDataset(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), "0.02")
+
+	// Orders are checked against the pair rules
+	strategy := backtest.StrategyFunc(func(ctx context.Context, c *stex.Client, ev backtest.Event) error {
+		_, err := c.NewCreateOrderService().CurrencyPairId(1).OrderType(stex.OrderType_BUY).
+			Amount(stex.MustParseDecimal("0.0001")).Price(stex.MustParseDecimal("0.02")).Do(ctx)
+		return err
+	})
+
+	_, err := backtest.New(data, strategy).Balance("BTC", stex.MustParseDecimal("1")).Run(context.Background())
+	if err == nil {
+		t.Error("order below minimum amount was accepted")
+	}
+}
@@ -0,0 +1,272 @@
+// Package backtest replays STEX market history into trading strategies offline.
+//
+// Loader downloads candles of CurrencyPairChartService and ticks of CurrencyPairTradesService
+// and caches them on disk. Backtest replays a Dataset in time order into a Strategy, which trades
+// with a regular *stex.Client: orders are checked against the pair rules by stex.OrderValidator
+// and filled by stex.PaperTrading from the replayed ticks.
+//
+//	data, err := backtest.NewLoader(c).CacheDir("testdata").Load(ctx, pair_id, from, till)
+//	if err != nil {
+//		return err
+//	}
+//	report, err := backtest.New(data, strategy).Balance("BTC", stex.MustParseDecimal("1")).Run(ctx)
+package backtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+)
+
+// CandleTypes lists all candle sizes of CurrencyPairChartService, smallest first
+var CandleTypes = []stex.CandleType{
+	stex.CandleType1m,
+	stex.CandleType5m,
+	stex.CandleType30m,
+	stex.CandleType1h,
+	stex.CandleType4h,
+	stex.CandleType12h,
+	stex.CandleType1d,
+}
+
+var candleSizes = map[stex.CandleType]time.Duration{
+	stex.CandleType1m:  time.Minute,
+	stex.CandleType5m:  5 * time.Minute,
+	stex.CandleType30m: 30 * time.Minute,
+	stex.CandleType1h:  time.Hour,
+	stex.CandleType4h:  4 * time.Hour,
+	stex.CandleType12h: 12 * time.Hour,
+	stex.CandleType1d:  24 * time.Hour,
+}
+
+// CandleSize returns duration of candles of given type, 0 for unknown types
+func CandleSize(candle_type stex.CandleType) time.Duration {
+	return candleSizes[candle_type]
+}
+
+// Dataset define market history of one currency pair
+type Dataset struct {
+	Pair stex.CurrencyPair `json:"pair"`
+	// Currency and Market are the traded and the quote currency of Pair
+	Currency stex.CurrencyInfo `json:"currency"`
+	Market   stex.CurrencyInfo `json:"market"`
+
+	From time.Time `json:"from"`
+	Till time.Time `json:"till"`
+
+	// Candles are sorted by time
+	Candles map[stex.CandleType][]stex.Candle `json:"candles"`
+	// Trades are sorted by time and id
+	Trades []stex.CurrencyPairTrades `json:"trades"`
+}
+
+// PairInfo makes Dataset a stex.PairInfoSource of its pair
+func (d *Dataset) PairInfo(ctx context.Context, pair_id int) (*stex.CurrencyPair, error) {
+	if pair_id != d.Pair.Id {
+		return nil, fmt.Errorf("pair %d: %w", pair_id, stex.ErrNotFound)
+	}
+
+	pair := d.Pair
+	return &pair, nil
+}
+
+// pairInfo is the cached part of Dataset describing the pair
+type pairInfo struct {
+	Pair     stex.CurrencyPair `json:"pair"`
+	Currency stex.CurrencyInfo `json:"currency"`
+	Market   stex.CurrencyInfo `json:"market"`
+}
+
+// Loader downloads market history and keeps it in a cache directory
+type Loader struct {
+	c *stex.Client
+
+	cache_dir    *string
+	candle_types []stex.CandleType
+	trades       bool
+}
+
+// NewLoader returns loader of all candle types and trades
+func NewLoader(c *stex.Client) *Loader {
+	return &Loader{c: c, trades: true}
+}
+
+// CacheDir sets directory of cached series. Series of the same pair and period are read from it
+// instead of the API, pair rules are cached too and are not refreshed while the file exists.
+func (l *Loader) CacheDir(dir string) *Loader {
+	l.cache_dir = &dir
+	return l
+}
+
+// CandleTypes sets candle sizes to load, default is all of CandleTypes
+func (l *Loader) CandleTypes(candle_types ...stex.CandleType) *Loader {
+	l.candle_types = candle_types
+	return l
+}
+
+// Trades sets whether public trades are loaded, default is true
+func (l *Loader) Trades(load bool) *Loader {
+	l.trades = load
+	return l
+}
+
+// Load returns history of pair from from till till
+func (l *Loader) Load(ctx context.Context, pair_id int, from, till time.Time) (*Dataset, error) {
+	if !from.Before(till) {
+		return nil, fmt.Errorf("from must be before till")
+	}
+
+	from = from.Truncate(time.Second)
+	till = till.Truncate(time.Second)
+
+	if l.cache_dir != nil {
+		err := os.MkdirAll(*l.cache_dir, 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	info := pairInfo{}
+	err := l.cached(fmt.Sprintf("%d-pair.json", pair_id), &info, func() (interface{}, error) {
+		return l.pairInfo(ctx, pair_id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dataset{
+		Pair:     info.Pair,
+		Currency: info.Currency,
+		Market:   info.Market,
+		From:     from,
+		Till:     till,
+		Candles:  map[stex.CandleType][]stex.Candle{},
+		Trades:   []stex.CurrencyPairTrades{},
+	}
+
+	candle_types := l.candle_types
+	if len(candle_types) == 0 {
+		candle_types = CandleTypes
+	}
+
+	for _, candle_type := range candle_types {
+		if _, ok := candleSizes[candle_type]; !ok {
+			return nil, fmt.Errorf("unknown candle type %q", candle_type)
+		}
+
+		candle_type := candle_type
+		candles := []stex.Candle{}
+		name := fmt.Sprintf("%d-%s-%d-%d.json", pair_id, candle_type, from.Unix(), till.Unix())
+		err = l.cached(name, &candles, func() (interface{}, error) {
+			return l.c.NewCurrencyPairChartService().CurrencyPairId(pair_id).CandleType(candle_type).
+				TmStart(from).TmEnd(till).Pager().All(ctx)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		sort.SliceStable(candles, func(i, j int) bool { return candles[i].Time.Before(candles[j].Time.Time) })
+		d.Candles[candle_type] = candles
+	}
+
+	if l.trades {
+		name := fmt.Sprintf("%d-trades-%d-%d.json", pair_id, from.Unix(), till.Unix())
+		err = l.cached(name, &d.Trades, func() (interface{}, error) {
+			return l.c.NewCurrencyPairTradesService().CurrencyPairId(pair_id).From(from).Till(till).
+				Sort(stex.SortAsc).Pager().All(ctx)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		sort.SliceStable(d.Trades, func(i, j int) bool {
+			a, b := d.Trades[i], d.Trades[j]
+			if !a.Timestamp.Equal(b.Timestamp.Time) {
+				return a.Timestamp.Before(b.Timestamp.Time)
+			}
+			return a.Id < b.Id
+		})
+	}
+
+	return d, nil
+}
+
+func (l *Loader) pairInfo(ctx context.Context, pair_id int) (*pairInfo, error) {
+	pair, err := l.c.NewCurrencyPairInfoService().PairId(pair_id).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	currency, err := l.c.NewCurrencyInfoByIdService().Id(pair.CurrencyId).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	market, err := l.c.NewCurrencyInfoByIdService().Id(pair.MarketCurrencyId).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pairInfo{Pair: *pair, Currency: currency, Market: market}, nil
+}
+
+// cached reads v from the cache file name or fetches it and writes the file
+func (l *Loader) cached(name string, v interface{}, fetch func() (interface{}, error)) error {
+	path := ""
+	if l.cache_dir != nil {
+		path = filepath.Join(*l.cache_dir, name)
+
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			return json.Unmarshal(data, v)
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	res, err := fetch()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	if path != "" {
+		err = writeFile(path, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// writeFile replaces the file atomically, so an interrupted download never leaves a broken cache
+func writeFile(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
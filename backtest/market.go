@@ -0,0 +1,193 @@
+package backtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+)
+
+// market is the http.RoundTripper of the replay client. It serves public data of the dataset pair
+// as it was at the replay time, trading requests never reach it as PaperTrading serves them.
+type market struct {
+	data *Dataset
+	fees stex.Fees
+
+	mu  sync.Mutex
+	now time.Time
+	// ticks replayed so far
+	ticks []stex.CurrencyPairTrades
+}
+
+func newMarket(data *Dataset, fees stex.Fees) *market {
+	return &market{data: data, fees: fees, now: data.From}
+}
+
+func (m *market) clock() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.now
+}
+
+func (m *market) advance(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.After(m.now) {
+		m.now = now
+	}
+}
+
+func (m *market) tick(t stex.CurrencyPairTrades) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ticks = append(m.ticks, t)
+}
+
+// last returns the latest tick
+func (m *market) last() (stex.CurrencyPairTrades, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.ticks) == 0 {
+		return stex.CurrencyPairTrades{}, false
+	}
+	return m.ticks[len(m.ticks)-1], true
+}
+
+func (m *market) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := strings.Trim(req.URL.Path, "/")
+	pair := strconv.Itoa(m.data.Pair.Id)
+
+	var data interface{}
+	switch {
+	case path == "public/currencies":
+		data = []stex.CurrencyInfo{m.data.Currency, m.data.Market}
+	case strings.HasPrefix(path, "public/currency_pairs/list/"):
+		data = []stex.CurrencyPair{m.data.Pair}
+	case path == "public/currency_pairs/"+pair:
+		data = m.data.Pair
+	case path == "public/orderbook/"+pair:
+		data = m.book()
+	case path == "public/trades/"+pair:
+		trades, err := m.trades(req)
+		if err != nil {
+			return response(req, http.StatusUnprocessableEntity, map[string]interface{}{"success": false, "message": err.Error()})
+		}
+		data = trades
+	case path == "trading/fees/"+pair:
+		data = m.fees
+	default:
+		return response(req, http.StatusNotFound, map[string]interface{}{"success": false, "message": "Not available in backtest"})
+	}
+
+	return response(req, http.StatusOK, map[string]interface{}{"success": true, "data": data})
+}
+
+// book has one level on each side at the price of the latest tick with its amount
+func (m *market) book() stex.OrderBook {
+	book := stex.OrderBook{Ask: []stex.Order{}, Bid: []stex.Order{}}
+
+	t, ok := m.last()
+	if !ok {
+		return book
+	}
+
+	level := stex.Order{
+		CurrencyPairId:   m.data.Pair.Id,
+		Amount:           t.Amount,
+		Price:            t.Price,
+		Amount2:          t.Amount.Mul(t.Price),
+		Count:            1,
+		CumulativeAmount: t.Amount,
+	}
+	book.Ask = append(book.Ask, level)
+	book.Bid = append(book.Bid, level)
+	book.AskTotalAmount = t.Amount
+	book.BidTotalAmount = t.Amount
+	return book
+}
+
+// trades serves CurrencyPairTradesService from replayed ticks
+func (m *market) trades(req *http.Request) ([]stex.CurrencyPairTrades, error) {
+	q := req.URL.Query()
+	param := func(key string, def int64) (int64, error) {
+		v := q.Get(key)
+		if v == "" {
+			return def, nil
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s", key)
+		}
+		return n, nil
+	}
+
+	from, err := param("from", 0)
+	if err != nil {
+		return nil, err
+	}
+	till, err := param("till", m.clock().Unix())
+	if err != nil {
+		return nil, err
+	}
+	limit, err := param("limit", 100)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := param("offset", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	res := []stex.CurrencyPairTrades{}
+	for _, t := range m.ticks {
+		if t.Timestamp.Unix() >= from && t.Timestamp.Unix() <= till {
+			res = append(res, t)
+		}
+	}
+	m.mu.Unlock()
+
+	if stex.SortOrder(q.Get("sort")) != stex.SortAsc {
+		for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+			res[i], res[j] = res[j], res[i]
+		}
+	}
+
+	if offset > int64(len(res)) {
+		offset = int64(len(res))
+	}
+	res = res[offset:]
+	if limit >= 0 && limit < int64(len(res)) {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func response(req *http.Request, status int, v interface{}) (*http.Response, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(string(body))),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
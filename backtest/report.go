@@ -0,0 +1,219 @@
+package backtest
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+)
+
+// EquityPoint define value of the account at the time
+type EquityPoint struct {
+	Time time.Time
+	// Equity is the value of both pair currencies in the market currency at the latest tick price
+	Equity stex.Decimal
+	// Drawdown is the fall from the highest equity so far, 0.1 is 10%
+	Drawdown float64
+}
+
+// Fill define one trade of the strategy
+type Fill struct {
+	Time    time.Time
+	OrderId int64
+	TradeId int64
+	Side    stex.TradeType
+	Price   stex.Decimal
+	Amount  stex.Decimal
+	// Quote is Price * Amount in the market currency
+	Quote         stex.Decimal
+	Fee           stex.Decimal
+	FeeCurrencyId int
+}
+
+// Report define results of Backtest.Run
+type Report struct {
+	Start time.Time
+	End   time.Time
+
+	// InitialEquity is the value of starting balances at the first tick price
+	InitialEquity stex.Decimal
+	FinalEquity   stex.Decimal
+	// Return is FinalEquity / InitialEquity - 1
+	Return float64
+
+	// Equity has a point for every replayed moment
+	Equity []EquityPoint
+	// Fills are sorted by time
+	Fills []Fill
+	// Orders is the number of orders placed
+	Orders int
+
+	MaxDrawdown float64
+	// Sharpe is the annualized Sharpe ratio of equity returns over SharpePeriod with zero risk free rate
+	Sharpe float64
+	// Turnover is the traded volume in the market currency
+	Turnover stex.Decimal
+	// TurnoverRatio is Turnover divided by the average equity
+	TurnoverRatio float64
+
+	// Balances are the final balances by currency code
+	Balances map[string]stex.Balance
+}
+
+// recorder builds Report while the backtest runs
+type recorder struct {
+	report *Report
+}
+
+// equity adds a point of the equity curve, points of the same time replace each other
+func (r *recorder) equity(tm time.Time, equity stex.Decimal) {
+	points := r.report.Equity
+	if n := len(points); n > 0 && points[n-1].Time.Equal(tm) {
+		points[n-1].Equity = equity
+		return
+	}
+	r.report.Equity = append(points, EquityPoint{Time: tm, Equity: equity})
+}
+
+// fills reads orders and their trades from the simulated account
+func (r *recorder) fills(ctx context.Context, c *stex.Client) error {
+	orders, err := c.NewOrdersHistoryService().Pager().All(ctx)
+	if err != nil {
+		return err
+	}
+
+	open, err := c.NewOpenOrdersListService().Pager().All(ctx)
+	if err != nil {
+		return err
+	}
+
+	orders = append(orders, open...)
+	r.report.Orders = len(orders)
+	r.report.Fills = []Fill{}
+
+	for _, o := range orders {
+		if !o.ProcessedAmount.IsPositive() {
+			continue
+		}
+
+		detail, err := c.NewTradesOrderHistoryService().OrderId(o.Id).Do(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Fees are recorded at the time of their trade, trades without fee have none
+		fees := append([]stex.Fee{}, detail.Fees...)
+		for _, t := range detail.Trades {
+			f := Fill{
+				Time:    t.Timestamp.Time,
+				OrderId: o.Id,
+				TradeId: t.Id,
+				Side:    t.TradeType,
+				Price:   t.Price,
+				Amount:  t.Amount,
+				Quote:   t.Price.Mul(t.Amount),
+			}
+			for i, fee := range fees {
+				if fee.Timestamp.Equal(t.Timestamp.Time) {
+					f.Fee = fee.Amount
+					f.FeeCurrencyId = fee.CurrencyId
+					fees = append(fees[:i], fees[i+1:]...)
+					break
+				}
+			}
+			r.report.Fills = append(r.report.Fills, f)
+		}
+	}
+
+	sort.SliceStable(r.report.Fills, func(i, j int) bool {
+		a, b := r.report.Fills[i], r.report.Fills[j]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		return a.TradeId < b.TradeId
+	})
+	return nil
+}
+
+// finish computes statistics of the equity curve and fills
+func (r *recorder) finish(sharpe_period time.Duration) {
+	rep := r.report
+
+	peak := 0.0
+	sum := 0.0
+	for i := range rep.Equity {
+		v := rep.Equity[i].Equity.Float64()
+		sum += v
+		if v > peak {
+			peak = v
+		}
+		if peak > 0 {
+			rep.Equity[i].Drawdown = (peak - v) / peak
+		}
+		if rep.Equity[i].Drawdown > rep.MaxDrawdown {
+			rep.MaxDrawdown = rep.Equity[i].Drawdown
+		}
+	}
+
+	if n := len(rep.Equity); n > 0 {
+		rep.FinalEquity = rep.Equity[n-1].Equity
+	}
+	if initial := rep.InitialEquity.Float64(); initial > 0 {
+		rep.Return = rep.FinalEquity.Float64()/initial - 1
+	}
+
+	for _, f := range rep.Fills {
+		rep.Turnover = rep.Turnover.Add(f.Quote)
+	}
+	if len(rep.Equity) > 0 && sum > 0 {
+		rep.TurnoverRatio = rep.Turnover.Float64() / (sum / float64(len(rep.Equity)))
+	}
+
+	rep.Sharpe = sharpe(rep.Equity, sharpe_period)
+}
+
+// sharpe samples equity at every period and returns the annualized Sharpe ratio of the sample returns
+func sharpe(points []EquityPoint, period time.Duration) float64 {
+	if len(points) < 2 || period <= 0 {
+		return 0
+	}
+
+	samples := []float64{}
+	i := 0
+	for tm := points[0].Time; !tm.After(points[len(points)-1].Time); tm = tm.Add(period) {
+		for i+1 < len(points) && !points[i+1].Time.After(tm) {
+			i++
+		}
+		samples = append(samples, points[i].Equity.Float64())
+	}
+
+	returns := []float64{}
+	for i := 1; i < len(samples); i++ {
+		if samples[i-1] > 0 {
+			returns = append(returns, samples[i]/samples[i-1]-1)
+		}
+	}
+	if len(returns) < 2 {
+		return 0
+	}
+
+	mean := 0.0
+	for _, v := range returns {
+		mean += v
+	}
+	mean /= float64(len(returns))
+
+	variance := 0.0
+	for _, v := range returns {
+		variance += (v - mean) * (v - mean)
+	}
+	std := math.Sqrt(variance / float64(len(returns)-1))
+	if std == 0 {
+		return 0
+	}
+
+	year := float64(365 * 24 * time.Hour)
+	return mean / std * math.Sqrt(year/float64(period))
+}
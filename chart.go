@@ -4,15 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 type Candle struct {
-	Time   int64   `json:"time"`
-	Open   float64 `json:"open"`
-	Close  float64 `json:"close"`
-	Low    float64 `json:"low"`
-	High   float64 `json:"high"`
-	Volume float64 `json:"volume"`
+	Time   Time    `json:"time"`
+	Open   Decimal `json:"open"`
+	Close  Decimal `json:"close"`
+	Low    Decimal `json:"low"`
+	High   Decimal `json:"high"`
+	Volume Decimal `json:"volume"`
 }
 
 type CurrencyPairChartService struct {
@@ -95,6 +96,18 @@ func (s *CurrencyPairChartService) CandleType(candle_type CandleType) *CurrencyP
 	return s
 }
 
+func (s *CurrencyPairChartService) TmStart(from time.Time) *CurrencyPairChartService {
+	tm := from.Unix()
+	s.tm_start = &tm
+	return s
+}
+
+func (s *CurrencyPairChartService) TmEnd(end time.Time) *CurrencyPairChartService {
+	tm := end.Unix()
+	s.tm_end = &tm
+	return s
+}
+
 func (s *CurrencyPairChartService) Limit(limit int) *CurrencyPairChartService {
 	s.limit = &limit
 	return s
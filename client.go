@@ -3,12 +3,14 @@ package stex
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
 type SortOrder string
@@ -55,6 +57,7 @@ const (
 	OrderStatus_CANCELLED   OrderStatus = "CANCELLED"
 	OrderStatus_PARTIAL     OrderStatus = "PARTIAL"
 	OrderStatus_PENDING     OrderStatus = "PENDING"
+	OrderStatus_PROCESSING  OrderStatus = "PROCESSING"
 	OrderStatus_WITH_TRADES OrderStatus = "WITH_TRADES"
 )
 
@@ -69,6 +72,17 @@ type Client struct {
 	Debug      bool
 	Logger     *log.Logger
 
+	// RetryPolicy enables automatic retries of failed requests, nil means a single attempt
+	RetryPolicy *RetryPolicy
+	// RateLimiter paces requests, nil means no client-side limits
+	RateLimiter RateLimiter
+	// TokenSource provides bearer token for authenticated requests instead of APIKey
+	TokenSource TokenSource
+	// Recorder writes every request and response pair to a file when set
+	Recorder *Recorder
+	// Validator checks orders of CreateOrderService before they are sent when set
+	Validator *OrderValidator
+
 	do doFunc
 }
 
@@ -92,7 +106,21 @@ func (c *Client) debug(format string, v ...interface{}) {
 	}
 }
 
-func (c *Client) parseRequest(r *request, opts ...RequestOption) (err error) {
+// accessToken returns bearer token from TokenSource if it is set, otherwise APIKey
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	if c.TokenSource == nil {
+		return c.APIKey, nil
+	}
+
+	t, err := c.TokenSource.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return t.AccessToken, nil
+}
+
+func (c *Client) parseRequest(ctx context.Context, r *request, opts ...RequestOption) (err error) {
 	// set request options from user
 	for _, opt := range opts {
 		opt(r)
@@ -111,7 +139,11 @@ func (c *Client) parseRequest(r *request, opts ...RequestOption) (err error) {
 	header.Set("accept", "application/json")
 
 	if r.secType == secTypeAPIKey {
-		header.Set("Authorization", "Bearer "+c.APIKey)
+		token, err := c.accessToken(ctx)
+		if err != nil {
+			return err
+		}
+		header.Set("Authorization", "Bearer "+token)
 	}
 
 	if bodyString != "" {
@@ -131,28 +163,91 @@ func (c *Client) parseRequest(r *request, opts ...RequestOption) (err error) {
 }
 
 func (c *Client) callAPI(ctx context.Context, r *request, opts ...RequestOption) (data []byte, err error) {
-	err = c.parseRequest(r, opts...)
+	attempt := 0
+	refreshed := false
+	for {
+		attempt++
+
+		var res *http.Response
+		data, res, err = c.doRequest(ctx, r, opts...)
+		if r.attempts != nil {
+			*r.attempts = attempt
+		}
+		if err == nil {
+			return data, nil
+		}
+
+		// Expired or revoked token is refreshed once, the request was not processed so it is safe to resend
+		if !refreshed && r.secType == secTypeAPIKey && errors.Is(err, ErrUnauthorized) {
+			if ts, ok := c.TokenSource.(TokenRefresher); ok {
+				refreshed = true
+				rejected := strings.TrimPrefix(r.header.Get("Authorization"), "Bearer ")
+				_, rerr := ts.Refresh(ctx, rejected)
+				if rerr == nil {
+					continue
+				}
+				c.debug("failed to refresh token: %s", rerr)
+			}
+		}
+
+		statusCode := 0
+		if res != nil {
+			statusCode = res.StatusCode
+		}
+
+		if attempt >= c.RetryPolicy.maxAttempts() || !c.RetryPolicy.retryable(r, statusCode, err) {
+			break
+		}
+
+		wait := c.RetryPolicy.backoff(attempt)
+		if res != nil {
+			if pause, ok := retryAfter(res.Header, time.Now()); ok && pause > wait {
+				wait = pause
+			}
+		}
+		c.debug("attempt %d failed: %s, retry in %s", attempt, err, wait)
+		if !sleepContext(ctx, wait) {
+			break
+		}
+	}
+
+	// The error of the last attempt is returned as is, so callers can keep asserting *APIError.
+	// WithAttempts reports how many attempts were made.
+	return nil, err
+}
+
+// doRequest makes a single attempt of request r. The returned response has its body already read and closed.
+func (c *Client) doRequest(ctx context.Context, r *request, opts ...RequestOption) (data []byte, res *http.Response, err error) {
+	err = c.parseRequest(ctx, r, opts...)
 	if err != nil {
-		return []byte{}, err
+		return nil, nil, err
 	}
 	req, err := http.NewRequest(r.method, r.fullURL, r.body)
 	if err != nil {
-		return []byte{}, err
+		return nil, nil, err
 	}
 	req = req.WithContext(ctx)
 	req.Header = r.header
 	c.debug("request: %#v", req)
+
+	if c.RateLimiter != nil {
+		err = c.RateLimiter.Wait(ctx, r.rateLimitGroup())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	f := c.do
 	if f == nil {
 		f = c.HTTPClient.Do
 	}
-	res, err := f(req)
+	res, err = f(req)
 	if err != nil {
-		return []byte{}, err
+		c.record(r, nil, nil, err)
+		return nil, nil, err
 	}
-	data, err = ioutil.ReadAll(res.Body)
-	if err != nil {
-		return []byte{}, err
+	if c.RateLimiter != nil {
+		c.RateLimiter.Observe(r.rateLimitGroup(), res.StatusCode, res.Header)
 	}
 	defer func() {
 		cerr := res.Body.Close()
@@ -162,19 +257,34 @@ func (c *Client) callAPI(ctx context.Context, r *request, opts ...RequestOption)
 			err = cerr
 		}
 	}()
+	data, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		c.record(r, nil, nil, err)
+		return nil, res, err
+	}
+	c.record(r, res, data, nil)
 	c.debug("response: %#v", res)
 	c.debug("response body: %s", string(data))
 	c.debug("response status code: %d", res.StatusCode)
 
 	if res.StatusCode >= 400 {
-		apiErr := new(APIError)
-		e := json.Unmarshal(data, apiErr)
+		apiErr, e := newAPIError(r, res, data)
 		if e != nil {
 			c.debug("failed to unmarshal json: %s", e)
 		}
-		return nil, apiErr
+		return nil, res, apiErr
+	}
+	return data, res, nil
+}
+
+func (c *Client) record(r *request, res *http.Response, data []byte, err error) {
+	if c.Recorder == nil {
+		return
+	}
+
+	if rerr := c.Recorder.Record(newRecording(r, res, data, err)); rerr != nil {
+		c.debug("failed to record request: %s", rerr)
 	}
-	return data, nil
 }
 
 // Get list of avialable currencies.
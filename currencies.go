@@ -11,8 +11,8 @@ type ProtocolSpecificSettings struct {
 	ProtocolId              int     `json:"protocol_id"`
 	Active                  bool    `json:"active"`
 	WithdrawalFeeCurrencyId int     `json:"withdrawal_fee_currency_id"`
-	WithdrawalFeeConst      float64 `json:"withdrawal_fee_const"`
-	WithdrawalFeePercent    float64 `json:"withdrawal_fee_percent"`
+	WithdrawalFeeConst      Decimal `json:"withdrawal_fee_const"`
+	WithdrawalFeePercent    Decimal `json:"withdrawal_fee_percent"`
 	BlockExplorerUrl        string  `json:"block_explorer_url"`
 }
 
@@ -23,16 +23,16 @@ type CurrencyInfo struct {
 	Active                    bool                       `json:"active"`
 	Delisted                  bool                       `json:"delisted"`
 	Precision                 int                        `json:"precision"`
-	MinimumWithdrawalAmount   string                     `json:"minimum_withdrawal_amount"`
-	MinimumDepositAmount      string                     `json:"minimum_deposit_amount"`
+	MinimumWithdrawalAmount   Decimal                    `json:"minimum_withdrawal_amount"`
+	MinimumDepositAmount      Decimal                    `json:"minimum_deposit_amount"`
 	DepositFeeCurrencyId      int                        `json:"deposit_fee_currency_id"`
 	DepositFeeCurrencyCode    string                     `json:"deposit_fee_currency_code"`
-	DepositFeeConst           string                     `json:"deposit_fee_const"`
-	DepositFeePercent         string                     `json:"deposit_fee_percent"`
+	DepositFeeConst           Decimal                    `json:"deposit_fee_const"`
+	DepositFeePercent         Decimal                    `json:"deposit_fee_percent"`
 	WithdrawalFeeCurrencyId   int                        `json:"withdrawal_fee_currency_id"`
 	WithdrawalFeeCurrencyCode string                     `json:"withdrawal_fee_currency_code"`
-	WithdrawalFeeConst        string                     `json:"withdrawal_fee_const"`
-	WithdrawalFeePercent      string                     `json:"withdrawal_fee_percent"`
+	WithdrawalFeeConst        Decimal                    `json:"withdrawal_fee_const"`
+	WithdrawalFeePercent      Decimal                    `json:"withdrawal_fee_percent"`
 	BlockExplorerUrl          string                     `json:"block_explorer_url"`
 	ProtocolSpecificSettings  []ProtocolSpecificSettings `json:"protocol_specific_settings"`
 }
@@ -0,0 +1,416 @@
+package stex
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal define arbitrary-precision decimal number used for prices, amounts and balances.
+// The zero value is 0. Decimal is immutable, every operation returns a new value.
+type Decimal struct {
+	// value is unscaled * 10^-scale, scale is never negative
+	unscaled *big.Int
+	scale    int32
+}
+
+var bigTen = big.NewInt(10)
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// NewDecimal returns value * 10^-scale
+func NewDecimal(value int64, scale int32) Decimal {
+	if scale < 0 {
+		return Decimal{unscaled: new(big.Int).Mul(big.NewInt(value), pow10(-scale))}
+	}
+	return Decimal{unscaled: big.NewInt(value), scale: scale}
+}
+
+// NewDecimalFromInt returns integer value as Decimal
+func NewDecimalFromInt(value int64) Decimal {
+	return NewDecimal(value, 0)
+}
+
+// NewDecimalFromFloat returns the shortest decimal representation of f
+func NewDecimalFromFloat(f float64) Decimal {
+	d, err := ParseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		return Decimal{}
+	}
+	return d
+}
+
+// maxDecimalExponent bounds the exponent accepted by ParseDecimal,
+// so input like "1e999999999" can't make it allocate a huge number
+const maxDecimalExponent = 1000
+
+// ParseDecimal parses decimal number like "-12.345", "0.00010000" or "1e-8".
+// The exponent must be within ±1000.
+func ParseDecimal(s string) (Decimal, error) {
+	str := strings.TrimSpace(s)
+	if str == "" {
+		return Decimal{}, fmt.Errorf("can't parse empty string as decimal")
+	}
+
+	var exp int64
+	if idx := strings.IndexAny(str, "eE"); idx >= 0 {
+		e, err := strconv.ParseInt(str[idx+1:], 10, 32)
+		if err != nil {
+			return Decimal{}, fmt.Errorf("can't parse %q as decimal: %s", s, err)
+		}
+		if e > maxDecimalExponent || e < -maxDecimalExponent {
+			return Decimal{}, fmt.Errorf("can't parse %q as decimal: exponent out of range", s)
+		}
+		exp = e
+		str = str[:idx]
+	}
+
+	neg := false
+	switch {
+	case strings.HasPrefix(str, "-"):
+		neg = true
+		str = str[1:]
+	case strings.HasPrefix(str, "+"):
+		str = str[1:]
+	}
+
+	intPart, fracPart := str, ""
+	if idx := strings.IndexByte(str, '.'); idx >= 0 {
+		intPart, fracPart = str[:idx], str[idx+1:]
+	}
+
+	digits := intPart + fracPart
+	if digits == "" {
+		return Decimal{}, fmt.Errorf("can't parse %q as decimal", s)
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return Decimal{}, fmt.Errorf("can't parse %q as decimal", s)
+		}
+	}
+
+	unscaled, _ := new(big.Int).SetString(digits, 10)
+	if neg {
+		unscaled.Neg(unscaled)
+	}
+
+	scale := int64(len(fracPart)) - exp
+	if scale < 0 {
+		unscaled.Mul(unscaled, pow10(int32(-scale)))
+		scale = 0
+	}
+
+	return Decimal{unscaled: unscaled, scale: int32(scale)}, nil
+}
+
+// MustParseDecimal is like ParseDecimal but panics if s is not a number
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// int returns unscaled value, it must not be modified
+func (d Decimal) int() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return d.unscaled
+}
+
+// rescale returns unscaled value for a scale not less than the own one
+func (d Decimal) rescale(scale int32) *big.Int {
+	if scale == d.scale {
+		return new(big.Int).Set(d.int())
+	}
+	return new(big.Int).Mul(d.int(), pow10(scale-d.scale))
+}
+
+func maxScale(a, b Decimal) int32 {
+	if a.scale > b.scale {
+		return a.scale
+	}
+	return b.scale
+}
+
+func (d Decimal) Add(o Decimal) Decimal {
+	scale := maxScale(d, o)
+	return Decimal{unscaled: new(big.Int).Add(d.rescale(scale), o.rescale(scale)), scale: scale}
+}
+
+func (d Decimal) Sub(o Decimal) Decimal {
+	scale := maxScale(d, o)
+	return Decimal{unscaled: new(big.Int).Sub(d.rescale(scale), o.rescale(scale)), scale: scale}
+}
+
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{unscaled: new(big.Int).Mul(d.int(), o.int()), scale: d.scale + o.scale}
+}
+
+// Div returns d / o rounded half away from zero to places digits after the point.
+// Panics if o is zero.
+func (d Decimal) Div(o Decimal, places int32) Decimal {
+	if o.IsZero() {
+		panic("stex: decimal division by zero")
+	}
+	if places < 0 {
+		places = 0
+	}
+
+	// d/o = (ud * 10^(so+places)) / (uo * 10^sd) * 10^-places
+	num := new(big.Int).Mul(d.int(), pow10(o.scale+places))
+	den := new(big.Int).Mul(o.int(), pow10(d.scale))
+
+	return Decimal{unscaled: quoRound(num, den), scale: places}
+}
+
+// quoRound returns num/den rounded half away from zero
+func quoRound(num, den *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	r2 := new(big.Int).Abs(r)
+	r2.Lsh(r2, 1)
+	if r2.Cmp(new(big.Int).Abs(den)) >= 0 {
+		if num.Sign()*den.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{unscaled: new(big.Int).Neg(d.int()), scale: d.scale}
+}
+
+func (d Decimal) Abs() Decimal {
+	return Decimal{unscaled: new(big.Int).Abs(d.int()), scale: d.scale}
+}
+
+// Sign returns -1, 0 or +1
+func (d Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+func (d Decimal) IsNegative() bool {
+	return d.Sign() < 0
+}
+
+func (d Decimal) IsPositive() bool {
+	return d.Sign() > 0
+}
+
+// Cmp returns -1 if d < o, 0 if d == o and +1 if d > o
+func (d Decimal) Cmp(o Decimal) int {
+	scale := maxScale(d, o)
+	return d.rescale(scale).Cmp(o.rescale(scale))
+}
+
+// Equal compares values regardless of scale, so 1.50 equals 1.5
+func (d Decimal) Equal(o Decimal) bool {
+	return d.Cmp(o) == 0
+}
+
+func (d Decimal) LessThan(o Decimal) bool {
+	return d.Cmp(o) < 0
+}
+
+func (d Decimal) LessThanOrEqual(o Decimal) bool {
+	return d.Cmp(o) <= 0
+}
+
+func (d Decimal) GreaterThan(o Decimal) bool {
+	return d.Cmp(o) > 0
+}
+
+func (d Decimal) GreaterThanOrEqual(o Decimal) bool {
+	return d.Cmp(o) >= 0
+}
+
+// MinDecimal returns the smallest of given values
+func MinDecimal(first Decimal, rest ...Decimal) Decimal {
+	res := first
+	for _, d := range rest {
+		if d.LessThan(res) {
+			res = d
+		}
+	}
+	return res
+}
+
+// MaxDecimal returns the largest of given values
+func MaxDecimal(first Decimal, rest ...Decimal) Decimal {
+	res := first
+	for _, d := range rest {
+		if d.GreaterThan(res) {
+			res = d
+		}
+	}
+	return res
+}
+
+type roundMode int
+
+const (
+	roundHalfUp roundMode = iota
+	roundDown
+	roundFloor
+	roundCeil
+)
+
+func (d Decimal) round(places int32, mode roundMode) Decimal {
+	if places < 0 {
+		places = 0
+	}
+	if places >= d.scale {
+		return d
+	}
+
+	factor := pow10(d.scale - places)
+	u := d.int()
+	q, r := new(big.Int).QuoRem(u, factor, new(big.Int))
+
+	if r.Sign() != 0 {
+		switch mode {
+		case roundHalfUp:
+			r.Abs(r).Lsh(r, 1)
+			if r.Cmp(factor) >= 0 {
+				q.Add(q, big.NewInt(int64(u.Sign())))
+			}
+		case roundFloor:
+			if u.Sign() < 0 {
+				q.Sub(q, big.NewInt(1))
+			}
+		case roundCeil:
+			if u.Sign() > 0 {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+	}
+
+	return Decimal{unscaled: q, scale: places}
+}
+
+// Round rounds half away from zero to places digits after the point
+func (d Decimal) Round(places int32) Decimal {
+	return d.round(places, roundHalfUp)
+}
+
+// Truncate drops digits after places towards zero
+func (d Decimal) Truncate(places int32) Decimal {
+	return d.round(places, roundDown)
+}
+
+// Floor rounds towards negative infinity to places digits after the point
+func (d Decimal) Floor(places int32) Decimal {
+	return d.round(places, roundFloor)
+}
+
+// Ceil rounds towards positive infinity to places digits after the point
+func (d Decimal) Ceil(places int32) Decimal {
+	return d.round(places, roundCeil)
+}
+
+// Scale returns number of digits after the point
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+// Normalize drops trailing zeros after the point, so equal values have equal String()
+func (d Decimal) Normalize() Decimal {
+	u := new(big.Int).Set(d.int())
+	scale := d.scale
+	r := new(big.Int)
+	for scale > 0 {
+		q, m := new(big.Int).QuoRem(u, bigTen, r)
+		if m.Sign() != 0 {
+			break
+		}
+		u = q
+		scale--
+	}
+	return Decimal{unscaled: u, scale: scale}
+}
+
+// String returns the number without exponent keeping all digits after the point
+func (d Decimal) String() string {
+	u := d.int()
+	digits := new(big.Int).Abs(u).String()
+
+	if d.scale > 0 {
+		if pad := int(d.scale) + 1 - len(digits); pad > 0 {
+			digits = strings.Repeat("0", pad) + digits
+		}
+		point := len(digits) - int(d.scale)
+		digits = digits[:point] + "." + digits[point:]
+	}
+
+	if u.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// StringFixed returns the number rounded to exactly places digits after the point
+func (d Decimal) StringFixed(places int32) string {
+	r := d.Round(places)
+	if places > r.scale {
+		r = Decimal{unscaled: r.rescale(places), scale: places}
+	}
+	return r.String()
+}
+
+// Float64 returns the nearest float64 value
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// MarshalJSON encodes decimal as a quoted string so no precision is lost
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+// UnmarshalJSON accepts numbers, quoted numbers, empty strings and null
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*d = Decimal{}
+		return nil
+	}
+
+	str := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		s, err := strconv.Unquote(str)
+		if err != nil {
+			return fmt.Errorf("can't unmarshal %s as decimal: %s", str, err)
+		}
+		str = s
+		if strings.TrimSpace(str) == "" {
+			*d = Decimal{}
+			return nil
+		}
+	}
+
+	v, err := ParseDecimal(str)
+	if err != nil {
+		return err
+	}
+
+	*d = v
+	return nil
+}
@@ -0,0 +1,146 @@
+package stex
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "0", want: "0"},
+		{in: "-12.345", want: "-12.345"},
+		{in: "+7", want: "7"},
+		{in: "0.00010000", want: "0.00010000"},
+		{in: " 1.5 ", want: "1.5"},
+		{in: ".5", want: "0.5"},
+		{in: "5.", want: "5"},
+		{in: "1e-8", want: "0.00000001"},
+		{in: "1.5E3", want: "1500"},
+		{in: "-2.5e-2", want: "-0.025"},
+		{in: "1e1000", want: "1" + zeros(1000)},
+		{in: "1e-1000", want: "0." + zeros(999) + "1"},
+		{in: "1e1001", wantErr: true},
+		{in: "1e-1001", wantErr: true},
+		{in: "1e999999999", wantErr: true},
+		{in: "1e99999999999", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: ".", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+		{in: "1e", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "0x10", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			d, err := ParseDecimal(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseDecimal(%q) = %s, want error", tt.in, d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDecimal(%q): %s", tt.in, err)
+			}
+			if got := d.String(); got != tt.want {
+				t.Errorf("ParseDecimal(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func zeros(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = '0'
+	}
+	return string(b)
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	d := MustParseDecimal
+
+	tests := []struct {
+		name string
+		got  Decimal
+		want string
+	}{
+		{name: "add", got: d("0.1").Add(d("0.2")), want: "0.3"},
+		{name: "sub", got: d("1").Sub(d("0.001")), want: "0.999"},
+		{name: "mul", got: d("1.5").Mul(d("-0.02")), want: "-0.030"},
+		{name: "div", got: d("1").Div(d("3"), 8), want: "0.33333333"},
+		{name: "div half up", got: d("2").Div(d("3"), 2), want: "0.67"},
+		{name: "div negative", got: d("-2").Div(d("3"), 2), want: "-0.67"},
+		{name: "round", got: d("1.005").Round(2), want: "1.01"},
+		{name: "round negative", got: d("-1.005").Round(2), want: "-1.01"},
+		{name: "truncate", got: d("-1.999").Truncate(2), want: "-1.99"},
+		{name: "floor", got: d("-1.001").Floor(2), want: "-1.01"},
+		{name: "ceil", got: d("1.001").Ceil(2), want: "1.01"},
+		{name: "normalize", got: d("1.5000").Normalize(), want: "1.5"},
+		{name: "zero value", got: Decimal{}.Add(d("2")), want: "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if s := tt.got.String(); s != tt.want {
+				t.Errorf("got %s, want %s", s, tt.want)
+			}
+		})
+	}
+
+	if !d("1.50").Equal(d("1.5")) {
+		t.Error("1.50 is not equal to 1.5")
+	}
+	if s := d("1.5").StringFixed(4); s != "1.5000" {
+		t.Errorf("StringFixed(4) = %s", s)
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: `"0.00000100"`, want: "0.00000100"},
+		{in: `12.5`, want: "12.5"},
+		{in: `1e-3`, want: "0.001"},
+		{in: `""`, want: "0"},
+		{in: `null`, want: "0"},
+		{in: `"1e5000"`, wantErr: true},
+		{in: `"n/a"`, wantErr: true},
+		{in: `true`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var v struct {
+				D Decimal `json:"d"`
+			}
+			err := json.Unmarshal([]byte(`{"d":`+tt.in+`}`), &v)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("unmarshal %s = %s, want error", tt.in, v.D)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := v.D.String(); got != tt.want {
+				t.Errorf("unmarshal %s = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+
+	data, _ := json.Marshal(MustParseDecimal("0.10"))
+	if string(data) != `"0.10"` {
+		t.Errorf("marshal = %s", data)
+	}
+}
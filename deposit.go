@@ -19,14 +19,14 @@ type DepositAdv struct {
 	CurrencyCode           string  `json:"currency_code"`
 	DepositFeeCurrencyId   int     `json:"deposit_fee_currency_id"`
 	DepositFeeCurrencyCode string  `json:"deposit_fee_currency_code"`
-	Amount                 float64 `json:"amount"`
-	Fee                    float64 `json:"fee"`
+	Amount                 Decimal `json:"amount"`
+	Fee                    Decimal `json:"fee"`
 	Txid                   string  `json:"txid"`
 	DepositStatusId        int     `json:"deposit_status_id"`
 	Status                 string  `json:"status"`
 	StatusColor            string  `json:"status_color"`
-	CreatedAt              string  `json:"created_at"`
-	Timestamp              int64   `json:"timestamp"`
+	CreatedAt              Time    `json:"created_at"`
+	Timestamp              Time    `json:"timestamp"`
 	Confirmations          string  `json:"confirmations"`
 }
 
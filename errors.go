@@ -1,22 +1,133 @@
 package stex
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
 )
 
+// Error categories of APIError, check them with errors.Is
+var (
+	ErrUnauthorized        = errors.New("stex: unauthorized")
+	ErrForbidden           = errors.New("stex: forbidden")
+	ErrNotFound            = errors.New("stex: not found")
+	ErrRateLimited         = errors.New("stex: rate limited")
+	ErrInsufficientBalance = errors.New("stex: insufficient balance")
+	ErrInvalidPrice        = errors.New("stex: invalid price")
+	ErrInvalidAmount       = errors.New("stex: invalid amount")
+	ErrMaintenance         = errors.New("stex: maintenance")
+	ErrServerError         = errors.New("stex: server error")
+)
+
+// Max length of non-JSON body used as error message
+const apiErrorMessageLimit = 256
+
 // APIError define API error when response status is 4xx or 5xx
 type APIError struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
+
+	StatusCode int         `json:"-"`
+	Method     string      `json:"-"`
+	Endpoint   string      `json:"-"`
+	Header     http.Header `json:"-"`
+	Body       []byte      `json:"-"`
+}
+
+// newAPIError builds error from response of request r. Bodies that are not JSON
+// (proxy or maintenance pages) become the message as is, the unmarshal error is returned separately.
+func newAPIError(r *request, res *http.Response, data []byte) (*APIError, error) {
+	e := new(APIError)
+	err := json.Unmarshal(data, e)
+
+	e.Method = r.method
+	e.Endpoint = r.endpoint
+	e.Body = data
+	if res != nil {
+		e.StatusCode = res.StatusCode
+		e.Header = res.Header
+	}
+
+	if err != nil || e.Message == "" {
+		e.Message = bodyMessage(data)
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(e.StatusCode)
+	}
+
+	return e, err
+}
+
+func bodyMessage(data []byte) string {
+	msg := strings.Join(strings.Fields(string(data)), " ")
+	if len(msg) > apiErrorMessageLimit {
+		msg = msg[:apiErrorMessageLimit]
+		for !utf8.ValidString(msg) {
+			msg = msg[:len(msg)-1]
+		}
+		msg += "..."
+	}
+	return msg
 }
 
 // Error return error code and message
 func (e APIError) Error() string {
-	return fmt.Sprintf("<APIError> success=%t, msg=%s", e.Success, e.Message)
+	return fmt.Sprintf("<APIError> status=%d, endpoint=%s %s, success=%t, msg=%s", e.StatusCode, e.Method, e.Endpoint, e.Success, e.Message)
+}
+
+// Category returns one of the Err* sentinels the error belongs to or nil if it is not known.
+// Known STEX messages take precedence over the HTTP status.
+func (e APIError) Category() error {
+	msg := strings.ToLower(e.Message)
+
+	switch {
+	case strings.Contains(msg, "insufficient") || strings.Contains(msg, "not enough"):
+		return ErrInsufficientBalance
+	case strings.Contains(msg, "maintenance") || strings.Contains(msg, "technical work"):
+		return ErrMaintenance
+	case strings.Contains(msg, "unauthenticated"):
+		return ErrUnauthorized
+	case strings.Contains(msg, "too many"):
+		return ErrRateLimited
+	}
+
+	if e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity {
+		switch {
+		case strings.Contains(msg, "price"):
+			return ErrInvalidPrice
+		case strings.Contains(msg, "amount"):
+			return ErrInvalidAmount
+		}
+	}
+
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusForbidden:
+		return ErrForbidden
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode == http.StatusServiceUnavailable:
+		return ErrMaintenance
+	case e.StatusCode >= 500:
+		return ErrServerError
+	}
+
+	return nil
+}
+
+// Is reports if the error belongs to the target category
+func (e APIError) Is(target error) bool {
+	return target != nil && e.Category() == target
 }
 
 // IsAPIError check if e is an API error
 func IsAPIError(e error) bool {
-	_, ok := e.(*APIError)
-	return ok
+	var apiErr *APIError
+	return errors.As(e, &apiErr)
 }
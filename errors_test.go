@@ -0,0 +1,89 @@
+package stex_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	stex "github.com/vladivolo/stex-api"
+	"github.com/vladivolo/stex-api/stextest"
+)
+
+func TestAPIErrorCategory(t *testing.T) {
+	categories := []error{
+		stex.ErrUnauthorized, stex.ErrForbidden, stex.ErrNotFound, stex.ErrRateLimited, stex.ErrInsufficientBalance,
+		stex.ErrInvalidPrice, stex.ErrInvalidAmount, stex.ErrMaintenance, stex.ErrServerError,
+	}
+
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    error
+		message string
+	}{
+		{name: "unauthorized", status: 401, want: stex.ErrUnauthorized},
+		{name: "unauthenticated message", status: 400, body: `{"success":false,"message":"Unauthenticated."}`, want: stex.ErrUnauthorized},
+		{name: "forbidden", status: 403, want: stex.ErrForbidden},
+		{name: "not found", status: 404, want: stex.ErrNotFound},
+		{name: "rate limited", status: 429, want: stex.ErrRateLimited},
+		{name: "too many attempts", status: 400, body: `{"success":false,"message":"Too Many Attempts."}`, want: stex.ErrRateLimited},
+		{name: "insufficient balance", status: 400, body: `{"success":false,"message":"Insufficient funds"}`, want: stex.ErrInsufficientBalance},
+		{name: "not enough", status: 422, body: `{"success":false,"message":"Not enough balance"}`, want: stex.ErrInsufficientBalance},
+		{name: "invalid price", status: 422, body: `{"success":false,"message":"The price must be at least 0.00000001."}`, want: stex.ErrInvalidPrice},
+		{name: "invalid amount", status: 400, body: `{"success":false,"message":"The amount is too small"}`, want: stex.ErrInvalidAmount},
+		{name: "price message of other status", status: 409, body: `{"success":false,"message":"price changed"}`},
+		{name: "maintenance status", status: 503, want: stex.ErrMaintenance},
+		{name: "maintenance message", status: 500, body: `{"success":false,"message":"Technical works are in progress"}`, want: stex.ErrMaintenance},
+		{name: "server error", status: 500, want: stex.ErrServerError},
+		{
+			name:    "html body",
+			status:  502,
+			body:    "<html>\n<head><title>502 Bad Gateway</title></head>\n<body>nginx</body>\n</html>",
+			want:    stex.ErrServerError,
+			message: "<html> <head><title>502 Bad Gateway</title></head> <body>nginx</body> </html>",
+		},
+		{name: "maintenance page", status: 502, body: "Site is under maintenance", want: stex.ErrMaintenance, message: "Site is under maintenance"},
+		{name: "long plain body", status: 500, body: strings.Repeat("x", 300), want: stex.ErrServerError, message: strings.Repeat("x", 256) + "..."},
+		{name: "empty body", status: 500, body: " ", want: stex.ErrServerError, message: "Internal Server Error"},
+		{name: "unknown", status: 418},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := stextest.NewServer()
+			defer srv.Close()
+
+			c := srv.Client("")
+			c.RetryPolicy = fastRetryPolicy(1)
+			srv.InjectFault(stextest.Fault{Path: "/public/ping", Status: tt.status, Body: tt.body})
+
+			_, err := c.NewPingService().Do(context.Background())
+			if !stex.IsAPIError(err) {
+				t.Fatalf("error %v is not APIError", err)
+			}
+			var apiErr *stex.APIError
+			errors.As(err, &apiErr)
+			if apiErr.StatusCode != tt.status || apiErr.Method != "GET" || apiErr.Endpoint != "/public/ping" {
+				t.Errorf("error = %+v", apiErr)
+			}
+			if tt.message != "" && apiErr.Message != tt.message {
+				t.Errorf("message = %q, want %q", apiErr.Message, tt.message)
+			}
+
+			if apiErr.Category() != tt.want {
+				t.Errorf("Category() = %v, want %v", apiErr.Category(), tt.want)
+			}
+			for _, category := range categories {
+				if got := errors.Is(err, category); got != (category == tt.want) {
+					t.Errorf("errors.Is(err, %v) = %t", category, got)
+				}
+			}
+		})
+	}
+
+	if stex.IsAPIError(errors.New("stex: other")) {
+		t.Error("IsAPIError of a plain error")
+	}
+}
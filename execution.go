@@ -0,0 +1,757 @@
+package stex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type ExecutionAlgo string
+
+const (
+	// ExecutionTWAP spreads the amount evenly over the slices
+	ExecutionTWAP ExecutionAlgo = "twap"
+	// ExecutionVWAP spreads the amount after the volume profile of the previous days
+	ExecutionVWAP ExecutionAlgo = "vwap"
+)
+
+type ExecutionStatus string
+
+const (
+	ExecutionPending   ExecutionStatus = "pending"
+	ExecutionRunning   ExecutionStatus = "running"
+	ExecutionPaused    ExecutionStatus = "paused"
+	ExecutionDone      ExecutionStatus = "done"
+	ExecutionCancelled ExecutionStatus = "cancelled"
+)
+
+// Sizes of candle types a volume profile can be built from
+var profileCandleSizes = map[CandleType]time.Duration{
+	CandleType1m:  time.Minute,
+	CandleType5m:  5 * time.Minute,
+	CandleType30m: 30 * time.Minute,
+	CandleType1h:  time.Hour,
+	CandleType4h:  4 * time.Hour,
+}
+
+// ExecutionRequest define parent order split into child limit orders by Executor
+type ExecutionRequest struct {
+	CurrencyPairId int
+	Algo           ExecutionAlgo
+	Side           TradeType
+	Amount         Decimal
+	// Duration of the execution, pauses extend it
+	Duration time.Duration
+	// Slices is the number of child orders, by default one a minute but no more than children of MinOrderAmount
+	Slices int
+	// LimitPrice is the worst price of the children, zero means no limit
+	LimitPrice Decimal
+	// MaxSlippageBps limits child prices to that many basis points worse than the best price, zero means no limit
+	MaxSlippageBps Decimal
+}
+
+// ExecutionChild define child order placed for a slice
+type ExecutionChild struct {
+	Slice        int
+	OrderId      int64
+	Amount       Decimal
+	Price        Decimal
+	Filled       Decimal
+	AveragePrice Decimal
+	Fees         []Fee
+	Status       OrderStatus
+	Placed       time.Time
+}
+
+// Execution define state of an execution
+type Execution struct {
+	ExecutionRequest
+	Status ExecutionStatus
+
+	// Targets are the amounts to be filled by the end of each slice
+	Targets []Decimal
+	// Slice is the current slice
+	Slice    int
+	Filled   Decimal
+	Children []ExecutionChild
+
+	// ArrivalPrice is the mid price of the book when the execution started
+	ArrivalPrice Decimal
+	Start        time.Time
+	// End is the planned end, it moves with pauses
+	End     time.Time
+	Updated time.Time
+	// Error is the last error of placing or cancelling children
+	Error string
+}
+
+// Done reports if the execution is finished
+func (e *Execution) Done() bool {
+	return e.Status == ExecutionDone || e.Status == ExecutionCancelled
+}
+
+// live returns index of the child in the book or -1
+func (e *Execution) live() int {
+	for i := range e.Children {
+		if !orderStatusDone(e.Children[i].Status) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *Execution) copy() Execution {
+	res := *e
+	res.Targets = append([]Decimal{}, e.Targets...)
+	res.Children = append([]ExecutionChild{}, e.Children...)
+	return res
+}
+
+// ExecutionReport define result of an execution
+type ExecutionReport struct {
+	Algo   ExecutionAlgo
+	Side   TradeType
+	Amount Decimal
+	Filled Decimal
+	// AveragePrice is the volume weighted price of all fills
+	AveragePrice Decimal
+	Fees         []Fee
+	Children     int
+
+	ArrivalPrice Decimal
+	// BenchmarkPrice is the volume weighted price of all trades of the pair during the execution
+	BenchmarkPrice Decimal
+	// Adverse differences of AveragePrice from ArrivalPrice and BenchmarkPrice in basis points
+	ArrivalSlippageBps   Decimal
+	BenchmarkSlippageBps Decimal
+
+	Start time.Time
+	End   time.Time
+}
+
+// Executor executes a large order as child limit orders spread over time, see ExecutionTWAP and ExecutionVWAP.
+// Every slice gets a child for the amount its target is missing, priced to take that amount from the
+// book within LimitPrice and MaxSlippageBps. The child is cancelled when the slice ends and the rest
+// goes to the next slice.
+type Executor struct {
+	c       *Client
+	w       *WssClient
+	tracker *OrderTracker
+	source  PairInfoSource
+	book    OrderBookView
+
+	profile_days int
+	profile_type CandleType
+	f            func(Execution)
+
+	// run serializes changes of the execution and the requests made for it
+	run sync.Mutex
+
+	mu    sync.Mutex
+	state Execution
+
+	pair       CurrencyPair
+	placed     int
+	cancelling bool
+	paused_at  time.Time
+
+	kick chan struct{}
+	done chan struct{}
+}
+
+// NewExecutor returns executor of req on the account of c. w must be connected, when it is nil
+// children are followed with REST only.
+func NewExecutor(c *Client, w *WssClient, req ExecutionRequest) *Executor {
+	e := &Executor{
+		c:            c,
+		w:            w,
+		source:       clientPairSource{c: c},
+		profile_days: 7,
+		profile_type: CandleType30m,
+		state:        Execution{ExecutionRequest: req, Status: ExecutionPending},
+		placed:       -1,
+		kick:         make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+	e.tracker = NewOrderTracker(c, w).CurrencyPairIds(req.CurrencyPairId).OnUpdate(func(TrackedOrder) { e.checkSoon() })
+	return e
+}
+
+// UserId sets user id, by default it is taken from ProfileInfoService
+func (e *Executor) UserId(user_id int64) *Executor {
+	e.tracker.UserId(user_id)
+	return e
+}
+
+// ReconcileInterval sets period of REST checks of the children, default is 30s
+func (e *Executor) ReconcileInterval(interval time.Duration) *Executor {
+	e.tracker.ReconcileInterval(interval)
+	return e
+}
+
+// Source sets where pair rules are loaded from, default is CurrencyPairInfoService
+func (e *Executor) Source(source PairInfoSource) *Executor {
+	e.source = source
+	return e
+}
+
+// OrderBook sets book children are priced from, e.g. LiveOrderBook. By default a snapshot
+// is loaded with CurrencyPairOrderbookService for every child.
+func (e *Executor) OrderBook(book OrderBookView) *Executor {
+	e.book = book
+	return e
+}
+
+// Profile sets days and candle size of the VWAP volume profile, default is 7 days of 30 minute candles
+func (e *Executor) Profile(days int, candle_type CandleType) *Executor {
+	e.profile_days = days
+	e.profile_type = candle_type
+	return e
+}
+
+// OnUpdate sets callback called after every change of the execution.
+// It runs while the execution is processed and must not call Pause, Resume or Cancel.
+func (e *Executor) OnUpdate(f func(Execution)) *Executor {
+	e.f = f
+	return e
+}
+
+// Do builds the schedule and starts the execution, it goes on until it is done or ctx is cancelled
+func (e *Executor) Do(ctx context.Context) error {
+	e.run.Lock()
+	defer e.run.Unlock()
+
+	ex := e.State()
+	if ex.Status != ExecutionPending {
+		return fmt.Errorf("execution already started")
+	}
+	if ex.Algo != ExecutionTWAP && ex.Algo != ExecutionVWAP {
+		return fmt.Errorf("unknown execution algo %q", ex.Algo)
+	}
+	if ex.Side != TradeType_BUY && ex.Side != TradeType_SELL {
+		return fmt.Errorf("unknown trade type %q", ex.Side)
+	}
+	if ex.Duration <= 0 {
+		return fmt.Errorf("duration must be positive")
+	}
+
+	pair, err := e.source.PairInfo(ctx, ex.CurrencyPairId)
+	if err != nil {
+		return err
+	}
+	e.pair = *pair
+
+	if !ex.Amount.IsPositive() || ex.Amount.LessThan(pair.MinOrderAmount) {
+		return fmt.Errorf("amount must be at least %s", pair.MinOrderAmount)
+	}
+
+	slices := ex.Slices
+	if slices <= 0 {
+		slices = int(ex.Duration / time.Minute)
+		if pair.MinOrderAmount.IsPositive() {
+			if n := int(ex.Amount.Div(pair.MinOrderAmount, analyticsPlaces).Floor(0).Float64()); slices > n {
+				slices = n
+			}
+		}
+		if slices < 1 {
+			slices = 1
+		}
+	}
+
+	start := time.Now()
+	weights := make([]Decimal, slices)
+	if ex.Algo == ExecutionVWAP {
+		weights, err = e.profile(ctx, start, ex.Duration, slices)
+		if err != nil {
+			return err
+		}
+	}
+	ex.Targets = targets(ex.Amount, weights)
+
+	book, err := e.orderBook(ctx)
+	if err == nil {
+		ex.ArrivalPrice, err = NewOrderBookAnalytics(book).Precision(e.pair).MidPrice()
+	}
+	if err != nil {
+		ticker, terr := e.c.NewCurrencyPairTickerService().CurrencyPairId(ex.CurrencyPairId).Do(ctx)
+		if terr != nil {
+			return err
+		}
+		ex.ArrivalPrice = ticker.Last
+	}
+
+	if e.w != nil {
+		if err := e.tracker.Do(ctx); err != nil {
+			return err
+		}
+	}
+
+	ex.Status = ExecutionRunning
+	ex.Start = start
+	ex.End = start.Add(ex.Duration)
+	e.put(ex)
+	e.checkSoon()
+
+	interval := ex.Duration / time.Duration(slices)
+	tick := interval / 4
+	if tick > time.Second {
+		tick = time.Second
+	}
+	if e.w == nil && tick > e.tracker.interval {
+		tick = e.tracker.interval
+	}
+
+	go func() {
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+
+		polled := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-e.kick:
+			case <-ticker.C:
+				if e.w == nil && time.Since(polled) >= e.tracker.interval {
+					polled = time.Now()
+					if err := e.tracker.Reconcile(ctx); err != nil {
+						e.c.debug("execution reconcile: %s", err)
+					}
+				}
+			}
+
+			if e.check(ctx) {
+				close(e.done)
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// targets returns cumulative amounts by slice, zero weights everywhere spread amount evenly
+func targets(amount Decimal, weights []Decimal) []Decimal {
+	total := Decimal{}
+	for _, w := range weights {
+		total = total.Add(w)
+	}
+	if !total.IsPositive() {
+		for i := range weights {
+			weights[i] = NewDecimalFromInt(1)
+		}
+		total = NewDecimalFromInt(int64(len(weights)))
+	}
+
+	res := make([]Decimal, len(weights))
+	cum := Decimal{}
+	for i, w := range weights {
+		cum = cum.Add(w)
+		res[i] = amount.Mul(cum).Div(total, analyticsPlaces).Normalize()
+	}
+	res[len(res)-1] = amount
+	return res
+}
+
+// profile returns volume weights of the slices from the average volume of the same time of day in the previous days
+func (e *Executor) profile(ctx context.Context, start time.Time, duration time.Duration, slices int) ([]Decimal, error) {
+	size, ok := profileCandleSizes[e.profile_type]
+	if !ok {
+		return nil, fmt.Errorf("candle type %q can not make a volume profile", e.profile_type)
+	}
+	if e.profile_days <= 0 {
+		return nil, fmt.Errorf("profile days must be positive")
+	}
+
+	candles, err := e.c.NewCurrencyPairChartService().CurrencyPairId(e.state.CurrencyPairId).CandleType(e.profile_type).
+		TmStart(start.Add(-time.Duration(e.profile_days) * 24 * time.Hour)).TmEnd(start).Pager().All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// volume by the start of the candle within the day
+	volume := map[time.Duration]Decimal{}
+	for _, c := range candles {
+		key := c.Time.Sub(c.Time.Truncate(24 * time.Hour)).Truncate(size)
+		volume[key] = volume[key].Add(c.Volume)
+	}
+
+	res := make([]Decimal, slices)
+	interval := duration / time.Duration(slices)
+	for i := range res {
+		from := start.Add(interval * time.Duration(i))
+		till := from.Add(interval)
+		for tm := from; tm.Before(till); {
+			day := tm.Sub(tm.Truncate(24 * time.Hour))
+			key := day.Truncate(size)
+			next := tm.Add(key + size - day)
+			if next.After(till) {
+				next = till
+			}
+			part := NewDecimalFromInt(int64(next.Sub(tm))).Div(NewDecimalFromInt(int64(size)), analyticsPlaces)
+			res[i] = res[i].Add(volume[key].Mul(part))
+			tm = next
+		}
+	}
+	return res, nil
+}
+
+// orderBook returns book children are priced from
+func (e *Executor) orderBook(ctx context.Context) (OrderBookView, error) {
+	if e.book != nil {
+		return e.book, nil
+	}
+	return e.c.NewCurrencyPairOrderbookService().CurrencyPairId(e.state.CurrencyPairId).Do(ctx)
+}
+
+// State returns state of the execution
+func (e *Executor) State() Execution {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.state.copy()
+}
+
+// Wait waits until the execution is finished and all its children left the book
+func (e *Executor) Wait(ctx context.Context) (Execution, error) {
+	select {
+	case <-ctx.Done():
+		return e.State(), ctx.Err()
+	case <-e.done:
+		return e.State(), nil
+	}
+}
+
+// Pause cancels the child in the book and stops placing children until Resume
+func (e *Executor) Pause(ctx context.Context) error {
+	e.run.Lock()
+	defer e.run.Unlock()
+
+	ex := e.State()
+	if ex.Status != ExecutionRunning {
+		return fmt.Errorf("execution is %s", ex.Status)
+	}
+
+	ex.Status = ExecutionPaused
+	e.paused_at = time.Now()
+	err := e.cancelChild(ctx, &ex)
+	e.put(ex)
+	return err
+}
+
+// Resume continues paused execution from the current slice, its end is moved by the time it was paused
+func (e *Executor) Resume() error {
+	e.run.Lock()
+	defer e.run.Unlock()
+
+	ex := e.State()
+	if ex.Status != ExecutionPaused {
+		return fmt.Errorf("execution is %s", ex.Status)
+	}
+
+	paused := time.Since(e.paused_at)
+	ex.Status = ExecutionRunning
+	ex.Start = ex.Start.Add(paused)
+	ex.End = ex.End.Add(paused)
+	// The child cancelled by Pause is placed again
+	e.placed = ex.Slice - 1
+	e.put(ex)
+	e.checkSoon()
+	return nil
+}
+
+// Cancel stops the execution and cancels the child in the book
+func (e *Executor) Cancel(ctx context.Context) error {
+	e.run.Lock()
+	defer e.run.Unlock()
+
+	ex := e.State()
+	if ex.Status == ExecutionPending {
+		return fmt.Errorf("execution not started")
+	}
+	if ex.Done() {
+		return nil
+	}
+
+	ex.Status = ExecutionCancelled
+	err := e.cancelChild(ctx, &ex)
+	e.put(ex)
+	e.checkSoon()
+	return err
+}
+
+func (e *Executor) checkSoon() {
+	select {
+	case e.kick <- struct{}{}:
+	default:
+	}
+}
+
+// put stores ex and reports the change
+func (e *Executor) put(ex Execution) {
+	ex.Updated = time.Now()
+
+	e.mu.Lock()
+	e.state = ex.copy()
+	e.mu.Unlock()
+
+	if e.f != nil {
+		e.f(ex)
+	}
+}
+
+// cancelChild cancels the child in the book, the execution goes on when the tracker reports it gone
+func (e *Executor) cancelChild(ctx context.Context, ex *Execution) error {
+	i := ex.live()
+	if i < 0 || e.cancelling {
+		return nil
+	}
+
+	_, err := e.c.NewOrderDeleteService().OrderId(ex.Children[i].OrderId).Do(ctx)
+	if err != nil {
+		ex.Error = err.Error()
+		return err
+	}
+	e.cancelling = true
+	e.tracker.reconcileSoon()
+	return nil
+}
+
+// sync updates children from the tracker, it reports if anything changed.
+// Fills of a child may arrive after it left the book, so all children are updated.
+func (e *Executor) sync(ex *Execution) bool {
+	changed := false
+	filled := Decimal{}
+	for i := range ex.Children {
+		ch := &ex.Children[i]
+		if o, ok := e.tracker.Order(ch.OrderId); ok {
+			done := orderStatusDone(ch.Status)
+			amount, price := o.filled()
+			if o.Status != ch.Status || !amount.Equal(ch.Filled) || !price.Equal(ch.AveragePrice) {
+				changed = true
+			}
+			ch.Status = o.Status
+			ch.Filled = amount
+			ch.AveragePrice = price
+			ch.Fees = o.Fees
+			if !done && o.Done() {
+				e.cancelling = false
+			}
+		}
+		filled = filled.Add(ch.Filled)
+	}
+	ex.Filled = filled
+	return changed
+}
+
+// check moves the execution on, it reports if the execution is finished with no child in the book
+func (e *Executor) check(ctx context.Context) bool {
+	e.run.Lock()
+	defer e.run.Unlock()
+
+	ex := e.State()
+	changed := e.sync(&ex)
+	live := ex.live()
+
+	switch {
+	case ex.Done() || ex.Status == ExecutionPaused:
+		if changed {
+			e.put(ex)
+		}
+		return ex.Done() && live < 0
+	case !ex.Filled.LessThan(ex.Amount) && live < 0:
+		ex.Status = ExecutionDone
+		e.put(ex)
+		return true
+	}
+
+	now := time.Now()
+	end := !now.Before(ex.End)
+	slice := int(now.Sub(ex.Start) / (ex.Duration / time.Duration(len(ex.Targets))))
+	if slice >= len(ex.Targets) {
+		slice = len(ex.Targets) - 1
+	}
+	if slice != ex.Slice {
+		ex.Slice = slice
+		changed = true
+	}
+
+	switch {
+	case live >= 0:
+		if end || ex.Children[live].Slice < slice {
+			if err := e.cancelChild(ctx, &ex); err != nil {
+				e.c.debug("execution cancel child: %s", err)
+				changed = true
+			}
+		}
+	case end:
+		ex.Status = ExecutionDone
+		e.put(ex)
+		return true
+	case e.placed < slice:
+		if err := e.place(ctx, &ex, slice); err != nil {
+			e.c.debug("execution place child: %s", err)
+		}
+		changed = true
+	}
+
+	if changed {
+		e.put(ex)
+	}
+	return false
+}
+
+// place places child of slice for the amount its target is missing
+func (e *Executor) place(ctx context.Context, ex *Execution, slice int) error {
+	min := e.pair.MinOrderAmount
+	left := ex.Amount.Sub(ex.Filled)
+	amount := ex.Targets[slice].Sub(ex.Filled)
+
+	// No dust below the minimum is left for later
+	if rest := left.Sub(amount); rest.IsPositive() && rest.LessThan(min) {
+		amount = left
+	}
+	if amount.LessThan(min) {
+		if slice < len(ex.Targets)-1 || left.LessThan(min) {
+			e.placed = slice
+			return nil
+		}
+		amount = min
+	}
+
+	book, err := e.orderBook(ctx)
+	if err != nil {
+		ex.Error = err.Error()
+		return err
+	}
+	price, err := e.price(ex, book, amount)
+	if err != nil {
+		ex.Error = err.Error()
+		return err
+	}
+
+	order_type := OrderType_BUY
+	if ex.Side == TradeType_SELL {
+		order_type = OrderType_SELL
+	}
+	order, err := (&OrderValidator{round: true}).check(&e.pair, OrderRequest{
+		CurrencyPairId: ex.CurrencyPairId,
+		Type:           order_type,
+		Amount:         amount,
+		Price:          price,
+	})
+	if err != nil {
+		// The amount is below the minimum after rounding to the pair step
+		if errors.Is(err, ErrInvalidAmount) {
+			e.placed = slice
+		}
+		ex.Error = err.Error()
+		return err
+	}
+
+	info, err := e.c.NewCreateOrderService().CurrencyPairId(ex.CurrencyPairId).OrderType(order.Type).
+		Amount(order.Amount).Price(order.Price).Do(ctx)
+	if err != nil {
+		ex.Error = err.Error()
+		return err
+	}
+
+	e.placed = slice
+	e.tracker.Track(*info)
+	ex.Children = append(ex.Children, ExecutionChild{
+		Slice:   slice,
+		OrderId: info.Id,
+		Amount:  order.Amount,
+		Price:   order.Price,
+		Status:  info.Status,
+		Placed:  time.Now(),
+	})
+	return nil
+}
+
+// price returns limit price taking amount from book within LimitPrice and MaxSlippageBps
+func (e *Executor) price(ex *Execution, book OrderBookView, amount Decimal) (Decimal, error) {
+	buy := ex.Side == TradeType_BUY
+
+	fill, err := NewOrderBookAnalytics(book).Precision(e.pair).FillAmount(ex.Side, amount)
+	if err == ErrEmptyBook && ex.LimitPrice.IsPositive() {
+		return ex.LimitPrice, nil
+	}
+	if err != nil {
+		return Decimal{}, err
+	}
+
+	price := fill.WorstPrice
+	if ex.MaxSlippageBps.IsPositive() {
+		move := fill.BestPrice.Mul(ex.MaxSlippageBps).Div(NewDecimalFromInt(10000), analyticsPlaces)
+		if buy {
+			price = MinDecimal(price, fill.BestPrice.Add(move))
+		} else {
+			price = MaxDecimal(price, fill.BestPrice.Sub(move))
+		}
+	}
+	if ex.LimitPrice.IsPositive() {
+		if buy {
+			price = MinDecimal(price, ex.LimitPrice)
+		} else {
+			price = MaxDecimal(price, ex.LimitPrice)
+		}
+	}
+	return price, nil
+}
+
+// Report returns fills of the execution compared with the arrival price and the volume weighted price
+// of the pair trades from the start of the execution till its end or now
+func (e *Executor) Report(ctx context.Context) (*ExecutionReport, error) {
+	ex := e.State()
+	if ex.Status == ExecutionPending {
+		return nil, fmt.Errorf("execution not started")
+	}
+
+	rep := &ExecutionReport{
+		Algo:         ex.Algo,
+		Side:         ex.Side,
+		Amount:       ex.Amount,
+		Filled:       ex.Filled,
+		Fees:         []Fee{},
+		Children:     len(ex.Children),
+		ArrivalPrice: ex.ArrivalPrice,
+		Start:        ex.Start,
+		End:          ex.End,
+	}
+	if !ex.Done() && time.Now().Before(rep.End) {
+		rep.End = time.Now()
+	}
+
+	quote := Decimal{}
+	for _, ch := range ex.Children {
+		quote = quote.Add(ch.Filled.Mul(ch.AveragePrice))
+		rep.Fees = append(rep.Fees, ch.Fees...)
+	}
+	if ex.Filled.IsPositive() {
+		rep.AveragePrice = quote.Div(ex.Filled, int32(e.pair.MarketPrecision))
+	}
+
+	// The API takes whole seconds, the end is rounded up so trades of its last second are included
+	trades, err := e.c.NewCurrencyPairTradesService().CurrencyPairId(ex.CurrencyPairId).
+		From(ex.Start).Till(rep.End.Add(time.Second - 1)).Pager().All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	volume, market := Decimal{}, Decimal{}
+	for _, t := range trades {
+		volume = volume.Add(t.Amount)
+		market = market.Add(t.Amount.Mul(t.Price))
+	}
+	if volume.IsPositive() {
+		rep.BenchmarkPrice = market.Div(volume, int32(e.pair.MarketPrecision))
+	}
+
+	if rep.AveragePrice.IsPositive() {
+		rep.ArrivalSlippageBps = adverseBps(ex.Side, rep.ArrivalPrice, rep.AveragePrice)
+		rep.BenchmarkSlippageBps = adverseBps(ex.Side, rep.BenchmarkPrice, rep.AveragePrice)
+	}
+	return rep, nil
+}
@@ -0,0 +1,196 @@
+package stex_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+)
+
+func TestExecutorTWAP(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	a := newTradingAccount(t, ctx)
+	defer a.close()
+
+	// Bids of the taker and an ask of another user around the mid price 0.0205
+	other := a.srv.AddUser("other")
+	a.srv.SetBalance(other, "ETH", stex.MustParseDecimal("10"))
+	if _, err := a.srv.PlaceOrder(other, 1, stex.OrderType_SELL, stex.MustParseDecimal("1"), stex.MustParseDecimal("0.021"), stex.Decimal{}); err != nil {
+		t.Fatal(err)
+	}
+	a.trade(t, stex.OrderType_BUY, "0.3", "0.02")
+	a.trade(t, stex.OrderType_BUY, "1", "0.019")
+
+	e := stex.NewExecutor(a.c, a.w, stex.ExecutionRequest{
+		CurrencyPairId: 1,
+		Algo:           stex.ExecutionTWAP,
+		Side:           stex.TradeType_SELL,
+		Amount:         stex.MustParseDecimal("1"),
+		Duration:       time.Second,
+		Slices:         2,
+		LimitPrice:     stex.MustParseDecimal("0.0195"),
+	}).UserId(a.maker).ReconcileInterval(20 * time.Millisecond)
+	if err := e.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first child takes the bid at 0.02 and rests at the limit price, the rest of it goes to
+	// the second child, which rests until the end
+	ex, err := e.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.Status != stex.ExecutionDone || !ex.Filled.Equal(stex.MustParseDecimal("0.3")) || len(ex.Targets) != 2 || !ex.Targets[0].Equal(stex.MustParseDecimal("0.5")) {
+		t.Fatalf("finished execution = %+v", ex)
+	}
+	if len(ex.Children) != 2 {
+		t.Fatalf("children = %+v", ex.Children)
+	}
+	first, second := ex.Children[0], ex.Children[1]
+	if first.Slice != 0 || !first.Amount.Equal(stex.MustParseDecimal("0.5")) || !first.Price.Equal(stex.MustParseDecimal("0.0195")) ||
+		!first.Filled.Equal(stex.MustParseDecimal("0.3")) || first.Status != stex.OrderStatus_CANCELLED {
+		t.Errorf("first child = %+v", first)
+	}
+	if second.Slice != 1 || !second.Amount.Equal(stex.MustParseDecimal("0.7")) || !second.Filled.IsZero() || second.Status != stex.OrderStatus_CANCELLED {
+		t.Errorf("second child = %+v", second)
+	}
+	if open := a.openOrders(t, ctx); len(open) != 0 {
+		t.Errorf("orders left in the book: %+v", open)
+	}
+
+	rep, err := e.Report(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.AveragePrice.Equal(stex.MustParseDecimal("0.02")) || !rep.ArrivalPrice.Equal(stex.MustParseDecimal("0.0205")) ||
+		!rep.ArrivalSlippageBps.Equal(stex.MustParseDecimal("243.9")) || !rep.BenchmarkPrice.Equal(stex.MustParseDecimal("0.02")) || rep.Children != 2 {
+		t.Errorf("report = %+v", rep)
+	}
+}
+
+func TestExecutorVWAPProfile(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	a := newTradingAccount(t, ctx)
+	defer a.close()
+
+	// Yesterday a quarter of the volume was traded in the first hour from now and the rest in the second one
+	other := a.srv.AddUser("other")
+	a.srv.SetBalance(other, "ETH", stex.MustParseDecimal("10"))
+	now := time.Now()
+	for _, tr := range []struct {
+		at     time.Duration
+		amount string
+	}{{10 * time.Minute, "0.1"}, {70 * time.Minute, "0.3"}} {
+		a.srv.Now = func() time.Time { return now.Add(tr.at - 24*time.Hour) }
+		if _, err := a.srv.PlaceOrder(other, 1, stex.OrderType_SELL, stex.MustParseDecimal(tr.amount), stex.MustParseDecimal("0.02"), stex.Decimal{}); err != nil {
+			t.Fatal(err)
+		}
+		a.trade(t, stex.OrderType_BUY, tr.amount, "0.02")
+	}
+	a.srv.Now = time.Now
+
+	e := stex.NewExecutor(a.c, a.w, stex.ExecutionRequest{
+		CurrencyPairId: 1,
+		Algo:           stex.ExecutionVWAP,
+		Side:           stex.TradeType_BUY,
+		Amount:         stex.MustParseDecimal("1"),
+		Duration:       2 * time.Hour,
+		Slices:         2,
+		LimitPrice:     stex.MustParseDecimal("0.01"),
+	}).UserId(a.maker).ReconcileInterval(20*time.Millisecond).Profile(1, stex.CandleType1m)
+	if err := e.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	ex := e.State()
+	if ex.Status != stex.ExecutionRunning || len(ex.Targets) != 2 ||
+		!ex.Targets[0].Equal(stex.MustParseDecimal("0.25")) || !ex.Targets[1].Equal(stex.MustParseDecimal("1")) {
+		t.Fatalf("started execution = %+v", ex)
+	}
+
+	// The first child is placed for the target of the first slice
+	waitFor(t, "first child", func() bool {
+		ex = e.State()
+		return len(ex.Children) == 1
+	})
+	if ch := ex.Children[0]; !ch.Amount.Equal(stex.MustParseDecimal("0.25")) || !ch.Price.Equal(stex.MustParseDecimal("0.01")) {
+		t.Errorf("first child = %+v", ch)
+	}
+
+	if err := e.Cancel(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ex, err := e.Wait(ctx); err != nil || ex.Status != stex.ExecutionCancelled {
+		t.Fatalf("cancelled execution = %+v, %v", ex, err)
+	}
+	if open := a.openOrders(t, ctx); len(open) != 0 {
+		t.Errorf("orders left in the book: %+v", open)
+	}
+}
+
+func TestExecutorPauseResume(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	a := newTradingAccount(t, ctx)
+	defer a.close()
+
+	e := stex.NewExecutor(a.c, a.w, stex.ExecutionRequest{
+		CurrencyPairId: 1,
+		Algo:           stex.ExecutionTWAP,
+		Side:           stex.TradeType_BUY,
+		Amount:         stex.MustParseDecimal("1"),
+		Duration:       2 * time.Hour,
+		Slices:         2,
+		LimitPrice:     stex.MustParseDecimal("0.01"),
+	}).UserId(a.maker).ReconcileInterval(20 * time.Millisecond)
+	if err := e.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var ex stex.Execution
+	waitFor(t, "first child", func() bool {
+		ex = e.State()
+		return len(ex.Children) == 1
+	})
+	end := ex.End
+
+	if err := e.Pause(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "child cancelled", func() bool {
+		ex = e.State()
+		return ex.Children[0].Status == stex.OrderStatus_CANCELLED
+	})
+	if ex.Status != stex.ExecutionPaused || len(ex.Children) != 1 {
+		t.Errorf("paused execution = %+v", ex)
+	}
+	if open := a.openOrders(t, ctx); len(open) != 0 {
+		t.Errorf("orders left in the book while paused: %+v", open)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// The end moves by the pause and the cancelled child of the slice is placed again
+	if err := e.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "child placed again", func() bool {
+		ex = e.State()
+		return len(ex.Children) == 2
+	})
+	if ex.Status != stex.ExecutionRunning || ex.End.Sub(end) < 100*time.Millisecond {
+		t.Errorf("resumed execution = %+v, end moved by %s", ex, ex.End.Sub(end))
+	}
+	if ch := ex.Children[1]; ch.Slice != 0 || !ch.Amount.Equal(stex.MustParseDecimal("0.5")) {
+		t.Errorf("child after resume = %+v", ch)
+	}
+	if open := a.openOrders(t, ctx); len(open) != 1 || open[0].Id != ex.Children[1].OrderId {
+		t.Errorf("open orders after resume = %+v", open)
+	}
+
+	if err := e.Cancel(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
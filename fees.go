@@ -7,8 +7,8 @@ import (
 )
 
 type Fees struct {
-	SellFee string `json:"sell_fee"`
-	BuyFee  string `json:"buy_fee"`
+	SellFee Decimal `json:"sell_fee"`
+	BuyFee  Decimal `json:"buy_fee"`
 }
 
 type CurrencyPairFeeService struct {
@@ -14,6 +14,11 @@ type WebsocketGlassRowChangedService struct {
 	currency_pair_id *int
 
 	f func(TradeType, Order)
+
+	channel    string
+	handler_id int64
+
+	streamConfig
 }
 
 func (s *WebsocketGlassRowChangedService) Do() error {
@@ -26,17 +31,20 @@ func (s *WebsocketGlassRowChangedService) Do() error {
 	}
 
 	channel := fmt.Sprintf("%s_data%d", strings.ToLower(string(*s.trade_type)), *s.currency_pair_id)
-	err := s.c.Subscribe(channel, false)
+	handler_id, err := s.c.handle("App\\\\Events\\\\GlassRowChanged", channel, func(h *ws.Channel, msg Order) {
+		s.f(*s.trade_type, msg)
+	})
 	if err != nil {
 		return err
 	}
 
-	err = s.c.C().On("App\\\\Events\\\\GlassRowChanged", func(h *ws.Channel, msg Order) {
-		s.f(*s.trade_type, msg)
-	}, channel)
+	err = s.c.Subscribe(channel, false)
 	if err != nil {
+		s.c.removeHandler(handler_id)
 		return err
 	}
+	s.handler_id = handler_id
+	s.channel = channel
 
 	return nil
 }
@@ -55,3 +63,23 @@ func (s *WebsocketGlassRowChangedService) OnMessage(f func(TradeType, Order)) *W
 	s.f = f
 	return s
 }
+
+// Unsubscribe stops calls of OnMessage and releases the channel subscription, the Stream channel is closed
+func (s *WebsocketGlassRowChangedService) Unsubscribe() error {
+	if s.stream != nil {
+		return s.stream.close()
+	}
+	return s.unsubscribe()
+}
+
+func (s *WebsocketGlassRowChangedService) unsubscribe() error {
+	if s.channel == "" {
+		return fmt.Errorf("not subscribed")
+	}
+
+	s.c.removeHandler(s.handler_id)
+	channel := s.channel
+	s.channel = ""
+
+	return s.c.Unsubscribe(channel)
+}
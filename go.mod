@@ -7,6 +7,7 @@ go 1.13
 replace github.com/vladivolo/golang-socketio => /home/vvv/gowork/src/github.com/vladivolo/golang-socketio
 
 require (
+	github.com/gorilla/websocket v1.4.1
 	github.com/konsorten/go-windows-terminal-sequences v1.0.2 // indirect
 	github.com/sirupsen/logrus v1.4.2
 	github.com/vladivolo/golang-socketio v0.1.2
@@ -11,27 +11,27 @@ type Trade struct {
 	Id          int64     `json:"id"`
 	BuyOrderId  int64     `json:"buy_order_id"`
 	SellOrderId int64     `json:"sell_order_id"`
-	Price       string    `json:"price"`
-	Amount      string    `json:"amount"`
+	Price       Decimal   `json:"price"`
+	Amount      Decimal   `json:"amount"`
 	TradeType   TradeType `json:"trade_type"`
-	Timestamp   string    `json:"timestamp"`
+	Timestamp   Time      `json:"timestamp"`
 }
 
 type Fee struct {
 	Id         int64   `json:"id"`
 	CurrencyId int     `json:"currency_id"`
-	Amount     float64 `json:"amount"`
-	Timestamp  string  `json:"timestamp"`
+	Amount     Decimal `json:"amount"`
+	Timestamp  Time    `json:"timestamp"`
 }
 
 type TradeOrderDetail struct {
 	Id             int64   `json:""`
 	CurrencyPairId int     `json:"currency_pair_id"`
-	Price          string  `json:"price"`
-	InitialAmount  string  `json:"initial_amount"`
+	Price          Decimal `json:"price"`
+	InitialAmount  Decimal `json:"initial_amount"`
 	Type           string  `json:"type"`
-	Created        string  `json:"created"`
-	Timestamp      int64   `json:"timestamp"`
+	Created        Time    `json:"created"`
+	Timestamp      Time    `json:"timestamp"`
 	Status         string  `json:"status"`
 	Trades         []Trade `json:"trades"`
 	Fees           []Fee   `json:"fees"`
@@ -0,0 +1,466 @@
+package stex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type IcebergStatus string
+
+const (
+	IcebergPending IcebergStatus = "pending"
+	IcebergActive  IcebergStatus = "active"
+	IcebergDone    IcebergStatus = "done"
+	// IcebergStopped means the book moved beyond LimitPrice
+	IcebergStopped   IcebergStatus = "stopped"
+	IcebergCancelled IcebergStatus = "cancelled"
+)
+
+// IcebergRequest define parent order shown in the book one slice at a time
+type IcebergRequest struct {
+	CurrencyPairId int
+	// Type is BUY or SELL
+	Type   OrderType
+	Amount Decimal
+	// SliceAmount is the amount shown in the book
+	SliceAmount Decimal
+	// Variance randomizes slice amounts by up to that part of SliceAmount, 0.2 is ±20%
+	Variance Decimal
+	// Price of the slices, zero places every slice at the best price of its side of the book
+	Price Decimal
+	// LimitPrice stops the iceberg when a slice priced from the book would be worse, zero means no limit
+	LimitPrice Decimal
+}
+
+// IcebergSlice define visible order of an iceberg
+type IcebergSlice struct {
+	OrderId      int64
+	Amount       Decimal
+	Price        Decimal
+	Filled       Decimal
+	AveragePrice Decimal
+	Fees         []Fee
+	Status       OrderStatus
+	Placed       time.Time
+}
+
+// Iceberg define state of an iceberg order
+type Iceberg struct {
+	IcebergRequest
+	Status IcebergStatus
+
+	Slices []IcebergSlice
+	// Filled and AveragePrice are totals of all slices
+	Filled       Decimal
+	AveragePrice Decimal
+
+	Created time.Time
+	Updated time.Time
+	// Error is the last error of placing or cancelling slices
+	Error string
+}
+
+// Done reports if the iceberg is finished
+func (b *Iceberg) Done() bool {
+	return b.Status == IcebergDone || b.Status == IcebergStopped || b.Status == IcebergCancelled
+}
+
+// Fees returns fees of all slices
+func (b *Iceberg) Fees() []Fee {
+	res := []Fee{}
+	for _, s := range b.Slices {
+		res = append(res, s.Fees...)
+	}
+	return res
+}
+
+// live returns index of the slice in the book or -1
+func (b *Iceberg) live() int {
+	for i := range b.Slices {
+		if !orderStatusDone(b.Slices[i].Status) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *Iceberg) copy() Iceberg {
+	res := *b
+	res.Slices = append([]IcebergSlice{}, b.Slices...)
+	return res
+}
+
+// IcebergOrder places an iceberg order: a slice is placed, the next one follows when it is filled
+// until the whole amount is filled, the price leaves LimitPrice or the iceberg is cancelled.
+// Fills are followed with OrderTracker, i.e. the private order channels with REST checks.
+type IcebergOrder struct {
+	c       *Client
+	w       *WssClient
+	tracker *OrderTracker
+	source  PairInfoSource
+	book    OrderBookView
+	rand    *rand.Rand
+	f       func(Iceberg)
+
+	// run serializes changes of the iceberg and the requests made for it
+	run sync.Mutex
+
+	mu    sync.Mutex
+	state Iceberg
+
+	pair       CurrencyPair
+	cancelling bool
+
+	kick chan struct{}
+	done chan struct{}
+}
+
+// NewIcebergOrder returns iceberg of req on the account of c. w must be connected, when it is nil
+// slices are polled with REST only.
+func NewIcebergOrder(c *Client, w *WssClient, req IcebergRequest) *IcebergOrder {
+	b := &IcebergOrder{
+		c:      c,
+		w:      w,
+		source: clientPairSource{c: c},
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		state:  Iceberg{IcebergRequest: req, Status: IcebergPending},
+		kick:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	b.tracker = NewOrderTracker(c, w).CurrencyPairIds(req.CurrencyPairId).OnUpdate(func(TrackedOrder) { b.checkSoon() })
+	return b
+}
+
+// UserId sets user id, by default it is taken from ProfileInfoService
+func (b *IcebergOrder) UserId(user_id int64) *IcebergOrder {
+	b.tracker.UserId(user_id)
+	return b
+}
+
+// ReconcileInterval sets period of REST checks of the slices, default is 30s
+func (b *IcebergOrder) ReconcileInterval(interval time.Duration) *IcebergOrder {
+	b.tracker.ReconcileInterval(interval)
+	return b
+}
+
+// Source sets where pair rules are loaded from, default is CurrencyPairInfoService
+func (b *IcebergOrder) Source(source PairInfoSource) *IcebergOrder {
+	b.source = source
+	return b
+}
+
+// OrderBook sets book slices without Price are priced from, e.g. LiveOrderBook. By default a snapshot
+// is loaded with CurrencyPairOrderbookService for every slice.
+func (b *IcebergOrder) OrderBook(book OrderBookView) *IcebergOrder {
+	b.book = book
+	return b
+}
+
+// Seed sets seed of the slice amount randomization
+func (b *IcebergOrder) Seed(seed int64) *IcebergOrder {
+	b.rand = rand.New(rand.NewSource(seed))
+	return b
+}
+
+// OnUpdate sets callback called after every change of the iceberg.
+// It runs while the iceberg is processed and must not call Cancel.
+func (b *IcebergOrder) OnUpdate(f func(Iceberg)) *IcebergOrder {
+	b.f = f
+	return b
+}
+
+// Do places the first slice and goes on until the iceberg is finished or ctx is cancelled
+func (b *IcebergOrder) Do(ctx context.Context) error {
+	b.run.Lock()
+	defer b.run.Unlock()
+
+	ice := b.State()
+	if ice.Status != IcebergPending {
+		return fmt.Errorf("iceberg already started")
+	}
+	if ice.Type != OrderType_BUY && ice.Type != OrderType_SELL {
+		return fmt.Errorf("type must be BUY or SELL")
+	}
+	if !ice.SliceAmount.IsPositive() || ice.SliceAmount.GreaterThan(ice.Amount) {
+		return fmt.Errorf("slice amount must be positive and not above amount")
+	}
+	if ice.Variance.IsNegative() || ice.Variance.GreaterThanOrEqual(NewDecimalFromInt(1)) {
+		return fmt.Errorf("variance must be from 0 to 1")
+	}
+
+	pair, err := b.source.PairInfo(ctx, ice.CurrencyPairId)
+	if err != nil {
+		return err
+	}
+	b.pair = *pair
+
+	if ice.SliceAmount.LessThan(pair.MinOrderAmount) {
+		return fmt.Errorf("slice amount must be at least %s", pair.MinOrderAmount)
+	}
+
+	if b.w != nil {
+		if err := b.tracker.Do(ctx); err != nil {
+			return err
+		}
+	}
+
+	ice.Status = IcebergActive
+	ice.Created = time.Now()
+	if err := b.place(ctx, &ice); err != nil && ice.Status == IcebergActive {
+		return err
+	}
+	b.put(ice)
+
+	go func() {
+		ticker := time.NewTicker(b.tracker.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-b.kick:
+			case <-ticker.C:
+				if b.w == nil {
+					if err := b.tracker.Reconcile(ctx); err != nil {
+						b.c.debug("iceberg reconcile: %s", err)
+					}
+				}
+			}
+
+			if b.check(ctx) {
+				close(b.done)
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// State returns state of the iceberg
+func (b *IcebergOrder) State() Iceberg {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state.copy()
+}
+
+// Wait waits until the iceberg is finished and its last slice left the book
+func (b *IcebergOrder) Wait(ctx context.Context) (Iceberg, error) {
+	select {
+	case <-ctx.Done():
+		return b.State(), ctx.Err()
+	case <-b.done:
+		return b.State(), nil
+	}
+}
+
+// Cancel stops the iceberg and cancels the slice in the book
+func (b *IcebergOrder) Cancel(ctx context.Context) error {
+	b.run.Lock()
+	defer b.run.Unlock()
+
+	ice := b.State()
+	if ice.Status == IcebergPending {
+		return fmt.Errorf("iceberg not started")
+	}
+	if ice.Done() {
+		return nil
+	}
+
+	ice.Status = IcebergCancelled
+	var err error
+	if i := ice.live(); i >= 0 && !b.cancelling {
+		_, err = b.c.NewOrderDeleteService().OrderId(ice.Slices[i].OrderId).Do(ctx)
+		if err != nil {
+			ice.Error = err.Error()
+		} else {
+			b.cancelling = true
+			b.tracker.reconcileSoon()
+		}
+	}
+
+	b.put(ice)
+	b.checkSoon()
+	return err
+}
+
+func (b *IcebergOrder) checkSoon() {
+	select {
+	case b.kick <- struct{}{}:
+	default:
+	}
+}
+
+// put stores ice and reports the change
+func (b *IcebergOrder) put(ice Iceberg) {
+	ice.Updated = time.Now()
+
+	b.mu.Lock()
+	b.state = ice.copy()
+	b.mu.Unlock()
+
+	if b.f != nil {
+		b.f(ice)
+	}
+}
+
+// sync updates slices and totals from the tracker, it reports if anything changed
+func (b *IcebergOrder) sync(ice *Iceberg) bool {
+	changed := false
+	filled, quote := Decimal{}, Decimal{}
+	for i := range ice.Slices {
+		s := &ice.Slices[i]
+		if o, ok := b.tracker.Order(s.OrderId); ok {
+			amount, price := o.filled()
+			if o.Status != s.Status || !amount.Equal(s.Filled) || !price.Equal(s.AveragePrice) {
+				changed = true
+			}
+			s.Status = o.Status
+			s.Filled = amount
+			s.AveragePrice = price
+			s.Fees = o.Fees
+		}
+		filled = filled.Add(s.Filled)
+		quote = quote.Add(s.Filled.Mul(s.AveragePrice))
+	}
+
+	ice.Filled = filled
+	if filled.IsPositive() {
+		ice.AveragePrice = quote.Div(filled, int32(b.pair.MarketPrecision))
+	}
+	return changed
+}
+
+// check places the next slice when the previous one is filled, it reports if the iceberg is finished
+// with no slice in the book
+func (b *IcebergOrder) check(ctx context.Context) bool {
+	b.run.Lock()
+	defer b.run.Unlock()
+
+	ice := b.State()
+	changed := b.sync(&ice)
+
+	if i := ice.live(); i >= 0 {
+		if changed {
+			b.put(ice)
+		}
+		return false
+	}
+	b.cancelling = false
+
+	if !ice.Done() {
+		last := ice.Slices[len(ice.Slices)-1]
+		if last.Status == OrderStatus_CANCELLED {
+			ice.Status = IcebergCancelled
+			ice.Error = "slice was cancelled outside of the iceberg"
+		} else if err := b.place(ctx, &ice); err != nil {
+			b.c.debug("iceberg place slice: %s", err)
+		}
+		changed = true
+	}
+
+	if changed {
+		b.put(ice)
+	}
+	return ice.Done()
+}
+
+// place places the next slice or finishes the iceberg when the amount left is below the minimum
+func (b *IcebergOrder) place(ctx context.Context, ice *Iceberg) error {
+	min := b.pair.MinOrderAmount
+	left := ice.Amount.Sub(ice.Filled)
+	if left.LessThan(min) || !left.IsPositive() {
+		ice.Status = IcebergDone
+		return nil
+	}
+
+	amount := ice.SliceAmount
+	if ice.Variance.IsPositive() {
+		shift := NewDecimalFromFloat(b.rand.Float64()*2 - 1).Mul(ice.Variance)
+		amount = amount.Add(amount.Mul(shift))
+	}
+	amount = MaxDecimal(MinDecimal(amount, left), min)
+	// No dust below the minimum is left for the last slice
+	if rest := left.Sub(amount); rest.LessThan(min) {
+		amount = left
+	}
+
+	price, err := b.price(ctx, ice)
+	if err != nil {
+		ice.Error = err.Error()
+		return err
+	}
+
+	order, err := (&OrderValidator{round: true}).check(&b.pair, OrderRequest{
+		CurrencyPairId: ice.CurrencyPairId,
+		Type:           ice.Type,
+		Amount:         amount,
+		Price:          price,
+	})
+	if err != nil {
+		// The amount left is below the minimum after rounding to the pair step
+		if errors.Is(err, ErrInvalidAmount) && amount.Equal(left) {
+			ice.Status = IcebergDone
+			return nil
+		}
+		ice.Error = err.Error()
+		return err
+	}
+
+	info, err := b.c.NewCreateOrderService().CurrencyPairId(ice.CurrencyPairId).OrderType(order.Type).
+		Amount(order.Amount).Price(order.Price).Do(ctx)
+	if err != nil {
+		ice.Error = err.Error()
+		return err
+	}
+
+	b.tracker.Track(*info)
+	ice.Slices = append(ice.Slices, IcebergSlice{
+		OrderId: info.Id,
+		Amount:  order.Amount,
+		Price:   order.Price,
+		Status:  info.Status,
+		Placed:  time.Now(),
+	})
+	return nil
+}
+
+// price returns Price or the best price of the slice side of the book, the iceberg is stopped
+// when it is beyond LimitPrice
+func (b *IcebergOrder) price(ctx context.Context, ice *Iceberg) (Decimal, error) {
+	if ice.Price.IsPositive() {
+		return ice.Price, nil
+	}
+
+	book := b.book
+	if book == nil {
+		snapshot, err := b.c.NewCurrencyPairOrderbookService().CurrencyPairId(ice.CurrencyPairId).Do(ctx)
+		if err != nil {
+			return Decimal{}, err
+		}
+		book = snapshot
+	}
+
+	buy := ice.Type == OrderType_BUY
+	bids, asks := book.Levels(1)
+	levels := asks
+	if buy {
+		levels = bids
+	}
+	if len(levels) == 0 {
+		return Decimal{}, ErrEmptyBook
+	}
+
+	price := levels[0].Price
+	if ice.LimitPrice.IsPositive() && ((buy && price.GreaterThan(ice.LimitPrice)) || (!buy && price.LessThan(ice.LimitPrice))) {
+		ice.Status = IcebergStopped
+		return Decimal{}, fmt.Errorf("best price %s is beyond limit %s", price, ice.LimitPrice)
+	}
+	return price, nil
+}
@@ -0,0 +1,102 @@
+package stex_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+)
+
+func TestIcebergSlices(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	a := newTradingAccount(t, ctx)
+	defer a.close()
+
+	b := stex.NewIcebergOrder(a.c, a.w, stex.IcebergRequest{
+		CurrencyPairId: 1,
+		Type:           stex.OrderType_SELL,
+		Amount:         stex.MustParseDecimal("1"),
+		SliceAmount:    stex.MustParseDecimal("0.4"),
+		Price:          stex.MustParseDecimal("0.03"),
+	}).UserId(a.maker).ReconcileInterval(20 * time.Millisecond)
+	if err := b.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the first slice is in the book
+	open := a.openOrders(t, ctx)
+	if len(open) != 1 || !open[0].InitialAmount.Equal(stex.MustParseDecimal("0.4")) {
+		t.Fatalf("open orders = %+v", open)
+	}
+
+	// The next slice follows the filled one
+	a.trade(t, stex.OrderType_BUY, "0.4", "0.03")
+	waitFor(t, "second slice", func() bool {
+		return len(b.State().Slices) == 2
+	})
+
+	// The rest of the buy stays in the book and fills the last slice, which takes the amount left
+	a.trade(t, stex.OrderType_BUY, "0.6", "0.03")
+	ice, err := b.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ice.Status != stex.IcebergDone || !ice.Filled.Equal(stex.MustParseDecimal("1")) || !ice.AveragePrice.Equal(stex.MustParseDecimal("0.03")) {
+		t.Errorf("finished iceberg = %+v", ice)
+	}
+	if len(ice.Slices) != 3 || !ice.Slices[2].Amount.Equal(stex.MustParseDecimal("0.2")) {
+		t.Errorf("slices = %+v", ice.Slices)
+	}
+	for _, s := range ice.Slices {
+		if s.Status != stex.OrderStatus_FINISHED || !s.Filled.Equal(s.Amount) {
+			t.Errorf("slice = %+v", s)
+		}
+	}
+}
+
+func TestIcebergLimitPrice(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	a := newTradingAccount(t, ctx)
+	defer a.close()
+
+	other := a.srv.AddUser("other")
+	a.srv.SetBalance(other, "ETH", stex.MustParseDecimal("10"))
+	ask := func(amount, price string) {
+		if _, err := a.srv.PlaceOrder(other, 1, stex.OrderType_SELL, stex.MustParseDecimal(amount), stex.MustParseDecimal(price), stex.Decimal{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Slices join the best ask
+	ask("0.1", "0.03")
+	b := stex.NewIcebergOrder(a.c, a.w, stex.IcebergRequest{
+		CurrencyPairId: 1,
+		Type:           stex.OrderType_SELL,
+		Amount:         stex.MustParseDecimal("1"),
+		SliceAmount:    stex.MustParseDecimal("0.5"),
+		LimitPrice:     stex.MustParseDecimal("0.025"),
+	}).UserId(a.maker).ReconcileInterval(20 * time.Millisecond)
+	if err := b.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ice := b.State(); len(ice.Slices) != 1 || !ice.Slices[0].Price.Equal(stex.MustParseDecimal("0.03")) {
+		t.Fatalf("started iceberg = %+v", ice)
+	}
+
+	// The book moves below the limit before the next slice
+	a.trade(t, stex.OrderType_BUY, "0.6", "0.03")
+	ask("1", "0.02")
+	ice, err := b.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ice.Status != stex.IcebergStopped || ice.Error == "" || !ice.Filled.Equal(stex.MustParseDecimal("0.5")) || len(ice.Slices) != 1 {
+		t.Errorf("stopped iceberg = %+v", ice)
+	}
+	if open := a.openOrders(t, ctx); len(open) != 0 {
+		t.Errorf("orders left in the book: %+v", open)
+	}
+}
@@ -0,0 +1,420 @@
+package stex
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LiveOrderBook keeps order book of one pair up to date from a REST snapshot and GlassRowChanged deltas.
+// Deltas received while the snapshot is fetched are buffered and replayed on top of it in the order they
+// arrived. Rows carry absolute level amounts, so replaying a delta the snapshot already has is harmless.
+// The book is fetched again after every reconnect of the websocket client, when a delta does not fit the book
+// and when the book stays crossed longer than CrossTolerance. Both sides come from separate channels,
+// so a trade may cross the book until the delta of the other side arrives.
+type LiveOrderBook struct {
+	c *Client
+	w *WssClient
+
+	pair_id         *int
+	snapshot_limit  *int
+	resync_delay    time.Duration
+	cross_tolerance time.Duration
+
+	mu      sync.RWMutex
+	bids    map[string]Order
+	asks    map[string]Order
+	synced  bool
+	pending []bookDelta
+	updated time.Time
+	resyncs int
+	// crossed is the time the book became crossed, zero if it is not
+	crossed time.Time
+
+	resync chan struct{}
+	f      func(*LiveOrderBook)
+}
+
+type bookDelta struct {
+	side TradeType
+	row  Order
+}
+
+// NewLiveOrderBook returns order book fed by c snapshots and w deltas, w must be connected
+func NewLiveOrderBook(c *Client, w *WssClient) *LiveOrderBook {
+	return &LiveOrderBook{
+		c:               c,
+		w:               w,
+		resync_delay:    time.Second,
+		cross_tolerance: time.Second,
+		bids:            map[string]Order{},
+		asks:            map[string]Order{},
+		resync:          make(chan struct{}, 1),
+	}
+}
+
+func (b *LiveOrderBook) CurrencyPairId(pair_id int) *LiveOrderBook {
+	b.pair_id = &pair_id
+	return b
+}
+
+// SnapshotLimit sets number of levels of each side requested in REST snapshots.
+// The snapshot is then truncated: levels deeper than limit are known only from deltas received after it,
+// so only the top limit levels of Levels, Depth and OrderBook are complete. By default the API limit is used.
+func (b *LiveOrderBook) SnapshotLimit(limit int) *LiveOrderBook {
+	b.snapshot_limit = &limit
+	return b
+}
+
+// CrossTolerance sets how long the book may stay crossed before it is fetched again, default is 1s
+func (b *LiveOrderBook) CrossTolerance(d time.Duration) *LiveOrderBook {
+	b.cross_tolerance = d
+	return b
+}
+
+// OnUpdate sets callback called after every change of the book
+func (b *LiveOrderBook) OnUpdate(f func(*LiveOrderBook)) *LiveOrderBook {
+	b.f = f
+	return b
+}
+
+// Do subscribes to deltas of both sides, fetches the first snapshot and keeps the book
+// in sync until ctx is cancelled
+func (b *LiveOrderBook) Do(ctx context.Context) error {
+	if b.pair_id == nil {
+		return fmt.Errorf("pair_id not init")
+	}
+
+	buy := NewWebsocketGlassRowChangedService(b.w).CurrencyPairId(*b.pair_id).TradeType(TradeType_BUY).
+		OnMessage(b.apply)
+	err := buy.Do()
+	if err != nil {
+		return err
+	}
+
+	sell := NewWebsocketGlassRowChangedService(b.w).CurrencyPairId(*b.pair_id).TradeType(TradeType_SELL).
+		OnMessage(b.apply)
+	err = sell.Do()
+	if err != nil {
+		buy.Unsubscribe()
+		return err
+	}
+
+	err = b.sync(ctx)
+	if err != nil {
+		buy.Unsubscribe()
+		sell.Unsubscribe()
+		return err
+	}
+
+	removeHook := b.w.addReconnectHook(b.Resync)
+
+	go func() {
+		defer func() {
+			removeHook()
+			buy.Unsubscribe()
+			sell.Unsubscribe()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-b.resync:
+			}
+
+			for {
+				err := b.sync(ctx)
+				if err == nil {
+					break
+				}
+				b.c.debug("order book %d resync: %s", *b.pair_id, err)
+				if !sleepContext(ctx, b.resync_delay) {
+					return
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Resync drops the book and fetches a new snapshot
+func (b *LiveOrderBook) Resync() {
+	b.mu.Lock()
+	b.synced = false
+	b.mu.Unlock()
+
+	select {
+	case b.resync <- struct{}{}:
+	default:
+	}
+}
+
+// sync replaces the book with a REST snapshot and applies deltas buffered meanwhile
+func (b *LiveOrderBook) sync(ctx context.Context) error {
+	b.mu.Lock()
+	b.synced = false
+	b.pending = nil
+	b.mu.Unlock()
+
+	s := b.c.NewCurrencyPairOrderbookService().CurrencyPairId(*b.pair_id)
+	if b.snapshot_limit != nil {
+		s.BidsLimit(*b.snapshot_limit).AsksLimit(*b.snapshot_limit)
+	}
+
+	ob, err := s.Do(ctx)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+
+	b.bids = map[string]Order{}
+	b.asks = map[string]Order{}
+	for _, o := range ob.Bid {
+		b.bids[priceKey(o.Price)] = o
+	}
+	for _, o := range ob.Ask {
+		b.asks[priceKey(o.Price)] = o
+	}
+
+	ok := true
+	for _, d := range b.pending {
+		if !b.applyLocked(d.side, d.row) {
+			ok = false
+			break
+		}
+	}
+	b.pending = nil
+	b.synced = ok
+	b.resyncs++
+	b.updated = time.Now()
+	b.crossed = time.Time{}
+	if ok {
+		b.checkCrossedLocked()
+	}
+
+	b.mu.Unlock()
+
+	// A buffered delta may not fit the snapshot, take another one
+	if !ok {
+		b.Resync()
+		return nil
+	}
+
+	if b.f != nil {
+		b.f(b)
+	}
+	return nil
+}
+
+// apply handles GlassRowChanged row of given side
+func (b *LiveOrderBook) apply(side TradeType, row Order) {
+	b.mu.Lock()
+
+	if !b.synced {
+		b.pending = append(b.pending, bookDelta{side: side, row: row})
+		b.mu.Unlock()
+		return
+	}
+
+	ok := b.applyLocked(side, row)
+	if ok {
+		b.updated = time.Now()
+		b.checkCrossedLocked()
+	} else {
+		b.synced = false
+	}
+
+	b.mu.Unlock()
+
+	if !ok {
+		b.Resync()
+		return
+	}
+
+	if b.f != nil {
+		b.f(b)
+	}
+}
+
+// applyLocked sets the level of row price, amount 0 removes it. Returns false if the row does not fit the book.
+// A crossed book is checked separately by checkCrossedLocked.
+func (b *LiveOrderBook) applyLocked(side TradeType, row Order) bool {
+	if row.CurrencyPairId != 0 && row.CurrencyPairId != *b.pair_id {
+		return false
+	}
+	if row.Amount.IsNegative() || !row.Price.IsPositive() {
+		return false
+	}
+
+	levels := b.bids
+	if side == TradeType_SELL {
+		levels = b.asks
+	}
+
+	key := priceKey(row.Price)
+	if row.Amount.IsZero() {
+		delete(levels, key)
+	} else {
+		levels[key] = row
+	}
+	return true
+}
+
+// checkCrossedLocked starts the cross tolerance timer when the book becomes crossed and stops it when it is not
+func (b *LiveOrderBook) checkCrossedLocked() {
+	bid, okBid := bestLevel(b.bids, true)
+	ask, okAsk := bestLevel(b.asks, false)
+	if !okBid || !okAsk || bid.Price.LessThan(ask.Price) {
+		b.crossed = time.Time{}
+		return
+	}
+	if !b.crossed.IsZero() {
+		return
+	}
+
+	crossed := time.Now()
+	b.crossed = crossed
+	time.AfterFunc(b.cross_tolerance, func() {
+		b.mu.Lock()
+		stale := b.synced && b.crossed.Equal(crossed)
+		b.mu.Unlock()
+
+		if stale {
+			b.c.debug("order book %d stays crossed, resync", *b.pair_id)
+			b.Resync()
+		}
+	})
+}
+
+func priceKey(price Decimal) string {
+	return price.Normalize().String()
+}
+
+func bestLevel(levels map[string]Order, bid bool) (Order, bool) {
+	var best Order
+	found := false
+	for _, o := range levels {
+		if !found || (bid && o.Price.GreaterThan(best.Price)) || (!bid && o.Price.LessThan(best.Price)) {
+			best = o
+			found = true
+		}
+	}
+	return best, found
+}
+
+// sortedLevels returns up to n levels best first with recalculated cumulative amounts, n <= 0 means all
+func sortedLevels(levels map[string]Order, bid bool, n int) []Order {
+	res := make([]Order, 0, len(levels))
+	for _, o := range levels {
+		res = append(res, o)
+	}
+	return sortLevels(res, bid, n)
+}
+
+// sortLevels sorts levels best first in place, cuts them to n and recalculates cumulative amounts
+func sortLevels(levels []Order, bid bool, n int) []Order {
+	sort.SliceStable(levels, func(i, j int) bool {
+		if bid {
+			return levels[i].Price.GreaterThan(levels[j].Price)
+		}
+		return levels[i].Price.LessThan(levels[j].Price)
+	})
+
+	if n > 0 && len(levels) > n {
+		levels = levels[:n]
+	}
+
+	cumulative := Decimal{}
+	for i := range levels {
+		cumulative = cumulative.Add(levels[i].Amount)
+		levels[i].CumulativeAmount = cumulative
+	}
+	return levels
+}
+
+// Synced reports if the book matches the exchange, it is false while a snapshot is fetched
+func (b *LiveOrderBook) Synced() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.synced
+}
+
+// Updated returns time of the last change
+func (b *LiveOrderBook) Updated() time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.updated
+}
+
+// Resyncs returns number of snapshots taken
+func (b *LiveOrderBook) Resyncs() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.resyncs
+}
+
+// BestBid returns the highest bid level
+func (b *LiveOrderBook) BestBid() (Order, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return bestLevel(b.bids, true)
+}
+
+// BestAsk returns the lowest ask level
+func (b *LiveOrderBook) BestAsk() (Order, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return bestLevel(b.asks, false)
+}
+
+// Spread returns best ask minus best bid, false if a side is empty
+func (b *LiveOrderBook) Spread() (Decimal, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	bid, okBid := bestLevel(b.bids, true)
+	ask, okAsk := bestLevel(b.asks, false)
+	if !okBid || !okAsk {
+		return Decimal{}, false
+	}
+	return ask.Price.Sub(bid.Price), true
+}
+
+// Depth returns number of bid and ask levels
+func (b *LiveOrderBook) Depth() (bids, asks int) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return len(b.bids), len(b.asks)
+}
+
+// Levels returns up to n best levels of each side, n <= 0 means all
+func (b *LiveOrderBook) Levels(n int) (bids, asks []Order) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return sortedLevels(b.bids, true, n), sortedLevels(b.asks, false, n)
+}
+
+// OrderBook returns copy of the book in the form of REST order book
+func (b *LiveOrderBook) OrderBook() *OrderBook {
+	bids, asks := b.Levels(0)
+
+	ob := &OrderBook{Bid: bids, Ask: asks}
+	if len(bids) > 0 {
+		ob.BidTotalAmount = bids[len(bids)-1].CumulativeAmount
+	}
+	if len(asks) > 0 {
+		ob.AskTotalAmount = asks[len(asks)-1].CumulativeAmount
+	}
+	return ob
+}
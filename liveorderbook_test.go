@@ -0,0 +1,112 @@
+package stex_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+	"github.com/vladivolo/stex-api/stextest"
+)
+
+func glassRow(price, amount string) map[string]interface{} {
+	return map[string]interface{}{"currency_pair_id": 1, "price": price, "amount": amount, "count": 1}
+}
+
+// waitBook waits until cond holds for the book
+func waitBook(t *testing.T, b *stex.LiveOrderBook, what string, cond func(b *stex.LiveOrderBook) bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond(b) {
+		if time.Now().After(deadline) {
+			bids, asks := b.Levels(0)
+			t.Fatalf("%s: bids %+v, asks %+v", what, bids, asks)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func hasLevel(levels []stex.Order, price, amount string) bool {
+	for _, o := range levels {
+		if o.Price.Equal(stex.MustParseDecimal(price)) {
+			return o.Amount.Equal(stex.MustParseDecimal(amount))
+		}
+	}
+	return amount == "0"
+}
+
+func TestLiveOrderBook(t *testing.T) {
+	srv := stextest.NewServer()
+	defer srv.Close()
+	sock := stextest.NewSocketServer()
+	defer sock.Close()
+
+	maker := srv.AddUser("maker")
+	srv.SetBalance(maker, "BTC", stex.MustParseDecimal("10"))
+	srv.SetBalance(maker, "ETH", stex.MustParseDecimal("10"))
+	if _, err := srv.PlaceOrder(maker, 1, stex.OrderType_BUY, stex.MustParseDecimal("1"), stex.MustParseDecimal("0.02"), stex.Decimal{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.PlaceOrder(maker, 1, stex.OrderType_SELL, stex.MustParseDecimal("1"), stex.MustParseDecimal("0.03"), stex.Decimal{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	w, err := sock.WssClient("").Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The snapshot takes 400ms, every delta received meanwhile is replayed on top of it in order:
+	// a level the snapshot has already, a level added and removed, and a level the snapshot misses
+	srv.InjectFault(stextest.Fault{Method: "GET", Path: "/public/orderbook/1", Latency: 400 * time.Millisecond, Count: 1})
+	go func() {
+		if sock.WaitSubscribed(ctx, "sell_data1", 1) != nil {
+			return
+		}
+		sock.Push("buy_data1", stextest.EventGlassRowChanged, glassRow("0.02", "1"))
+		sock.Push("buy_data1", stextest.EventGlassRowChanged, glassRow("0.021", "3"))
+		sock.Push("buy_data1", stextest.EventGlassRowChanged, glassRow("0.021", "0"))
+		time.Sleep(50 * time.Millisecond)
+		sock.Push("buy_data1", stextest.EventGlassRowChanged, glassRow("0.019", "2"))
+	}()
+
+	b := stex.NewLiveOrderBook(srv.Client(""), w).CurrencyPairId(1).CrossTolerance(200 * time.Millisecond)
+	if err = b.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !b.Synced() || b.Resyncs() != 1 {
+		t.Fatalf("synced %v, resyncs %d", b.Synced(), b.Resyncs())
+	}
+	bids, asks := b.Levels(0)
+	if len(bids) != 2 || !hasLevel(bids, "0.02", "1") || !hasLevel(bids, "0.019", "2") || len(asks) != 1 || !hasLevel(asks, "0.03", "1") {
+		t.Fatalf("book after snapshot: bids %+v, asks %+v", bids, asks)
+	}
+
+	// A trade crosses the book until the delta of the other side arrives
+	sock.Push("sell_data1", stextest.EventGlassRowChanged, glassRow("0.019", "1"))
+	waitBook(t, b, "crossed", func(b *stex.LiveOrderBook) bool {
+		_, asks := b.Levels(0)
+		return hasLevel(asks, "0.019", "1")
+	})
+	sock.Push("buy_data1", stextest.EventGlassRowChanged, glassRow("0.02", "0"))
+	sock.Push("buy_data1", stextest.EventGlassRowChanged, glassRow("0.019", "0"))
+	waitBook(t, b, "uncrossed", func(b *stex.LiveOrderBook) bool {
+		bids, _ := b.Levels(0)
+		return len(bids) == 0
+	})
+	time.Sleep(300 * time.Millisecond)
+	if n := b.Resyncs(); n != 1 {
+		t.Fatalf("transient cross caused resync, resyncs %d", n)
+	}
+
+	// A cross lasting longer than the tolerance takes a new snapshot
+	sock.Push("buy_data1", stextest.EventGlassRowChanged, glassRow("0.05", "1"))
+	waitBook(t, b, "resync", func(b *stex.LiveOrderBook) bool {
+		return b.Resyncs() == 2 && b.Synced()
+	})
+	bids, asks = b.Levels(0)
+	if len(bids) != 1 || !hasLevel(bids, "0.02", "1") || len(asks) != 1 || !hasLevel(asks, "0.03", "1") {
+		t.Errorf("book after resync: bids %+v, asks %+v", bids, asks)
+	}
+}
@@ -9,7 +9,7 @@ type Notification struct {
 	Id    string `json:"id"`
 	Title string `json:"title"`
 	Desc  string `json:"desc"`
-	Date  string `json:"date"`
+	Date  Time   `json:"date"`
 }
 
 type ProfileNotificationsService struct {
@@ -0,0 +1,251 @@
+package stex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token define OAuth2 access token
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// expired check if token expires within margin. Tokens without expiry never expire.
+func (t *Token) expired(margin time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return true
+	}
+	if t.Expiry.IsZero() {
+		return false
+	}
+	return time.Now().Add(margin).After(t.Expiry)
+}
+
+// TokenSource provides access token for every authenticated request or subscription
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenRefresher is a TokenSource that can obtain a new token on demand,
+// Client uses it to retry once when request fails with 401.
+// Refresh gets the access token rejected by the server and returns the current token without refreshing
+// if it was already replaced, so concurrent failed requests cause a single refresh.
+type TokenRefresher interface {
+	TokenSource
+	Refresh(ctx context.Context, rejected string) (*Token, error)
+}
+
+type staticTokenSource struct {
+	t *Token
+}
+
+func (s staticTokenSource) Token(ctx context.Context) (*Token, error) {
+	return s.t, nil
+}
+
+// StaticTokenSource returns TokenSource that always returns the same access token
+func StaticTokenSource(accessToken string) TokenSource {
+	return staticTokenSource{t: &Token{AccessToken: accessToken, TokenType: "Bearer"}}
+}
+
+// TokenStore keeps token between restarts
+type TokenStore interface {
+	// Load returns nil token without error if nothing was saved yet
+	Load() (*Token, error)
+	Save(t *Token) error
+}
+
+// FileTokenStore keeps token as JSON in a file readable only by the owner
+type FileTokenStore struct {
+	Path string
+}
+
+func (s *FileTokenStore) Load() (*Token, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t := new(Token)
+	err = json.Unmarshal(data, t)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Save writes token to a temporary file and renames it, so a crash never leaves a broken file
+func (s *FileTokenStore) Save(t *Token) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.Path, data)
+}
+
+// OAuthTokenSource refreshes STEX personal access token with the OAuth2 refresh token grant
+// shortly before it expires and keeps the result in Store
+type OAuthTokenSource struct {
+	ClientID     string
+	ClientSecret string
+	Scope        string
+	TokenURL     string
+	HTTPClient   *http.Client
+	Store        TokenStore
+	// Token is refreshed when it expires within this interval
+	RefreshBefore time.Duration
+	// Logger reports failures to save the refreshed token, nil disables it
+	Logger *log.Logger
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// NewOAuthTokenSource creates token source with the initial token. If token is nil it is loaded from store.
+func NewOAuthTokenSource(clientID, clientSecret string, token *Token, store TokenStore) *OAuthTokenSource {
+	return &OAuthTokenSource{
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		TokenURL:      "https://api3.stex.com/oauth/token",
+		HTTPClient:    http.DefaultClient,
+		Store:         store,
+		RefreshBefore: time.Minute,
+		Logger:        log.New(os.Stderr, "Stex-golang-oauth ", log.LstdFlags),
+		token:         token,
+	}
+}
+
+// Token returns current token, refreshing it if it is about to expire
+func (s *OAuthTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == nil && s.Store != nil {
+		t, err := s.Store.Load()
+		if err != nil {
+			return nil, err
+		}
+		s.token = t
+	}
+
+	if !s.token.expired(s.RefreshBefore) {
+		return s.token, nil
+	}
+
+	return s.refresh(ctx)
+}
+
+// Refresh obtains a new token regardless of the expiry of the current one, unless the current token
+// is not the rejected one anymore. Empty rejected always refreshes.
+// Concurrent calls are serialised, the later ones see the token obtained by the first.
+func (s *OAuthTokenSource) Refresh(ctx context.Context, rejected string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rejected != "" && s.token != nil && s.token.AccessToken != rejected {
+		return s.token, nil
+	}
+
+	return s.refresh(ctx)
+}
+
+func (s *OAuthTokenSource) refresh(ctx context.Context) (*Token, error) {
+	if s.token == nil || s.token.RefreshToken == "" {
+		return nil, fmt.Errorf("refresh_token not init")
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", s.token.RefreshToken)
+	form.Set("client_id", s.ClientID)
+	form.Set("client_secret", s.ClientSecret)
+	if s.Scope != "" {
+		form.Set("scope", s.Scope)
+	}
+
+	req, err := http.NewRequest("POST", s.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	httpClient := s.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 400 {
+		apiErr, _ := newAPIError(&request{method: "POST", endpoint: s.TokenURL}, res, data)
+		return nil, apiErr
+	}
+
+	grant := struct {
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int64  `json:"expires_in"`
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}{}
+
+	err = json.Unmarshal(data, &grant)
+	if err != nil {
+		return nil, err
+	}
+
+	if grant.AccessToken == "" {
+		return nil, fmt.Errorf("access_token not found in response")
+	}
+
+	t := &Token{
+		AccessToken:  grant.AccessToken,
+		TokenType:    grant.TokenType,
+		RefreshToken: grant.RefreshToken,
+	}
+	if t.RefreshToken == "" {
+		t.RefreshToken = s.token.RefreshToken
+	}
+	if grant.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(grant.ExpiresIn) * time.Second)
+	}
+
+	s.token = t
+
+	// The token is valid even if it was not saved, the next refresh saves it again
+	if s.Store != nil {
+		err = s.Store.Save(t)
+		if err != nil && s.Logger != nil {
+			s.Logger.Printf("failed to save token: %s", err)
+		}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,194 @@
+package stex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTokenServer serves the token endpoint and an authenticated /profile/info accepting only the last issued token
+func newTokenServer() (*httptest.Server, *int32) {
+	var (
+		mu      sync.Mutex
+		current = "access-0"
+		grants  int32
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "refresh" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"success":false,"message":"invalid_grant"}`))
+			return
+		}
+		// Slow grant lets concurrent refreshes overlap
+		time.Sleep(20 * time.Millisecond)
+		n := atomic.AddInt32(&grants, 1)
+
+		mu.Lock()
+		current = fmt.Sprintf("access-%d", n)
+		mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"access_token": current,
+		})
+	})
+	mux.HandleFunc("/profile/info", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ok := r.Header.Get("Authorization") == "Bearer "+current
+		mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"success":false,"message":"Unauthenticated."}`))
+			return
+		}
+		w.Write([]byte(`{"success":true,"data":{"user_id":1}}`))
+	})
+
+	return httptest.NewServer(mux), &grants
+}
+
+type failingTokenStore struct{}
+
+func (failingTokenStore) Load() (*Token, error) { return nil, nil }
+func (failingTokenStore) Save(t *Token) error   { return fmt.Errorf("disk full") }
+
+func TestOAuthTokenSourceToken(t *testing.T) {
+	srv, grants := newTokenServer()
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		token  *Token
+		want   string
+		grants int32
+	}{
+		{name: "valid", token: &Token{AccessToken: "access-0", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}, want: "access-0"},
+		{name: "no expiry", token: &Token{AccessToken: "access-0", RefreshToken: "refresh"}, want: "access-0"},
+		{name: "expiring", token: &Token{AccessToken: "access-0", RefreshToken: "refresh", Expiry: time.Now().Add(time.Second)}, want: "access-1", grants: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(grants, 0)
+			s := NewOAuthTokenSource("id", "secret", tt.token, nil)
+			s.TokenURL = srv.URL + "/oauth/token"
+
+			tok, err := s.Token(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok.AccessToken != tt.want {
+				t.Errorf("token = %s, want %s", tok.AccessToken, tt.want)
+			}
+			if tok.RefreshToken != "refresh" {
+				t.Errorf("refresh token %q is not kept", tok.RefreshToken)
+			}
+			if n := atomic.LoadInt32(grants); n != tt.grants {
+				t.Errorf("grants = %d, want %d", n, tt.grants)
+			}
+		})
+	}
+}
+
+func TestOAuthTokenSourceRefreshOnUnauthorized(t *testing.T) {
+	srv, grants := newTokenServer()
+	defer srv.Close()
+
+	// The server rejects the stale token, it is refreshed once for all concurrent requests
+	s := NewOAuthTokenSource("id", "secret", &Token{AccessToken: "stale", RefreshToken: "refresh"}, failingTokenStore{})
+	s.TokenURL = srv.URL + "/oauth/token"
+	s.Logger = nil
+
+	c := NewClient("")
+	c.BaseURL = srv.URL
+	c.TokenSource = s
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.callAPI(context.Background(), &request{method: "GET", endpoint: "/profile/info", secType: secTypeAPIKey})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("request failed: %s", err)
+		}
+	}
+	if n := atomic.LoadInt32(grants); n != 1 {
+		t.Errorf("grants = %d, want a single refresh", n)
+	}
+}
+
+func TestOAuthTokenSourceRefreshError(t *testing.T) {
+	srv, _ := newTokenServer()
+	defer srv.Close()
+
+	s := NewOAuthTokenSource("id", "secret", &Token{AccessToken: "a", RefreshToken: "revoked"}, nil)
+	s.TokenURL = srv.URL + "/oauth/token"
+
+	_, err := s.Refresh(context.Background(), "")
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Refresh() error = %v, want 400 APIError", err)
+	}
+
+	s = NewOAuthTokenSource("id", "secret", &Token{AccessToken: "a"}, nil)
+	if _, err = s.Refresh(context.Background(), ""); err == nil {
+		t.Error("Refresh() without refresh token succeeded")
+	}
+}
+
+func TestFileTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stex-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &FileTokenStore{Path: filepath.Join(dir, "token.json")}
+
+	tok, err := s.Load()
+	if err != nil || tok != nil {
+		t.Fatalf("Load() of missing file = %v, %v", tok, err)
+	}
+
+	want := &Token{AccessToken: "a", TokenType: "Bearer", RefreshToken: "r", Expiry: time.Unix(1600000000, 0).UTC()}
+	if err = s.Save(want); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("mode = %s, want 0600", fi.Mode().Perm())
+	}
+
+	tok, err = s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *tok != *want {
+		t.Errorf("Load() = %+v, want %+v", tok, want)
+	}
+}
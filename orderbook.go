@@ -10,22 +10,22 @@ import (
 
 type Order struct {
 	CurrencyPairId   int     `json:"currency_pair_id"`
-	Amount           string  `json:"amount"`
-	Price            string  `json:"price"`
-	Amount2          string  `json:"amount2"`
+	Amount           Decimal `json:"amount"`
+	Price            Decimal `json:"price"`
+	Amount2          Decimal `json:"amount2"`
 	Count            int     `json:"count"`
-	CumulativeAmount float64 `json:"cumulative_amount"`
+	CumulativeAmount Decimal `json:"cumulative_amount"`
 }
 
 func (o *Order) Fields() logrus.Fields {
 	return logrus.Fields{
 		"order_book": map[string]interface{}{
 			"currency_pair_id":  o.CurrencyPairId,
-			"amount":            o.Amount,
-			"price":             o.Price,
-			"amount2":           o.Amount2,
+			"amount":            o.Amount.String(),
+			"price":             o.Price.String(),
+			"amount2":           o.Amount2.String(),
 			"count":             o.Count,
-			"cumulative_amount": o.CumulativeAmount,
+			"cumulative_amount": o.CumulativeAmount.String(),
 		},
 	}
 }
@@ -33,8 +33,8 @@ func (o *Order) Fields() logrus.Fields {
 type OrderBook struct {
 	Ask            []Order `json:"ask"`
 	Bid            []Order `json:"bid"`
-	AskTotalAmount float64 `json:"ask_total_amount"`
-	BidTotalAmount float64 `json:"bid_total_amount"`
+	AskTotalAmount Decimal `json:"ask_total_amount"`
+	BidTotalAmount Decimal `json:"bid_total_amount"`
 }
 
 type CurrencyPairOrderbookService struct {
@@ -0,0 +1,741 @@
+package stex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Period of group checks besides order updates of the tracker
+const orderGroupCheckInterval = 5 * time.Second
+
+// Orders created this long before a placing attempt are still adopted on restart, covers clock skew
+const orderGroupAdoptSkew = time.Minute
+
+type OrderGroupType string
+
+const (
+	OrderGroupOCO     OrderGroupType = "oco"
+	OrderGroupBracket OrderGroupType = "bracket"
+)
+
+type OrderGroupStatus string
+
+const (
+	// OrderGroupPending waits for the first fill of the bracket entry
+	OrderGroupPending   OrderGroupStatus = "pending"
+	OrderGroupActive    OrderGroupStatus = "active"
+	OrderGroupDone      OrderGroupStatus = "done"
+	OrderGroupCancelled OrderGroupStatus = "cancelled"
+)
+
+type OrderLegRole string
+
+const (
+	OrderLegFirst      OrderLegRole = "first"
+	OrderLegSecond     OrderLegRole = "second"
+	OrderLegEntry      OrderLegRole = "entry"
+	OrderLegTakeProfit OrderLegRole = "take_profit"
+	OrderLegStopLoss   OrderLegRole = "stop_loss"
+)
+
+// LegOrder define one exchange order of a leg
+type LegOrder struct {
+	Id     int64       `json:"id"`
+	Amount Decimal     `json:"amount"`
+	Filled Decimal     `json:"filled"`
+	Status OrderStatus `json:"status"`
+	// Cancelling is set when deletion was requested
+	Cancelling bool `json:"cancelling"`
+}
+
+func (o *LegOrder) live() bool {
+	return !orderStatusDone(o.Status)
+}
+
+// LegPlacing define order being created, it is kept when the result is unknown and the order is looked up on restart
+type LegPlacing struct {
+	Time   time.Time `json:"time"`
+	Amount Decimal   `json:"amount"`
+}
+
+// OrderLeg define one side of an order group. A leg is replaced by a new order when its amount has to change.
+type OrderLeg struct {
+	Role    OrderLegRole `json:"role"`
+	Request OrderRequest `json:"request"`
+	// Orders of the leg, the last one is current
+	Orders  []LegOrder  `json:"orders"`
+	Placing *LegPlacing `json:"placing,omitempty"`
+
+	// amount the exchange rejected, the leg is not placed again with it
+	rejected Decimal
+}
+
+// Filled returns amount filled by all orders of the leg
+func (l *OrderLeg) Filled() Decimal {
+	res := Decimal{}
+	for _, o := range l.Orders {
+		res = res.Add(o.Filled)
+	}
+	return res
+}
+
+// Live reports if the leg has an order in the book
+func (l *OrderLeg) Live() bool {
+	for _, o := range l.Orders {
+		if o.live() {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *OrderLeg) current() *LegOrder {
+	if len(l.Orders) == 0 {
+		return nil
+	}
+	return &l.Orders[len(l.Orders)-1]
+}
+
+func (l *OrderLeg) copy() *OrderLeg {
+	res := *l
+	res.Orders = append([]LegOrder{}, l.Orders...)
+	if l.Placing != nil {
+		placing := *l.Placing
+		res.Placing = &placing
+	}
+	return &res
+}
+
+// OrderGroup define one-cancels-other or bracket orders emulated on the client.
+// OCO legs together fill Amount at most. Bracket exits cover the filled amount of the entry.
+type OrderGroup struct {
+	Id     int64            `json:"id"`
+	Type   OrderGroupType   `json:"type"`
+	Status OrderGroupStatus `json:"status"`
+	Amount Decimal          `json:"amount"`
+	// Entry is set for brackets only
+	Entry *OrderLeg `json:"entry,omitempty"`
+	// Legs are the first and the second order of OCO or take profit and stop loss of bracket
+	Legs    []*OrderLeg `json:"legs"`
+	Created time.Time   `json:"created"`
+	Updated time.Time   `json:"updated"`
+	// Error is the last error of placing or cancelling orders of the group
+	Error string `json:"error,omitempty"`
+}
+
+// Done reports if the group has finished and has no orders in the book
+func (g *OrderGroup) Done() bool {
+	return g.Status == OrderGroupDone || (g.Status == OrderGroupCancelled && !g.live())
+}
+
+func (g *OrderGroup) legs() []*OrderLeg {
+	if g.Entry == nil {
+		return g.Legs
+	}
+	return append([]*OrderLeg{g.Entry}, g.Legs...)
+}
+
+func (g *OrderGroup) live() bool {
+	for _, leg := range g.legs() {
+		if leg.Live() || leg.Placing != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *OrderGroup) copy() *OrderGroup {
+	res := *g
+	if g.Entry != nil {
+		res.Entry = g.Entry.copy()
+	}
+	res.Legs = make([]*OrderLeg, len(g.Legs))
+	for i, leg := range g.Legs {
+		res.Legs[i] = leg.copy()
+	}
+	return &res
+}
+
+// orderGroupState is the content of the state file
+type orderGroupState struct {
+	Seq    int64         `json:"seq"`
+	Groups []*OrderGroup `json:"groups"`
+}
+
+// OrderGroupManager emulates OCO and bracket orders. It places the legs, follows their fills with
+// OrderTracker and cancels or resizes the sibling legs with OrderDeleteService and CreateOrderService.
+//
+// Partial fills are handled by keeping the amount left in the book of every exit leg equal to the amount
+// still to be covered. A leg with another amount left is cancelled and placed again for the right amount.
+type OrderGroupManager struct {
+	c       *Client
+	tracker *OrderTracker
+
+	path *string
+	f    func(OrderGroup)
+
+	// run serializes changes of groups and the requests made for them
+	run sync.Mutex
+
+	mu     sync.Mutex
+	seq    int64
+	groups map[int64]*OrderGroup
+
+	kick chan struct{}
+}
+
+// NewOrderGroupManager returns manager of the account of c, w must be connected
+func NewOrderGroupManager(c *Client, w *WssClient) *OrderGroupManager {
+	m := &OrderGroupManager{
+		c:      c,
+		groups: map[int64]*OrderGroup{},
+		kick:   make(chan struct{}, 1),
+	}
+	m.tracker = NewOrderTracker(c, w).OnUpdate(func(TrackedOrder) { m.checkSoon() })
+	return m
+}
+
+// UserId sets user id, by default it is taken from ProfileInfoService
+func (m *OrderGroupManager) UserId(user_id int64) *OrderGroupManager {
+	m.tracker.UserId(user_id)
+	return m
+}
+
+// CurrencyPairIds sets pairs of the groups
+func (m *OrderGroupManager) CurrencyPairIds(pair_ids ...int) *OrderGroupManager {
+	m.tracker.CurrencyPairIds(pair_ids...)
+	return m
+}
+
+// ReconcileInterval sets period of REST checks of the orders, default is 30s
+func (m *OrderGroupManager) ReconcileInterval(interval time.Duration) *OrderGroupManager {
+	m.tracker.ReconcileInterval(interval)
+	return m
+}
+
+// StatePath sets file the groups are saved to after every change and restored from by Do
+func (m *OrderGroupManager) StatePath(path string) *OrderGroupManager {
+	m.path = &path
+	return m
+}
+
+// OnUpdate sets callback called after every change of a group.
+// It runs while groups are processed and must not call PlaceOCO, PlaceBracket or Cancel.
+func (m *OrderGroupManager) OnUpdate(f func(OrderGroup)) *OrderGroupManager {
+	m.f = f
+	return m
+}
+
+// Tracker returns tracker of the group orders
+func (m *OrderGroupManager) Tracker() *OrderTracker {
+	return m.tracker
+}
+
+// Do restores saved groups, starts tracking their orders and keeps the groups consistent until ctx is cancelled.
+// Orders of restored groups are checked with REST first, so legs filled or placed while the process was down are handled.
+func (m *OrderGroupManager) Do(ctx context.Context) error {
+	err := m.load()
+	if err != nil {
+		return err
+	}
+
+	err = m.tracker.Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range m.Groups() {
+		for _, leg := range g.legs() {
+			for _, o := range leg.Orders {
+				if !o.live() {
+					continue
+				}
+				info, err := m.c.NewOrderInfoService().OrderId(o.Id).Do(ctx)
+				if err != nil {
+					return err
+				}
+				m.tracker.Track(*info)
+			}
+		}
+	}
+
+	m.check(ctx)
+
+	go func() {
+		ticker := time.NewTicker(orderGroupCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-m.kick:
+			}
+			m.check(ctx)
+		}
+	}()
+
+	return nil
+}
+
+// PlaceOCO places two orders of the same pair, side and amount, e.g. take profit SELL and stop loss STOP_LIMIT_SELL.
+// Fills of one leg reduce the other, it is cancelled when the amount is filled.
+func (m *OrderGroupManager) PlaceOCO(ctx context.Context, first, second OrderRequest) (OrderGroup, error) {
+	if first.CurrencyPairId != second.CurrencyPairId {
+		return OrderGroup{}, fmt.Errorf("legs of different pairs")
+	}
+	if orderTypeBuy(first.Type) != orderTypeBuy(second.Type) {
+		return OrderGroup{}, fmt.Errorf("legs of different sides")
+	}
+	if !first.Amount.IsPositive() || !first.Amount.Equal(second.Amount) {
+		return OrderGroup{}, fmt.Errorf("legs must have the same positive amount")
+	}
+
+	return m.add(ctx, &OrderGroup{
+		Type:   OrderGroupOCO,
+		Status: OrderGroupActive,
+		Amount: first.Amount,
+		Legs: []*OrderLeg{
+			{Role: OrderLegFirst, Request: first},
+			{Role: OrderLegSecond, Request: second},
+		},
+	})
+}
+
+// PlaceBracket places entry order and, as it fills, take profit and stop loss of the opposite side as OCO.
+// Amounts of the exits follow the filled amount of the entry, their Amount is ignored.
+func (m *OrderGroupManager) PlaceBracket(ctx context.Context, entry, take_profit, stop_loss OrderRequest) (OrderGroup, error) {
+	if entry.CurrencyPairId != take_profit.CurrencyPairId || entry.CurrencyPairId != stop_loss.CurrencyPairId {
+		return OrderGroup{}, fmt.Errorf("legs of different pairs")
+	}
+	if orderTypeBuy(entry.Type) == orderTypeBuy(take_profit.Type) || orderTypeBuy(entry.Type) == orderTypeBuy(stop_loss.Type) {
+		return OrderGroup{}, fmt.Errorf("exits must be of the opposite side of entry")
+	}
+	if !entry.Amount.IsPositive() {
+		return OrderGroup{}, fmt.Errorf("entry amount must be positive")
+	}
+
+	take_profit.Amount = Decimal{}
+	stop_loss.Amount = Decimal{}
+
+	return m.add(ctx, &OrderGroup{
+		Type:   OrderGroupBracket,
+		Status: OrderGroupPending,
+		Amount: entry.Amount,
+		Entry:  &OrderLeg{Role: OrderLegEntry, Request: entry},
+		Legs: []*OrderLeg{
+			{Role: OrderLegTakeProfit, Request: take_profit},
+			{Role: OrderLegStopLoss, Request: stop_loss},
+		},
+	})
+}
+
+func orderTypeBuy(order_type OrderType) bool {
+	return order_type == OrderType_BUY || order_type == OrderType_STOP_LIMIT_BUY
+}
+
+// add saves new group and places its first orders. When they fail the group is cancelled and the error is returned.
+func (m *OrderGroupManager) add(ctx context.Context, g *OrderGroup) (OrderGroup, error) {
+	m.run.Lock()
+	defer m.run.Unlock()
+
+	m.mu.Lock()
+	m.seq++
+	g.Id = m.seq
+	m.mu.Unlock()
+
+	g.Created = time.Now()
+	m.put(g)
+
+	err := m.evaluate(ctx, g)
+	if err != nil {
+		g.Status = OrderGroupCancelled
+		m.evaluate(ctx, g)
+	}
+
+	return *g.copy(), err
+}
+
+// Cancel cancels all orders of group id, filled amounts stay as they are
+func (m *OrderGroupManager) Cancel(ctx context.Context, id int64) error {
+	m.run.Lock()
+	defer m.run.Unlock()
+
+	g, ok := m.group(id)
+	if !ok {
+		return fmt.Errorf("order group %d: %w", id, ErrNotFound)
+	}
+	if g.Status == OrderGroupDone || g.Status == OrderGroupCancelled {
+		return nil
+	}
+
+	g.Status = OrderGroupCancelled
+	return m.evaluate(ctx, g)
+}
+
+// Group returns group id
+func (m *OrderGroupManager) Group(id int64) (OrderGroup, bool) {
+	g, ok := m.group(id)
+	if !ok {
+		return OrderGroup{}, false
+	}
+	return *g, true
+}
+
+// group returns copy of group id
+func (m *OrderGroupManager) group(id int64) (*OrderGroup, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, ok := m.groups[id]
+	if !ok {
+		return nil, false
+	}
+	return g.copy(), true
+}
+
+// Groups returns all groups sorted by id
+func (m *OrderGroupManager) Groups() []OrderGroup {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := []OrderGroup{}
+	for _, g := range m.groups {
+		res = append(res, *g.copy())
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Id < res[j].Id })
+	return res
+}
+
+func (m *OrderGroupManager) checkSoon() {
+	select {
+	case m.kick <- struct{}{}:
+	default:
+	}
+}
+
+// check evaluates groups which are not done
+func (m *OrderGroupManager) check(ctx context.Context) {
+	m.run.Lock()
+	defer m.run.Unlock()
+
+	for _, g := range m.Groups() {
+		if g.Done() {
+			continue
+		}
+		g := g.copy()
+		if err := m.evaluate(ctx, g); err != nil {
+			m.c.debug("order group %d: %s", g.Id, err)
+		}
+	}
+}
+
+// put stores copy of g, when it changed the state is saved and the change is reported
+func (m *OrderGroupManager) put(g *OrderGroup) {
+	m.mu.Lock()
+	prev := m.groups[g.Id]
+	changed := true
+	if prev != nil {
+		g.Updated = prev.Updated
+		before, _ := json.Marshal(prev)
+		after, _ := json.Marshal(g)
+		changed = string(before) != string(after)
+	}
+	if changed {
+		g.Updated = time.Now()
+	}
+	m.groups[g.Id] = g.copy()
+	m.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if err := m.save(); err != nil {
+		m.c.debug("order group state: %s", err)
+	}
+	if m.f != nil {
+		m.f(*g.copy())
+	}
+}
+
+// evaluate brings orders of g in line with its fills, g is a working copy stored after every step
+func (m *OrderGroupManager) evaluate(ctx context.Context, g *OrderGroup) error {
+	m.refresh(g)
+
+	var res error
+	fail := func(err error) {
+		g.Error = err.Error()
+		if res == nil {
+			res = err
+		}
+	}
+
+	for _, leg := range g.legs() {
+		if leg.Placing != nil {
+			if err := m.adopt(ctx, g, leg); err != nil {
+				fail(err)
+			}
+		}
+	}
+
+	if g.Status == OrderGroupCancelled {
+		for _, leg := range g.legs() {
+			m.cancelLeg(ctx, g, leg, fail)
+		}
+		m.put(g)
+		return res
+	}
+
+	covered := g.Amount
+	entry_live := false
+	if g.Entry != nil {
+		if len(g.Entry.Orders) == 0 && g.Entry.Placing == nil {
+			if err := m.place(ctx, g, g.Entry, g.Amount); err != nil {
+				fail(err)
+				m.put(g)
+				return res
+			}
+		}
+
+		covered = g.Entry.Filled()
+		entry_live = g.Entry.Live() || g.Entry.Placing != nil
+		if !entry_live && !covered.IsPositive() {
+			g.Status = OrderGroupCancelled
+			m.put(g)
+			return res
+		}
+	}
+
+	exits := Decimal{}
+	for _, leg := range g.Legs {
+		exits = exits.Add(leg.Filled())
+	}
+
+	target := covered.Sub(exits)
+	if target.IsNegative() {
+		fail(fmt.Errorf("legs overfilled by %s", target.Neg()))
+		target = Decimal{}
+	}
+
+	for _, leg := range g.Legs {
+		if leg.Placing != nil {
+			continue
+		}
+
+		if leg.Live() {
+			cur := leg.current()
+			if cur.live() && !cur.Amount.Sub(cur.Filled).Equal(target) {
+				m.cancelLeg(ctx, g, leg, fail)
+			}
+			continue
+		}
+
+		// A finished order completes its leg, its trades may still be loading and placing the rest again would double it
+		if cur := leg.current(); cur != nil && cur.Status == OrderStatus_FINISHED {
+			continue
+		}
+
+		if target.IsPositive() && !target.Equal(leg.rejected) {
+			if err := m.place(ctx, g, leg, target); err != nil {
+				fail(err)
+			}
+		}
+	}
+
+	switch {
+	case !target.IsPositive() && !entry_live && !g.live():
+		g.Status = OrderGroupDone
+	case g.Entry != nil && !covered.IsPositive():
+		g.Status = OrderGroupPending
+	default:
+		g.Status = OrderGroupActive
+	}
+
+	m.put(g)
+	return res
+}
+
+// refresh takes status and fills of the group orders from the tracker
+func (m *OrderGroupManager) refresh(g *OrderGroup) {
+	for _, leg := range g.legs() {
+		for i := range leg.Orders {
+			o := &leg.Orders[i]
+			if t, ok := m.tracker.Order(o.Id); ok {
+				filled, _ := t.filled()
+				o.Status = t.Status
+				o.Filled = MaxDecimal(o.Filled, filled)
+			}
+			// A finished order is filled completely even before its trades are loaded
+			if o.Status == OrderStatus_FINISHED {
+				o.Filled = MaxDecimal(o.Filled, o.Amount)
+			}
+		}
+	}
+}
+
+// cancelLeg requests deletion of live orders of leg
+func (m *OrderGroupManager) cancelLeg(ctx context.Context, g *OrderGroup, leg *OrderLeg, fail func(error)) {
+	for i := range leg.Orders {
+		o := &leg.Orders[i]
+		if !o.live() || o.Cancelling {
+			continue
+		}
+
+		_, err := m.c.NewOrderDeleteService().OrderId(o.Id).Do(ctx)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		o.Cancelling = true
+		m.tracker.reconcileSoon()
+	}
+}
+
+// place creates order of leg for amount. The attempt is saved first, so an order created
+// just before a crash is adopted on restart instead of being left in the book.
+func (m *OrderGroupManager) place(ctx context.Context, g *OrderGroup, leg *OrderLeg, amount Decimal) error {
+	leg.Placing = &LegPlacing{Time: time.Now(), Amount: amount}
+	m.put(g)
+
+	s := m.c.NewCreateOrderService().CurrencyPairId(leg.Request.CurrencyPairId).OrderType(leg.Request.Type).
+		Amount(amount).Price(leg.Request.Price)
+	if leg.Request.TriggerPrice != nil {
+		s.TriggerPrice(*leg.Request.TriggerPrice)
+	}
+
+	info, err := s.Do(ctx)
+	if err != nil {
+		// The order was surely not created, otherwise it is looked up by adopt
+		if rejected(err) {
+			leg.Placing = nil
+			leg.rejected = amount
+		}
+		return err
+	}
+
+	leg.Placing = nil
+	leg.Orders = append(leg.Orders, LegOrder{Id: info.Id, Amount: amount, Filled: info.ProcessedAmount, Status: info.Status})
+	m.tracker.Track(*info)
+	m.refresh(g)
+	return nil
+}
+
+func rejected(err error) bool {
+	var api *APIError
+	if errors.As(err, &api) {
+		return api.StatusCode < 500
+	}
+	var validation *OrderValidationError
+	return errors.As(err, &validation)
+}
+
+// adopt looks for the order of an unfinished placing attempt of leg among orders created since
+func (m *OrderGroupManager) adopt(ctx context.Context, g *OrderGroup, leg *OrderLeg) error {
+	since := leg.Placing.Time.Add(-orderGroupAdoptSkew)
+
+	open, err := m.c.NewOpenOrdersListService().Pager().All(ctx)
+	if err != nil {
+		return err
+	}
+
+	history, err := m.c.NewOrdersHistoryService().CurrencyPairId(leg.Request.CurrencyPairId).TmStart(since).Pager().All(ctx)
+	if err != nil {
+		return err
+	}
+
+	known := map[int64]bool{}
+	for _, other := range m.Groups() {
+		for _, l := range other.legs() {
+			for _, o := range l.Orders {
+				known[o.Id] = true
+			}
+		}
+	}
+
+	var found *OrderInfo
+	for _, info := range append(open, history...) {
+		info := info
+		if known[info.Id] || info.CurrencyPairId != leg.Request.CurrencyPairId || info.Created.Before(since) {
+			continue
+		}
+		if info.OriginalType != leg.Request.Type && info.Type != leg.Request.Type {
+			continue
+		}
+		if !info.Price.Equal(leg.Request.Price) || !info.InitialAmount.Equal(leg.Placing.Amount) {
+			continue
+		}
+		if found == nil || info.Id > found.Id {
+			found = &info
+		}
+	}
+
+	if found != nil {
+		leg.Orders = append(leg.Orders, LegOrder{Id: found.Id, Amount: leg.Placing.Amount, Filled: found.ProcessedAmount, Status: found.Status})
+		m.tracker.Track(*found)
+		m.refresh(g)
+	}
+	leg.Placing = nil
+	m.put(g)
+	return nil
+}
+
+// load reads groups from the state file, a missing file is an empty state
+func (m *OrderGroupManager) load() error {
+	if m.path == nil {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(*m.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	state := orderGroupState{}
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.seq = state.Seq
+	for _, g := range state.Groups {
+		m.groups[g.Id] = g
+	}
+	return nil
+}
+
+// save writes all groups to the state file
+func (m *OrderGroupManager) save() error {
+	if m.path == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	state := orderGroupState{Seq: m.seq, Groups: []*OrderGroup{}}
+	for _, g := range m.groups {
+		state.Groups = append(state.Groups, g.copy())
+	}
+	m.mu.Unlock()
+
+	sort.Slice(state.Groups, func(i, j int) bool { return state.Groups[i].Id < state.Groups[j].Id })
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(*m.path, data)
+}
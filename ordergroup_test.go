@@ -0,0 +1,320 @@
+package stex_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+	"github.com/vladivolo/stex-api/stextest"
+)
+
+// tradingAccount is the "maker" account of a fake exchange with a connected websocket client
+// and a "taker" user trading against it
+type tradingAccount struct {
+	srv   *stextest.Server
+	sock  *stextest.SocketServer
+	c     *stex.Client
+	w     *stex.WssClient
+	maker int64
+	taker int64
+}
+
+func newTradingAccount(t *testing.T, ctx context.Context) *tradingAccount {
+	a := &tradingAccount{srv: stextest.NewServer(), sock: stextest.NewSocketServer()}
+	a.maker = a.srv.AddUser("maker")
+	a.taker = a.srv.AddUser("taker")
+	for _, u := range []int64{a.maker, a.taker} {
+		a.srv.SetBalance(u, "BTC", stex.MustParseDecimal("10"))
+		a.srv.SetBalance(u, "ETH", stex.MustParseDecimal("100"))
+	}
+	a.sock.AddToken("maker", a.maker)
+
+	a.c = a.srv.Client("maker")
+	w, err := a.sock.WssClient("maker").Do(ctx)
+	if err != nil {
+		a.close()
+		t.Fatal(err)
+	}
+	a.w = w
+	return a
+}
+
+func (a *tradingAccount) close() {
+	a.sock.Close()
+	a.srv.Close()
+}
+
+// trade places order of the taker
+func (a *tradingAccount) trade(t *testing.T, order_type stex.OrderType, amount, price string) {
+	_, err := a.srv.PlaceOrder(a.taker, 1, order_type, stex.MustParseDecimal(amount), stex.MustParseDecimal(price), stex.Decimal{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// openOrders returns open orders of the maker
+func (a *tradingAccount) openOrders(t *testing.T, ctx context.Context) []stex.OrderInfo {
+	open, err := a.c.NewOpenOrdersListService().Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return open
+}
+
+// waitFor polls cond until it holds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func orderRequest(order_type stex.OrderType, amount, price string) stex.OrderRequest {
+	return stex.OrderRequest{CurrencyPairId: 1, Type: order_type, Amount: stex.MustParseDecimal(amount), Price: stex.MustParseDecimal(price)}
+}
+
+func TestOrderGroupOCO(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	a := newTradingAccount(t, ctx)
+	defer a.close()
+
+	m := stex.NewOrderGroupManager(a.c, a.w).UserId(a.maker).CurrencyPairIds(1).ReconcileInterval(20 * time.Millisecond)
+	if err := m.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := m.PlaceOCO(ctx, orderRequest(stex.OrderType_SELL, "1", "0.03"), orderRequest(stex.OrderType_SELL, "1", "0.04"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Status != stex.OrderGroupActive || !g.Legs[0].Live() || !g.Legs[1].Live() {
+		t.Fatalf("placed group = %+v", g)
+	}
+
+	// A partial fill of the first leg resizes the second one to the amount left
+	a.trade(t, stex.OrderType_BUY, "0.4", "0.03")
+	waitFor(t, "second leg resized", func() bool {
+		g, _ = m.Group(g.Id)
+		orders := g.Legs[1].Orders
+		cur := orders[len(orders)-1]
+		return len(orders) == 2 && cur.Status == stex.OrderStatus_PENDING && cur.Amount.Equal(stex.MustParseDecimal("0.6"))
+	})
+
+	// The rest of the first leg fills, the second one is cancelled
+	a.trade(t, stex.OrderType_BUY, "0.6", "0.03")
+	waitFor(t, "group done", func() bool {
+		g, _ = m.Group(g.Id)
+		return g.Done()
+	})
+	if g.Status != stex.OrderGroupDone || !g.Legs[0].Filled().Equal(stex.MustParseDecimal("1")) || !g.Legs[1].Filled().IsZero() {
+		t.Errorf("done group = %+v", g)
+	}
+	if open := a.openOrders(t, ctx); len(open) != 0 {
+		t.Errorf("orders left in the book: %+v", open)
+	}
+}
+
+func TestOrderGroupBracket(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	a := newTradingAccount(t, ctx)
+	defer a.close()
+
+	m := stex.NewOrderGroupManager(a.c, a.w).UserId(a.maker).CurrencyPairIds(1).ReconcileInterval(20 * time.Millisecond)
+	if err := m.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	trigger := stex.MustParseDecimal("0.015")
+	stop := orderRequest(stex.OrderType_STOP_LIMIT_SELL, "0", "0.014")
+	stop.TriggerPrice = &trigger
+	g, err := m.PlaceBracket(ctx, orderRequest(stex.OrderType_BUY, "1", "0.02"), orderRequest(stex.OrderType_SELL, "0", "0.03"), stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Status != stex.OrderGroupPending || !g.Entry.Live() || len(g.Legs[0].Orders) != 0 {
+		t.Fatalf("placed bracket = %+v", g)
+	}
+
+	// Exits cover the filled part of the entry
+	a.trade(t, stex.OrderType_SELL, "0.5", "0.02")
+	waitFor(t, "exits placed", func() bool {
+		g, _ = m.Group(g.Id)
+		for _, leg := range g.Legs {
+			if len(leg.Orders) != 1 || !leg.Orders[0].Amount.Equal(stex.MustParseDecimal("0.5")) {
+				return false
+			}
+		}
+		return g.Status == stex.OrderGroupActive
+	})
+
+	if err = m.Cancel(ctx, g.Id); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "group cancelled", func() bool {
+		g, _ = m.Group(g.Id)
+		return g.Done()
+	})
+	if g.Status != stex.OrderGroupCancelled || !g.Entry.Filled().Equal(stex.MustParseDecimal("0.5")) {
+		t.Errorf("cancelled bracket = %+v", g)
+	}
+	if open := a.openOrders(t, ctx); len(open) != 0 {
+		t.Errorf("orders left in the book: %+v", open)
+	}
+}
+
+// The fake exchange pushes no private order events, they are pushed by the test while REST reconciliation is idle
+func TestOrderGroupWebsocketEvents(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	a := newTradingAccount(t, ctx)
+	defer a.close()
+
+	m := stex.NewOrderGroupManager(a.c, a.w).UserId(a.maker).CurrencyPairIds(1).ReconcileInterval(time.Hour)
+	if err := m.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	updates := fmt.Sprintf("private-%s_user_data_u%dc1", stex.OrderType_SELL, a.maker)
+	deletes := fmt.Sprintf("private-del_order_u%dc1", a.maker)
+	for _, channel := range []string{updates, deletes} {
+		if err := a.sock.WaitSubscribed(ctx, channel, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g, err := m.PlaceOCO(ctx, orderRequest(stex.OrderType_SELL, "1", "0.03"), orderRequest(stex.OrderType_SELL, "1", "0.04"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := g.Legs[0].Orders[0].Id
+
+	// An update with the amount left resizes the second leg
+	a.trade(t, stex.OrderType_BUY, "0.4", "0.03")
+	a.sock.Push(updates, stextest.EventUserOrder, map[string]interface{}{
+		"id": first, "user_id": a.maker, "currency_pair_id": 1, "price": "0.03", "amount": "0.6",
+	})
+	waitFor(t, "second leg resized", func() bool {
+		g, _ = m.Group(g.Id)
+		orders := g.Legs[1].Orders
+		return len(orders) == 2 && orders[1].Amount.Equal(stex.MustParseDecimal("0.6"))
+	})
+
+	// A finished first leg is filled completely before its trades are loaded and is not placed again
+	a.trade(t, stex.OrderType_BUY, "0.6", "0.03")
+	a.sock.Push(deletes, stextest.EventUserOrderDeleted, map[string]interface{}{
+		"id": first, "user_id": a.maker, "currency_pair_id": 1, "status": stex.OrderStatus_FINISHED,
+	})
+	waitFor(t, "group done", func() bool {
+		g, _ = m.Group(g.Id)
+		return g.Done()
+	})
+	if g.Status != stex.OrderGroupDone || len(g.Legs[0].Orders) != 1 || !g.Legs[0].Filled().Equal(stex.MustParseDecimal("1")) || !g.Legs[1].Filled().IsZero() {
+		t.Errorf("done group = %+v", g)
+	}
+	if open := a.openOrders(t, ctx); len(open) != 0 {
+		t.Errorf("orders left in the book: %+v", open)
+	}
+}
+
+func TestOrderGroupRestart(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	a := newTradingAccount(t, ctx)
+	defer a.close()
+
+	dir, err := ioutil.TempDir("", "stex-groups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "groups.json")
+
+	run, stop := context.WithCancel(ctx)
+	m := stex.NewOrderGroupManager(a.c, a.w).UserId(a.maker).CurrencyPairIds(1).ReconcileInterval(20 * time.Millisecond).StatePath(path)
+	if err = m.Do(run); err != nil {
+		t.Fatal(err)
+	}
+	g, err := m.PlaceOCO(ctx, orderRequest(stex.OrderType_SELL, "1", "0.03"), orderRequest(stex.OrderType_SELL, "1", "0.04"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+
+	// While the manager is down the first leg fills, the second one is left in the book
+	a.trade(t, stex.OrderType_BUY, "1", "0.03")
+
+	// and it crashed placing the first leg of another group after the order was created
+	placed, err := a.srv.PlaceOrder(a.maker, 1, stex.OrderType_SELL, stex.MustParseDecimal("1"), stex.MustParseDecimal("0.05"), stex.Decimal{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := struct {
+		Seq    int64              `json:"seq"`
+		Groups []*stex.OrderGroup `json:"groups"`
+	}{}
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &state)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Seq++
+	state.Groups = append(state.Groups, &stex.OrderGroup{
+		Id: state.Seq, Type: stex.OrderGroupOCO, Status: stex.OrderGroupActive, Amount: stex.MustParseDecimal("1"),
+		Legs: []*stex.OrderLeg{
+			{Role: stex.OrderLegFirst, Request: orderRequest(stex.OrderType_SELL, "1", "0.05"),
+				Placing: &stex.LegPlacing{Time: time.Now(), Amount: stex.MustParseDecimal("1")}},
+			{Role: stex.OrderLegSecond, Request: orderRequest(stex.OrderType_SELL, "1", "0.06")},
+		},
+		Created: time.Now(),
+	})
+	if data, err = json.Marshal(state); err == nil {
+		err = ioutil.WriteFile(path, data, 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := a.sock.WssClient("maker").Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = stex.NewOrderGroupManager(a.c, w).UserId(a.maker).CurrencyPairIds(1).ReconcileInterval(20 * time.Millisecond).StatePath(path)
+	if err = m.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The orphaned second leg is cancelled, the created order is adopted and the other leg placed
+	var next stex.OrderGroup
+	waitFor(t, "groups restored", func() bool {
+		g, _ = m.Group(g.Id)
+		next, _ = m.Group(state.Seq)
+		return g.Done() && len(next.Legs[0].Orders) == 1 && len(next.Legs[1].Orders) == 1
+	})
+	if g.Status != stex.OrderGroupDone || !g.Legs[0].Filled().Equal(stex.MustParseDecimal("1")) || g.Legs[1].Live() {
+		t.Errorf("group filled while down = %+v", g)
+	}
+	if next.Legs[0].Placing != nil || next.Legs[0].Orders[0].Id != placed.Id {
+		t.Errorf("first leg = %+v, want adopted order %d", next.Legs[0], placed.Id)
+	}
+
+	open := a.openOrders(t, ctx)
+	ids := map[int64]bool{}
+	for _, o := range open {
+		ids[o.Id] = true
+	}
+	if len(open) != 2 || !ids[placed.Id] || !ids[next.Legs[1].Orders[0].Id] {
+		t.Errorf("open orders = %+v", open)
+	}
+}
@@ -9,14 +9,14 @@ import (
 type OrderInfo struct {
 	Id              int64       `json:"id"`
 	CurrencyPairId  int         `json:"currency_pair_id"`
-	Price           string      `json:"price"`
-	TriggerPrice    float64     `json:"trigger_price"`
-	InitialAmount   string      `json:"initial_amount"`
-	ProcessedAmount string      `json:"processed_amount"`
+	Price           Decimal     `json:"price"`
+	TriggerPrice    Decimal     `json:"trigger_price"`
+	InitialAmount   Decimal     `json:"initial_amount"`
+	ProcessedAmount Decimal     `json:"processed_amount"`
 	Type            OrderType   `json:"type"`
 	OriginalType    OrderType   `json:"original_type"`
-	Created         string      `json:"created"`
-	Timestamp       interface{} `json:"timestamp"`
+	Created         Time        `json:"created"`
+	Timestamp       Time        `json:"timestamp"`
 	Status          OrderStatus `json:"status"`
 }
 
@@ -215,9 +215,9 @@ type CreateOrderService struct {
 	pair_id *int
 
 	order_type    *OrderType //(BUY / SELL / STOP_LIMIT_BUY / STOP_LIMIT_SELL)
-	amount        *string
-	price         *string
-	trigger_price *string
+	amount        *Decimal
+	price         *Decimal
+	trigger_price *Decimal
 }
 
 // Do send request
@@ -258,6 +258,25 @@ func (s *CreateOrderService) Do(ctx context.Context, opts ...RequestOption) (*Or
 		}
 	}
 
+	if s.c.Validator != nil {
+		order, err := s.c.Validator.Validate(ctx, OrderRequest{
+			CurrencyPairId: *s.pair_id,
+			Type:           *s.order_type,
+			Amount:         *s.amount,
+			Price:          *s.price,
+			TriggerPrice:   s.trigger_price,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		r.setFormParam("amount", order.Amount)
+		r.setFormParam("price", order.Price)
+		if order.TriggerPrice != nil {
+			r.setFormParam("trigger_price", *order.TriggerPrice)
+		}
+	}
+
 	data, err := s.c.callAPI(ctx, r, opts...)
 	if err != nil {
 		return nil, err
@@ -286,17 +305,17 @@ func (s *CreateOrderService) OrderType(order_type OrderType) *CreateOrderService
 	return s
 }
 
-func (s *CreateOrderService) Amount(amount string) *CreateOrderService {
+func (s *CreateOrderService) Amount(amount Decimal) *CreateOrderService {
 	s.amount = &amount
 	return s
 }
 
-func (s *CreateOrderService) Price(price string) *CreateOrderService {
+func (s *CreateOrderService) Price(price Decimal) *CreateOrderService {
 	s.price = &price
 	return s
 }
 
-func (s *CreateOrderService) TriggerPrice(price string) *CreateOrderService {
+func (s *CreateOrderService) TriggerPrice(price Decimal) *CreateOrderService {
 	s.trigger_price = &price
 	return s
 }
@@ -309,9 +328,13 @@ type OrderInfoService struct {
 
 // Do send request
 func (s *OrderInfoService) Do(ctx context.Context, opts ...RequestOption) (*OrderInfo, error) {
+	if s.order_id == nil {
+		return nil, fmt.Errorf("order_id not init")
+	}
+
 	r := &request{
 		method:   "GET",
-		endpoint: fmt.Sprintf("/trading/order/%d", s.order_id),
+		endpoint: fmt.Sprintf("/trading/order/%d", *s.order_id),
 		secType:  secTypeAPIKey,
 	}
 
@@ -9,10 +9,12 @@ import (
 type TradeOrder struct {
 	UserId         int64     `json:"user_id"`
 	CurrencyPairId int       `json:"currency_pair_id"`
-	Price          string    `json:"price"`
-	Amount         string    `json:"amount"`
-	Amount2        float64   `json:"amount2"`
-	Date           string    `json:"date"`
+	BuyOrderId     int64     `json:"buy_order_id"`
+	SellOrderId    int64     `json:"sell_order_id"`
+	Price          Decimal   `json:"price"`
+	Amount         Decimal   `json:"amount"`
+	Amount2        Decimal   `json:"amount2"`
+	Date           Time      `json:"date"`
 	OrderType      OrderType `json:"order_type"`
 }
 
@@ -24,12 +26,12 @@ type DeleteOrder struct {
 }
 
 type UpdateOrder struct {
-	Id             int64  `json:"id"`
-	UserId         int64  `json:"user_id"`
-	CurrencyPairId int    `json:"currency_pair_id"`
-	Price          string `json:"price"`
-	Amount         string `json:"amount"`
-	Amount2        string `json:"amount2"`
+	Id             int64   `json:"id"`
+	UserId         int64   `json:"user_id"`
+	CurrencyPairId int     `json:"currency_pair_id"`
+	Price          Decimal `json:"price"`
+	Amount         Decimal `json:"amount"`
+	Amount2        Decimal `json:"amount2"`
 }
 
 type WebsocketUserOrderFillChannelService struct {
@@ -39,6 +41,11 @@ type WebsocketUserOrderFillChannelService struct {
 	currency_pair_id *int
 
 	f func(string, TradeOrder)
+
+	channel    string
+	handler_id int64
+
+	streamConfig
 }
 
 func (s *WebsocketUserOrderFillChannelService) Do() error {
@@ -52,17 +59,20 @@ func (s *WebsocketUserOrderFillChannelService) Do() error {
 
 	channel := fmt.Sprintf("private-trade_u%dc%d", *s.user_id, *s.currency_pair_id)
 
-	err := s.c.Subscribe(channel, true)
+	handler_id, err := s.c.handle("App\\\\Events\\\\UserOrderFillCreated", channel, func(h *ws.Channel, msg TradeOrder) {
+		s.f("private-trade", msg)
+	})
 	if err != nil {
 		return err
 	}
 
-	err = s.c.C().On("App\\\\Events\\\\UserOrderFillCreated", func(h *ws.Channel, msg TradeOrder) {
-		s.f("private-trade", msg)
-	})
+	err = s.c.Subscribe(channel, true)
 	if err != nil {
+		s.c.removeHandler(handler_id)
 		return err
 	}
+	s.handler_id = handler_id
+	s.channel = channel
 
 	return nil
 }
@@ -82,6 +92,26 @@ func (s *WebsocketUserOrderFillChannelService) OnMessage(f func(string, TradeOrd
 	return s
 }
 
+// Unsubscribe stops calls of OnMessage and releases the channel subscription, the Stream channel is closed
+func (s *WebsocketUserOrderFillChannelService) Unsubscribe() error {
+	if s.stream != nil {
+		return s.stream.close()
+	}
+	return s.unsubscribe()
+}
+
+func (s *WebsocketUserOrderFillChannelService) unsubscribe() error {
+	if s.channel == "" {
+		return fmt.Errorf("not subscribed")
+	}
+
+	s.c.removeHandler(s.handler_id)
+	channel := s.channel
+	s.channel = ""
+
+	return s.c.Unsubscribe(channel)
+}
+
 /****************************************************************************************************************************************************/
 
 type WebsocketUserOrderDeletedChannelService struct {
@@ -91,6 +121,11 @@ type WebsocketUserOrderDeletedChannelService struct {
 	currency_pair_id *int
 
 	f func(string, DeleteOrder)
+
+	channel    string
+	handler_id int64
+
+	streamConfig
 }
 
 func (s *WebsocketUserOrderDeletedChannelService) Do() error {
@@ -104,17 +139,20 @@ func (s *WebsocketUserOrderDeletedChannelService) Do() error {
 
 	channel := fmt.Sprintf("private-del_order_u%dc%d", *s.user_id, *s.currency_pair_id)
 
-	err := s.c.Subscribe(channel, true)
+	handler_id, err := s.c.handle("App\\\\Events\\\\UserOrderDeleted", channel, func(h *ws.Channel, msg DeleteOrder) {
+		s.f("private-delete", msg)
+	})
 	if err != nil {
 		return err
 	}
 
-	err = s.c.C().On("App\\\\Events\\\\UserOrderDeleted", func(h *ws.Channel, msg DeleteOrder) {
-		s.f("private-delete", msg)
-	})
+	err = s.c.Subscribe(channel, true)
 	if err != nil {
+		s.c.removeHandler(handler_id)
 		return err
 	}
+	s.handler_id = handler_id
+	s.channel = channel
 
 	return nil
 }
@@ -134,6 +172,26 @@ func (s *WebsocketUserOrderDeletedChannelService) OnMessage(f func(string, Delet
 	return s
 }
 
+// Unsubscribe stops calls of OnMessage and releases the channel subscription, the Stream channel is closed
+func (s *WebsocketUserOrderDeletedChannelService) Unsubscribe() error {
+	if s.stream != nil {
+		return s.stream.close()
+	}
+	return s.unsubscribe()
+}
+
+func (s *WebsocketUserOrderDeletedChannelService) unsubscribe() error {
+	if s.channel == "" {
+		return fmt.Errorf("not subscribed")
+	}
+
+	s.c.removeHandler(s.handler_id)
+	channel := s.channel
+	s.channel = ""
+
+	return s.c.Unsubscribe(channel)
+}
+
 /****************************************************************************************************************************************************/
 
 type WebsocketUserOrderUpdateChannelService struct {
@@ -144,6 +202,11 @@ type WebsocketUserOrderUpdateChannelService struct {
 	order_type       *OrderType
 
 	f func(OrderType, UpdateOrder)
+
+	channel    string
+	handler_id int64
+
+	streamConfig
 }
 
 func (s *WebsocketUserOrderUpdateChannelService) Do() error {
@@ -160,17 +223,20 @@ func (s *WebsocketUserOrderUpdateChannelService) Do() error {
 	}
 
 	channel := fmt.Sprintf("private-%s_user_data_u%dc%d", *s.order_type, *s.user_id, *s.currency_pair_id)
-	err := s.c.Subscribe(channel, true)
+	handler_id, err := s.c.handle("App\\\\Events\\\\UserOrder", channel, func(h *ws.Channel, msg UpdateOrder) {
+		s.f(*s.order_type, msg)
+	})
 	if err != nil {
 		return err
 	}
 
-	err = s.c.C().On("App\\\\Events\\\\UserOrder", func(h *ws.Channel, msg UpdateOrder) {
-		s.f(*s.order_type, msg)
-	}, channel)
+	err = s.c.Subscribe(channel, true)
 	if err != nil {
+		s.c.removeHandler(handler_id)
 		return err
 	}
+	s.handler_id = handler_id
+	s.channel = channel
 
 	return nil
 }
@@ -194,3 +260,23 @@ func (s *WebsocketUserOrderUpdateChannelService) OnMessage(f func(OrderType, Upd
 	s.f = f
 	return s
 }
+
+// Unsubscribe stops calls of OnMessage and releases the channel subscription, the Stream channel is closed
+func (s *WebsocketUserOrderUpdateChannelService) Unsubscribe() error {
+	if s.stream != nil {
+		return s.stream.close()
+	}
+	return s.unsubscribe()
+}
+
+func (s *WebsocketUserOrderUpdateChannelService) unsubscribe() error {
+	if s.channel == "" {
+		return fmt.Errorf("not subscribed")
+	}
+
+	s.c.removeHandler(s.handler_id)
+	channel := s.channel
+	s.channel = ""
+
+	return s.c.Unsubscribe(channel)
+}
@@ -0,0 +1,545 @@
+package stex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrOrderCancelled is returned by WaitFilled when the order was cancelled
+var ErrOrderCancelled = errors.New("stex: order cancelled")
+
+// Consecutive reconciles an order must disagree with websocket state to be flagged
+const trackerMismatchStrikes = 2
+
+// TrackedOrder define state of an order kept by OrderTracker
+type TrackedOrder struct {
+	Id             int64
+	CurrencyPairId int
+	Type           OrderType
+	Price          Decimal
+	TriggerPrice   Decimal
+	InitialAmount  Decimal
+	Status         OrderStatus
+	// FilledAmount and AveragePrice come from trades of the order, ProcessedAmount of REST is used until they are fetched
+	FilledAmount Decimal
+	AveragePrice Decimal
+	Fees         []Fee
+	Created      time.Time
+	Updated      time.Time
+
+	// Statuses last reported by REST and websocket
+	RestStatus OrderStatus
+	WsStatus   OrderStatus
+	// Mismatch is set when REST and websocket states keep disagreeing, the REST state is used
+	Mismatch bool
+}
+
+// Done reports if the order left the book
+func (o *TrackedOrder) Done() bool {
+	return orderStatusDone(o.Status)
+}
+
+// filled returns filled amount and average price, a finished order is filled completely even before its trades are loaded
+func (o *TrackedOrder) filled() (Decimal, Decimal) {
+	amount, price := o.FilledAmount, o.AveragePrice
+	if o.Status == OrderStatus_FINISHED {
+		amount = MaxDecimal(amount, o.InitialAmount)
+		if !price.IsPositive() {
+			price = o.Price
+		}
+	}
+	return amount, price
+}
+
+func orderStatusDone(status OrderStatus) bool {
+	return status == OrderStatus_FINISHED || status == OrderStatus_CANCELLED
+}
+
+// OrderTransition define change of order status, Source is "rest" or "ws"
+type OrderTransition struct {
+	Order  TrackedOrder
+	From   OrderStatus
+	To     OrderStatus
+	Source string
+	Time   time.Time
+}
+
+type trackedOrder struct {
+	TrackedOrder
+
+	// amount of trades the fills were computed from
+	history_amount Decimal
+	disagree       int
+}
+
+// OrderTracker keeps state of the account orders of given pairs. It starts from open orders,
+// follows the private order channels and reconciles with REST periodically.
+type OrderTracker struct {
+	c *Client
+	w *WssClient
+
+	user_id  *int64
+	pair_ids []int
+	interval time.Duration
+
+	mu      sync.Mutex
+	orders  map[int64]*trackedOrder
+	changed chan struct{}
+
+	kick     chan struct{}
+	f        func(OrderTransition)
+	onUpdate func(TrackedOrder)
+}
+
+// NewOrderTracker returns tracker of the account of c, w must be connected
+func NewOrderTracker(c *Client, w *WssClient) *OrderTracker {
+	return &OrderTracker{
+		c:        c,
+		w:        w,
+		interval: 30 * time.Second,
+		orders:   map[int64]*trackedOrder{},
+		changed:  make(chan struct{}),
+		kick:     make(chan struct{}, 1),
+	}
+}
+
+// UserId sets user id, by default it is taken from ProfileInfoService
+func (t *OrderTracker) UserId(user_id int64) *OrderTracker {
+	t.user_id = &user_id
+	return t
+}
+
+// CurrencyPairIds sets pairs of tracked orders
+func (t *OrderTracker) CurrencyPairIds(pair_ids ...int) *OrderTracker {
+	t.pair_ids = pair_ids
+	return t
+}
+
+// ReconcileInterval sets period of REST checks, default is 30s
+func (t *OrderTracker) ReconcileInterval(interval time.Duration) *OrderTracker {
+	t.interval = interval
+	return t
+}
+
+// OnTransition sets callback called after every status change
+func (t *OrderTracker) OnTransition(f func(OrderTransition)) *OrderTracker {
+	t.f = f
+	return t
+}
+
+// OnUpdate sets callback called after every change of order status, REST status, filled amount or loaded trades
+func (t *OrderTracker) OnUpdate(f func(TrackedOrder)) *OrderTracker {
+	t.onUpdate = f
+	return t
+}
+
+// Do subscribes to the private order channels, loads open orders and keeps them up to date until ctx is cancelled.
+// When the websocket connection is lost for good the tracker goes on with REST checks only.
+func (t *OrderTracker) Do(ctx context.Context) error {
+	if len(t.pair_ids) == 0 {
+		return fmt.Errorf("pair_ids not init")
+	}
+
+	// Balances are not needed, an empty list skips wallets discovery
+	s := NewUserDataStream(t.c, t.w).CurrencyPairIds(t.pair_ids...).WalletIds([]int64{}...).
+		OrderTypes(OrderType_BUY, OrderType_SELL, OrderType_STOP_LIMIT_BUY, OrderType_STOP_LIMIT_SELL)
+	if t.user_id != nil {
+		s.UserId(*t.user_id)
+	}
+
+	sctx, cancel := context.WithCancel(ctx)
+	events, err := s.Stream(sctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	err = t.Reconcile(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	go func() {
+		defer cancel()
+
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-events:
+				if !ok {
+					events = nil
+					continue
+				}
+				t.apply(ev)
+				continue
+			case <-ticker.C:
+			case <-t.kick:
+			}
+
+			if err := t.Reconcile(ctx); err != nil {
+				t.c.debug("order tracker reconcile: %s", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Track adds order, e.g. just created by CreateOrderService
+func (t *OrderTracker) Track(info OrderInfo) {
+	t.update(info, nil, "rest")
+}
+
+// Order returns state of order id
+func (t *OrderTracker) Order(id int64) (TrackedOrder, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	o, ok := t.orders[id]
+	if !ok {
+		return TrackedOrder{}, false
+	}
+	return o.copy(), true
+}
+
+// settled reports if REST confirmed order id left the book and its trades are loaded
+func (t *OrderTracker) settled(id int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	o, ok := t.orders[id]
+	return ok && orderStatusDone(o.RestStatus) && !o.FilledAmount.GreaterThan(o.history_amount)
+}
+
+// Orders returns all tracked orders sorted by id
+func (t *OrderTracker) Orders() []TrackedOrder {
+	return t.filter(func(o *trackedOrder) bool { return true })
+}
+
+// Open returns orders still in the book
+func (t *OrderTracker) Open() []TrackedOrder {
+	return t.filter(func(o *trackedOrder) bool { return !o.Done() })
+}
+
+// Mismatched returns orders whose REST and websocket states disagree
+func (t *OrderTracker) Mismatched() []TrackedOrder {
+	return t.filter(func(o *trackedOrder) bool { return o.Mismatch })
+}
+
+func (t *OrderTracker) filter(f func(o *trackedOrder) bool) []TrackedOrder {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	res := []TrackedOrder{}
+	for _, o := range t.orders {
+		if f(o) {
+			res = append(res, o.copy())
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Id < res[j].Id })
+	return res
+}
+
+func (o *trackedOrder) copy() TrackedOrder {
+	res := o.TrackedOrder
+	res.Fees = append([]Fee{}, o.Fees...)
+	return res
+}
+
+// WaitStatus waits until order id has one of statuses
+func (t *OrderTracker) WaitStatus(ctx context.Context, id int64, statuses ...OrderStatus) (TrackedOrder, error) {
+	for {
+		t.mu.Lock()
+		changed := t.changed
+		o, ok := t.orders[id]
+		if ok {
+			for _, status := range statuses {
+				if o.Status == status {
+					res := o.copy()
+					t.mu.Unlock()
+					return res, nil
+				}
+			}
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return TrackedOrder{}, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// WaitDone waits until order id is finished or cancelled
+func (t *OrderTracker) WaitDone(ctx context.Context, id int64) (TrackedOrder, error) {
+	return t.WaitStatus(ctx, id, OrderStatus_FINISHED, OrderStatus_CANCELLED)
+}
+
+// WaitFilled waits until order id is finished, ErrOrderCancelled is returned with the order if it was cancelled
+func (t *OrderTracker) WaitFilled(ctx context.Context, id int64) (TrackedOrder, error) {
+	o, err := t.WaitDone(ctx, id)
+	if err != nil {
+		return o, err
+	}
+	if o.Status == OrderStatus_CANCELLED {
+		return o, ErrOrderCancelled
+	}
+	return o, nil
+}
+
+// Reconcile checks tracked orders against REST: open orders are listed, orders that left the list
+// are fetched one by one and fills of changed orders are taken from their trades.
+// A failed request of one order does not stop the check of others, the first error is returned.
+func (t *OrderTracker) Reconcile(ctx context.Context) error {
+	open, err := t.c.NewOpenOrdersListService().Pager().All(ctx)
+	if err != nil {
+		return err
+	}
+
+	listed := map[int64]bool{}
+	for _, info := range open {
+		if !t.pair(info.CurrencyPairId) {
+			continue
+		}
+		listed[info.Id] = true
+		t.update(info, nil, "rest")
+	}
+
+	var res error
+	for _, o := range t.Orders() {
+		if listed[o.Id] || orderStatusDone(o.RestStatus) {
+			continue
+		}
+
+		info, err := t.c.NewOrderInfoService().OrderId(o.Id).Do(ctx)
+		if err != nil {
+			t.c.debug("order tracker order %d: %s", o.Id, err)
+			if res == nil {
+				res = err
+			}
+			continue
+		}
+		// REST reports orders cancelled after partial fills as PARTIAL, an open one would be listed
+		if info.Status == OrderStatus_PARTIAL {
+			info.Status = OrderStatus_CANCELLED
+		}
+		t.update(*info, nil, "rest")
+	}
+
+	for _, o := range t.filterHistory() {
+		detail, err := t.c.NewTradesOrderHistoryService().OrderId(o.Id).Do(ctx)
+		if err != nil {
+			t.c.debug("order tracker trades of order %d: %s", o.Id, err)
+			if res == nil {
+				res = err
+			}
+			continue
+		}
+		t.setTrades(o.Id, detail)
+	}
+
+	return res
+}
+
+func (t *OrderTracker) pair(pair_id int) bool {
+	for _, id := range t.pair_ids {
+		if id == pair_id {
+			return true
+		}
+	}
+	return len(t.pair_ids) == 0
+}
+
+// filterHistory returns orders filled beyond their known trades
+func (t *OrderTracker) filterHistory() []TrackedOrder {
+	return t.filter(func(o *trackedOrder) bool {
+		return o.FilledAmount.GreaterThan(o.history_amount)
+	})
+}
+
+// setTrades computes fills and fees of order id from its trades
+func (t *OrderTracker) setTrades(id int64, detail *TradeOrderDetail) {
+	filled, quote := Decimal{}, Decimal{}
+	for _, trade := range detail.Trades {
+		filled = filled.Add(trade.Amount)
+		quote = quote.Add(trade.Amount.Mul(trade.Price))
+	}
+
+	t.mu.Lock()
+	o, ok := t.orders[id]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+
+	loaded := !o.history_amount.Equal(filled)
+	o.history_amount = filled
+	o.Fees = append([]Fee{}, detail.Fees...)
+	before := o.FilledAmount
+	if filled.IsPositive() {
+		o.FilledAmount = MaxDecimal(o.FilledAmount, filled)
+		o.AveragePrice = quote.Div(filled, analyticsPlaces).Normalize()
+	}
+	res := o.copy()
+	t.notifyLocked()
+	t.mu.Unlock()
+
+	if (loaded || !before.Equal(res.FilledAmount)) && t.onUpdate != nil {
+		t.onUpdate(res)
+	}
+}
+
+// update merges REST order info, ws is the websocket status when the info comes from the websocket
+func (t *OrderTracker) update(info OrderInfo, ws *OrderStatus, source string) {
+	t.mu.Lock()
+
+	o, ok := t.orders[info.Id]
+	if !ok {
+		o = &trackedOrder{TrackedOrder: TrackedOrder{Id: info.Id}}
+		t.orders[info.Id] = o
+	}
+	from, rest := o.Status, o.RestStatus
+	filled := o.FilledAmount
+
+	if info.CurrencyPairId != 0 {
+		o.CurrencyPairId = info.CurrencyPairId
+	}
+	if info.Type != "" {
+		o.Type = info.Type
+	}
+	if info.Price.IsPositive() {
+		o.Price = info.Price
+	}
+	if info.TriggerPrice.IsPositive() {
+		o.TriggerPrice = info.TriggerPrice
+	}
+	if info.InitialAmount.IsPositive() {
+		o.InitialAmount = info.InitialAmount
+	}
+	if o.Created.IsZero() && !info.Created.IsZero() {
+		o.Created = info.Created.Time
+	}
+	o.FilledAmount = MaxDecimal(o.FilledAmount, info.ProcessedAmount)
+
+	if ws != nil {
+		o.WsStatus = *ws
+		// Websocket reports can not reopen an order
+		if !o.Done() {
+			o.Status = *ws
+		}
+		t.check(o, false)
+	} else if info.Status != "" {
+		o.RestStatus = info.Status
+		// A lagging open orders list can not reopen an order either
+		if !o.Done() || orderStatusDone(info.Status) {
+			o.Status = info.Status
+		}
+		t.check(o, true)
+	}
+	o.Updated = time.Now()
+
+	res := o.copy()
+	t.notifyLocked()
+	t.mu.Unlock()
+
+	if from != res.Status && t.f != nil {
+		t.f(OrderTransition{Order: res, From: from, To: res.Status, Source: source, Time: res.Updated})
+	}
+	if (from != res.Status || rest != res.RestStatus || !filled.Equal(res.FilledAmount)) && t.onUpdate != nil {
+		t.onUpdate(res)
+	}
+}
+
+// check updates mismatch flag of o. Final statuses disagree at once, others when REST checks
+// keep disagreeing, as the websocket may lag behind.
+func (t *OrderTracker) check(o *trackedOrder, rest bool) {
+	if t.agree(o) {
+		o.disagree = 0
+		o.Mismatch = false
+		return
+	}
+
+	if orderStatusDone(o.RestStatus) && orderStatusDone(o.WsStatus) {
+		o.Mismatch = true
+		return
+	}
+
+	if rest {
+		o.disagree++
+		o.Mismatch = o.disagree >= trackerMismatchStrikes
+	}
+}
+
+// agree reports if REST and websocket statuses of o are the same, PROCESSING is only seen by REST
+func (t *OrderTracker) agree(o *trackedOrder) bool {
+	if o.RestStatus == "" || o.WsStatus == "" {
+		return true
+	}
+
+	rest := o.RestStatus
+	if rest == OrderStatus_PROCESSING {
+		rest = OrderStatus_PENDING
+	}
+	return rest == o.WsStatus
+}
+
+func (t *OrderTracker) notifyLocked() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+func (t *OrderTracker) reconcileSoon() {
+	select {
+	case t.kick <- struct{}{}:
+	default:
+	}
+}
+
+// apply handles event of the private order channels.
+// Amount of an order update is the amount left in the book.
+func (t *OrderTracker) apply(ev UserEvent) {
+	switch ev.Type {
+	case UserEventOrderUpdate:
+		info := OrderInfo{
+			Id:             ev.Update.Id,
+			CurrencyPairId: ev.Update.CurrencyPairId,
+			Type:           ev.OrderType,
+			Price:          ev.Update.Price,
+		}
+
+		status := OrderStatus_PENDING
+		if o, ok := t.Order(ev.Update.Id); ok && o.InitialAmount.IsPositive() {
+			filled := o.InitialAmount.Sub(ev.Update.Amount)
+			if filled.IsPositive() {
+				info.ProcessedAmount = filled
+				status = OrderStatus_PARTIAL
+			}
+		} else {
+			// Unknown order, its initial amount comes from REST
+			t.reconcileSoon()
+		}
+		t.update(info, &status, "ws")
+
+	case UserEventOrderDeleted:
+		status := ev.Delete.Status
+		if !orderStatusDone(status) {
+			status = OrderStatus_CANCELLED
+		}
+		t.update(OrderInfo{Id: ev.Delete.Id, CurrencyPairId: ev.Delete.CurrencyPairId}, &status, "ws")
+		t.reconcileSoon()
+
+	case UserEventFill:
+		// Fill amounts and prices are taken from trades of the order by REST
+		t.reconcileSoon()
+	}
+}
@@ -0,0 +1,126 @@
+package stex_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+	"github.com/vladivolo/stex-api/stextest"
+)
+
+func TestOrderTrackerReconcile(t *testing.T) {
+	srv := stextest.NewServer()
+	defer srv.Close()
+
+	maker := srv.AddUser("maker")
+	taker := srv.AddUser("taker")
+	srv.SetBalance(maker, "ETH", stex.MustParseDecimal("10"))
+	srv.SetBalance(taker, "BTC", stex.MustParseDecimal("10"))
+
+	place := func(u int64, order_type stex.OrderType, amount, price string) stex.OrderInfo {
+		info, err := srv.PlaceOrder(u, 1, order_type, stex.MustParseDecimal(amount), stex.MustParseDecimal(price), stex.Decimal{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+
+	partial := place(maker, stex.OrderType_SELL, "1", "0.02")
+	filled := place(maker, stex.OrderType_SELL, "0.5", "0.021")
+	place(taker, stex.OrderType_BUY, "0.4", "0.02")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c := srv.Client("maker")
+	tracker := stex.NewOrderTracker(c, nil).CurrencyPairIds(1)
+	if err := tracker.Reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// A partly filled order in the open orders list is still open
+	o, ok := tracker.Order(partial.Id)
+	if !ok || o.Status != stex.OrderStatus_PARTIAL || o.Done() {
+		t.Fatalf("listed partial order = %+v", o)
+	}
+	if open := tracker.Open(); len(open) != 2 {
+		t.Fatalf("open orders = %+v", open)
+	}
+
+	// Not existing order fails its check, others are still reconciled
+	tracker.Track(stex.OrderInfo{Id: 999999, CurrencyPairId: 1, Status: stex.OrderStatus_PENDING})
+	if _, err := c.NewOrderDeleteService().OrderId(partial.Id).Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	place(taker, stex.OrderType_BUY, "0.5", "0.021")
+
+	if err := tracker.Reconcile(ctx); err == nil {
+		t.Error("Reconcile does not report the failed order")
+	}
+
+	// REST reports the cancelled partly filled order as PARTIAL, it is not listed anymore
+	o, _ = tracker.Order(partial.Id)
+	if o.Status != stex.OrderStatus_CANCELLED || !o.FilledAmount.Equal(stex.MustParseDecimal("0.4")) {
+		t.Errorf("cancelled partial order = %+v", o)
+	}
+	o, _ = tracker.Order(filled.Id)
+	if o.Status != stex.OrderStatus_FINISHED || !o.FilledAmount.Equal(stex.MustParseDecimal("0.5")) ||
+		!o.AveragePrice.Equal(stex.MustParseDecimal("0.021")) {
+		t.Errorf("finished order = %+v", o)
+	}
+	o, _ = tracker.Order(999999)
+	if o.Status != stex.OrderStatus_PENDING {
+		t.Errorf("failed order = %+v", o)
+	}
+}
+
+func TestOrderTrackerTransitions(t *testing.T) {
+	srv := stextest.NewServer()
+	defer srv.Close()
+
+	maker := srv.AddUser("maker")
+	taker := srv.AddUser("taker")
+	srv.SetBalance(maker, "ETH", stex.MustParseDecimal("10"))
+	srv.SetBalance(taker, "BTC", stex.MustParseDecimal("10"))
+
+	info, err := srv.PlaceOrder(maker, 1, stex.OrderType_SELL, stex.MustParseDecimal("1"), stex.MustParseDecimal("0.02"), stex.Decimal{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	transitions := []stex.OrderStatus{}
+	tracker := stex.NewOrderTracker(srv.Client("maker"), nil).CurrencyPairIds(1).OnTransition(func(tr stex.OrderTransition) {
+		transitions = append(transitions, tr.To)
+	})
+	tracker.Track(info)
+
+	for _, amount := range []string{"0.4", "0.6"} {
+		if _, err = srv.PlaceOrder(taker, 1, stex.OrderType_BUY, stex.MustParseDecimal(amount), stex.MustParseDecimal("0.02"), stex.Decimal{}); err != nil {
+			t.Fatal(err)
+		}
+		if err = tracker.Reconcile(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	o, err := tracker.WaitFilled(ctx, info.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !o.FilledAmount.Equal(stex.MustParseDecimal("1")) {
+		t.Errorf("filled order = %+v", o)
+	}
+	want := []stex.OrderStatus{stex.OrderStatus_PENDING, stex.OrderStatus_PARTIAL, stex.OrderStatus_FINISHED}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions = %v, want %v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Fatalf("transitions = %v, want %v", transitions, want)
+		}
+	}
+}
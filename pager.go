@@ -0,0 +1,641 @@
+package stex
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+// ErrPagerDone is returned by Next when all pages have been read
+var ErrPagerDone = errors.New("stex: no more pages")
+
+const defaultPageSize = 100
+
+// Pages consisting of already returned items only that are skipped in a row before the iteration ends
+const maxDuplicatePages = 3
+
+// pager keeps limit/offset state shared by all typed pagers
+type pager struct {
+	pageSize int
+	maxItems int
+	offset   int
+	count    int
+	done     bool
+	seen     map[string]struct{}
+}
+
+func newPager() pager {
+	return pager{
+		pageSize: defaultPageSize,
+		seen:     map[string]struct{}{},
+	}
+}
+
+// next fetches the next page and returns indexes of its items not returned before.
+// fetch requests a page and returns its length, key returns the key of item i of the page.
+// A page shorter than the limit is the last one, so the page size must not exceed the limit the API allows.
+// Records inserted while paging shift offsets, so already seen items are dropped by key and a page
+// of duplicates only is skipped. After maxDuplicatePages of them in a row the iteration ends,
+// so an API ignoring offset never loops forever.
+func (p *pager) next(ctx context.Context, fetch func(ctx context.Context, limit, offset int) (int, error), key func(i int) string) ([]int, error) {
+	limit := p.pageSize
+	if limit < 1 {
+		limit = defaultPageSize
+	}
+
+	for duplicates := 0; !p.done; duplicates++ {
+		if duplicates >= maxDuplicatePages {
+			p.done = true
+			break
+		}
+
+		n, err := fetch(ctx, limit, p.offset)
+		if err != nil {
+			return nil, err
+		}
+		p.offset += n
+		if n < limit {
+			p.done = true
+		}
+
+		keep := []int{}
+		for i := 0; i < n; i++ {
+			if p.maxItems > 0 && p.count >= p.maxItems {
+				break
+			}
+			k := key(i)
+			if _, ok := p.seen[k]; ok {
+				continue
+			}
+			p.seen[k] = struct{}{}
+			keep = append(keep, i)
+			p.count++
+		}
+
+		if p.maxItems > 0 && p.count >= p.maxItems {
+			p.done = true
+		}
+
+		if len(keep) > 0 {
+			return keep, nil
+		}
+	}
+
+	return nil, ErrPagerDone
+}
+
+// each calls next until ErrPagerDone and item for every index of the returned pages.
+// next returns the length of the page. Stops on the first error of next or item.
+func (p *pager) each(next func() (int, error), item func(i int) error) error {
+	for {
+		n, err := next()
+		if err == ErrPagerDone {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			err = item(i)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// OpenOrdersListPager iterates over open orders page by page
+type OpenOrdersListPager struct {
+	s *OpenOrdersListService
+	p pager
+}
+
+// Pager returns iterator over all pages of the request. Limit and Offset of the service are managed by the pager.
+func (s *OpenOrdersListService) Pager() *OpenOrdersListPager {
+	return &OpenOrdersListPager{s: s, p: newPager()}
+}
+
+func (it *OpenOrdersListPager) PageSize(size int) *OpenOrdersListPager {
+	it.p.pageSize = size
+	return it
+}
+
+// MaxItems stops iteration after given number of items
+func (it *OpenOrdersListPager) MaxItems(max int) *OpenOrdersListPager {
+	it.p.maxItems = max
+	return it
+}
+
+// Next returns the next page or ErrPagerDone if there are no more pages
+func (it *OpenOrdersListPager) Next(ctx context.Context, opts ...RequestOption) ([]OrderInfo, error) {
+	var page []OrderInfo
+	keep, err := it.p.next(ctx, func(ctx context.Context, limit, offset int) (n int, err error) {
+		page, err = it.s.Limit(limit).Offset(offset).Do(ctx, opts...)
+		return len(page), err
+	}, func(i int) string {
+		return strconv.FormatInt(page[i].Id, 10)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]OrderInfo, 0, len(keep))
+	for _, i := range keep {
+		res = append(res, page[i])
+	}
+
+	return res, nil
+}
+
+// All returns items of all remaining pages
+func (it *OpenOrdersListPager) All(ctx context.Context, opts ...RequestOption) ([]OrderInfo, error) {
+	var res, page []OrderInfo
+	err := it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		res = append(res, page[i])
+		return nil
+	})
+	return res, err
+}
+
+// Each calls f for every remaining item, stops on the first error returned by f
+func (it *OpenOrdersListPager) Each(ctx context.Context, f func(OrderInfo) error, opts ...RequestOption) error {
+	var page []OrderInfo
+	return it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		return f(page[i])
+	})
+}
+
+// OrdersHistoryPager iterates over closed orders page by page
+type OrdersHistoryPager struct {
+	s *OrdersHistoryService
+	p pager
+}
+
+// Pager returns iterator over all pages of the request. Limit and Offset of the service are managed by the pager.
+func (s *OrdersHistoryService) Pager() *OrdersHistoryPager {
+	return &OrdersHistoryPager{s: s, p: newPager()}
+}
+
+func (it *OrdersHistoryPager) PageSize(size int) *OrdersHistoryPager {
+	it.p.pageSize = size
+	return it
+}
+
+// MaxItems stops iteration after given number of items
+func (it *OrdersHistoryPager) MaxItems(max int) *OrdersHistoryPager {
+	it.p.maxItems = max
+	return it
+}
+
+// Next returns the next page or ErrPagerDone if there are no more pages
+func (it *OrdersHistoryPager) Next(ctx context.Context, opts ...RequestOption) ([]OrderInfo, error) {
+	var page []OrderInfo
+	keep, err := it.p.next(ctx, func(ctx context.Context, limit, offset int) (n int, err error) {
+		page, err = it.s.Limit(limit).Offset(offset).Do(ctx, opts...)
+		return len(page), err
+	}, func(i int) string {
+		return strconv.FormatInt(page[i].Id, 10)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]OrderInfo, 0, len(keep))
+	for _, i := range keep {
+		res = append(res, page[i])
+	}
+
+	return res, nil
+}
+
+// All returns items of all remaining pages
+func (it *OrdersHistoryPager) All(ctx context.Context, opts ...RequestOption) ([]OrderInfo, error) {
+	var res, page []OrderInfo
+	err := it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		res = append(res, page[i])
+		return nil
+	})
+	return res, err
+}
+
+// Each calls f for every remaining item, stops on the first error returned by f
+func (it *OrdersHistoryPager) Each(ctx context.Context, f func(OrderInfo) error, opts ...RequestOption) error {
+	var page []OrderInfo
+	return it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		return f(page[i])
+	})
+}
+
+// CurrencyPairTradesHistoryPager iterates over user trades page by page
+type CurrencyPairTradesHistoryPager struct {
+	s *CurrencyPairTradesHistoryService
+	p pager
+}
+
+// Pager returns iterator over all pages of the request. Limit and Offset of the service are managed by the pager.
+func (s *CurrencyPairTradesHistoryService) Pager() *CurrencyPairTradesHistoryPager {
+	return &CurrencyPairTradesHistoryPager{s: s, p: newPager()}
+}
+
+func (it *CurrencyPairTradesHistoryPager) PageSize(size int) *CurrencyPairTradesHistoryPager {
+	it.p.pageSize = size
+	return it
+}
+
+// MaxItems stops iteration after given number of items
+func (it *CurrencyPairTradesHistoryPager) MaxItems(max int) *CurrencyPairTradesHistoryPager {
+	it.p.maxItems = max
+	return it
+}
+
+// Next returns the next page or ErrPagerDone if there are no more pages
+func (it *CurrencyPairTradesHistoryPager) Next(ctx context.Context, opts ...RequestOption) ([]Trade, error) {
+	var page []Trade
+	keep, err := it.p.next(ctx, func(ctx context.Context, limit, offset int) (n int, err error) {
+		page, err = it.s.Limit(limit).Offset(offset).Do(ctx, opts...)
+		return len(page), err
+	}, func(i int) string {
+		return strconv.FormatInt(page[i].Id, 10)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Trade, 0, len(keep))
+	for _, i := range keep {
+		res = append(res, page[i])
+	}
+
+	return res, nil
+}
+
+// All returns items of all remaining pages
+func (it *CurrencyPairTradesHistoryPager) All(ctx context.Context, opts ...RequestOption) ([]Trade, error) {
+	var res, page []Trade
+	err := it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		res = append(res, page[i])
+		return nil
+	})
+	return res, err
+}
+
+// Each calls f for every remaining item, stops on the first error returned by f
+func (it *CurrencyPairTradesHistoryPager) Each(ctx context.Context, f func(Trade) error, opts ...RequestOption) error {
+	var page []Trade
+	return it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		return f(page[i])
+	})
+}
+
+// ProfileDepositsListPager iterates over deposits page by page
+type ProfileDepositsListPager struct {
+	s *ProfileDepositsListService
+	p pager
+}
+
+// Pager returns iterator over all pages of the request. Limit and Offset of the service are managed by the pager.
+func (s *ProfileDepositsListService) Pager() *ProfileDepositsListPager {
+	return &ProfileDepositsListPager{s: s, p: newPager()}
+}
+
+func (it *ProfileDepositsListPager) PageSize(size int) *ProfileDepositsListPager {
+	it.p.pageSize = size
+	return it
+}
+
+// MaxItems stops iteration after given number of items
+func (it *ProfileDepositsListPager) MaxItems(max int) *ProfileDepositsListPager {
+	it.p.maxItems = max
+	return it
+}
+
+// Next returns the next page or ErrPagerDone if there are no more pages
+func (it *ProfileDepositsListPager) Next(ctx context.Context, opts ...RequestOption) ([]DepositAdv, error) {
+	var page []DepositAdv
+	keep, err := it.p.next(ctx, func(ctx context.Context, limit, offset int) (n int, err error) {
+		page, err = it.s.Limit(limit).Offset(offset).Do(ctx, opts...)
+		return len(page), err
+	}, func(i int) string {
+		return strconv.FormatInt(page[i].Id, 10)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]DepositAdv, 0, len(keep))
+	for _, i := range keep {
+		res = append(res, page[i])
+	}
+
+	return res, nil
+}
+
+// All returns items of all remaining pages
+func (it *ProfileDepositsListPager) All(ctx context.Context, opts ...RequestOption) ([]DepositAdv, error) {
+	var res, page []DepositAdv
+	err := it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		res = append(res, page[i])
+		return nil
+	})
+	return res, err
+}
+
+// Each calls f for every remaining item, stops on the first error returned by f
+func (it *ProfileDepositsListPager) Each(ctx context.Context, f func(DepositAdv) error, opts ...RequestOption) error {
+	var page []DepositAdv
+	return it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		return f(page[i])
+	})
+}
+
+// ProfileWithdrawalListPager iterates over withdrawals page by page
+type ProfileWithdrawalListPager struct {
+	s *ProfileWithdrawalListService
+	p pager
+}
+
+// Pager returns iterator over all pages of the request. Limit and Offset of the service are managed by the pager.
+func (s *ProfileWithdrawalListService) Pager() *ProfileWithdrawalListPager {
+	return &ProfileWithdrawalListPager{s: s, p: newPager()}
+}
+
+func (it *ProfileWithdrawalListPager) PageSize(size int) *ProfileWithdrawalListPager {
+	it.p.pageSize = size
+	return it
+}
+
+// MaxItems stops iteration after given number of items
+func (it *ProfileWithdrawalListPager) MaxItems(max int) *ProfileWithdrawalListPager {
+	it.p.maxItems = max
+	return it
+}
+
+// Next returns the next page or ErrPagerDone if there are no more pages
+func (it *ProfileWithdrawalListPager) Next(ctx context.Context, opts ...RequestOption) ([]WithdrawalAdv, error) {
+	var page []WithdrawalAdv
+	keep, err := it.p.next(ctx, func(ctx context.Context, limit, offset int) (n int, err error) {
+		page, err = it.s.Limit(limit).Offset(offset).Do(ctx, opts...)
+		return len(page), err
+	}, func(i int) string {
+		return strconv.FormatInt(page[i].Id, 10)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]WithdrawalAdv, 0, len(keep))
+	for _, i := range keep {
+		res = append(res, page[i])
+	}
+
+	return res, nil
+}
+
+// All returns items of all remaining pages
+func (it *ProfileWithdrawalListPager) All(ctx context.Context, opts ...RequestOption) ([]WithdrawalAdv, error) {
+	var res, page []WithdrawalAdv
+	err := it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		res = append(res, page[i])
+		return nil
+	})
+	return res, err
+}
+
+// Each calls f for every remaining item, stops on the first error returned by f
+func (it *ProfileWithdrawalListPager) Each(ctx context.Context, f func(WithdrawalAdv) error, opts ...RequestOption) error {
+	var page []WithdrawalAdv
+	return it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		return f(page[i])
+	})
+}
+
+// ProfileNotificationsPager iterates over notifications page by page
+type ProfileNotificationsPager struct {
+	s *ProfileNotificationsService
+	p pager
+}
+
+// Pager returns iterator over all pages of the request. Limit and Offset of the service are managed by the pager.
+func (s *ProfileNotificationsService) Pager() *ProfileNotificationsPager {
+	return &ProfileNotificationsPager{s: s, p: newPager()}
+}
+
+func (it *ProfileNotificationsPager) PageSize(size int) *ProfileNotificationsPager {
+	it.p.pageSize = size
+	return it
+}
+
+// MaxItems stops iteration after given number of items
+func (it *ProfileNotificationsPager) MaxItems(max int) *ProfileNotificationsPager {
+	it.p.maxItems = max
+	return it
+}
+
+// Next returns the next page or ErrPagerDone if there are no more pages
+func (it *ProfileNotificationsPager) Next(ctx context.Context, opts ...RequestOption) ([]Notification, error) {
+	var page []Notification
+	keep, err := it.p.next(ctx, func(ctx context.Context, limit, offset int) (n int, err error) {
+		page, err = it.s.Limit(limit).Offset(offset).Do(ctx, opts...)
+		return len(page), err
+	}, func(i int) string {
+		return page[i].Id
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Notification, 0, len(keep))
+	for _, i := range keep {
+		res = append(res, page[i])
+	}
+
+	return res, nil
+}
+
+// All returns items of all remaining pages
+func (it *ProfileNotificationsPager) All(ctx context.Context, opts ...RequestOption) ([]Notification, error) {
+	var res, page []Notification
+	err := it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		res = append(res, page[i])
+		return nil
+	})
+	return res, err
+}
+
+// Each calls f for every remaining item, stops on the first error returned by f
+func (it *ProfileNotificationsPager) Each(ctx context.Context, f func(Notification) error, opts ...RequestOption) error {
+	var page []Notification
+	return it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		return f(page[i])
+	})
+}
+
+// CurrencyPairTradesPager iterates over public trades page by page
+type CurrencyPairTradesPager struct {
+	s *CurrencyPairTradesService
+	p pager
+}
+
+// Pager returns iterator over all pages of the request. Limit and Offset of the service are managed by the pager.
+func (s *CurrencyPairTradesService) Pager() *CurrencyPairTradesPager {
+	return &CurrencyPairTradesPager{s: s, p: newPager()}
+}
+
+func (it *CurrencyPairTradesPager) PageSize(size int) *CurrencyPairTradesPager {
+	it.p.pageSize = size
+	return it
+}
+
+// MaxItems stops iteration after given number of items
+func (it *CurrencyPairTradesPager) MaxItems(max int) *CurrencyPairTradesPager {
+	it.p.maxItems = max
+	return it
+}
+
+// Next returns the next page or ErrPagerDone if there are no more pages
+func (it *CurrencyPairTradesPager) Next(ctx context.Context, opts ...RequestOption) ([]CurrencyPairTrades, error) {
+	var page []CurrencyPairTrades
+	keep, err := it.p.next(ctx, func(ctx context.Context, limit, offset int) (n int, err error) {
+		page, err = it.s.Limit(limit).Offset(offset).Do(ctx, opts...)
+		return len(page), err
+	}, func(i int) string {
+		return strconv.FormatInt(page[i].Id, 10)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]CurrencyPairTrades, 0, len(keep))
+	for _, i := range keep {
+		res = append(res, page[i])
+	}
+
+	return res, nil
+}
+
+// All returns items of all remaining pages
+func (it *CurrencyPairTradesPager) All(ctx context.Context, opts ...RequestOption) ([]CurrencyPairTrades, error) {
+	var res, page []CurrencyPairTrades
+	err := it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		res = append(res, page[i])
+		return nil
+	})
+	return res, err
+}
+
+// Each calls f for every remaining item, stops on the first error returned by f
+func (it *CurrencyPairTradesPager) Each(ctx context.Context, f func(CurrencyPairTrades) error, opts ...RequestOption) error {
+	var page []CurrencyPairTrades
+	return it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		return f(page[i])
+	})
+}
+
+// CurrencyPairChartPager iterates over candles page by page
+type CurrencyPairChartPager struct {
+	s *CurrencyPairChartService
+	p pager
+}
+
+// Pager returns iterator over all pages of the request. Limit and Offset of the service are managed by the pager.
+func (s *CurrencyPairChartService) Pager() *CurrencyPairChartPager {
+	return &CurrencyPairChartPager{s: s, p: newPager()}
+}
+
+func (it *CurrencyPairChartPager) PageSize(size int) *CurrencyPairChartPager {
+	it.p.pageSize = size
+	return it
+}
+
+// MaxItems stops iteration after given number of items
+func (it *CurrencyPairChartPager) MaxItems(max int) *CurrencyPairChartPager {
+	it.p.maxItems = max
+	return it
+}
+
+// Next returns the next page or ErrPagerDone if there are no more pages
+func (it *CurrencyPairChartPager) Next(ctx context.Context, opts ...RequestOption) ([]Candle, error) {
+	var page []Candle
+	keep, err := it.p.next(ctx, func(ctx context.Context, limit, offset int) (n int, err error) {
+		page, err = it.s.Limit(limit).Offset(offset).Do(ctx, opts...)
+		return len(page), err
+	}, func(i int) string {
+		return strconv.FormatInt(page[i].Time.Unix(), 10)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Candle, 0, len(keep))
+	for _, i := range keep {
+		res = append(res, page[i])
+	}
+
+	return res, nil
+}
+
+// All returns items of all remaining pages
+func (it *CurrencyPairChartPager) All(ctx context.Context, opts ...RequestOption) ([]Candle, error) {
+	var res, page []Candle
+	err := it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		res = append(res, page[i])
+		return nil
+	})
+	return res, err
+}
+
+// Each calls f for every remaining item, stops on the first error returned by f
+func (it *CurrencyPairChartPager) Each(ctx context.Context, f func(Candle) error, opts ...RequestOption) error {
+	var page []Candle
+	return it.p.each(func() (n int, err error) {
+		page, err = it.Next(ctx, opts...)
+		return len(page), err
+	}, func(i int) error {
+		return f(page[i])
+	})
+}
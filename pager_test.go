@@ -0,0 +1,152 @@
+package stex
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newOrdersServer serves /trading/orders from ids, capping the page at maxLimit.
+// insert is called before every page and may change ids to emulate records added while paging.
+func newOrdersServer(ids *[]int64, maxLimit int, ignoreOffset bool, insert func(page int)) (*httptest.Server, *int) {
+	pages := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if insert != nil {
+			insert(pages)
+		}
+		pages++
+
+		limit, _ := strconv.Atoi(r.FormValue("limit"))
+		offset, _ := strconv.Atoi(r.FormValue("offset"))
+		if limit > maxLimit {
+			limit = maxLimit
+		}
+		if ignoreOffset {
+			offset = 0
+		}
+
+		items := []string{}
+		for i := offset; i < offset+limit && i < len(*ids); i++ {
+			items = append(items, fmt.Sprintf(`{"id":%d}`, (*ids)[i]))
+		}
+		fmt.Fprintf(w, `{"success":true,"data":[%s]}`, strings.Join(items, ","))
+	}))
+	return srv, &pages
+}
+
+func seqIds(from, to int64) []int64 {
+	res := []int64{}
+	for id := from; id <= to; id++ {
+		res = append(res, id)
+	}
+	return res
+}
+
+func TestPager(t *testing.T) {
+	tests := []struct {
+		name         string
+		ids          []int64
+		pageSize     int
+		maxLimit     int
+		maxItems     int
+		ignoreOffset bool
+		insert       func(ids *[]int64, page int)
+		want         int
+		pages        int
+	}{
+		{name: "empty", pageSize: 10, maxLimit: 100, want: 0, pages: 1},
+		{name: "exact pages", ids: seqIds(1, 20), pageSize: 10, maxLimit: 100, want: 20, pages: 3},
+		{name: "short last page", ids: seqIds(1, 25), pageSize: 10, maxLimit: 100, want: 25, pages: 3},
+		{name: "limit capped by api", ids: seqIds(1, 25), pageSize: 10, maxLimit: 4, want: 4, pages: 1},
+		{name: "max items", ids: seqIds(1, 25), pageSize: 10, maxLimit: 100, maxItems: 15, want: 15, pages: 2},
+		{name: "offset ignored", ids: seqIds(1, 25), pageSize: 10, maxLimit: 100, ignoreOffset: true, want: 10, pages: 4},
+		{
+			name: "records inserted while paging", ids: seqIds(1, 20), pageSize: 10, maxLimit: 100,
+			// Two newer records shift the second page, its first two items were already returned
+			insert: func(ids *[]int64, page int) {
+				if page == 1 {
+					*ids = append([]int64{100, 101}, *ids...)
+				}
+			},
+			want: 20, pages: 3,
+		},
+		{
+			name: "full page of duplicates", ids: seqIds(1, 30), pageSize: 10, maxLimit: 100,
+			// Ten newer records shift the second page by a full page, it is skipped
+			insert: func(ids *[]int64, page int) {
+				if page == 1 {
+					*ids = append(seqIds(100, 109), *ids...)
+				}
+			},
+			want: 30, pages: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := tt.ids
+			var insert func(int)
+			if tt.insert != nil {
+				insert = func(page int) { tt.insert(&ids, page) }
+			}
+			srv, pages := newOrdersServer(&ids, tt.maxLimit, tt.ignoreOffset, insert)
+			defer srv.Close()
+
+			c := NewClient("key")
+			c.BaseURL = srv.URL
+
+			it := c.NewOpenOrdersListService().Pager().PageSize(tt.pageSize).MaxItems(tt.maxItems)
+			res, err := it.All(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res) != tt.want {
+				t.Errorf("items = %d, want %d", len(res), tt.want)
+			}
+			if *pages != tt.pages {
+				t.Errorf("pages = %d, want %d", *pages, tt.pages)
+			}
+
+			seen := map[int64]bool{}
+			for _, o := range res {
+				if seen[o.Id] {
+					t.Errorf("order %d returned twice", o.Id)
+				}
+				seen[o.Id] = true
+			}
+
+			if _, err = it.Next(context.Background()); err != ErrPagerDone {
+				t.Errorf("Next() after the end = %v, want ErrPagerDone", err)
+			}
+		})
+	}
+}
+
+func TestPagerEachStopsOnError(t *testing.T) {
+	ids := seqIds(1, 30)
+	srv, pages := newOrdersServer(&ids, 100, false, nil)
+	defer srv.Close()
+
+	c := NewClient("key")
+	c.BaseURL = srv.URL
+
+	stop := fmt.Errorf("stop")
+	n := 0
+	err := c.NewOpenOrdersListService().Pager().PageSize(10).Each(context.Background(), func(o OrderInfo) error {
+		n++
+		if o.Id == 12 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("Each() = %v, want the error of f", err)
+	}
+	if n != 12 || *pages != 2 {
+		t.Errorf("visited %d items on %d pages, want 12 on 2", n, *pages)
+	}
+}
@@ -7,27 +7,27 @@ import (
 )
 
 type CurrencyPair struct {
-	Id                int    `json:"id"`
-	CurrencyId        int    `json:"currency_id"`
-	CurrencyCode      string `json:"currency_code"`
-	CurrencyName      string `json:"currency_name"`
-	MarketCurrencyId  int    `json:"market_currency_id"`
-	MarketCode        string `json:"market_code"`
-	MarketName        string `json:"market_name"`
-	MinOrderAmount    string `json:"min_order_amount"`
-	MinBuyPrice       string `json:"min_buy_price"`
-	MinSellPrice      string `json:"min_sell_price"`
-	BuyFeePercent     string `json:"buy_fee_percent"`
-	SellFeePercent    string `json:"sell_fee_percent"`
-	Active            bool   `json:"active"`
-	Delisted          bool   `json:"delisted"`
-	PairMessage       string `json:"pair_message"`
-	CurrencyPrecision int    `json:"currency_precision"`
-	MarketPrecision   int    `json:"market_precision"`
-	Symbol            string `json:"symbol"`
-	GroupName         string `json:"group_name"`
-	GroupId           int    `json:"group_id"`
-	AmountMultiplier  int    `json:"amount_multiplier"`
+	Id                int     `json:"id"`
+	CurrencyId        int     `json:"currency_id"`
+	CurrencyCode      string  `json:"currency_code"`
+	CurrencyName      string  `json:"currency_name"`
+	MarketCurrencyId  int     `json:"market_currency_id"`
+	MarketCode        string  `json:"market_code"`
+	MarketName        string  `json:"market_name"`
+	MinOrderAmount    Decimal `json:"min_order_amount"`
+	MinBuyPrice       Decimal `json:"min_buy_price"`
+	MinSellPrice      Decimal `json:"min_sell_price"`
+	BuyFeePercent     Decimal `json:"buy_fee_percent"`
+	SellFeePercent    Decimal `json:"sell_fee_percent"`
+	Active            bool    `json:"active"`
+	Delisted          bool    `json:"delisted"`
+	PairMessage       string  `json:"pair_message"`
+	CurrencyPrecision int     `json:"currency_precision"`
+	MarketPrecision   int     `json:"market_precision"`
+	Symbol            string  `json:"symbol"`
+	GroupName         string  `json:"group_name"`
+	GroupId           int     `json:"group_id"`
+	AmountMultiplier  int     `json:"amount_multiplier"`
 }
 
 type CurrencyPairsMarketListService struct {
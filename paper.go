@@ -0,0 +1,1076 @@
+package stex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of latest public trades fetched to find fills of resting orders
+const paperTradesLimit = 100
+
+// Default period of Sync run by simulated requests which do not change orders
+const paperSyncInterval = 5 * time.Second
+
+// PaperTrading simulates the trading account of a Client. Order, report and wallet requests
+// are served by the simulation, public and fee requests go to the transport the client had before,
+// the real API or a Replayer. Other private requests are rejected.
+//
+// Orders crossing the order book are filled at book prices when placed. Resting orders are filled at
+// their own price by public trades reaching it and by the book moving through it, checked by Sync.
+// Sync runs before every request placing or cancelling orders and before other simulated requests
+// once per SyncInterval. Fees come from CurrencyPairFeeService and are taken from the received currency.
+type PaperTrading struct {
+	// market serves public data with the original transport of the client
+	market *Client
+
+	initial       map[string]Decimal
+	now           func() time.Time
+	sync_interval time.Duration
+
+	mu         sync.Mutex
+	synced     time.Time
+	loaded     bool
+	pairs      map[int]CurrencyPair
+	currencies map[int]CurrencyInfo
+	wallets    map[int]*paperWallet
+	orders     map[int64]*paperOrder
+	fees       map[int]Fees
+	// id of the latest public trade seen of every pair
+	last_trade map[int]int64
+	last_price map[int]Decimal
+	// book liquidity of every pair already taken by simulated fills, by side and price
+	used map[int]map[string]Decimal
+	seq  int64
+}
+
+type paperWallet struct {
+	id          int64
+	currency_id int
+	balance     Decimal
+	frozen      Decimal
+}
+
+type paperOrder struct {
+	OrderInfo
+
+	// funds still frozen: market currency for buys, currency for sells
+	frozen Decimal
+	trades []Trade
+	fees   []Fee
+}
+
+func (o *paperOrder) remaining() Decimal {
+	return o.InitialAmount.Sub(o.ProcessedAmount)
+}
+
+func (o *paperOrder) isBuy() bool {
+	return o.Type == OrderType_BUY || o.Type == OrderType_STOP_LIMIT_BUY
+}
+
+func (o *paperOrder) isStop() bool {
+	return o.Type == OrderType_STOP_LIMIT_BUY || o.Type == OrderType_STOP_LIMIT_SELL
+}
+
+func (o *paperOrder) isActive() bool {
+	return o.Status == OrderStatus_PENDING
+}
+
+// paperError is returned to the client as API error with given status
+type paperError struct {
+	status  int
+	message string
+}
+
+func (e *paperError) Error() string {
+	return e.message
+}
+
+// NewPaperTrading returns simulation with starting balances by currency code, e.g. {"BTC": 1}
+func NewPaperTrading(balances map[string]Decimal) *PaperTrading {
+	initial := map[string]Decimal{}
+	for code, amount := range balances {
+		initial[strings.ToUpper(code)] = amount
+	}
+
+	return &PaperTrading{
+		initial:       initial,
+		now:           time.Now,
+		sync_interval: paperSyncInterval,
+		wallets:       map[int]*paperWallet{},
+		orders:        map[int64]*paperOrder{},
+		fees:          map[int]Fees{},
+		last_trade:    map[int]int64{},
+		last_price:    map[int]Decimal{},
+		used:          map[int]map[string]Decimal{},
+	}
+}
+
+// Clock sets the time source of order and trade timestamps, default is time.Now
+func (p *PaperTrading) Clock(now func() time.Time) *PaperTrading {
+	p.now = now
+	return p
+}
+
+// SyncInterval sets how often requests not changing orders run Sync, default is 5s of the Clock.
+// Zero makes every simulated request run it.
+func (p *PaperTrading) SyncInterval(interval time.Duration) *PaperTrading {
+	p.sync_interval = interval
+	return p
+}
+
+// PaperTrade switches the client to paper trading, set RateLimiter, RetryPolicy and transport before it
+func (c *Client) PaperTrade(p *PaperTrading) *Client {
+	market := *c
+	p.market = &market
+	c.do = p.Do
+	return c
+}
+
+// Do serves req, it is used as transport of Client
+func (p *PaperTrading) Do(req *http.Request) (*http.Response, error) {
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	for i, part := range parts {
+		switch part {
+		case "public", "trading", "reports", "profile":
+			parts = parts[i:]
+		default:
+			continue
+		}
+		break
+	}
+
+	if parts[0] == "public" || (len(parts) == 3 && parts[0] == "trading" && parts[1] == "fees") {
+		f := p.market.do
+		if f == nil {
+			f = p.market.HTTPClient.Do
+		}
+		return f(req)
+	}
+
+	form := url.Values{}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		form, _ = url.ParseQuery(string(body))
+	}
+	for k, v := range req.URL.Query() {
+		form[k] = v
+	}
+
+	data, err := p.serve(req.Context(), req.Method, parts, form)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if e, ok := err.(*paperError); ok {
+			status = e.status
+		}
+		return paperResponse(req, status, map[string]interface{}{"success": false, "message": err.Error()})
+	}
+	return paperResponse(req, http.StatusOK, map[string]interface{}{"success": true, "data": data})
+}
+
+func paperResponse(req *http.Request, status int, v interface{}) (*http.Response, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(string(body))),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// serve handles simulated request, parts start from the first path segment after the base URL
+func (p *PaperTrading) serve(ctx context.Context, method string, parts []string, form url.Values) (interface{}, error) {
+	err := p.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	due := p.now().Sub(p.synced) >= p.sync_interval
+	p.mu.Unlock()
+
+	if method != "GET" || due {
+		err = p.Sync(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(parts) < 2 {
+		return nil, &paperError{http.StatusForbidden, "Not available in paper trading"}
+	}
+
+	route := method + " " + strings.Join(parts[:2], "/")
+	arg := ""
+	if len(parts) == 3 {
+		arg = parts[2]
+	} else if len(parts) > 3 {
+		route = ""
+	}
+
+	switch route {
+	case "POST trading/orders":
+		return p.createOrder(ctx, arg, form)
+	case "GET trading/orders":
+		return p.openOrders(arg)
+	case "DELETE trading/orders":
+		return p.cancelOrders(arg)
+	case "GET trading/order":
+		o, err := p.order(arg)
+		if err != nil {
+			return nil, err
+		}
+		return o.OrderInfo, nil
+	case "DELETE trading/order":
+		return p.cancelOrder(arg)
+	case "GET reports/orders":
+		if arg != "" {
+			return p.orderDetail(arg)
+		}
+		return p.history(form)
+	case "GET reports/trades":
+		return p.trades(arg, form)
+	case "GET profile/wallets":
+		if arg != "" {
+			return p.wallet(arg)
+		}
+		return p.walletList(), nil
+	}
+
+	return nil, &paperError{http.StatusForbidden, "Not available in paper trading"}
+}
+
+// load fetches currencies and pairs once and creates wallets with starting balances
+func (p *PaperTrading) load(ctx context.Context) error {
+	p.mu.Lock()
+	loaded := p.loaded
+	p.mu.Unlock()
+	if loaded {
+		return nil
+	}
+
+	currencies, err := p.market.NewAvailableCurrenciesService().Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	pairs, err := p.market.NewCurrencyPairsMarketListService().Market("ALL").Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.loaded {
+		return nil
+	}
+
+	p.currencies = map[int]CurrencyInfo{}
+	for _, c := range currencies {
+		p.currencies[c.Id] = c
+		if amount, ok := p.initial[strings.ToUpper(c.Code)]; ok {
+			p.walletLocked(c.Id).balance = amount
+		}
+	}
+
+	p.pairs = map[int]CurrencyPair{}
+	for _, pair := range pairs {
+		p.pairs[pair.Id] = pair
+	}
+
+	p.loaded = true
+	return nil
+}
+
+func (p *PaperTrading) nextId() int64 {
+	p.seq++
+	return p.seq
+}
+
+func (p *PaperTrading) walletLocked(currency_id int) *paperWallet {
+	w, ok := p.wallets[currency_id]
+	if !ok {
+		w = &paperWallet{id: p.nextId(), currency_id: currency_id}
+		p.wallets[currency_id] = w
+	}
+	return w
+}
+
+// pairFees returns fees of pair from CurrencyPairFeeService, falling back to the pair fee percents
+func (p *PaperTrading) pairFees(ctx context.Context, pair CurrencyPair) Fees {
+	p.mu.Lock()
+	fees, ok := p.fees[pair.Id]
+	p.mu.Unlock()
+	if ok {
+		return fees
+	}
+
+	res, err := p.market.NewCurrencyPairFeeService().CurrencyPairId(pair.Id).Do(ctx)
+	if err != nil {
+		p.market.debug("paper trading fees of pair %d: %s", pair.Id, err)
+		hundred := NewDecimalFromInt(100)
+		return Fees{
+			BuyFee:  pair.BuyFeePercent.Div(hundred, analyticsPlaces).Normalize(),
+			SellFee: pair.SellFeePercent.Div(hundred, analyticsPlaces).Normalize(),
+		}
+	}
+
+	p.mu.Lock()
+	p.fees[pair.Id] = *res
+	p.mu.Unlock()
+	return *res
+}
+
+// Sync fills resting orders and triggers stop orders from public trades and order books of their pairs
+func (p *PaperTrading) Sync(ctx context.Context) error {
+	p.mu.Lock()
+	pair_ids := []int{}
+	seen := map[int]bool{}
+	for _, o := range p.orders {
+		if o.isActive() && !seen[o.CurrencyPairId] {
+			seen[o.CurrencyPairId] = true
+			pair_ids = append(pair_ids, o.CurrencyPairId)
+		}
+	}
+	p.mu.Unlock()
+	sort.Ints(pair_ids)
+
+	for _, pair_id := range pair_ids {
+		if err := p.syncPair(ctx, pair_id); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	p.synced = p.now()
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *PaperTrading) syncPair(ctx context.Context, pair_id int) error {
+	trades, err := p.market.NewCurrencyPairTradesService().CurrencyPairId(pair_id).Sort(SortDesc).Limit(paperTradesLimit).Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	book, err := p.market.NewCurrencyPairOrderbookService().CurrencyPairId(pair_id).Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	pair := p.pairs[pair_id]
+	p.mu.Unlock()
+	fees := p.pairFees(ctx, pair)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pruneUsedLocked(pair_id, book)
+
+	sort.Slice(trades, func(i, j int) bool { return trades[i].Id < trades[j].Id })
+	for _, t := range trades {
+		if t.Id <= p.last_trade[pair_id] {
+			continue
+		}
+		p.last_trade[pair_id] = t.Id
+		p.last_price[pair_id] = t.Price
+
+		p.triggerStopsLocked(pair, fees, book)
+
+		// Trade amount is shared by resting orders in price priority
+		left := t.Amount
+		for _, o := range p.restingLocked(pair_id) {
+			if !left.IsPositive() {
+				break
+			}
+			if (o.isBuy() && t.Price.GreaterThan(o.Price)) || (!o.isBuy() && t.Price.LessThan(o.Price)) {
+				continue
+			}
+			qty := MinDecimal(left, o.remaining())
+			p.fillLocked(pair, fees, o, qty, o.Price)
+			// The trade took book liquidity at its price, the book may still show it
+			p.useLocked(pair_id, usedKey(!o.isBuy(), t.Price), qty)
+			left = left.Sub(qty)
+		}
+	}
+
+	// The book moved through resting orders: crossing levels fill them at their price
+	bids, asks := book.Levels(0)
+	for _, o := range p.restingLocked(pair_id) {
+		levels := bids
+		if o.isBuy() {
+			levels = asks
+		}
+		p.takeLocked(pair, fees, o, levels, false)
+	}
+
+	return nil
+}
+
+// restingLocked returns active limit orders of pair, best prices first
+func (p *PaperTrading) restingLocked(pair_id int) []*paperOrder {
+	res := []*paperOrder{}
+	for _, o := range p.orders {
+		if o.CurrencyPairId == pair_id && o.isActive() && !o.isStop() {
+			res = append(res, o)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if a.isBuy() != b.isBuy() {
+			return a.isBuy()
+		}
+		if !a.Price.Equal(b.Price) {
+			if a.isBuy() {
+				return a.Price.GreaterThan(b.Price)
+			}
+			return a.Price.LessThan(b.Price)
+		}
+		return a.Id < b.Id
+	})
+	return res
+}
+
+func (p *PaperTrading) triggerStopsLocked(pair CurrencyPair, fees Fees, book *OrderBook) {
+	last, ok := p.last_price[pair.Id]
+	if !ok {
+		return
+	}
+
+	for _, o := range p.orders {
+		if o.CurrencyPairId != pair.Id || !o.isActive() || !o.isStop() {
+			continue
+		}
+		if (o.Type == OrderType_STOP_LIMIT_BUY && last.LessThan(o.TriggerPrice)) ||
+			(o.Type == OrderType_STOP_LIMIT_SELL && last.GreaterThan(o.TriggerPrice)) {
+			continue
+		}
+		p.activateLocked(pair, fees, o, book)
+	}
+}
+
+// activateLocked turns stop order into limit order and takes the book crossing its price
+func (p *PaperTrading) activateLocked(pair CurrencyPair, fees Fees, o *paperOrder, book *OrderBook) {
+	if o.Type == OrderType_STOP_LIMIT_BUY {
+		o.Type = OrderType_BUY
+	}
+	if o.Type == OrderType_STOP_LIMIT_SELL {
+		o.Type = OrderType_SELL
+	}
+
+	bids, asks := book.Levels(0)
+	levels := bids
+	if o.isBuy() {
+		levels = asks
+	}
+	p.takeLocked(pair, fees, o, levels, true)
+}
+
+// takeLocked fills o from levels crossing its price, at level prices when taker or at the order price otherwise
+func (p *PaperTrading) takeLocked(pair CurrencyPair, fees Fees, o *paperOrder, levels []Order, taker bool) {
+	for _, level := range levels {
+		if !o.remaining().IsPositive() {
+			return
+		}
+		if (o.isBuy() && level.Price.GreaterThan(o.Price)) || (!o.isBuy() && level.Price.LessThan(o.Price)) {
+			return
+		}
+
+		key := usedKey(!o.isBuy(), level.Price)
+		qty := MinDecimal(level.Amount.Sub(p.used[pair.Id][key]), o.remaining())
+		if !qty.IsPositive() {
+			continue
+		}
+
+		price := o.Price
+		if taker {
+			price = level.Price
+		}
+		p.fillLocked(pair, fees, o, qty, price)
+		p.useLocked(pair.Id, key, qty)
+	}
+}
+
+// useLocked records qty of book level key of pair as taken by simulated fills
+func (p *PaperTrading) useLocked(pair_id int, key string, qty Decimal) {
+	used := p.used[pair_id]
+	if used == nil {
+		used = map[string]Decimal{}
+		p.used[pair_id] = used
+	}
+	used[key] = used[key].Add(qty)
+}
+
+func usedKey(bid bool, price Decimal) string {
+	if bid {
+		return "bid:" + price.Normalize().String()
+	}
+	return "ask:" + price.Normalize().String()
+}
+
+// pruneUsedLocked forgets taken liquidity of levels which are gone or shrank in the fresh book
+func (p *PaperTrading) pruneUsedLocked(pair_id int, book *OrderBook) {
+	used := p.used[pair_id]
+	if len(used) == 0 {
+		return
+	}
+
+	levels := map[string]Decimal{}
+	bids, asks := book.Levels(0)
+	for _, level := range bids {
+		levels[usedKey(true, level.Price)] = level.Amount
+	}
+	for _, level := range asks {
+		levels[usedKey(false, level.Price)] = level.Amount
+	}
+
+	for key, amount := range used {
+		level, ok := levels[key]
+		if !ok {
+			delete(used, key)
+			continue
+		}
+		used[key] = MinDecimal(amount, level)
+	}
+}
+
+// fillLocked executes qty of o at price, unused frozen funds of buys are returned on every fill
+func (p *PaperTrading) fillLocked(pair CurrencyPair, fees Fees, o *paperOrder, qty, price Decimal) {
+	if !qty.IsPositive() {
+		return
+	}
+
+	now := p.now()
+	quote := qty.Mul(price)
+	base := p.walletLocked(pair.CurrencyId)
+	market := p.walletLocked(pair.MarketCurrencyId)
+
+	trade := Trade{
+		Id:        p.nextId(),
+		Price:     price,
+		Amount:    qty,
+		Timestamp: NewTime(now),
+	}
+
+	var fee Fee
+	if o.isBuy() {
+		frozen := qty.Mul(o.Price)
+		o.frozen = o.frozen.Sub(frozen)
+		market.frozen = market.frozen.Sub(frozen)
+		market.balance = market.balance.Add(frozen.Sub(quote))
+
+		fee = Fee{CurrencyId: pair.CurrencyId, Amount: qty.Mul(fees.BuyFee).Round(int32(p.currencies[pair.CurrencyId].Precision))}
+		base.balance = base.balance.Add(qty.Sub(fee.Amount))
+
+		trade.BuyOrderId = o.Id
+		trade.TradeType = TradeType_BUY
+	} else {
+		o.frozen = o.frozen.Sub(qty)
+		base.frozen = base.frozen.Sub(qty)
+
+		fee = Fee{CurrencyId: pair.MarketCurrencyId, Amount: quote.Mul(fees.SellFee).Round(int32(p.currencies[pair.MarketCurrencyId].Precision))}
+		market.balance = market.balance.Add(quote.Sub(fee.Amount))
+
+		trade.SellOrderId = o.Id
+		trade.TradeType = TradeType_SELL
+	}
+
+	o.ProcessedAmount = o.ProcessedAmount.Add(qty)
+	o.Timestamp = NewTime(now)
+	o.trades = append(o.trades, trade)
+	if fee.Amount.IsPositive() {
+		fee.Id = p.nextId()
+		fee.Timestamp = NewTime(now)
+		o.fees = append(o.fees, fee)
+	}
+
+	if !o.remaining().IsPositive() {
+		p.closeLocked(pair, o, OrderStatus_FINISHED)
+	}
+}
+
+// closeLocked finishes or cancels order and unfreezes funds left
+func (p *PaperTrading) closeLocked(pair CurrencyPair, o *paperOrder, status OrderStatus) {
+	if o.frozen.Sign() != 0 {
+		w := p.walletLocked(pair.CurrencyId)
+		if o.isBuy() {
+			w = p.walletLocked(pair.MarketCurrencyId)
+		}
+		w.frozen = w.frozen.Sub(o.frozen)
+		w.balance = w.balance.Add(o.frozen)
+		o.frozen = Decimal{}
+	}
+
+	if status == OrderStatus_CANCELLED && o.ProcessedAmount.IsPositive() {
+		status = OrderStatus_PARTIAL
+	}
+	o.Status = status
+	o.Timestamp = NewTime(p.now())
+}
+
+func paperDecimal(form url.Values, key string) (Decimal, error) {
+	v := form.Get(key)
+	if v == "" {
+		return Decimal{}, nil
+	}
+
+	d, err := ParseDecimal(v)
+	if err != nil {
+		return Decimal{}, &paperError{http.StatusUnprocessableEntity, fmt.Sprintf("Invalid %s", key)}
+	}
+	return d, nil
+}
+
+func paperId(arg string) (int64, error) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, &paperError{http.StatusNotFound, "Not found"}
+	}
+	return id, nil
+}
+
+func paperParam(form url.Values, key string, def int64) (int64, error) {
+	v := form.Get(key)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, &paperError{http.StatusUnprocessableEntity, fmt.Sprintf("Invalid %s", key)}
+	}
+	return n, nil
+}
+
+// paperPage cuts page of slice v by offset and limit
+func paperPage(v interface{}, offset, limit int64) interface{} {
+	rv := reflect.ValueOf(v)
+	n := int64(rv.Len())
+	if offset > n {
+		offset = n
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	rv = rv.Slice(int(offset), int(n))
+	if limit >= 0 && limit < int64(rv.Len()) {
+		rv = rv.Slice(0, int(limit))
+	}
+	return rv.Interface()
+}
+
+func (p *PaperTrading) createOrder(ctx context.Context, arg string, form url.Values) (interface{}, error) {
+	pair_id, err := paperId(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	pair, ok := p.pairs[int(pair_id)]
+	p.mu.Unlock()
+	if !ok {
+		return nil, &paperError{http.StatusNotFound, "Currency pair not found"}
+	}
+	if !pair.Active || pair.Delisted {
+		return nil, &paperError{http.StatusBadRequest, "Currency pair is not active"}
+	}
+
+	amount, err := paperDecimal(form, "amount")
+	if err != nil {
+		return nil, err
+	}
+	price, err := paperDecimal(form, "price")
+	if err != nil {
+		return nil, err
+	}
+	trigger, err := paperDecimal(form, "trigger_price")
+	if err != nil {
+		return nil, err
+	}
+
+	order_type := OrderType(form.Get("type"))
+	switch order_type {
+	case OrderType_BUY, OrderType_SELL:
+	case OrderType_STOP_LIMIT_BUY, OrderType_STOP_LIMIT_SELL:
+		if !trigger.IsPositive() {
+			return nil, &paperError{http.StatusUnprocessableEntity, "Invalid trigger price"}
+		}
+	default:
+		return nil, &paperError{http.StatusUnprocessableEntity, "Invalid order type"}
+	}
+	if !amount.IsPositive() || amount.LessThan(pair.MinOrderAmount) {
+		return nil, &paperError{http.StatusUnprocessableEntity, "Invalid amount: less than minimal order amount"}
+	}
+	if !price.IsPositive() {
+		return nil, &paperError{http.StatusUnprocessableEntity, "Invalid price"}
+	}
+
+	book, err := p.market.NewCurrencyPairOrderbookService().CurrencyPairId(pair.Id).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fees := p.pairFees(ctx, pair)
+
+	// Trades made before the order can not fill it
+	if _, ok := p.lastTrade(pair.Id); !ok {
+		trades, err := p.market.NewCurrencyPairTradesService().CurrencyPairId(pair.Id).Sort(SortDesc).Limit(1).Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		p.last_trade[pair.Id] = 0
+		if len(trades) > 0 {
+			p.last_trade[pair.Id] = trades[0].Id
+			p.last_price[pair.Id] = trades[0].Price
+		}
+		p.mu.Unlock()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pruneUsedLocked(pair.Id, book)
+
+	o := &paperOrder{}
+	o.Id = p.nextId()
+	o.CurrencyPairId = pair.Id
+	o.Price = price
+	o.TriggerPrice = trigger
+	o.InitialAmount = amount
+	o.Type = order_type
+	o.OriginalType = order_type
+	o.Status = OrderStatus_PENDING
+	now := p.now()
+	o.Created = NewTime(now)
+	o.Timestamp = NewTime(now)
+
+	// Funds are frozen at the limit price
+	var w *paperWallet
+	if o.isBuy() {
+		o.frozen = amount.Mul(price)
+		w = p.walletLocked(pair.MarketCurrencyId)
+	} else {
+		o.frozen = amount
+		w = p.walletLocked(pair.CurrencyId)
+	}
+	if w.balance.LessThan(o.frozen) {
+		return nil, &paperError{http.StatusBadRequest, "Insufficient balance"}
+	}
+	w.balance = w.balance.Sub(o.frozen)
+	w.frozen = w.frozen.Add(o.frozen)
+
+	p.orders[o.Id] = o
+
+	if o.isStop() {
+		p.triggerStopsLocked(pair, fees, book)
+	} else {
+		p.activateLocked(pair, fees, o, book)
+	}
+
+	return o.OrderInfo, nil
+}
+
+func (p *PaperTrading) lastTrade(pair_id int) (int64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id, ok := p.last_trade[pair_id]
+	return id, ok
+}
+
+// ordersLocked returns orders matching f sorted by id
+func (p *PaperTrading) ordersLocked(f func(o *paperOrder) bool) []*paperOrder {
+	res := []*paperOrder{}
+	for _, o := range p.orders {
+		if f(o) {
+			res = append(res, o)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Id < res[j].Id })
+	return res
+}
+
+func (p *PaperTrading) openOrders(arg string) (interface{}, error) {
+	pair_id := int64(-1)
+	if arg != "" {
+		id, err := paperId(arg)
+		if err != nil {
+			return nil, err
+		}
+		pair_id = id
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	res := []OrderInfo{}
+	for _, o := range p.ordersLocked(func(o *paperOrder) bool {
+		return o.isActive() && (pair_id < 0 || int64(o.CurrencyPairId) == pair_id)
+	}) {
+		res = append(res, o.OrderInfo)
+	}
+	return res, nil
+}
+
+func (p *PaperTrading) cancelOrders(arg string) (interface{}, error) {
+	pair_id := int64(-1)
+	if arg != "" {
+		id, err := paperId(arg)
+		if err != nil {
+			return nil, err
+		}
+		pair_id = id
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	res := DeletedOrders{
+		Processing: []OrderInfo{},
+		Pending:    []OrderInfo{},
+		Message:    "Orders were put into processing queue",
+	}
+	for _, o := range p.ordersLocked(func(o *paperOrder) bool {
+		return o.isActive() && (pair_id < 0 || int64(o.CurrencyPairId) == pair_id)
+	}) {
+		p.closeLocked(p.pairs[o.CurrencyPairId], o, OrderStatus_CANCELLED)
+		res.Processing = append(res.Processing, o.OrderInfo)
+	}
+	return res, nil
+}
+
+func (p *PaperTrading) order(arg string) (paperOrder, error) {
+	id, err := paperId(arg)
+	if err != nil {
+		return paperOrder{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	o, ok := p.orders[id]
+	if !ok {
+		return paperOrder{}, &paperError{http.StatusNotFound, "Order not found"}
+	}
+	return *o, nil
+}
+
+func (p *PaperTrading) cancelOrder(arg string) (interface{}, error) {
+	id, err := paperId(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	o, ok := p.orders[id]
+	if !ok {
+		return nil, &paperError{http.StatusNotFound, "Order not found"}
+	}
+
+	res := DeletedOrders{
+		Processing: []OrderInfo{},
+		Pending:    []OrderInfo{},
+	}
+	if o.isActive() {
+		p.closeLocked(p.pairs[o.CurrencyPairId], o, OrderStatus_CANCELLED)
+		res.Processing = append(res.Processing, o.OrderInfo)
+		res.Message = "Order was put into processing queue"
+	} else {
+		res.Pending = append(res.Pending, o.OrderInfo)
+		res.Message = "Order is not active"
+	}
+	return res, nil
+}
+
+func (p *PaperTrading) orderDetail(arg string) (interface{}, error) {
+	o, err := p.order(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return TradeOrderDetail{
+		Id:             o.Id,
+		CurrencyPairId: o.CurrencyPairId,
+		Price:          o.Price,
+		InitialAmount:  o.InitialAmount,
+		Type:           string(o.OriginalType),
+		Created:        o.Created,
+		Timestamp:      o.Timestamp,
+		Status:         string(o.Status),
+		Trades:         append([]Trade{}, o.trades...),
+		Fees:           append([]Fee{}, o.fees...),
+	}, nil
+}
+
+// history serves OrdersHistoryService, newest orders first
+func (p *PaperTrading) history(form url.Values) (interface{}, error) {
+	pair_id, err := paperParam(form, "currencyPairId", -1)
+	if err != nil {
+		return nil, err
+	}
+	from, err := paperParam(form, "timeStart", 0)
+	if err != nil {
+		return nil, err
+	}
+	till, err := paperParam(form, "timeEnd", p.now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	limit, err := paperParam(form, "limit", 100)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := paperParam(form, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	status := OrderStatus(form.Get("orderStatus"))
+	if status == "" {
+		status = OrderStatus_ALL
+	}
+
+	p.mu.Lock()
+	orders := p.ordersLocked(func(o *paperOrder) bool {
+		if o.isActive() || (pair_id >= 0 && int64(o.CurrencyPairId) != pair_id) {
+			return false
+		}
+		if o.Timestamp.Unix() < from || o.Timestamp.Unix() > till {
+			return false
+		}
+		switch status {
+		case OrderStatus_ALL:
+			return true
+		case OrderStatus_WITH_TRADES:
+			return len(o.trades) > 0
+		}
+		return o.Status == status
+	})
+	res := []OrderInfo{}
+	for i := len(orders) - 1; i >= 0; i-- {
+		res = append(res, orders[i].OrderInfo)
+	}
+	p.mu.Unlock()
+
+	return paperPage(res, offset, limit), nil
+}
+
+// trades serves CurrencyPairTradesHistoryService, newest trades first
+func (p *PaperTrading) trades(arg string, form url.Values) (interface{}, error) {
+	pair_id, err := paperId(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := paperParam(form, "timeStart", 0)
+	if err != nil {
+		return nil, err
+	}
+	till, err := paperParam(form, "timeEnd", p.now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	limit, err := paperParam(form, "limit", 100)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := paperParam(form, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	res := []Trade{}
+	for _, o := range p.ordersLocked(func(o *paperOrder) bool { return int64(o.CurrencyPairId) == pair_id }) {
+		for _, t := range o.trades {
+			if t.Timestamp.Unix() >= from && t.Timestamp.Unix() <= till {
+				res = append(res, t)
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Id > res[j].Id })
+	return paperPage(res, offset, limit), nil
+}
+
+func (p *PaperTrading) walletInfoLocked(w *paperWallet) Wallet {
+	c := p.currencies[w.currency_id]
+	return Wallet{
+		Id:            w.id,
+		CurrencyId:    w.currency_id,
+		Delisted:      c.Delisted,
+		CurrencyCode:  c.Code,
+		CurrencyName:  c.Name,
+		Balance:       w.balance,
+		FrozenBalance: w.frozen,
+	}
+}
+
+func (p *PaperTrading) walletList() []Wallet {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	res := []Wallet{}
+	for _, w := range p.wallets {
+		res = append(res, p.walletInfoLocked(w))
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Id < res[j].Id })
+	return res
+}
+
+func (p *PaperTrading) wallet(arg string) (interface{}, error) {
+	id, err := paperId(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, w := range p.wallets {
+		if w.id == id {
+			return p.walletInfoLocked(w), nil
+		}
+	}
+	return nil, &paperError{http.StatusNotFound, "Wallet not found"}
+}
+
+// Balances returns available and frozen balances by currency code
+func (p *PaperTrading) Balances() map[string]Balance {
+	res := map[string]Balance{}
+	for _, w := range p.walletList() {
+		res[w.CurrencyCode] = Balance{
+			Balance:       w.Balance,
+			FrozenBalance: w.FrozenBalance,
+			TotalBalance:  w.Balance.Add(w.FrozenBalance),
+		}
+	}
+	return res
+}
@@ -0,0 +1,94 @@
+package stex_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+	"github.com/vladivolo/stex-api/stextest"
+)
+
+// testClock is a settable time source
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func TestPaperTradingRestingFill(t *testing.T) {
+	srv := stextest.NewServer()
+	defer srv.Close()
+
+	seller := srv.AddUser("seller")
+	buyer := srv.AddUser("buyer")
+	srv.AddUser("paper")
+	srv.SetBalance(seller, "ETH", stex.MustParseDecimal("10"))
+	srv.SetBalance(buyer, "BTC", stex.MustParseDecimal("10"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	clock := &testClock{now: time.Now()}
+	p := stex.NewPaperTrading(map[string]stex.Decimal{"BTC": stex.MustParseDecimal("1")}).Clock(clock.Now)
+	c := srv.Client("paper").PaperTrade(p)
+
+	order, err := c.NewCreateOrderService().CurrencyPairId(1).OrderType(stex.OrderType_BUY).
+		Amount(stex.MustParseDecimal("2")).Price(stex.MustParseDecimal("0.02")).Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1 ETH is traded at 0.019 and 1 ETH is left in the book at that price
+	if _, err = srv.PlaceOrder(seller, 1, stex.OrderType_SELL, stex.MustParseDecimal("2"), stex.MustParseDecimal("0.019"), stex.Decimal{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = srv.PlaceOrder(buyer, 1, stex.OrderType_BUY, stex.MustParseDecimal("1"), stex.MustParseDecimal("0.019"), stex.Decimal{}); err != nil {
+		t.Fatal(err)
+	}
+
+	processed := func() stex.Decimal {
+		info, err := c.NewOrderInfoService().OrderId(order.Id).Do(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.ProcessedAmount
+	}
+
+	// Reads within SyncInterval do not sync
+	if got := processed(); !got.IsZero() {
+		t.Errorf("processed before sync = %s", got)
+	}
+
+	clock.Advance(10 * time.Second)
+	if got := processed(); !got.Equal(stex.MustParseDecimal("1")) {
+		t.Errorf("processed after sync = %s, want 1 without the traded liquidity taken again", got)
+	}
+
+	// Later syncs do not take the traded liquidity either
+	if err = p.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := processed(); !got.Equal(stex.MustParseDecimal("1")) {
+		t.Errorf("processed after second sync = %s", got)
+	}
+
+	balances := p.Balances()
+	if btc := balances["BTC"]; !btc.Balance.Equal(stex.MustParseDecimal("0.96")) || !btc.FrozenBalance.Equal(stex.MustParseDecimal("0.02")) {
+		t.Errorf("BTC balance = %+v", btc)
+	}
+}
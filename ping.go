@@ -6,7 +6,7 @@ import (
 )
 
 type Ping struct {
-	Timestamp int64 `json:"server_timestamp"`
+	Timestamp Time `json:"server_timestamp"`
 }
 
 // PingService ping server
@@ -22,6 +22,9 @@ func (s *PingService) Do(ctx context.Context, opts ...RequestOption) (*Ping, err
 		secType:  secTypeNone,
 	}
 	data, err := s.c.callAPI(ctx, r, opts...)
+	if err != nil {
+		return nil, err
+	}
 
 	res := struct {
 		APIError
@@ -13,10 +13,10 @@ type ProfileVerifications struct {
 }
 
 type TradingFeeLevel struct {
-	NotVerified  string `json:"not_verified"`
-	Cryptonomica string `json:"cryptonomica"`
-	Privatbank   string `json:"privatbank"`
-	Stex         string `json:"stex"`
+	NotVerified  Decimal `json:"not_verified"`
+	Cryptonomica Decimal `json:"cryptonomica"`
+	Privatbank   Decimal `json:"privatbank"`
+	Stex         Decimal `json:"stex"`
 }
 
 type ReferralProgram struct {
@@ -26,10 +26,10 @@ type ReferralProgram struct {
 }
 
 type Balance struct {
-	Balance       string `json:"balance"`
-	FrozenBalance string `json:"frozen_balance"`
-	BonusBalance  string `json:"bonus_balance"`
-	TotalBalance  string `json:"total_balance"`
+	Balance       Decimal `json:"balance"`
+	FrozenBalance Decimal `json:"frozen_balance"`
+	BonusBalance  Decimal `json:"bonus_balance"`
+	TotalBalance  Decimal `json:"total_balance"`
 }
 
 type ProfileInfo struct {
@@ -44,18 +44,18 @@ type ProfileInfo struct {
 }
 
 type Wallet struct {
-	Id              int64             `json:"id"`
-	CurrencyId      int               `json:"currency_id"`
-	Delisted        bool              `json:"delisted"`
-	Disabled        bool              `json:"disabled"`
-	DisableDeposits bool              `json:"disable_deposits"`
-	CurrencyCode    string            `json:"currency_code"`
-	CurrencyName    string            `json:"currency_name"`
-	OfficialUrl     string            `json:"official_url"`
-	Rates           map[string]string `json:"rates"`
-	Balance         string            `json:"balance"`
-	FrozenBalance   string            `json:"frozen_balance"`
-	BonusBalance    string            `json:"bonus_balance"`
+	Id              int64              `json:"id"`
+	CurrencyId      int                `json:"currency_id"`
+	Delisted        bool               `json:"delisted"`
+	Disabled        bool               `json:"disabled"`
+	DisableDeposits bool               `json:"disable_deposits"`
+	CurrencyCode    string             `json:"currency_code"`
+	CurrencyName    string             `json:"currency_name"`
+	OfficialUrl     string             `json:"official_url"`
+	Rates           map[string]Decimal `json:"rates"`
+	Balance         Decimal            `json:"balance"`
+	FrozenBalance   Decimal            `json:"frozen_balance"`
+	BonusBalance    Decimal            `json:"bonus_balance"`
 }
 
 type Address struct {
@@ -69,19 +69,19 @@ type Address struct {
 }
 
 type WalletAdv struct {
-	Id                            int64             `json:"id"`
-	CurrencyId                    int               `json:"currency_id"`
-	Delisted                      bool              `json:"delisted"`
-	Disabled                      bool              `json:"disabled"`
-	DisableDeposits               bool              `json:"disable_deposits"`
-	Code                          string            `json:"code"`
-	Balance                       string            `json:"balance"`
-	FrozenBalance                 string            `json:"frozen_balance"`
-	BonusBalance                  string            `json:"bonus_balance"`
-	DepositAddress                Address           `json:"deposit_address"`
-	MultiDepositAddress           Address           `json:"multi_deposit_address"`
-	WithdrawalAdditionalFieldName string            `json:"withdrawal_additional_field_name"`
-	Rates                         map[string]string `json:"rates"`
+	Id                            int64              `json:"id"`
+	CurrencyId                    int                `json:"currency_id"`
+	Delisted                      bool               `json:"delisted"`
+	Disabled                      bool               `json:"disabled"`
+	DisableDeposits               bool               `json:"disable_deposits"`
+	Code                          string             `json:"code"`
+	Balance                       Decimal            `json:"balance"`
+	FrozenBalance                 Decimal            `json:"frozen_balance"`
+	BonusBalance                  Decimal            `json:"bonus_balance"`
+	DepositAddress                Address            `json:"deposit_address"`
+	MultiDepositAddress           Address            `json:"multi_deposit_address"`
+	WithdrawalAdditionalFieldName string             `json:"withdrawal_additional_field_name"`
+	Rates                         map[string]Decimal `json:"rates"`
 }
 
 type ProfileInfoService struct {
@@ -271,15 +271,15 @@ func (s *ProfileWalletAddressInfoService) Do(ctx context.Context, opts ...Reques
 		secType:  secTypeAPIKey,
 	}
 
+	if s.protocol_id != nil {
+		r.setParam("protocol_id", *s.protocol_id)
+	}
+
 	data, err := s.c.callAPI(ctx, r, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	if s.protocol_id != nil {
-		r.setParam("protocol_id", *s.protocol_id)
-	}
-
 	res := struct {
 		APIError
 		Data Address `json:"data"`
@@ -321,15 +321,15 @@ func (s *ProfileWalletAddressCreateService) Do(ctx context.Context, opts ...Requ
 		secType:  secTypeAPIKey,
 	}
 
+	if s.protocol_id != nil {
+		r.setParam("protocol_id", *s.protocol_id)
+	}
+
 	data, err := s.c.callAPI(ctx, r, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	if s.protocol_id != nil {
-		r.setParam("protocol_id", *s.protocol_id)
-	}
-
 	res := struct {
 		APIError
 		Data Address `json:"data"`
@@ -7,12 +7,12 @@ import (
 )
 
 type UpdateBalance struct {
-	Id            int64  `json:"id"`
-	Code          string `json:"currency_code"`
-	Balance       string `json:"balance"`
-	FrozenBalance string `json:"frozen_balance"`
-	BonusBalance  string `json:"bonus_balance"`
-	TotalBalance  string `json:"total_balance"`
+	Id            int64   `json:"id"`
+	Code          string  `json:"currency_code"`
+	Balance       Decimal `json:"balance"`
+	FrozenBalance Decimal `json:"frozen_balance"`
+	BonusBalance  Decimal `json:"bonus_balance"`
+	TotalBalance  Decimal `json:"total_balance"`
 }
 
 type WebsocketUserBalanceUpdateChannelService struct {
@@ -21,6 +21,11 @@ type WebsocketUserBalanceUpdateChannelService struct {
 	wallet_id *int64
 
 	f func(string, UpdateBalance)
+
+	channel    string
+	handler_id int64
+
+	streamConfig
 }
 
 func (s *WebsocketUserBalanceUpdateChannelService) Do() error {
@@ -30,17 +35,20 @@ func (s *WebsocketUserBalanceUpdateChannelService) Do() error {
 
 	channel := fmt.Sprintf("private-balance_changed_w_%d", *s.wallet_id)
 
-	err := s.c.Subscribe(channel, true)
+	handler_id, err := s.c.handle("App\\\\Events\\\\BalanceChanged", channel, func(h *ws.Channel, msg UpdateBalance) {
+		s.f("private-balance", msg)
+	})
 	if err != nil {
 		return err
 	}
 
-	err = s.c.C().On("App\\\\Events\\\\BalanceChanged", func(h *ws.Channel, msg UpdateBalance) {
-		s.f("private-balance", msg)
-	})
+	err = s.c.Subscribe(channel, true)
 	if err != nil {
+		s.c.removeHandler(handler_id)
 		return err
 	}
+	s.handler_id = handler_id
+	s.channel = channel
 
 	return nil
 }
@@ -54,3 +62,23 @@ func (s *WebsocketUserBalanceUpdateChannelService) OnMessage(f func(string, Upda
 	s.f = f
 	return s
 }
+
+// Unsubscribe stops calls of OnMessage and releases the channel subscription, the Stream channel is closed
+func (s *WebsocketUserBalanceUpdateChannelService) Unsubscribe() error {
+	if s.stream != nil {
+		return s.stream.close()
+	}
+	return s.unsubscribe()
+}
+
+func (s *WebsocketUserBalanceUpdateChannelService) unsubscribe() error {
+	if s.channel == "" {
+		return fmt.Errorf("not subscribed")
+	}
+
+	s.c.removeHandler(s.handler_id)
+	channel := s.channel
+	s.channel = ""
+
+	return s.c.Unsubscribe(channel)
+}
@@ -1,40 +1,52 @@
 package stex
 
 import (
+	"fmt"
+
 	ws "github.com/vladivolo/golang-socketio"
 )
 
 type RateMessage struct {
-	Id              int    `json:"id"`
-	ClosedOrders    int    `json:"closedOrders"`
-	LastPriceDayAgo string `json:"lastPriceDayAgo"`
-	MaxBuy          string `json:"maxBuy"`
-	MinSell         string `json:"minSell"`
-	VolumeSum       string `json:"volumeSum"`
-	MarketVolume    string `json:"market_volume"`
-	LastPrice       string `json:"lastPrice"`
-	Spread          string `json:"spread"`
-	Precision       int    `json:"precision"`
+	Id              int     `json:"id"`
+	ClosedOrders    int     `json:"closedOrders"`
+	LastPriceDayAgo Decimal `json:"lastPriceDayAgo"`
+	MaxBuy          Decimal `json:"maxBuy"`
+	MinSell         Decimal `json:"minSell"`
+	VolumeSum       Decimal `json:"volumeSum"`
+	MarketVolume    Decimal `json:"market_volume"`
+	LastPrice       Decimal `json:"lastPrice"`
+	Spread          Decimal `json:"spread"`
+	Precision       int     `json:"precision"`
 }
 
 type WebsocketRateChannelService struct {
 	c *WssClient
 
 	f func(string, RateMessage)
+
+	channel    string
+	handler_id int64
+
+	streamConfig
 }
 
 func (s *WebsocketRateChannelService) Do() error {
-	err := s.c.Subscribe("rate", false)
+	channel := "rate"
+
+	handler_id, err := s.c.handle("App\\\\Events\\\\Ticker", channel, func(h *ws.Channel, msg RateMessage) {
+		s.f("rate", msg)
+	})
 	if err != nil {
 		return err
 	}
 
-	err = s.c.C().On("App\\\\Events\\\\Ticker", func(h *ws.Channel, msg RateMessage) {
-		s.f("rate", msg)
-	})
+	err = s.c.Subscribe(channel, false)
 	if err != nil {
+		s.c.removeHandler(handler_id)
 		return err
 	}
+	s.handler_id = handler_id
+	s.channel = channel
 
 	return nil
 }
@@ -43,3 +55,23 @@ func (s *WebsocketRateChannelService) OnMessage(f func(string, RateMessage)) *We
 	s.f = f
 	return s
 }
+
+// Unsubscribe stops calls of OnMessage and releases the channel subscription, the Stream channel is closed
+func (s *WebsocketRateChannelService) Unsubscribe() error {
+	if s.stream != nil {
+		return s.stream.close()
+	}
+	return s.unsubscribe()
+}
+
+func (s *WebsocketRateChannelService) unsubscribe() error {
+	if s.channel == "" {
+		return fmt.Errorf("not subscribed")
+	}
+
+	s.c.removeHandler(s.handler_id)
+	channel := s.channel
+	s.channel = ""
+
+	return s.c.Unsubscribe(channel)
+}
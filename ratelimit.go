@@ -0,0 +1,218 @@
+package stex
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RateLimitGroup string
+
+const (
+	// Public market data endpoints (secTypeNone)
+	RateLimitPublic RateLimitGroup = "public"
+	// Authenticated endpoints (secTypeAPIKey) outside of /trading
+	RateLimitPrivate RateLimitGroup = "private"
+	// Authenticated /trading endpoints
+	RateLimitTrading RateLimitGroup = "trading"
+)
+
+// RateLimiter paces requests sent by Client
+type RateLimiter interface {
+	// Wait blocks until a request of the group may be sent or ctx is done
+	Wait(ctx context.Context, group RateLimitGroup) error
+	// Observe is called with every response so the limiter can follow the server feedback
+	Observe(group RateLimitGroup, statusCode int, header http.Header)
+}
+
+// RateLimit define a token bucket: Rate requests per second on average with bursts up to Burst requests
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// DefaultRateLimits returns conservative limits for every group. Tune them to the quota of your account.
+func DefaultRateLimits() map[RateLimitGroup]RateLimit {
+	return map[RateLimitGroup]RateLimit{
+		RateLimitPublic:  {Rate: 5, Burst: 10},
+		RateLimitPrivate: {Rate: 3, Burst: 5},
+		RateLimitTrading: {Rate: 3, Burst: 3},
+	}
+}
+
+const (
+	// Rate is never slowed down below this part of the configured one
+	rateLimitMinFactor = 0.1
+	// Part of the configured rate restored after every successful response
+	rateLimitRecovery = 0.05
+	// Pause after 429 without any hint from the server
+	rateLimitDefaultPause = time.Second
+)
+
+type tokenBucket struct {
+	limit   RateLimit
+	rate    float64
+	tokens  float64
+	last    time.Time
+	blocked time.Time
+}
+
+// reserve takes a token if one is available, otherwise returns how long to wait for it
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	if now.Before(b.blocked) {
+		return b.blocked.Sub(now)
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// TokenBucketLimiter is a RateLimiter with a separate token bucket for every group.
+// It pauses a group on 429 responses for Retry-After (or X-RateLimit-Reset) and halves its rate,
+// then restores the rate step by step with every successful response.
+type TokenBucketLimiter struct {
+	mu      sync.Mutex
+	buckets map[RateLimitGroup]*tokenBucket
+}
+
+// NewTokenBucketLimiter creates limiter with given limits. Groups without limit are not paced.
+func NewTokenBucketLimiter(limits map[RateLimitGroup]RateLimit) *TokenBucketLimiter {
+	l := &TokenBucketLimiter{
+		buckets: map[RateLimitGroup]*tokenBucket{},
+	}
+
+	now := time.Now()
+	for group, limit := range limits {
+		if limit.Rate <= 0 {
+			continue
+		}
+		if limit.Burst < 1 {
+			limit.Burst = 1
+		}
+		l.buckets[group] = &tokenBucket{
+			limit:  limit,
+			rate:   limit.Rate,
+			tokens: float64(limit.Burst),
+			last:   now,
+		}
+	}
+
+	return l
+}
+
+// Wait blocks until a token of the group is available. Returns ctx error if ctx is done or
+// its deadline expires before the token becomes available.
+func (l *TokenBucketLimiter) Wait(ctx context.Context, group RateLimitGroup) error {
+	for {
+		l.mu.Lock()
+		b, ok := l.buckets[group]
+		if !ok {
+			l.mu.Unlock()
+			return nil
+		}
+		wait := b.reserve(time.Now())
+		l.mu.Unlock()
+
+		if wait <= 0 {
+			return nil
+		}
+
+		if !sleepContext(ctx, wait) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return context.DeadlineExceeded
+		}
+	}
+}
+
+// Observe slows the group down on 429 or exhausted quota and speeds it up again on success
+func (l *TokenBucketLimiter) Observe(group RateLimitGroup, statusCode int, header http.Header) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[group]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	pause, hinted := retryAfter(header, now)
+
+	if statusCode == http.StatusTooManyRequests {
+		if !hinted {
+			pause = rateLimitDefaultPause
+		}
+		b.rate /= 2
+		if floor := b.limit.Rate * rateLimitMinFactor; b.rate < floor {
+			b.rate = floor
+		}
+		b.tokens = 0
+		if until := now.Add(pause); until.After(b.blocked) {
+			b.blocked = until
+		}
+		return
+	}
+
+	if header.Get("X-RateLimit-Remaining") == "0" && hinted {
+		b.tokens = 0
+		if until := now.Add(pause); until.After(b.blocked) {
+			b.blocked = until
+		}
+	}
+
+	if statusCode < 400 && b.rate < b.limit.Rate {
+		b.rate += b.limit.Rate * rateLimitRecovery
+		if b.rate > b.limit.Rate {
+			b.rate = b.limit.Rate
+		}
+	}
+}
+
+// retryAfter reads the pause requested by the server from Retry-After (seconds or HTTP date)
+// or X-RateLimit-Reset (unix timestamp or seconds)
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if header == nil {
+		return 0, false
+	}
+
+	if v := strings.TrimSpace(header.Get("Retry-After")); v != "" {
+		if sec, err := strconv.ParseFloat(v, 64); err == nil && sec >= 0 {
+			return time.Duration(sec * float64(time.Second)), true
+		}
+		if tm, err := http.ParseTime(v); err == nil {
+			if d := tm.Sub(now); d > 0 {
+				return d, true
+			}
+			return 0, true
+		}
+	}
+
+	if v := strings.TrimSpace(header.Get("X-RateLimit-Reset")); v != "" {
+		if sec, err := strconv.ParseInt(v, 10, 64); err == nil && sec >= 0 {
+			// Big values are unix timestamps, small ones are seconds to wait
+			if sec > 1000000000 {
+				if d := time.Unix(sec, 0).Sub(now); d > 0 {
+					return d, true
+				}
+				return 0, true
+			}
+			return time.Duration(sec) * time.Second, true
+		}
+	}
+
+	return 0, false
+}
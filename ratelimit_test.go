@@ -0,0 +1,84 @@
+package stex
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+		ok     bool
+	}{
+		{name: "none", header: http.Header{}},
+		{name: "seconds", header: http.Header{"Retry-After": {"3"}}, want: 3 * time.Second, ok: true},
+		{name: "fraction", header: http.Header{"Retry-After": {"0.5"}}, want: 500 * time.Millisecond, ok: true},
+		{name: "http date", header: http.Header{"Retry-After": {now.Add(2 * time.Second).Format(http.TimeFormat)}}, want: 2 * time.Second, ok: true},
+		{name: "past date", header: http.Header{"Retry-After": {now.Add(-time.Minute).Format(http.TimeFormat)}}, want: 0, ok: true},
+		{name: "reset seconds", header: http.Header{"X-Ratelimit-Reset": {"7"}}, want: 7 * time.Second, ok: true},
+		{name: "reset timestamp", header: http.Header{"X-Ratelimit-Reset": {"1577836810"}}, want: 10 * time.Second, ok: true},
+		{name: "garbage", header: http.Header{"Retry-After": {"soon"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := retryAfter(tt.header, now)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("retryAfter() = %s, %v, want %s, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	now := time.Now()
+	b := &tokenBucket{limit: RateLimit{Rate: 10, Burst: 2}, rate: 10, tokens: 2, last: now}
+
+	if d := b.reserve(now); d != 0 {
+		t.Fatalf("first token waits %s", d)
+	}
+	if d := b.reserve(now); d != 0 {
+		t.Fatalf("burst token waits %s", d)
+	}
+	if d := b.reserve(now); d != 100*time.Millisecond {
+		t.Fatalf("empty bucket waits %s, want 100ms", d)
+	}
+	if d := b.reserve(now.Add(100 * time.Millisecond)); d != 0 {
+		t.Fatalf("refilled token waits %s", d)
+	}
+}
+
+func TestTokenBucketLimiterObserve(t *testing.T) {
+	l := NewTokenBucketLimiter(map[RateLimitGroup]RateLimit{RateLimitTrading: {Rate: 10, Burst: 1}})
+	b := l.buckets[RateLimitTrading]
+
+	l.Observe(RateLimitTrading, http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}})
+	if b.rate != 5 {
+		t.Errorf("rate after 429 = %v, want 5", b.rate)
+	}
+	if wait := b.reserve(time.Now()); wait < 900*time.Millisecond {
+		t.Errorf("group is paused for %s, want about 1s", wait)
+	}
+
+	l.Observe(RateLimitTrading, http.StatusOK, http.Header{})
+	if b.rate != 5.5 {
+		t.Errorf("rate after success = %v, want 5.5", b.rate)
+	}
+
+	// Groups without limit are not paced
+	if err := l.Wait(context.Background(), RateLimitPublic); err != nil {
+		t.Errorf("unlimited group: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, RateLimitTrading); err != context.DeadlineExceeded {
+		t.Errorf("Wait past deadline = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,429 @@
+package stex
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoRecording is matched by errors.Is when Replayer has no recording for a request
+var ErrNoRecording = errors.New("stex: no recording for request")
+
+const redacted = "REDACTED"
+
+// Recording define a request and response pair made by callAPI
+type Recording struct {
+	Time     time.Time `json:"time"`
+	Method   string    `json:"method"`
+	Endpoint string    `json:"endpoint"`
+	// Path is the full path of the request URL including the path of Client.BaseURL
+	Path string `json:"path,omitempty"`
+	// Query and Form are url encoded with sorted keys
+	Query         string      `json:"query,omitempty"`
+	Form          string      `json:"form,omitempty"`
+	RequestHeader http.Header `json:"request_header,omitempty"`
+
+	StatusCode int         `json:"status_code,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	// Error of the transport when no response was received
+	Error string `json:"error,omitempty"`
+	// ErrorKind keeps the class of Error, so a replayed error is retried like the original one:
+	// "dial", "timeout", "eof", "net", "deadline", "canceled" or empty for other errors
+	ErrorKind string `json:"error_kind,omitempty"`
+}
+
+// Recorder appends every request and response pair of the client to a file as JSON lines.
+// Bearer tokens, cookies and OAuth tokens and secrets in forms and response bodies are redacted.
+type Recorder struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewRecorder opens file for appending recordings, the file is created if it does not exist
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{f: f}, nil
+}
+
+// Close closes the file
+func (rec *Recorder) Close() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return rec.f.Close()
+}
+
+// Record appends recording to the file
+func (rec *Recorder) Record(v Recording) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	_, err = rec.f.Write(append(data, '\n'))
+	return err
+}
+
+// newRecording builds recording of request r, res is nil when the transport failed
+func newRecording(r *request, res *http.Response, data []byte, err error) Recording {
+	v := Recording{
+		Time:          time.Now(),
+		Method:        r.method,
+		Endpoint:      r.endpoint,
+		Query:         r.query.Encode(),
+		Form:          redactForm(r.form).Encode(),
+		RequestHeader: redactHeader(r.header),
+	}
+	if u, perr := url.Parse(r.fullURL); perr == nil {
+		v.Path = u.Path
+	}
+
+	if res != nil {
+		v.StatusCode = res.StatusCode
+		v.Header = redactHeader(res.Header)
+		v.Body = redactBody(data)
+	} else if err != nil {
+		v.Error = err.Error()
+		v.ErrorKind = errorKind(err)
+	}
+	return v
+}
+
+// Form fields and JSON keys holding OAuth tokens and secrets
+var redactedParams = []string{"access_token", "refresh_token", "client_secret"}
+
+func redactHeader(h http.Header) http.Header {
+	res := http.Header{}
+	for k, v := range h {
+		res[k] = append([]string{}, v...)
+	}
+	if res.Get("Authorization") != "" {
+		res.Set("Authorization", "Bearer "+redacted)
+	}
+	for _, k := range []string{"Cookie", "Set-Cookie"} {
+		if len(res[k]) > 0 {
+			res[k] = []string{redacted}
+		}
+	}
+	return res
+}
+
+func redactForm(form url.Values) url.Values {
+	res := url.Values{}
+	for k, v := range form {
+		res[k] = append([]string{}, v...)
+	}
+	for _, k := range redactedParams {
+		if _, ok := res[k]; ok {
+			res.Set(k, redacted)
+		}
+	}
+	return res
+}
+
+// redactBody replaces tokens in JSON body at any depth, like a response of the OAuth token endpoint.
+// Other bodies are kept byte for byte.
+func redactBody(data []byte) string {
+	found := false
+	for _, k := range redactedParams {
+		if bytes.Contains(data, []byte(`"`+k+`"`)) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return string(data)
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return string(data)
+	}
+	redactJSON(v)
+
+	res, err := json.Marshal(v)
+	if err != nil {
+		return string(data)
+	}
+	return string(res)
+}
+
+func redactJSON(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			redact := false
+			for _, p := range redactedParams {
+				if k == p {
+					redact = true
+				}
+			}
+			if redact {
+				v[k] = redacted
+				continue
+			}
+			redactJSON(item)
+		}
+	case []interface{}:
+		for _, item := range v {
+			redactJSON(item)
+		}
+	}
+}
+
+// errorKind classifies transport error the same way as RetryPolicy does
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline"
+	case isDialError(err):
+		return "dial"
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return "eof"
+	}
+	if IsTemporaryNetError(err) {
+		return "net"
+	}
+	return ""
+}
+
+// replayedError is the transport error of a recording
+type replayedError struct {
+	msg     string
+	timeout bool
+}
+
+func (e *replayedError) Error() string {
+	return "replayed error: " + e.msg
+}
+
+func (e *replayedError) Timeout() bool {
+	return e.timeout
+}
+
+func (e *replayedError) Temporary() bool {
+	return e.timeout
+}
+
+// newReplayedError rebuilds transport error of the given kind
+func newReplayedError(kind, msg string) error {
+	e := &replayedError{msg: msg}
+	switch kind {
+	case "canceled":
+		return fmt.Errorf("%s: %w", e, context.Canceled)
+	case "deadline":
+		return fmt.Errorf("%s: %w", e, context.DeadlineExceeded)
+	case "dial":
+		return &net.OpError{Op: "dial", Net: "tcp", Err: e}
+	case "timeout":
+		e.timeout = true
+		return &net.OpError{Op: "read", Net: "tcp", Err: e}
+	case "eof":
+		return fmt.Errorf("%s: %w", e, io.ErrUnexpectedEOF)
+	case "net":
+		return &net.OpError{Op: "read", Net: "tcp", Err: e}
+	}
+	return e
+}
+
+// ReplayMatch define which parts of a request select its recording
+type ReplayMatch int
+
+const (
+	// ReplayMatchParams matches method, endpoint, query and form
+	ReplayMatchParams ReplayMatch = iota
+	// ReplayMatchEndpoint matches method and endpoint only
+	ReplayMatchEndpoint
+)
+
+// Replayer serves recorded responses instead of the network.
+// Identical requests get their recordings in recorded order, the last one is repeated when they run out.
+type Replayer struct {
+	Match ReplayMatch
+	// IgnoreParams are removed from query and form before matching, e.g. "timeStart" and "timeEnd"
+	IgnoreParams []string
+
+	mu         sync.Mutex
+	recordings []Recording
+	used       map[int]bool
+}
+
+// NewReplayer returns replayer of given recordings
+func NewReplayer(recordings []Recording) *Replayer {
+	return &Replayer{
+		recordings: recordings,
+		used:       map[int]bool{},
+	}
+}
+
+// LoadReplayer reads recordings written by Recorder
+func LoadReplayer(path string) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	recordings := []Recording{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		v := Recording{}
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+		recordings = append(recordings, v)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewReplayer(recordings), nil
+}
+
+// ReplayError define request without recording
+type ReplayError struct {
+	Method   string
+	Endpoint string
+	Query    string
+	Form     string
+}
+
+func (e *ReplayError) Error() string {
+	msg := fmt.Sprintf("<ReplayError> no recording for %s %s", e.Method, e.Endpoint)
+	if e.Query != "" {
+		msg += "?" + e.Query
+	}
+	if e.Form != "" {
+		msg += ", form=" + e.Form
+	}
+	return msg
+}
+
+func (e *ReplayError) Is(target error) bool {
+	return target == ErrNoRecording
+}
+
+// normalizeParams sorts encoded params and drops ignored ones
+func normalizeParams(s string, ignore []string) string {
+	v, err := url.ParseQuery(s)
+	if err != nil {
+		return s
+	}
+	for _, k := range ignore {
+		v.Del(k)
+	}
+	return v.Encode()
+}
+
+// matches compares the full path of the request, recordings without Path are matched by Endpoint
+func (rp *Replayer) matches(v *Recording, method, path, query, form string) bool {
+	recorded := v.Path
+	if recorded == "" {
+		recorded = v.Endpoint
+	}
+	if v.Method != method || recorded != path {
+		return false
+	}
+	if rp.Match == ReplayMatchEndpoint {
+		return true
+	}
+	return normalizeParams(v.Query, rp.IgnoreParams) == query && normalizeParams(v.Form, rp.IgnoreParams) == form
+}
+
+// Do serves recorded response for req, it is used as transport of Client
+func (rp *Replayer) Do(req *http.Request) (*http.Response, error) {
+	form := ""
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		form = string(body)
+	}
+
+	query := normalizeParams(req.URL.RawQuery, rp.IgnoreParams)
+	form = normalizeParams(form, rp.IgnoreParams)
+
+	rp.mu.Lock()
+	found := -1
+	for i := range rp.recordings {
+		if !rp.matches(&rp.recordings[i], req.Method, req.URL.Path, query, form) {
+			continue
+		}
+		found = i
+		if !rp.used[i] {
+			break
+		}
+	}
+	if found >= 0 {
+		rp.used[found] = true
+	}
+	rp.mu.Unlock()
+
+	if found < 0 {
+		return nil, &ReplayError{Method: req.Method, Endpoint: req.URL.Path, Query: query, Form: form}
+	}
+
+	v := rp.recordings[found]
+	if v.StatusCode == 0 {
+		return nil, newReplayedError(v.ErrorKind, v.Error)
+	}
+
+	header := http.Header{}
+	for k, vv := range v.Header {
+		header[k] = append([]string{}, vv...)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", v.StatusCode, http.StatusText(v.StatusCode)),
+		StatusCode:    v.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(v.Body)),
+		ContentLength: int64(len(v.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Replay makes the client serve responses from rp instead of the network
+func (c *Client) Replay(rp *Replayer) *Client {
+	c.do = rp.Do
+	return c
+}
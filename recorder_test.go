@@ -0,0 +1,120 @@
+package stex
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret-cookie"})
+		switch r.URL.Path {
+		case "/api/public/ping":
+			w.Write([]byte(`{"success":true,"data":{"server_datetime":{"date":"2020-01-01 00:00:00.000000","timezone_type":3,"timezone":"UTC"},"server_timestamp":1577836800}}`))
+		case "/api/oauth/token":
+			w.Write([]byte(`{"token_type":"Bearer","expires_in":3600,"access_token":"secret-access","refresh_token":"secret-refresh"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"success":false,"message":"Not found"}`))
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "stex-recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rec.jsonl")
+
+	rec, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient("secret-key")
+	c.BaseURL = srv.URL + "/api"
+	c.Recorder = rec
+
+	ctx := context.Background()
+	if _, err = c.NewPingService().Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	form := map[string]string{"grant_type": "refresh_token", "refresh_token": "secret-refresh", "client_secret": "secret-client"}
+	r := &request{method: "POST", endpoint: "/oauth/token", secType: secTypeAPIKey}
+	for k, v := range form {
+		r.setFormParam(k, v)
+	}
+	if _, err = c.callAPI(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	rec.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-") {
+		t.Errorf("recording contains a secret:\n%s", data)
+	}
+
+	rp, err := LoadReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp.Match = ReplayMatchEndpoint
+
+	c = NewClient("key")
+	c.BaseURL = "http://replay/api"
+	c.Replay(rp)
+	ping, err := c.NewPingService().Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ping.Timestamp.Unix() != 1577836800 {
+		t.Errorf("replayed ping = %+v", ping)
+	}
+
+	// Only the full path selects the recording
+	c.BaseURL = "http://replay/other/api"
+	if _, err = c.NewPingService().Do(ctx); !errors.Is(err, ErrNoRecording) {
+		t.Errorf("replay with another base path = %v, want ErrNoRecording", err)
+	}
+}
+
+func TestReplayedErrorKind(t *testing.T) {
+	for _, kind := range []string{"dial", "timeout", "eof", "net", "deadline", "canceled", ""} {
+		t.Run(kind, func(t *testing.T) {
+			err := newReplayedError(kind, "boom")
+			if got := errorKind(err); got != kind {
+				t.Errorf("errorKind() = %q, want %q", got, kind)
+			}
+		})
+	}
+}
+
+func TestReplayedErrorRetry(t *testing.T) {
+	rp := NewReplayer([]Recording{
+		{Method: "GET", Endpoint: "/public/ping", Error: "connection reset", ErrorKind: "net"},
+		{Method: "GET", Endpoint: "/public/ping", StatusCode: 200, Body: `{"success":true,"data":{}}`},
+	})
+
+	c := NewClient("key")
+	c.BaseURL = ""
+	c.RetryPolicy = &RetryPolicy{MaxAttempts: 2}
+	c.Replay(rp)
+
+	attempts := 0
+	if _, err := c.NewPingService().Do(context.Background(), WithAttempts(&attempts)); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want the replayed network error retried", attempts)
+	}
+}
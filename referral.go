@@ -3,6 +3,7 @@ package stex
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 )
 
 type Referral struct {
@@ -49,12 +50,18 @@ type ProfileReferralSetService struct {
 
 // Do send request
 func (s *ProfileReferralSetService) Do(ctx context.Context, opts ...RequestOption) (*Referral, error) {
+	if s.code == nil {
+		return nil, fmt.Errorf("code not init")
+	}
+
 	r := &request{
 		method:   "POST",
 		endpoint: "/profile/referral/insert",
 		secType:  secTypeAPIKey,
 	}
 
+	r.setFormParam("code", *s.code)
+
 	data, err := s.c.callAPI(ctx, r, opts...)
 	if err != nil {
 		return nil, err
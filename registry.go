@@ -0,0 +1,465 @@
+package stex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type MarketEventType string
+
+const (
+	MarketEventPairAdded       MarketEventType = "pair_added"
+	MarketEventPairRemoved     MarketEventType = "pair_removed"
+	MarketEventPairDelisted    MarketEventType = "pair_delisted"
+	MarketEventPairDeactivated MarketEventType = "pair_deactivated"
+	MarketEventPairActivated   MarketEventType = "pair_activated"
+	MarketEventFeesChanged     MarketEventType = "fees_changed"
+)
+
+// MarketEvent define change of a pair found by MarketRegistry refresh, Previous is nil for added pairs
+type MarketEvent struct {
+	Type     MarketEventType
+	Pair     CurrencyPair
+	Previous *CurrencyPair
+	Time     time.Time
+}
+
+// marketSnapshot is the registry content, it is stored in the cache file as is
+type marketSnapshot struct {
+	Fetched    time.Time      `json:"fetched"`
+	Currencies []CurrencyInfo `json:"currencies"`
+	Pairs      []CurrencyPair `json:"pairs"`
+	Markets    []MarketInfo   `json:"markets"`
+	Groups     []PairsGroup   `json:"groups"`
+}
+
+// MarketRegistry keeps currencies, pairs, markets and pair groups and resolves symbols and codes to ids.
+// It implements PairInfoSource for OrderValidator.
+type MarketRegistry struct {
+	c *Client
+
+	ttl        time.Duration
+	cache_path string
+	f          func(MarketEvent)
+
+	// refresh serialises Refresh calls, so pairs are diffed against the result of the previous one
+	refresh sync.Mutex
+
+	mu               sync.RWMutex
+	snap             marketSnapshot
+	pairs            map[int]CurrencyPair
+	pairs_by_symbol  map[string]int
+	currencies       map[int]CurrencyInfo
+	currency_by_code map[string]int
+}
+
+func NewMarketRegistry(c *Client) *MarketRegistry {
+	return &MarketRegistry{
+		c:   c,
+		ttl: time.Hour,
+	}
+}
+
+// TTL sets period of background refresh, default is 1 hour. Zero or negative ttl disables the refresh.
+func (m *MarketRegistry) TTL(ttl time.Duration) *MarketRegistry {
+	m.ttl = ttl
+	return m
+}
+
+// CachePath sets file the registry is saved to after every refresh and loaded from when the API is not reachable
+func (m *MarketRegistry) CachePath(path string) *MarketRegistry {
+	m.cache_path = path
+	return m
+}
+
+// OnEvent sets callback called for every pair change found by refresh, it must not call Refresh
+func (m *MarketRegistry) OnEvent(f func(MarketEvent)) *MarketRegistry {
+	m.f = f
+	return m
+}
+
+// Do loads the registry and refreshes it every TTL until ctx is cancelled
+func (m *MarketRegistry) Do(ctx context.Context) error {
+	err := m.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	if m.ttl <= 0 {
+		return nil
+	}
+
+	go func() {
+		ticker := time.NewTicker(m.ttl)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := m.Refresh(ctx); err != nil {
+				m.c.debug("market registry refresh: %s", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Load reads the cache file if it is set and refreshes from the API.
+// The cached content is kept when the API fails, an error is returned only when neither is available.
+func (m *MarketRegistry) Load(ctx context.Context) error {
+	cached := false
+	if m.cache_path != "" {
+		snap, err := readMarketSnapshot(m.cache_path)
+		if err == nil {
+			m.set(snap)
+			cached = true
+		} else if !os.IsNotExist(err) {
+			m.c.debug("market registry cache: %s", err)
+		}
+	}
+
+	err := m.Refresh(ctx)
+	if err != nil && cached {
+		m.c.debug("market registry refresh: %s, using cache of %s", err, m.Fetched())
+		return nil
+	}
+	return err
+}
+
+// Refresh fetches everything from the API, emits events of changed pairs and saves the cache file.
+// Concurrent calls run one after another.
+func (m *MarketRegistry) Refresh(ctx context.Context) error {
+	m.refresh.Lock()
+	defer m.refresh.Unlock()
+
+	snap := marketSnapshot{Fetched: time.Now()}
+
+	var err error
+	snap.Currencies, err = m.c.NewAvailableCurrenciesService().Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	snap.Pairs, err = m.c.NewCurrencyPairsMarketListService().Market("ALL").Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	snap.Markets, err = m.c.NewAvailableMarketsService().Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	snap.Groups, err = m.c.NewPairsGroupsService().Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	loaded := m.pairs != nil
+	events := []MarketEvent{}
+	if loaded {
+		events = diffPairs(m.pairs, snap.Pairs, snap.Fetched)
+	}
+	m.mu.RUnlock()
+
+	m.set(snap)
+
+	if m.cache_path != "" {
+		if err := writeMarketSnapshot(m.cache_path, snap); err != nil {
+			m.c.debug("market registry cache: %s", err)
+		}
+	}
+
+	if m.f != nil {
+		for _, ev := range events {
+			m.f(ev)
+		}
+	}
+	return nil
+}
+
+// diffPairs returns events turning old pairs into pairs
+func diffPairs(old map[int]CurrencyPair, pairs []CurrencyPair, now time.Time) []MarketEvent {
+	events := []MarketEvent{}
+	seen := map[int]bool{}
+
+	for _, p := range pairs {
+		seen[p.Id] = true
+
+		prev, ok := old[p.Id]
+		if !ok {
+			events = append(events, MarketEvent{Type: MarketEventPairAdded, Pair: p, Time: now})
+			continue
+		}
+
+		add := func(t MarketEventType) {
+			prev := prev
+			events = append(events, MarketEvent{Type: t, Pair: p, Previous: &prev, Time: now})
+		}
+
+		if p.Delisted && !prev.Delisted {
+			add(MarketEventPairDelisted)
+		}
+		if !p.Active && prev.Active {
+			add(MarketEventPairDeactivated)
+		}
+		if p.Active && !prev.Active {
+			add(MarketEventPairActivated)
+		}
+		if !p.BuyFeePercent.Equal(prev.BuyFeePercent) || !p.SellFeePercent.Equal(prev.SellFeePercent) {
+			add(MarketEventFeesChanged)
+		}
+	}
+
+	removed := []CurrencyPair{}
+	for id, p := range old {
+		if !seen[id] {
+			removed = append(removed, p)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].Id < removed[j].Id })
+	for _, p := range removed {
+		prev := p
+		events = append(events, MarketEvent{Type: MarketEventPairRemoved, Pair: p, Previous: &prev, Time: now})
+	}
+
+	return events
+}
+
+// set replaces content and indexes
+func (m *MarketRegistry) set(snap marketSnapshot) {
+	pairs := map[int]CurrencyPair{}
+	pairs_by_symbol := map[string]int{}
+	for _, p := range snap.Pairs {
+		pairs[p.Id] = p
+		pairs_by_symbol[normalizeSymbol(p.Symbol)] = p.Id
+	}
+
+	currencies := map[int]CurrencyInfo{}
+	currency_by_code := map[string]int{}
+	for _, c := range snap.Currencies {
+		currencies[c.Id] = c
+		currency_by_code[strings.ToUpper(c.Code)] = c.Id
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.snap = snap
+	m.pairs = pairs
+	m.pairs_by_symbol = pairs_by_symbol
+	m.currencies = currencies
+	m.currency_by_code = currency_by_code
+}
+
+// normalizeSymbol makes "eth/btc", "ETH-BTC" and "ETH_BTC" the same
+func normalizeSymbol(symbol string) string {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	return strings.NewReplacer("/", "_", "-", "_").Replace(symbol)
+}
+
+func readMarketSnapshot(path string) (marketSnapshot, error) {
+	snap := marketSnapshot{}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return snap, err
+	}
+
+	err = json.Unmarshal(data, &snap)
+	return snap, err
+}
+
+func writeMarketSnapshot(path string, snap marketSnapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic replaces the file atomically, so a crash never leaves it broken.
+// The file is readable by the owner only, it may hold tokens or account data.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+
+	return err
+}
+
+// Fetched returns time the content was fetched from the API
+func (m *MarketRegistry) Fetched() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.snap.Fetched
+}
+
+// Pair returns pair by id
+func (m *MarketRegistry) Pair(pair_id int) (CurrencyPair, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.pairs[pair_id]
+	return p, ok
+}
+
+// PairBySymbol returns pair by symbol like "ETH_BTC", case and separator ("_", "/", "-") do not matter
+func (m *MarketRegistry) PairBySymbol(symbol string) (CurrencyPair, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.pairs_by_symbol[normalizeSymbol(symbol)]
+	if !ok {
+		return CurrencyPair{}, false
+	}
+	return m.pairs[id], true
+}
+
+// PairByCodes returns pair of base currency traded for quote market currency
+func (m *MarketRegistry) PairByCodes(base, quote string) (CurrencyPair, bool) {
+	return m.PairBySymbol(base + "_" + quote)
+}
+
+// PairId resolves symbol to pair id, the error matches ErrNotFound
+func (m *MarketRegistry) PairId(symbol string) (int, error) {
+	p, ok := m.PairBySymbol(symbol)
+	if !ok {
+		return 0, fmt.Errorf("%w: pair %q", ErrNotFound, symbol)
+	}
+	return p.Id, nil
+}
+
+// Symbol resolves pair id to its symbol, the error matches ErrNotFound
+func (m *MarketRegistry) Symbol(pair_id int) (string, error) {
+	p, ok := m.Pair(pair_id)
+	if !ok {
+		return "", fmt.Errorf("%w: pair %d", ErrNotFound, pair_id)
+	}
+	return p.Symbol, nil
+}
+
+// Currency returns currency by id
+func (m *MarketRegistry) Currency(currency_id int) (CurrencyInfo, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.currencies[currency_id]
+	return c, ok
+}
+
+// CurrencyByCode returns currency by code, case does not matter
+func (m *MarketRegistry) CurrencyByCode(code string) (CurrencyInfo, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.currency_by_code[strings.ToUpper(strings.TrimSpace(code))]
+	if !ok {
+		return CurrencyInfo{}, false
+	}
+	return m.currencies[id], true
+}
+
+// CurrencyId resolves code to currency id, the error matches ErrNotFound
+func (m *MarketRegistry) CurrencyId(code string) (int, error) {
+	c, ok := m.CurrencyByCode(code)
+	if !ok {
+		return 0, fmt.Errorf("%w: currency %q", ErrNotFound, code)
+	}
+	return c.Id, nil
+}
+
+// CurrencyCode resolves currency id to its code, the error matches ErrNotFound
+func (m *MarketRegistry) CurrencyCode(currency_id int) (string, error) {
+	c, ok := m.Currency(currency_id)
+	if !ok {
+		return "", fmt.Errorf("%w: currency %d", ErrNotFound, currency_id)
+	}
+	return c.Code, nil
+}
+
+// Pairs returns all pairs sorted by id
+func (m *MarketRegistry) Pairs() []CurrencyPair {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res := append([]CurrencyPair{}, m.snap.Pairs...)
+	sort.Slice(res, func(i, j int) bool { return res[i].Id < res[j].Id })
+	return res
+}
+
+// Currencies returns all currencies sorted by id
+func (m *MarketRegistry) Currencies() []CurrencyInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res := append([]CurrencyInfo{}, m.snap.Currencies...)
+	sort.Slice(res, func(i, j int) bool { return res[i].Id < res[j].Id })
+	return res
+}
+
+// Markets returns all markets
+func (m *MarketRegistry) Markets() []MarketInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]MarketInfo{}, m.snap.Markets...)
+}
+
+// Groups returns all pair groups
+func (m *MarketRegistry) Groups() []PairsGroup {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]PairsGroup{}, m.snap.Groups...)
+}
+
+// PairInfo returns pair by id, the registry is loaded on first use
+func (m *MarketRegistry) PairInfo(ctx context.Context, pair_id int) (*CurrencyPair, error) {
+	m.mu.RLock()
+	loaded := m.pairs != nil
+	m.mu.RUnlock()
+
+	if !loaded {
+		if err := m.Load(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	p, ok := m.Pair(pair_id)
+	if !ok {
+		return nil, fmt.Errorf("%w: pair %d", ErrNotFound, pair_id)
+	}
+	return &p, nil
+}
@@ -0,0 +1,90 @@
+package stex_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+	"github.com/vladivolo/stex-api/stextest"
+)
+
+func TestMarketRegistry(t *testing.T) {
+	srv := stextest.NewServer()
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "stex-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "markets.json")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	events := []stex.MarketEvent{}
+	m := stex.NewMarketRegistry(srv.Client("")).CachePath(path).TTL(0).OnEvent(func(ev stex.MarketEvent) {
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+	})
+	// Zero TTL loads the registry without background refresh
+	if err = m.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := m.PairId("eth/btc")
+	if err != nil || id != 1 {
+		t.Fatalf("PairId() = %d, %v", id, err)
+	}
+	if code, err := m.CurrencyCode(3); err != nil || code != "USDT" {
+		t.Errorf("CurrencyCode() = %q, %v", code, err)
+	}
+
+	// Concurrent refreshes report the change once
+	srv.UpdatePair(1, func(p *stex.CurrencyPair) {
+		p.Active = false
+	})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.Refresh(ctx); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	if len(events) != 1 || events[0].Type != stex.MarketEventPairDeactivated || events[0].Pair.Id != 1 {
+		t.Errorf("events = %+v", events)
+	}
+	mu.Unlock()
+
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("cache file = %v, %v, want mode 0600", fi, err)
+	}
+
+	// The cache is used when the API is not reachable
+	srv.InjectFault(stextest.Fault{Status: http.StatusInternalServerError})
+	cached := stex.NewMarketRegistry(srv.Client("")).CachePath(path)
+	if err = cached.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := cached.PairBySymbol("ETH_BTC"); !ok || p.Active {
+		t.Errorf("cached pair = %+v", p)
+	}
+
+	if err = stex.NewMarketRegistry(srv.Client("")).Load(ctx); err == nil {
+		t.Error("Load without cache and API succeeded")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
 type secType int
@@ -22,6 +23,7 @@ type request struct {
 	header     http.Header
 	body       io.Reader
 	fullURL    string
+	attempts   *int
 }
 
 // setParam set param with key/value to query string
@@ -68,5 +70,16 @@ func (r *request) validate() (err error) {
 	return nil
 }
 
+// rateLimitGroup returns the quota group the request is counted in
+func (r *request) rateLimitGroup() RateLimitGroup {
+	if strings.HasPrefix(r.endpoint, "/trading") {
+		return RateLimitTrading
+	}
+	if r.secType == secTypeAPIKey {
+		return RateLimitPrivate
+	}
+	return RateLimitPublic
+}
+
 // RequestOption define option type for request
 type RequestOption func(*request)
@@ -0,0 +1,180 @@
+package stex
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy define how Client retries failed requests.
+// A nil policy on Client means every request is sent exactly once.
+type RetryPolicy struct {
+	// Total number of attempts, including the first one
+	MaxAttempts int
+	// Delay before the second attempt
+	InitialBackoff time.Duration
+	// Upper bound of the delay between attempts
+	MaxBackoff time.Duration
+	// Backoff growth factor between attempts
+	Multiplier float64
+	// Part of the delay (0..1) that is randomised to spread retries of many clients
+	Jitter float64
+	// HTTP status codes that are worth retrying
+	RetryStatusCodes []int
+	// Decides if a transport error is worth retrying. Nil means IsTemporaryNetError
+	RetryOnError func(err error) bool
+}
+
+// DefaultRetryPolicy returns a policy with 3 attempts and exponential backoff from 200ms up to 5s
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryStatusCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns the delay before attempt number attempt+1
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+
+	d := float64(p.InitialBackoff) * math.Pow(mult, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		d -= d * jitter * rand.Float64()
+	}
+
+	return time.Duration(d)
+}
+
+// retryable checks if request r may be sent again after it failed with the given status code or transport error.
+// Non-idempotent requests (POST) are replayed only when the exchange certainly did not process them.
+func (p *RetryPolicy) retryable(r *request, statusCode int, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	idempotent := r.method != http.MethodPost
+
+	if statusCode == 0 {
+		if !idempotent {
+			return isDialError(err)
+		}
+		if p.RetryOnError != nil {
+			return p.RetryOnError(err)
+		}
+		return IsTemporaryNetError(err)
+	}
+
+	if !idempotent && statusCode != http.StatusTooManyRequests {
+		return false
+	}
+
+	for _, code := range p.RetryStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsTemporaryNetError check if e is a transport error that usually goes away on retry:
+// timeouts, refused or reset connections and truncated responses
+func IsTemporaryNetError(e error) bool {
+	if e == nil {
+		return false
+	}
+
+	if errors.Is(e, io.ErrUnexpectedEOF) || errors.Is(e, io.EOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(e, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(e, &opErr) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(e, &dnsErr) {
+		return dnsErr.Temporary()
+	}
+
+	return false
+}
+
+// isDialError check if e happened before the request was written to the connection
+func isDialError(e error) bool {
+	var opErr *net.OpError
+	if errors.As(e, &opErr) {
+		return opErr.Op == "dial"
+	}
+
+	var dnsErr *net.DNSError
+	return errors.As(e, &dnsErr)
+}
+
+// sleepContext waits for d or until ctx is done. Returns false if ctx is done first
+// or its deadline expires before d passes.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(d).After(deadline) {
+		return false
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// WithAttempts stores the number of attempts made for the request into n
+func WithAttempts(n *int) RequestOption {
+	return func(r *request) {
+		r.attempts = n
+	}
+}
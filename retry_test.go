@@ -0,0 +1,104 @@
+package stex_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+	"github.com/vladivolo/stex-api/stextest"
+)
+
+func fastRetryPolicy(attempts int) *stex.RetryPolicy {
+	p := stex.DefaultRetryPolicy()
+	p.MaxAttempts = attempts
+	p.InitialBackoff = time.Millisecond
+	p.MaxBackoff = 5 * time.Millisecond
+	return p
+}
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		fault    stextest.Fault
+		post     bool
+		attempts int
+		wantErr  int
+	}{
+		{name: "transient 503", fault: stextest.Fault{Path: "/public/ping", Status: 503, Count: 2}, attempts: 3},
+		{name: "exhausted", fault: stextest.Fault{Path: "/public/ping", Status: 502}, attempts: 3, wantErr: 502},
+		{name: "not retryable", fault: stextest.Fault{Path: "/public/ping", Status: 400}, attempts: 1, wantErr: 400},
+		{name: "post not replayed", fault: stextest.Fault{Method: "POST", Path: "/trading/orders", Status: 503}, post: true, attempts: 1, wantErr: 503},
+		{name: "post replayed on 429", fault: stextest.Fault{Method: "POST", Path: "/trading/orders", Status: 429, Count: 1}, post: true, attempts: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := stextest.NewServer()
+			defer srv.Close()
+			user := srv.AddUser("token")
+			srv.SetBalance(user, "BTC", stex.MustParseDecimal("1"))
+
+			c := srv.Client("token")
+			c.RetryPolicy = fastRetryPolicy(3)
+			srv.InjectFault(tt.fault)
+
+			attempts := 0
+			var err error
+			if tt.post {
+				_, err = c.NewCreateOrderService().CurrencyPairId(1).OrderType(stex.OrderType_BUY).
+					Amount(stex.MustParseDecimal("1")).Price(stex.MustParseDecimal("0.01")).Do(context.Background(), stex.WithAttempts(&attempts))
+			} else {
+				_, err = c.NewPingService().Do(context.Background(), stex.WithAttempts(&attempts))
+			}
+
+			if attempts != tt.attempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.attempts)
+			}
+			if tt.wantErr == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			// The last error is returned as is, not wrapped
+			apiErr, ok := err.(*stex.APIError)
+			if !ok {
+				t.Fatalf("error %T %v is not *APIError", err, err)
+			}
+			if apiErr.StatusCode != tt.wantErr {
+				t.Errorf("status = %d, want %d", apiErr.StatusCode, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryStopsAtContextDeadline(t *testing.T) {
+	srv := stextest.NewServer()
+	defer srv.Close()
+	srv.InjectFault(stextest.Fault{Path: "/public/ping", Status: http.StatusServiceUnavailable})
+
+	c := srv.Client("")
+	c.RetryPolicy = fastRetryPolicy(5)
+	c.RetryPolicy.InitialBackoff = time.Second
+	c.RetryPolicy.MaxBackoff = time.Second
+	c.RetryPolicy.Jitter = 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	attempts := 0
+	start := time.Now()
+	_, err := c.NewPingService().Do(ctx, stex.WithAttempts(&attempts))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1 as the backoff exceeds the deadline", attempts)
+	}
+	if time.Since(start) > 150*time.Millisecond {
+		t.Errorf("waited %s for a backoff past the deadline", time.Since(start))
+	}
+}
@@ -0,0 +1,494 @@
+package stextest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+)
+
+// Status of an order resting in the book or waiting for its trigger price.
+// A resting order that is partially filled is reported as PARTIAL, as the real API does.
+const statusActive = stex.OrderStatus_PENDING
+
+type market struct {
+	pair stex.CurrencyPair
+
+	// bids are sorted by price descending, asks ascending, both by time within a price
+	bids  []*order
+	asks  []*order
+	stops []*order
+
+	trades []stex.CurrencyPairTrades
+	last   stex.Decimal
+}
+
+type order struct {
+	stex.OrderInfo
+
+	userId int64
+	// open is set while the order rests in the book or waits for its trigger price
+	open bool
+	// funds still frozen for the order: market currency for buys, currency for sells
+	frozen stex.Decimal
+	trades []stex.Trade
+	fees   []stex.Fee
+}
+
+func (o *order) remaining() stex.Decimal {
+	return o.InitialAmount.Sub(o.ProcessedAmount)
+}
+
+func (o *order) isBuy() bool {
+	return o.Type == stex.OrderType_BUY || o.Type == stex.OrderType_STOP_LIMIT_BUY
+}
+
+func (o *order) isStop() bool {
+	return o.Type == stex.OrderType_STOP_LIMIT_BUY || o.Type == stex.OrderType_STOP_LIMIT_SELL
+}
+
+func (o *order) isActive() bool {
+	return o.open
+}
+
+// httpError is returned to the client as a response with given status
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+// PlaceOrder places order of the user directly, bypassing HTTP. Useful to seed the order book.
+func (s *Server) PlaceOrder(userId int64, pairId int, orderType stex.OrderType, amount, price, triggerPrice stex.Decimal) (stex.OrderInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userId]
+	if !ok {
+		return stex.OrderInfo{}, fmt.Errorf("user %d not found", userId)
+	}
+
+	o, err := s.placeOrder(u, pairId, orderType, amount, price, triggerPrice)
+	if err != nil {
+		return stex.OrderInfo{}, err
+	}
+	return o.OrderInfo, nil
+}
+
+// Order returns current state of the order
+func (s *Server) Order(id int64) (stex.OrderInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[id]
+	if !ok {
+		return stex.OrderInfo{}, false
+	}
+	return o.OrderInfo, true
+}
+
+func (s *Server) placeOrder(u *user, pairId int, orderType stex.OrderType, amount, price, triggerPrice stex.Decimal) (*order, error) {
+	m, ok := s.markets[pairId]
+	if !ok {
+		return nil, &httpError{404, "Currency pair not found"}
+	}
+	if !m.pair.Active || m.pair.Delisted {
+		return nil, &httpError{400, "Currency pair is not active"}
+	}
+
+	switch orderType {
+	case stex.OrderType_BUY, stex.OrderType_SELL:
+	case stex.OrderType_STOP_LIMIT_BUY, stex.OrderType_STOP_LIMIT_SELL:
+		if !triggerPrice.IsPositive() {
+			return nil, &httpError{422, "Invalid trigger price"}
+		}
+	default:
+		return nil, &httpError{422, "Invalid order type"}
+	}
+
+	if !amount.IsPositive() || amount.LessThan(m.pair.MinOrderAmount) {
+		return nil, &httpError{422, "Invalid amount: less than minimal order amount"}
+	}
+	if amount.Scale() > int32(m.pair.CurrencyPrecision) && !amount.Equal(amount.Truncate(int32(m.pair.CurrencyPrecision))) {
+		return nil, &httpError{422, "Invalid amount precision"}
+	}
+
+	minPrice := m.pair.MinSellPrice
+	if orderType == stex.OrderType_BUY || orderType == stex.OrderType_STOP_LIMIT_BUY {
+		minPrice = m.pair.MinBuyPrice
+	}
+	if !price.IsPositive() || price.LessThan(minPrice) {
+		return nil, &httpError{422, "Invalid price: less than minimal price"}
+	}
+	if price.Scale() > int32(m.pair.MarketPrecision) && !price.Equal(price.Truncate(int32(m.pair.MarketPrecision))) {
+		return nil, &httpError{422, "Invalid price precision"}
+	}
+
+	o := &order{userId: u.id}
+	o.Id = s.nextId()
+	o.CurrencyPairId = pairId
+	o.Price = price
+	o.TriggerPrice = triggerPrice
+	o.InitialAmount = amount
+	o.Type = orderType
+	o.OriginalType = orderType
+	o.Status = statusActive
+	o.open = true
+	now := s.now()
+	o.Created = dateTime(now)
+	o.Timestamp = stex.NewTime(now)
+
+	// Funds are frozen at the limit price, price improvement is returned on every fill
+	var w *wallet
+	if o.isBuy() {
+		o.frozen = amount.Mul(price)
+		w = s.wallet(u, m.pair.MarketCurrencyId)
+	} else {
+		o.frozen = amount
+		w = s.wallet(u, m.pair.CurrencyId)
+	}
+	if w.balance.LessThan(o.frozen) {
+		return nil, &httpError{400, "Insufficient balance"}
+	}
+	w.balance = w.balance.Sub(o.frozen)
+	w.frozen = w.frozen.Add(o.frozen)
+
+	s.orders[o.Id] = o
+
+	if o.isStop() && !s.triggered(m, o) {
+		m.stops = append(m.stops, o)
+		return o, nil
+	}
+
+	s.activate(m, o)
+	s.triggerStops(m)
+	return o, nil
+}
+
+// triggered check if last price reached trigger price of stop order
+func (s *Server) triggered(m *market, o *order) bool {
+	if m.last.IsZero() {
+		return false
+	}
+	if o.Type == stex.OrderType_STOP_LIMIT_BUY {
+		return m.last.GreaterThanOrEqual(o.TriggerPrice)
+	}
+	return m.last.LessThanOrEqual(o.TriggerPrice)
+}
+
+func (s *Server) triggerStops(m *market) {
+	for {
+		var next *order
+		for i, o := range m.stops {
+			if s.triggered(m, o) {
+				next = o
+				m.stops = append(m.stops[:i], m.stops[i+1:]...)
+				break
+			}
+		}
+		if next == nil {
+			return
+		}
+		s.activate(m, next)
+	}
+}
+
+// activate matches limit order against the book and puts the rest into the book
+func (s *Server) activate(m *market, o *order) {
+	if o.Type == stex.OrderType_STOP_LIMIT_BUY {
+		o.Type = stex.OrderType_BUY
+	}
+	if o.Type == stex.OrderType_STOP_LIMIT_SELL {
+		o.Type = stex.OrderType_SELL
+	}
+
+	for o.remaining().IsPositive() {
+		var maker *order
+		if o.isBuy() {
+			if len(m.asks) == 0 || m.asks[0].Price.GreaterThan(o.Price) {
+				break
+			}
+			maker = m.asks[0]
+		} else {
+			if len(m.bids) == 0 || m.bids[0].Price.LessThan(o.Price) {
+				break
+			}
+			maker = m.bids[0]
+		}
+
+		qty := stex.MinDecimal(o.remaining(), maker.remaining())
+		if o.isBuy() {
+			s.fill(m, o, maker, qty, maker.Price, stex.TradeType_BUY)
+		} else {
+			s.fill(m, maker, o, qty, maker.Price, stex.TradeType_SELL)
+		}
+
+		if !maker.remaining().IsPositive() {
+			if o.isBuy() {
+				m.asks = m.asks[1:]
+			} else {
+				m.bids = m.bids[1:]
+			}
+			s.close(m, maker, stex.OrderStatus_FINISHED)
+		}
+	}
+
+	if !o.remaining().IsPositive() {
+		s.close(m, o, stex.OrderStatus_FINISHED)
+		return
+	}
+
+	if o.isBuy() {
+		idx := sort.Search(len(m.bids), func(i int) bool { return m.bids[i].Price.LessThan(o.Price) })
+		m.bids = append(m.bids, nil)
+		copy(m.bids[idx+1:], m.bids[idx:])
+		m.bids[idx] = o
+	} else {
+		idx := sort.Search(len(m.asks), func(i int) bool { return m.asks[i].Price.GreaterThan(o.Price) })
+		m.asks = append(m.asks, nil)
+		copy(m.asks[idx+1:], m.asks[idx:])
+		m.asks[idx] = o
+	}
+}
+
+// fill executes qty between buy and sell orders at price. Fees are taken from the received currency.
+func (s *Server) fill(m *market, buy, sell *order, qty, price stex.Decimal, side stex.TradeType) {
+	now := s.now()
+	buyer := s.users[buy.userId]
+	seller := s.users[sell.userId]
+
+	quote := qty.Mul(price)
+	quotePrecision := int32(s.currencies[m.pair.MarketCurrencyId].Precision)
+	basePrecision := int32(s.currencies[m.pair.CurrencyId].Precision)
+
+	// Buyer pays from funds frozen at the limit price and gets the difference back
+	frozen := qty.Mul(buy.Price)
+	buy.frozen = buy.frozen.Sub(frozen)
+	bq := s.wallet(buyer, m.pair.MarketCurrencyId)
+	bq.frozen = bq.frozen.Sub(frozen)
+	bq.balance = bq.balance.Add(frozen.Sub(quote))
+
+	buyFee := qty.Mul(s.fees(buyer, m).BuyFee).Round(basePrecision)
+	bb := s.wallet(buyer, m.pair.CurrencyId)
+	bb.balance = bb.balance.Add(qty.Sub(buyFee))
+
+	sell.frozen = sell.frozen.Sub(qty)
+	sb := s.wallet(seller, m.pair.CurrencyId)
+	sb.frozen = sb.frozen.Sub(qty)
+
+	sellFee := quote.Mul(s.fees(seller, m).SellFee).Round(quotePrecision)
+	sq := s.wallet(seller, m.pair.MarketCurrencyId)
+	sq.balance = sq.balance.Add(quote.Sub(sellFee))
+
+	buy.ProcessedAmount = buy.ProcessedAmount.Add(qty)
+	sell.ProcessedAmount = sell.ProcessedAmount.Add(qty)
+	buy.Status = stex.OrderStatus_PARTIAL
+	sell.Status = stex.OrderStatus_PARTIAL
+
+	trade := stex.Trade{
+		Id:          s.nextId(),
+		BuyOrderId:  buy.Id,
+		SellOrderId: sell.Id,
+		Price:       price,
+		Amount:      qty,
+		TradeType:   side,
+		Timestamp:   stex.NewTime(now),
+	}
+	buy.trades = append(buy.trades, trade)
+	sell.trades = append(sell.trades, trade)
+
+	if buyFee.IsPositive() {
+		buy.fees = append(buy.fees, stex.Fee{Id: s.nextId(), CurrencyId: m.pair.CurrencyId, Amount: buyFee, Timestamp: stex.NewTime(now)})
+	}
+	if sellFee.IsPositive() {
+		sell.fees = append(sell.fees, stex.Fee{Id: s.nextId(), CurrencyId: m.pair.MarketCurrencyId, Amount: sellFee, Timestamp: stex.NewTime(now)})
+	}
+
+	m.trades = append(m.trades, stex.CurrencyPairTrades{
+		Id:        trade.Id,
+		Price:     price,
+		Amount:    qty,
+		Type:      string(side),
+		Timestamp: stex.NewTime(now),
+	})
+	m.last = price
+}
+
+// close finishes or cancels order and unfreezes funds left
+func (s *Server) close(m *market, o *order, status stex.OrderStatus) {
+	if o.frozen.Sign() != 0 {
+		u := s.users[o.userId]
+		var w *wallet
+		if o.isBuy() {
+			w = s.wallet(u, m.pair.MarketCurrencyId)
+		} else {
+			w = s.wallet(u, m.pair.CurrencyId)
+		}
+		w.frozen = w.frozen.Sub(o.frozen)
+		w.balance = w.balance.Add(o.frozen)
+		o.frozen = stex.Decimal{}
+	}
+
+	if status == stex.OrderStatus_CANCELLED && o.ProcessedAmount.IsPositive() {
+		status = stex.OrderStatus_PARTIAL
+	}
+	o.Status = status
+	o.open = false
+	o.Timestamp = stex.NewTime(s.now())
+}
+
+// cancel removes active order from the book or stop list
+func (s *Server) cancel(o *order) bool {
+	if !o.isActive() {
+		return false
+	}
+
+	m := s.markets[o.CurrencyPairId]
+	remove := func(list []*order) []*order {
+		for i, v := range list {
+			if v == o {
+				return append(list[:i], list[i+1:]...)
+			}
+		}
+		return list
+	}
+	m.bids = remove(m.bids)
+	m.asks = remove(m.asks)
+	m.stops = remove(m.stops)
+
+	s.close(m, o, stex.OrderStatus_CANCELLED)
+	return true
+}
+
+// candles aggregates public trades of the market into candles of the given size, latest first
+func (m *market) candles(size time.Duration, from, till time.Time) []stex.Candle {
+	res := []stex.Candle{}
+	index := map[int64]int{}
+
+	for _, t := range m.trades {
+		if t.Timestamp.Before(from) || t.Timestamp.After(till) {
+			continue
+		}
+
+		start := t.Timestamp.Truncate(size)
+		key := start.Unix()
+		i, ok := index[key]
+		if !ok {
+			res = append(res, stex.Candle{
+				Time: unixMillis(start),
+				Open: t.Price,
+				Low:  t.Price,
+				High: t.Price,
+			})
+			i = len(res) - 1
+			index[key] = i
+		}
+
+		c := &res[i]
+		c.Close = t.Price
+		c.Low = stex.MinDecimal(c.Low, t.Price)
+		c.High = stex.MaxDecimal(c.High, t.Price)
+		c.Volume = c.Volume.Add(t.Amount)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Time.After(res[j].Time.Time) })
+	return res
+}
+
+var candleSizes = map[stex.CandleType]time.Duration{
+	stex.CandleType1m:  time.Minute,
+	stex.CandleType5m:  5 * time.Minute,
+	stex.CandleType30m: 30 * time.Minute,
+	stex.CandleType1h:  time.Hour,
+	stex.CandleType4h:  4 * time.Hour,
+	stex.CandleType12h: 12 * time.Hour,
+	stex.CandleType1d:  24 * time.Hour,
+}
+
+// book aggregates resting orders by price
+func (m *market) book(limitBids, limitAsks int) stex.OrderBook {
+	aggregate := func(orders []*order, limit int) ([]stex.Order, stex.Decimal) {
+		res := []stex.Order{}
+		var total stex.Decimal
+		for _, o := range orders {
+			qty := o.remaining()
+			total = total.Add(qty)
+			if n := len(res); n > 0 && res[n-1].Price.Equal(o.Price) {
+				res[n-1].Amount = res[n-1].Amount.Add(qty)
+				res[n-1].Amount2 = res[n-1].Amount.Mul(o.Price)
+				res[n-1].Count++
+				res[n-1].CumulativeAmount = total
+				continue
+			}
+			if limit > 0 && len(res) >= limit {
+				continue
+			}
+			res = append(res, stex.Order{
+				CurrencyPairId:   m.pair.Id,
+				Amount:           qty,
+				Price:            o.Price,
+				Amount2:          qty.Mul(o.Price),
+				Count:            1,
+				CumulativeAmount: total,
+			})
+		}
+		return res, total
+	}
+
+	bids, bidTotal := aggregate(m.bids, limitBids)
+	asks, askTotal := aggregate(m.asks, limitAsks)
+
+	return stex.OrderBook{
+		Bid:            bids,
+		Ask:            asks,
+		BidTotalAmount: bidTotal,
+		AskTotalAmount: askTotal,
+	}
+}
+
+// ticker computes 24h statistics of the market
+func (m *market) ticker(now time.Time) stex.CurrencyPairTicker {
+	t := stex.CurrencyPairTicker{
+		Id:               m.pair.Id,
+		AmountMultiplier: m.pair.AmountMultiplier,
+		CurrencyCode:     m.pair.CurrencyCode,
+		MarketCode:       m.pair.MarketCode,
+		CurrencyName:     m.pair.CurrencyName,
+		MarketName:       m.pair.MarketName,
+		Symbol:           m.pair.Symbol,
+		GroupName:        m.pair.GroupName,
+		GroupId:          m.pair.GroupId,
+		Last:             m.last,
+		FiatsRate:        map[string]stex.Decimal{},
+		Timestamp:        stex.NewTime(now),
+	}
+
+	if len(m.bids) > 0 {
+		t.Bid = m.bids[0].Price
+	}
+	if len(m.asks) > 0 {
+		t.Ask = m.asks[0].Price
+	}
+
+	dayAgo := now.Add(-24 * time.Hour)
+	first := true
+	for _, tr := range m.trades {
+		if tr.Timestamp.Before(dayAgo) {
+			continue
+		}
+		if first {
+			t.Open, t.Low, t.High = tr.Price, tr.Price, tr.Price
+			first = false
+		}
+		t.Low = stex.MinDecimal(t.Low, tr.Price)
+		t.High = stex.MaxDecimal(t.High, tr.Price)
+		t.Volume = t.Volume.Add(tr.Amount)
+		t.VolumeQuote = t.VolumeQuote.Add(tr.Amount.Mul(tr.Price))
+	}
+
+	return t
+}
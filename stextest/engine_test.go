@@ -0,0 +1,71 @@
+package stextest
+
+import (
+	"context"
+	"testing"
+
+	stex "github.com/vladivolo/stex-api"
+)
+
+func TestEngineOrderStatus(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	maker := s.AddUser("maker")
+	taker := s.AddUser("taker")
+	s.SetBalance(maker, "ETH", stex.MustParseDecimal("10"))
+	s.SetBalance(taker, "BTC", stex.MustParseDecimal("1"))
+
+	sell, err := s.PlaceOrder(maker, 1, stex.OrderType_SELL, stex.MustParseDecimal("1"), stex.MustParseDecimal("0.02"), stex.Decimal{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sell.Status != stex.OrderStatus_PENDING {
+		t.Errorf("resting order status = %s, want PENDING", sell.Status)
+	}
+
+	buy, err := s.PlaceOrder(taker, 1, stex.OrderType_BUY, stex.MustParseDecimal("0.4"), stex.MustParseDecimal("0.02"), stex.Decimal{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buy.Status != stex.OrderStatus_FINISHED {
+		t.Errorf("filled order status = %s, want FINISHED", buy.Status)
+	}
+
+	ctx := context.Background()
+	c := s.Client("maker")
+
+	// Partially filled resting order stays open and is reported as PARTIAL
+	open, err := c.NewOpenOrdersListService().Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 1 || open[0].Id != sell.Id || open[0].Status != stex.OrderStatus_PARTIAL {
+		t.Fatalf("open orders = %+v, want order %d PARTIAL", open, sell.Id)
+	}
+	if !open[0].ProcessedAmount.Equal(stex.MustParseDecimal("0.4")) {
+		t.Errorf("processed = %s, want 0.4", open[0].ProcessedAmount)
+	}
+
+	// Cancelled after a partial fill it moves to history, still as PARTIAL
+	if _, err = c.NewOrderDeleteService().OrderId(sell.Id).Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	open, err = c.NewOpenOrdersListService().Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 0 {
+		t.Errorf("open orders after cancel = %+v", open)
+	}
+
+	info, ok := s.Order(sell.Id)
+	if !ok || info.Status != stex.OrderStatus_PARTIAL {
+		t.Errorf("cancelled order = %+v, want PARTIAL", info)
+	}
+
+	available, frozen := s.Balance(maker, "ETH")
+	if !available.Equal(stex.MustParseDecimal("9.6")) || !frozen.IsZero() {
+		t.Errorf("maker ETH = %s available, %s frozen, want 9.6 and 0", available, frozen)
+	}
+}
@@ -0,0 +1,104 @@
+package stextest
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Fault describes an injected failure of requests matching Method and Path
+type Fault struct {
+	// Method to match, empty matches any method
+	Method string
+	// Path prefix to match like "/trading/orders", empty matches any path
+	Path string
+
+	// Status of the response, 0 passes the request through after Latency
+	Status int
+	// Body of the response, default is STEX error envelope with the status text
+	Body string
+	// Header added to the response, e.g. Retry-After
+	Header http.Header
+	// Latency before the response is written
+	Latency time.Duration
+
+	// Count of requests to fail, 0 fails all matching requests until ClearFaults
+	Count int
+}
+
+type faultState struct {
+	Fault
+	hits int
+}
+
+// InjectFault makes matching requests fail, faults are checked in order of injection
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &faultState{Fault: f})
+}
+
+// ClearFaults removes all injected faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = nil
+}
+
+// takeFault returns the first active fault matching request and counts the hit
+func (s *Server) takeFault(r *http.Request) (Fault, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.faults {
+		if f.Method != "" && f.Method != r.Method {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, f.Path) {
+			continue
+		}
+		if f.Count > 0 && f.hits >= f.Count {
+			continue
+		}
+		f.hits++
+		return f.Fault, true
+	}
+	return Fault{}, false
+}
+
+// applyFault writes injected failure and reports whether the request is answered
+func (s *Server) applyFault(w http.ResponseWriter, r *http.Request) bool {
+	f, ok := s.takeFault(r)
+	if !ok {
+		return false
+	}
+
+	if f.Latency > 0 {
+		select {
+		case <-time.After(f.Latency):
+		case <-r.Context().Done():
+			return true
+		}
+	}
+
+	if f.Status == 0 {
+		return false
+	}
+
+	for k, v := range f.Header {
+		w.Header()[k] = v
+	}
+	if f.Body != "" {
+		w.WriteHeader(f.Status)
+		w.Write([]byte(f.Body))
+		return true
+	}
+
+	writeJSON(w, f.Status, map[string]interface{}{
+		"success": false,
+		"message": http.StatusText(f.Status),
+	})
+	return true
+}
@@ -0,0 +1,1023 @@
+package stextest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+)
+
+type handler func(s *Server, r *http.Request, u *user, args []string) (interface{}, error)
+
+type route struct {
+	method string
+	// "*" matches any path segment, matched segments are passed to the handler as args
+	path    []string
+	private bool
+	h       handler
+}
+
+var routes = []route{
+	{"GET", []string{"public", "ping"}, false, handlePing},
+	{"GET", []string{"public", "currencies"}, false, handleCurrencies},
+	{"GET", []string{"public", "currencies", "*"}, false, handleCurrency},
+	{"GET", []string{"public", "markets"}, false, handleMarkets},
+	{"GET", []string{"public", "pairs-goups"}, false, handlePairsGroups},
+	{"GET", []string{"public", "currency_pairs", "list", "*"}, false, handlePairsList},
+	{"GET", []string{"public", "currency_pairs", "group", "*"}, false, handlePairsGroup},
+	{"GET", []string{"public", "currency_pairs", "*"}, false, handlePair},
+	{"GET", []string{"public", "ticker"}, false, handleTickers},
+	{"GET", []string{"public", "ticker", "*"}, false, handleTicker},
+	{"GET", []string{"public", "trades", "*"}, false, handlePublicTrades},
+	{"GET", []string{"public", "orderbook", "*"}, false, handleOrderbook},
+	{"GET", []string{"public", "chart", "*", "*"}, false, handleChart},
+	{"GET", []string{"public", "deposit-statuses"}, false, handleDepositStatuses},
+	{"GET", []string{"public", "deposit-statuses", "*"}, false, handleDepositStatus},
+	{"GET", []string{"public", "withdrawal-statuses"}, false, handleWithdrawalStatuses},
+	{"GET", []string{"public", "withdrawal-statuses", "*"}, false, handleWithdrawalStatus},
+
+	{"GET", []string{"trading", "fees", "*"}, true, handleFees},
+	{"GET", []string{"trading", "orders"}, true, handleOpenOrders},
+	{"DELETE", []string{"trading", "orders"}, true, handleDeleteOrders},
+	{"GET", []string{"trading", "orders", "*"}, true, handleOpenOrders},
+	{"DELETE", []string{"trading", "orders", "*"}, true, handleDeleteOrders},
+	{"POST", []string{"trading", "orders", "*"}, true, handleCreateOrder},
+	{"GET", []string{"trading", "order", "*"}, true, handleOrder},
+	{"DELETE", []string{"trading", "order", "*"}, true, handleDeleteOrder},
+
+	{"GET", []string{"reports", "orders"}, true, handleOrdersHistory},
+	{"GET", []string{"reports", "orders", "*"}, true, handleOrderDetail},
+	{"GET", []string{"reports", "trades", "*"}, true, handleTradesHistory},
+
+	{"GET", []string{"profile", "info"}, true, handleProfileInfo},
+	{"GET", []string{"profile", "wallets"}, true, handleWallets},
+	{"GET", []string{"profile", "wallets", "address", "*"}, true, handleWalletAddress},
+	{"POST", []string{"profile", "wallets", "address", "*"}, true, handleWalletAddress},
+	{"GET", []string{"profile", "wallets", "*"}, true, handleWallet},
+	{"POST", []string{"profile", "wallets", "*"}, true, handleCreateWallet},
+	{"GET", []string{"profile", "deposits"}, true, handleDeposits},
+	{"GET", []string{"profile", "deposits", "*"}, true, handleDeposit},
+	{"GET", []string{"profile", "withdrawals"}, true, handleWithdrawals},
+	{"GET", []string{"profile", "withdrawals", "*"}, true, handleWithdrawal},
+	{"POST", []string{"profile", "withdraw"}, true, handleWithdraw},
+	{"DELETE", []string{"profile", "withdraw", "*"}, true, handleCancelWithdrawal},
+	{"GET", []string{"profile", "notifications"}, true, handleNotifications},
+	{"POST", []string{"profile", "referral", "program"}, true, handleReferral},
+	{"POST", []string{"profile", "referral", "insert"}, true, handleReferral},
+}
+
+func (rt *route) match(method string, parts []string) ([]string, bool) {
+	if rt.method != method || len(rt.path) != len(parts) {
+		return nil, false
+	}
+
+	args := []string{}
+	for i, p := range rt.path {
+		if p == "*" {
+			args = append(args, parts[i])
+			continue
+		}
+		if p != parts[i] {
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.applyFault(w, r) {
+		return
+	}
+
+	r.ParseForm()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	for _, rt := range routes {
+		args, ok := rt.match(r.Method, parts)
+		if !ok {
+			continue
+		}
+
+		s.mu.Lock()
+		data, err := s.handle(&rt, r, args)
+		s.mu.Unlock()
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    data,
+		})
+		return
+	}
+
+	writeError(w, &httpError{http.StatusNotFound, "Not found"})
+}
+
+func (s *Server) handle(rt *route, r *http.Request, args []string) (interface{}, error) {
+	var u *user
+	if rt.private {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		var ok bool
+		u, ok = s.tokens[token]
+		if !ok || token == "" {
+			return nil, &httpError{http.StatusUnauthorized, "Unauthenticated."}
+		}
+	}
+	return rt.h(s, r, u, args)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if e, ok := err.(*httpError); ok {
+		status = e.status
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"success": false,
+		"message": err.Error(),
+	})
+}
+
+var errNotFound = &httpError{http.StatusNotFound, "Not found"}
+
+func argInt(args []string, i int) (int64, error) {
+	v, err := strconv.ParseInt(args[i], 10, 64)
+	if err != nil {
+		return 0, &httpError{http.StatusNotFound, "Not found"}
+	}
+	return v, nil
+}
+
+func paramInt(r *http.Request, name string, def int64) (int64, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, &httpError{http.StatusUnprocessableEntity, "Invalid " + name}
+	}
+	return n, nil
+}
+
+func paramDecimal(r *http.Request, name string) (stex.Decimal, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return stex.Decimal{}, nil
+	}
+	d, err := stex.ParseDecimal(v)
+	if err != nil {
+		return stex.Decimal{}, &httpError{http.StatusUnprocessableEntity, "Invalid " + name}
+	}
+	return d, nil
+}
+
+// paramTime reads unix seconds, missing value gives def
+func paramTime(r *http.Request, name string, def time.Time) (time.Time, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, &httpError{http.StatusUnprocessableEntity, "Invalid " + name}
+	}
+	return time.Unix(n, 0), nil
+}
+
+// page returns limit and offset bounds for a list of n items
+func page(r *http.Request, n int) (int, int, error) {
+	limit, err := paramInt(r, "limit", 100)
+	if err != nil {
+		return 0, 0, err
+	}
+	offset, err := paramInt(r, "offset", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	from := int(offset)
+	if from > n {
+		from = n
+	}
+	to := from + int(limit)
+	if limit <= 0 || to > n {
+		to = n
+	}
+	return from, to, nil
+}
+
+func handlePing(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	return stex.Ping{Timestamp: stex.NewTime(s.now())}, nil
+}
+
+func handleCurrencies(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	return s.sortedCurrencies(), nil
+}
+
+func handleCurrency(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	id, err := argInt(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := s.currencies[int(id)]
+	if !ok {
+		return nil, errNotFound
+	}
+	return c, nil
+}
+
+func handleMarkets(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	res := []stex.MarketInfo{}
+	seen := map[string]bool{}
+	for _, m := range s.sortedPairs() {
+		if seen[m.pair.MarketCode] {
+			continue
+		}
+		seen[m.pair.MarketCode] = true
+		res = append(res, stex.MarketInfo{Code: m.pair.MarketCode, Name: m.pair.MarketName})
+	}
+	return res, nil
+}
+
+func handlePairsGroups(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	return append([]stex.PairsGroup{}, s.groups...), nil
+}
+
+func handlePairsList(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	res := []stex.CurrencyPair{}
+	for _, m := range s.sortedPairs() {
+		if args[0] == "ALL" || strings.EqualFold(args[0], m.pair.MarketCode) {
+			res = append(res, m.pair)
+		}
+	}
+	return res, nil
+}
+
+func handlePairsGroup(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	id, err := argInt(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	res := []stex.CurrencyPair{}
+	for _, m := range s.sortedPairs() {
+		if int64(m.pair.GroupId) == id {
+			res = append(res, m.pair)
+		}
+	}
+	return res, nil
+}
+
+func (s *Server) marketArg(args []string, i int) (*market, error) {
+	id, err := argInt(args, i)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := s.markets[int(id)]
+	if !ok {
+		return nil, &httpError{http.StatusNotFound, "Currency pair not found"}
+	}
+	return m, nil
+}
+
+func handlePair(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	m, err := s.marketArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return m.pair, nil
+}
+
+func handleTickers(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	res := []stex.CurrencyPairTicker{}
+	for _, m := range s.sortedPairs() {
+		res = append(res, m.ticker(s.now()))
+	}
+	return res, nil
+}
+
+func handleTicker(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	m, err := s.marketArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return m.ticker(s.now()), nil
+}
+
+func handlePublicTrades(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	m, err := s.marketArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	from, err := paramTime(r, "from", time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	till, err := paramTime(r, "till", s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	res := []stex.CurrencyPairTrades{}
+	for _, t := range m.trades {
+		if !t.Timestamp.Before(from) && !t.Timestamp.After(till) {
+			res = append(res, t)
+		}
+	}
+
+	if r.FormValue("sort") != string(stex.SortAsc) {
+		for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+			res[i], res[j] = res[j], res[i]
+		}
+	}
+
+	lo, hi, err := page(r, len(res))
+	if err != nil {
+		return nil, err
+	}
+	return res[lo:hi], nil
+}
+
+func handleOrderbook(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	m, err := s.marketArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	limitBids, err := paramInt(r, "limit_bids", 100)
+	if err != nil {
+		return nil, err
+	}
+	limitAsks, err := paramInt(r, "limit_asks", 100)
+	if err != nil {
+		return nil, err
+	}
+	return m.book(int(limitBids), int(limitAsks)), nil
+}
+
+func handleChart(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	m, err := s.marketArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	size, ok := candleSizes[stex.CandleType(args[1])]
+	if !ok {
+		return nil, &httpError{http.StatusUnprocessableEntity, "Invalid candle type"}
+	}
+	if r.FormValue("timeStart") == "" || r.FormValue("timeEnd") == "" {
+		return nil, &httpError{http.StatusUnprocessableEntity, "timeStart and timeEnd are required"}
+	}
+	from, err := paramTime(r, "timeStart", time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	till, err := paramTime(r, "timeEnd", time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	res := m.candles(size, from, till)
+	lo, hi, err := page(r, len(res))
+	if err != nil {
+		return nil, err
+	}
+	return res[lo:hi], nil
+}
+
+var depositStatuses = []stex.Deposit{
+	{Id: 1, Name: "Processing", StatusColor: "#B7A300"},
+	{Id: 2, Name: "Finished", StatusColor: "#00BE6E"},
+}
+
+const (
+	withdrawalAwaiting  = 1
+	withdrawalFinished  = 3
+	withdrawalCancelled = 4
+)
+
+var withdrawalStatuses = map[int]stex.Withdrawal{
+	1: {Id: 1, Name: "Awaiting Confirmation", StatusColor: "#B7A300"},
+	2: {Id: 2, Name: "Processing", StatusColor: "#B7A300"},
+	3: {Id: 3, Name: "Finished", StatusColor: "#00BE6E"},
+	4: {Id: 4, Name: "Cancelled", StatusColor: "#EA0000"},
+}
+
+func handleDepositStatuses(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	return depositStatuses, nil
+}
+
+func handleDepositStatus(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	id, err := argInt(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range depositStatuses {
+		if d.Id == id {
+			return d, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+func handleWithdrawalStatuses(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	res := []stex.Withdrawal{}
+	for i := 1; i <= len(withdrawalStatuses); i++ {
+		res = append(res, withdrawalStatuses[i])
+	}
+	return res, nil
+}
+
+func handleWithdrawalStatus(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	id, err := argInt(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	st, ok := withdrawalStatuses[int(id)]
+	if !ok {
+		return nil, errNotFound
+	}
+	return st, nil
+}
+
+func handleFees(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	m, err := s.marketArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return s.fees(u, m), nil
+}
+
+// userOrders returns orders of the user matching filter ordered by id descending
+func (s *Server) userOrders(u *user, filter func(o *order) bool) []*order {
+	res := []*order{}
+	for _, o := range s.orders {
+		if o.userId == u.id && filter(o) {
+			res = append(res, o)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Id > res[j].Id })
+	return res
+}
+
+func orderInfos(orders []*order) []stex.OrderInfo {
+	res := make([]stex.OrderInfo, 0, len(orders))
+	for _, o := range orders {
+		res = append(res, o.OrderInfo)
+	}
+	return res
+}
+
+func handleOpenOrders(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	pairId := int64(-1)
+	if len(args) > 0 {
+		m, err := s.marketArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		pairId = int64(m.pair.Id)
+	}
+
+	orders := s.userOrders(u, func(o *order) bool {
+		return o.isActive() && (pairId < 0 || int64(o.CurrencyPairId) == pairId)
+	})
+
+	lo, hi, err := page(r, len(orders))
+	if err != nil {
+		return nil, err
+	}
+	return orderInfos(orders[lo:hi]), nil
+}
+
+func handleDeleteOrders(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	pairId := int64(-1)
+	if len(args) > 0 {
+		m, err := s.marketArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		pairId = int64(m.pair.Id)
+	}
+
+	orders := s.userOrders(u, func(o *order) bool {
+		return o.isActive() && (pairId < 0 || int64(o.CurrencyPairId) == pairId)
+	})
+
+	res := stex.DeletedOrders{
+		Processing: []stex.OrderInfo{},
+		Pending:    []stex.OrderInfo{},
+		Message:    "Orders were put into processing queue",
+	}
+	for _, o := range orders {
+		s.cancel(o)
+		res.Processing = append(res.Processing, o.OrderInfo)
+	}
+	return res, nil
+}
+
+func handleCreateOrder(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	pairId, err := argInt(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := paramDecimal(r, "amount")
+	if err != nil {
+		return nil, err
+	}
+	price, err := paramDecimal(r, "price")
+	if err != nil {
+		return nil, err
+	}
+	trigger, err := paramDecimal(r, "trigger_price")
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := s.placeOrder(u, int(pairId), stex.OrderType(r.FormValue("type")), amount, price, trigger)
+	if err != nil {
+		return nil, err
+	}
+	return o.OrderInfo, nil
+}
+
+func (s *Server) userOrder(u *user, args []string) (*order, error) {
+	id, err := argInt(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	o, ok := s.orders[id]
+	if !ok || o.userId != u.id {
+		return nil, &httpError{http.StatusNotFound, "Order not found"}
+	}
+	return o, nil
+}
+
+func handleOrder(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	o, err := s.userOrder(u, args)
+	if err != nil {
+		return nil, err
+	}
+	return o.OrderInfo, nil
+}
+
+func handleDeleteOrder(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	o, err := s.userOrder(u, args)
+	if err != nil {
+		return nil, err
+	}
+
+	res := stex.DeletedOrders{
+		Processing: []stex.OrderInfo{},
+		Pending:    []stex.OrderInfo{},
+	}
+	if s.cancel(o) {
+		res.Processing = append(res.Processing, o.OrderInfo)
+		res.Message = "Order was put into processing queue"
+	} else {
+		res.Pending = append(res.Pending, o.OrderInfo)
+		res.Message = "Order is not active"
+	}
+	return res, nil
+}
+
+func handleOrdersHistory(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	pairId, err := paramInt(r, "currencyPairId", -1)
+	if err != nil {
+		return nil, err
+	}
+	from, err := paramTime(r, "timeStart", time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	till, err := paramTime(r, "timeEnd", s.now())
+	if err != nil {
+		return nil, err
+	}
+	status := stex.OrderStatus(r.FormValue("orderStatus"))
+	if status == "" {
+		status = stex.OrderStatus_ALL
+	}
+
+	orders := s.userOrders(u, func(o *order) bool {
+		if o.isActive() || (pairId >= 0 && int64(o.CurrencyPairId) != pairId) {
+			return false
+		}
+		if o.Timestamp.Before(from) || o.Timestamp.After(till) {
+			return false
+		}
+		switch status {
+		case stex.OrderStatus_ALL:
+			return true
+		case stex.OrderStatus_WITH_TRADES:
+			return o.Status == stex.OrderStatus_FINISHED || o.Status == stex.OrderStatus_PARTIAL
+		}
+		return o.Status == status
+	})
+
+	lo, hi, err := page(r, len(orders))
+	if err != nil {
+		return nil, err
+	}
+	return orderInfos(orders[lo:hi]), nil
+}
+
+func handleOrderDetail(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	o, err := s.userOrder(u, args)
+	if err != nil {
+		return nil, err
+	}
+	return stex.TradeOrderDetail{
+		Id:             o.Id,
+		CurrencyPairId: o.CurrencyPairId,
+		Price:          o.Price,
+		InitialAmount:  o.InitialAmount,
+		Type:           string(o.OriginalType),
+		Created:        o.Created,
+		Timestamp:      o.Timestamp,
+		Status:         string(o.Status),
+		Trades:         append([]stex.Trade{}, o.trades...),
+		Fees:           append([]stex.Fee{}, o.fees...),
+	}, nil
+}
+
+func handleTradesHistory(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	m, err := s.marketArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	from, err := paramTime(r, "timeStart", time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	till, err := paramTime(r, "timeEnd", s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	res := []stex.Trade{}
+	seen := map[int64]bool{}
+	for _, o := range s.userOrders(u, func(o *order) bool { return o.CurrencyPairId == m.pair.Id }) {
+		for _, t := range o.trades {
+			if seen[t.Id] || t.Timestamp.Before(from) || t.Timestamp.After(till) {
+				continue
+			}
+			seen[t.Id] = true
+			res = append(res, t)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Id > res[j].Id })
+
+	lo, hi, err := page(r, len(res))
+	if err != nil {
+		return nil, err
+	}
+	return res[lo:hi], nil
+}
+
+func handleProfileInfo(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	percent := stex.MustParseDecimal("0.2")
+	info := stex.ProfileInfo{
+		Email:    u.email,
+		Username: strings.Split(u.email, "@")[0],
+		UserId:   u.id,
+		TradingFeeLevels: stex.TradingFeeLevel{
+			NotVerified:  percent,
+			Cryptonomica: percent,
+			Privatbank:   percent,
+			Stex:         percent,
+		},
+		ApiWithdrawalsAllowed: true,
+		ReferralProgram:       stex.ReferralProgram(u.referral),
+		ApproxBalance:         map[string]stex.Balance{},
+	}
+
+	for _, w := range u.wallets {
+		c := s.currencies[w.currencyId]
+		info.ApproxBalance[c.Code] = stex.Balance{
+			Balance:       w.balance,
+			FrozenBalance: w.frozen,
+			TotalBalance:  w.balance.Add(w.frozen),
+		}
+	}
+	return info, nil
+}
+
+func (s *Server) walletInfo(w *wallet) stex.Wallet {
+	c := s.currencies[w.currencyId]
+	return stex.Wallet{
+		Id:            w.id,
+		CurrencyId:    c.Id,
+		Delisted:      c.Delisted,
+		CurrencyCode:  c.Code,
+		CurrencyName:  c.Name,
+		Rates:         map[string]stex.Decimal{},
+		Balance:       w.balance,
+		FrozenBalance: w.frozen,
+	}
+}
+
+func (s *Server) walletAdv(w *wallet) stex.WalletAdv {
+	c := s.currencies[w.currencyId]
+	return stex.WalletAdv{
+		Id:             w.id,
+		CurrencyId:     c.Id,
+		Delisted:       c.Delisted,
+		Code:           c.Code,
+		Balance:        w.balance,
+		FrozenBalance:  w.frozen,
+		DepositAddress: depositAddress(w),
+		Rates:          map[string]stex.Decimal{},
+	}
+}
+
+func depositAddress(w *wallet) stex.Address {
+	return stex.Address{
+		Address:      "addr" + strconv.FormatInt(w.id, 10),
+		AddressName:  "Address",
+		ProtocolName: "Default",
+	}
+}
+
+func handleWallets(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	res := []stex.Wallet{}
+	for _, w := range u.wallets {
+		res = append(res, s.walletInfo(w))
+	}
+
+	value := func(w stex.Wallet) stex.Decimal {
+		switch stex.SortBalanceField(r.FormValue("sortBy")) {
+		case stex.SortByFrozen:
+			return w.FrozenBalance
+		case stex.SortByBonus:
+			return w.BonusBalance
+		case stex.SortByTotal:
+			return w.Balance.Add(w.FrozenBalance).Add(w.BonusBalance)
+		case stex.SortByBalance:
+			return w.Balance
+		}
+		return stex.NewDecimalFromInt(w.Id)
+	}
+	desc := r.FormValue("sort") == string(stex.SortDesc)
+	sort.SliceStable(res, func(i, j int) bool {
+		if desc {
+			return value(res[i]).GreaterThan(value(res[j]))
+		}
+		return value(res[i]).LessThan(value(res[j]))
+	})
+
+	return res, nil
+}
+
+func (s *Server) userWallet(u *user, args []string) (*wallet, error) {
+	id, err := argInt(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range u.wallets {
+		if w.id == id {
+			return w, nil
+		}
+	}
+	return nil, &httpError{http.StatusNotFound, "Wallet not found"}
+}
+
+func handleWallet(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	w, err := s.userWallet(u, args)
+	if err != nil {
+		return nil, err
+	}
+	return s.walletAdv(w), nil
+}
+
+func handleCreateWallet(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	id, err := argInt(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.currencies[int(id)]; !ok {
+		return nil, &httpError{http.StatusNotFound, "Currency not found"}
+	}
+	if _, ok := u.wallets[int(id)]; ok {
+		return nil, &httpError{http.StatusBadRequest, "Wallet already exists"}
+	}
+	return s.walletAdv(s.wallet(u, int(id))), nil
+}
+
+func handleWalletAddress(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	w, err := s.userWallet(u, args)
+	if err != nil {
+		return nil, err
+	}
+	return depositAddress(w), nil
+}
+
+func handleDeposits(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	currencyId, err := paramInt(r, "currencyId", -1)
+	if err != nil {
+		return nil, err
+	}
+	from, err := paramTime(r, "timeStart", time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	till, err := paramTime(r, "timeEnd", s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	res := []stex.DepositAdv{}
+	for _, d := range s.deposits {
+		if d.userId != u.id || (currencyId >= 0 && int64(d.CurrencyId) != currencyId) {
+			continue
+		}
+		if d.Timestamp.Before(from) || d.Timestamp.After(till) {
+			continue
+		}
+		res = append(res, d.DepositAdv)
+	}
+	if r.FormValue("sort") != string(stex.SortAsc) {
+		sort.Slice(res, func(i, j int) bool { return res[i].Id > res[j].Id })
+	}
+
+	lo, hi, err := page(r, len(res))
+	if err != nil {
+		return nil, err
+	}
+	return res[lo:hi], nil
+}
+
+func handleDeposit(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	id, err := argInt(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range s.deposits {
+		if d.Id == id && d.userId == u.id {
+			return d.DepositAdv, nil
+		}
+	}
+	return nil, &httpError{http.StatusNotFound, "Deposit not found"}
+}
+
+func handleWithdrawals(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	currencyId, err := paramInt(r, "currencyId", -1)
+	if err != nil {
+		return nil, err
+	}
+	from, err := paramTime(r, "timeStart", time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	till, err := paramTime(r, "timeEnd", s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	res := []stex.WithdrawalAdv{}
+	for _, wd := range s.withdrawals {
+		if wd.userId != u.id || (currencyId >= 0 && int64(wd.CurrencyId) != currencyId) {
+			continue
+		}
+		if wd.CreatedTs.Before(from) || wd.CreatedTs.After(till) {
+			continue
+		}
+		res = append(res, wd.WithdrawalAdv)
+	}
+	if r.FormValue("sort") != string(stex.SortAsc) {
+		sort.Slice(res, func(i, j int) bool { return res[i].Id > res[j].Id })
+	}
+
+	lo, hi, err := page(r, len(res))
+	if err != nil {
+		return nil, err
+	}
+	return res[lo:hi], nil
+}
+
+func (s *Server) userWithdrawal(u *user, args []string) (*withdrawal, error) {
+	id, err := argInt(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, wd := range s.withdrawals {
+		if wd.Id == id && wd.userId == u.id {
+			return wd, nil
+		}
+	}
+	return nil, &httpError{http.StatusNotFound, "Withdrawal not found"}
+}
+
+func handleWithdrawal(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	wd, err := s.userWithdrawal(u, args)
+	if err != nil {
+		return nil, err
+	}
+	return wd.WithdrawalAdv, nil
+}
+
+func handleWithdraw(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	currencyId, err := paramInt(r, "currency_id", -1)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := s.currencies[int(currencyId)]
+	if !ok {
+		return nil, &httpError{http.StatusNotFound, "Currency not found"}
+	}
+	amount, err := paramDecimal(r, "amount")
+	if err != nil {
+		return nil, err
+	}
+	if !amount.IsPositive() || amount.LessThan(c.MinimumWithdrawalAmount) {
+		return nil, &httpError{http.StatusUnprocessableEntity, "Invalid amount: less than minimal withdrawal amount"}
+	}
+	address := r.FormValue("address")
+	if address == "" {
+		return nil, &httpError{http.StatusUnprocessableEntity, "Invalid address"}
+	}
+
+	w := s.wallet(u, c.Id)
+	if w.balance.LessThan(amount) {
+		return nil, &httpError{http.StatusBadRequest, "Insufficient balance"}
+	}
+	w.balance = w.balance.Sub(amount)
+	w.frozen = w.frozen.Add(amount)
+
+	now := s.now()
+	st := withdrawalStatuses[withdrawalAwaiting]
+	wd := &withdrawal{userId: u.id}
+	wd.WithdrawalAdv = stex.WithdrawalAdv{
+		Id:                 s.nextId(),
+		CurrencyId:         c.Id,
+		CurrencyCode:       c.Code,
+		Amount:             amount,
+		Fee:                c.WithdrawalFeeConst,
+		FeeCurrencyId:      c.Id,
+		FeeCurrencyCode:    c.Code,
+		WithdrawalStatusId: withdrawalAwaiting,
+		Status:             st.Name,
+		StatusColor:        st.StatusColor,
+		CreatedAt:          dateTime(now),
+		CreatedTs:          stex.NewTime(now),
+		UpdatedAt:          dateTime(now),
+		UpdatedTs:          stex.NewTime(now),
+		WithdrawalAddress:  stex.Address{Address: address, AdditionalAddressParameter: r.FormValue("additional_address_parameter")},
+	}
+	s.withdrawals = append(s.withdrawals, wd)
+
+	return wd.WithdrawalAdv, nil
+}
+
+func handleCancelWithdrawal(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	wd, err := s.userWithdrawal(u, args)
+	if err != nil {
+		return nil, err
+	}
+	if wd.WithdrawalStatusId != withdrawalAwaiting {
+		return nil, &httpError{http.StatusBadRequest, "Withdrawal can't be cancelled"}
+	}
+
+	w := s.wallet(u, wd.CurrencyId)
+	w.frozen = w.frozen.Sub(wd.Amount)
+	w.balance = w.balance.Add(wd.Amount)
+
+	now := s.now()
+	st := withdrawalStatuses[withdrawalCancelled]
+	wd.WithdrawalStatusId = withdrawalCancelled
+	wd.Status = st.Name
+	wd.StatusColor = st.StatusColor
+	wd.UpdatedAt = dateTime(now)
+	wd.UpdatedTs = stex.NewTime(now)
+
+	return wd.WithdrawalAdv, nil
+}
+
+func handleNotifications(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	res := make([]stex.Notification, 0, len(u.notifications))
+	for i := len(u.notifications) - 1; i >= 0; i-- {
+		res = append(res, u.notifications[i])
+	}
+
+	lo, hi, err := page(r, len(res))
+	if err != nil {
+		return nil, err
+	}
+	return res[lo:hi], nil
+}
+
+func handleReferral(s *Server, r *http.Request, u *user, args []string) (interface{}, error) {
+	if code := r.FormValue("code"); code != "" {
+		u.referral.Invited = true
+	}
+	return u.referral, nil
+}
@@ -0,0 +1,395 @@
+// Package stextest provides in-memory fakes of STEX API for tests.
+//
+// Server is a fake of the REST API with a matching engine for limit and stop-limit orders,
+// balance freezing and fee deduction. Point Client.BaseURL at Server.URL:
+//
+//	srv := stextest.NewServer()
+//	defer srv.Close()
+//
+//	user := srv.AddUser("token")
+//	srv.SetBalance(user, "BTC", stex.MustParseDecimal("1"))
+//	c := srv.Client("token")
+package stextest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+)
+
+// Server is an in-memory fake of STEX REST API
+type Server struct {
+	*httptest.Server
+
+	// Now returns the exchange time, tests may replace it before placing orders
+	Now func() time.Time
+
+	mu sync.Mutex
+
+	currencies map[int]*stex.CurrencyInfo
+	groups     []stex.PairsGroup
+	markets    map[int]*market
+	users      map[int64]*user
+	tokens     map[string]*user
+	orders     map[int64]*order
+
+	deposits    []*deposit
+	withdrawals []*withdrawal
+
+	seq    int64
+	faults []*faultState
+}
+
+type user struct {
+	id            int64
+	token         string
+	email         string
+	wallets       map[int]*wallet
+	fees          map[int]stex.Fees
+	notifications []stex.Notification
+	referral      stex.Referral
+}
+
+type wallet struct {
+	id         int64
+	currencyId int
+	balance    stex.Decimal
+	frozen     stex.Decimal
+}
+
+type deposit struct {
+	stex.DepositAdv
+	userId int64
+}
+
+type withdrawal struct {
+	stex.WithdrawalAdv
+	userId int64
+}
+
+// NewServer starts fake server with BTC, ETH and USDT currencies and pairs
+// ETH_BTC (id 1), BTC_USDT (id 2) and ETH_USDT (id 3)
+func NewServer() *Server {
+	s := NewEmptyServer()
+
+	s.AddCurrency(stex.CurrencyInfo{Id: 1, Code: "BTC", Name: "Bitcoin", Precision: 8})
+	s.AddCurrency(stex.CurrencyInfo{Id: 2, Code: "ETH", Name: "Ethereum", Precision: 8})
+	s.AddCurrency(stex.CurrencyInfo{Id: 3, Code: "USDT", Name: "Tether", Precision: 8})
+
+	s.AddPair(stex.CurrencyPair{Id: 1, CurrencyId: 2, MarketCurrencyId: 1, MinOrderAmount: stex.MustParseDecimal("0.001"), MinBuyPrice: stex.MustParseDecimal("0.00000001"), MinSellPrice: stex.MustParseDecimal("0.00000001"), BuyFeePercent: stex.MustParseDecimal("0.2"), SellFeePercent: stex.MustParseDecimal("0.2"), CurrencyPrecision: 8, MarketPrecision: 8, GroupId: 1, GroupName: "Main"})
+	s.AddPair(stex.CurrencyPair{Id: 2, CurrencyId: 1, MarketCurrencyId: 3, MinOrderAmount: stex.MustParseDecimal("0.0001"), MinBuyPrice: stex.MustParseDecimal("0.01"), MinSellPrice: stex.MustParseDecimal("0.01"), BuyFeePercent: stex.MustParseDecimal("0.2"), SellFeePercent: stex.MustParseDecimal("0.2"), CurrencyPrecision: 8, MarketPrecision: 2, GroupId: 1, GroupName: "Main"})
+	s.AddPair(stex.CurrencyPair{Id: 3, CurrencyId: 2, MarketCurrencyId: 3, MinOrderAmount: stex.MustParseDecimal("0.001"), MinBuyPrice: stex.MustParseDecimal("0.01"), MinSellPrice: stex.MustParseDecimal("0.01"), BuyFeePercent: stex.MustParseDecimal("0.2"), SellFeePercent: stex.MustParseDecimal("0.2"), CurrencyPrecision: 8, MarketPrecision: 2, GroupId: 1, GroupName: "Main"})
+
+	return s
+}
+
+// NewEmptyServer starts fake server without currencies and pairs
+func NewEmptyServer() *Server {
+	s := &Server{
+		Now:        time.Now,
+		currencies: map[int]*stex.CurrencyInfo{},
+		markets:    map[int]*market{},
+		users:      map[int64]*user{},
+		tokens:     map[string]*user{},
+		orders:     map[int64]*order{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Client returns API client of the user with given token pointed at the server
+func (s *Server) Client(token string) *stex.Client {
+	c := stex.NewClient(token)
+	c.BaseURL = s.URL
+	c.HTTPClient = s.Server.Client()
+	return c
+}
+
+func (s *Server) nextId() int64 {
+	s.seq++
+	return s.seq
+}
+
+func (s *Server) now() time.Time {
+	return s.Now().In(stex.TimeLocation)
+}
+
+// AddCurrency registers currency, Active is forced to true unless Delisted is set
+func (s *Server) AddCurrency(c stex.CurrencyInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !c.Delisted {
+		c.Active = true
+	}
+	s.currencies[c.Id] = &c
+}
+
+// AddPair registers currency pair of known currencies. Codes, names and symbol are filled from currencies.
+func (s *Server) AddPair(p stex.CurrencyPair) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	base, ok := s.currencies[p.CurrencyId]
+	if !ok {
+		return fmt.Errorf("currency %d not found", p.CurrencyId)
+	}
+	quote, ok := s.currencies[p.MarketCurrencyId]
+	if !ok {
+		return fmt.Errorf("currency %d not found", p.MarketCurrencyId)
+	}
+
+	p.CurrencyCode = base.Code
+	p.CurrencyName = base.Name
+	p.MarketCode = quote.Code
+	p.MarketName = quote.Name
+	p.Symbol = base.Code + "_" + quote.Code
+	if !p.Delisted {
+		p.Active = true
+	}
+	if p.AmountMultiplier == 0 {
+		p.AmountMultiplier = 1
+	}
+
+	if p.GroupId != 0 {
+		found := false
+		for _, g := range s.groups {
+			if g.Id == fmt.Sprint(p.GroupId) {
+				found = true
+			}
+		}
+		if !found {
+			s.groups = append(s.groups, stex.PairsGroup{Id: fmt.Sprint(p.GroupId), Name: p.GroupName, Position: len(s.groups) + 1})
+		}
+	}
+
+	s.markets[p.Id] = &market{pair: p}
+	return nil
+}
+
+// UpdatePair changes pair settings, e.g. to delist or deactivate it
+func (s *Server) UpdatePair(id int, f func(p *stex.CurrencyPair)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.markets[id]
+	if !ok {
+		return fmt.Errorf("pair %d not found", id)
+	}
+	f(&m.pair)
+	return nil
+}
+
+// AddUser registers user authenticated by token and returns its id
+func (s *Server) AddUser(token string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := &user{
+		id:      s.nextId(),
+		token:   token,
+		wallets: map[int]*wallet{},
+		fees:    map[int]stex.Fees{},
+	}
+	u.email = fmt.Sprintf("user%d@example.com", u.id)
+	u.referral.ReferralCode = fmt.Sprintf("ref%d", u.id)
+
+	s.users[u.id] = u
+	s.tokens[token] = u
+	return u.id
+}
+
+func (s *Server) currencyByCode(code string) (*stex.CurrencyInfo, bool) {
+	for _, c := range s.currencies {
+		if strings.EqualFold(c.Code, code) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) wallet(u *user, currencyId int) *wallet {
+	w, ok := u.wallets[currencyId]
+	if !ok {
+		w = &wallet{id: s.nextId(), currencyId: currencyId}
+		u.wallets[currencyId] = w
+	}
+	return w
+}
+
+// SetBalance sets available balance of user wallet in given currency
+func (s *Server) SetBalance(userId int64, code string, amount stex.Decimal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userId]
+	if !ok {
+		return fmt.Errorf("user %d not found", userId)
+	}
+	c, ok := s.currencyByCode(code)
+	if !ok {
+		return fmt.Errorf("currency %s not found", code)
+	}
+
+	s.wallet(u, c.Id).balance = amount
+	return nil
+}
+
+// Balance returns available and frozen balance of user wallet in given currency
+func (s *Server) Balance(userId int64, code string) (available, frozen stex.Decimal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userId]
+	if !ok {
+		return
+	}
+	c, ok := s.currencyByCode(code)
+	if !ok {
+		return
+	}
+	w, ok := u.wallets[c.Id]
+	if !ok {
+		return
+	}
+	return w.balance, w.frozen
+}
+
+// SetFees overrides user fees for the pair. Fees are fractions, 0.002 means 0.2%.
+func (s *Server) SetFees(userId int64, pairId int, buy, sell stex.Decimal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[userId]; ok {
+		u.fees[pairId] = stex.Fees{BuyFee: buy, SellFee: sell}
+	}
+}
+
+// fees returns user fees for the pair as fractions
+func (s *Server) fees(u *user, m *market) stex.Fees {
+	if f, ok := u.fees[m.pair.Id]; ok {
+		return f
+	}
+	hundred := stex.NewDecimalFromInt(100)
+	return stex.Fees{
+		BuyFee:  m.pair.BuyFeePercent.Div(hundred, 10).Normalize(),
+		SellFee: m.pair.SellFeePercent.Div(hundred, 10).Normalize(),
+	}
+}
+
+// Deposit credits user wallet and records a finished deposit
+func (s *Server) Deposit(userId int64, code string, amount stex.Decimal) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userId]
+	if !ok {
+		return 0, fmt.Errorf("user %d not found", userId)
+	}
+	c, ok := s.currencyByCode(code)
+	if !ok {
+		return 0, fmt.Errorf("currency %s not found", code)
+	}
+
+	w := s.wallet(u, c.Id)
+	w.balance = w.balance.Add(amount)
+
+	now := s.now()
+	d := &deposit{userId: userId}
+	d.DepositAdv = stex.DepositAdv{
+		Id:                     s.nextId(),
+		CurrencyId:             c.Id,
+		CurrencyCode:           c.Code,
+		DepositFeeCurrencyId:   c.Id,
+		DepositFeeCurrencyCode: c.Code,
+		Amount:                 amount,
+		Txid:                   fmt.Sprintf("tx%d", s.seq),
+		DepositStatusId:        2,
+		Status:                 "Finished",
+		StatusColor:            "#00BE6E",
+		CreatedAt:              dateTime(now),
+		Timestamp:              stex.NewTime(now),
+		Confirmations:          "1",
+	}
+	s.deposits = append(s.deposits, d)
+
+	return d.Id, nil
+}
+
+// FinishWithdrawal marks pending withdrawal as sent and removes the frozen funds
+func (s *Server) FinishWithdrawal(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, wd := range s.withdrawals {
+		if wd.Id != id {
+			continue
+		}
+		if wd.WithdrawalStatusId != withdrawalAwaiting {
+			return fmt.Errorf("withdrawal %d is not pending", id)
+		}
+		w := s.wallet(s.users[wd.userId], wd.CurrencyId)
+		w.frozen = w.frozen.Sub(wd.Amount)
+		wd.WithdrawalStatusId = withdrawalFinished
+		wd.Status = withdrawalStatuses[withdrawalFinished].Name
+		txid := fmt.Sprintf("tx%d", s.nextId())
+		wd.Txid = &txid
+		now := s.now()
+		wd.UpdatedAt = dateTime(now)
+		wd.UpdatedTs = stex.NewTime(now)
+		return nil
+	}
+
+	return fmt.Errorf("withdrawal %d not found", id)
+}
+
+// Notify adds notification for the user
+func (s *Server) Notify(userId int64, title, desc string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userId]
+	if !ok {
+		return
+	}
+	u.notifications = append(u.notifications, stex.Notification{
+		Id:    fmt.Sprint(s.nextId()),
+		Title: title,
+		Desc:  desc,
+		Date:  dateTime(s.now()),
+	})
+}
+
+// dateTime returns time encoded the way STEX encodes dates
+func dateTime(t time.Time) stex.Time {
+	return stex.Time{Time: t, Raw: t.Format("2006-01-02 15:04:05")}
+}
+
+// unixMillis returns time encoded as milliseconds the way STEX encodes candle times
+func unixMillis(t time.Time) stex.Time {
+	return stex.Time{Time: t, Raw: fmt.Sprint(t.UnixNano() / int64(time.Millisecond))}
+}
+
+func (s *Server) sortedPairs() []*market {
+	res := make([]*market, 0, len(s.markets))
+	for _, m := range s.markets {
+		res = append(res, m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].pair.Id < res[j].pair.Id })
+	return res
+}
+
+func (s *Server) sortedCurrencies() []stex.CurrencyInfo {
+	res := make([]stex.CurrencyInfo, 0, len(s.currencies))
+	for _, c := range s.currencies {
+		res = append(res, *c)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Id < res[j].Id })
+	return res
+}
@@ -0,0 +1,461 @@
+package stextest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	stex "github.com/vladivolo/stex-api"
+)
+
+// Events pushed by socket.stex.com
+const (
+	EventTicker               = `App\Events\Ticker`
+	EventGlassRowChanged      = `App\Events\GlassRowChanged`
+	EventUserOrderFillCreated = `App\Events\UserOrderFillCreated`
+	EventUserOrderDeleted     = `App\Events\UserOrderDeleted`
+	EventUserOrder            = `App\Events\UserOrder`
+	EventBalanceChanged       = `App\Events\BalanceChanged`
+)
+
+// ScriptedEvent is sent to every connection subscribing to the channel it is scripted for
+type ScriptedEvent struct {
+	// Event name, names without namespace get App\Events\ prefix
+	Event string
+	Data  interface{}
+	// Delay after the subscription or the previous scripted event
+	Delay time.Duration
+}
+
+// Subscription describes channel subscribed by a connection
+type Subscription struct {
+	Conn    int64
+	Channel string
+	Token   string
+}
+
+// SocketServer is a stand-in of socket.stex.com speaking Engine.IO v3 / Socket.IO over websocket
+// the way WssClient dials it:
+//
+//	ss := stextest.NewSocketServer()
+//	defer ss.Close()
+//
+//	ss.AddToken("token", 1)
+//	w, err := ss.WssClient("token").Do(ctx)
+type SocketServer struct {
+	*httptest.Server
+
+	// Authorize checks bearer token of private-* channel subscription.
+	// Default accepts tokens added by AddToken, channels with "_u<id>" must belong to the token user.
+	Authorize func(token, channel string) bool
+
+	// PingInterval and PingTimeout are advertised in the Engine.IO handshake
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+
+	mu sync.Mutex
+
+	tokens  map[string]int64
+	conns   map[int64]*socketConn
+	scripts map[string][]ScriptedEvent
+	seq     int64
+
+	pongDelay time.Duration
+	dropPongs bool
+
+	// changed is closed and replaced on every subscription change
+	changed chan struct{}
+}
+
+type socketConn struct {
+	id int64
+	ws *websocket.Conn
+
+	wmu    sync.Mutex
+	closed chan struct{}
+
+	// channel -> token used to subscribe, guarded by SocketServer.mu
+	channels map[string]string
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+var userChannelRe = regexp.MustCompile(`_u(\d+)`)
+
+// NewSocketServer starts socket.io stand-in without registered tokens
+func NewSocketServer() *SocketServer {
+	s := &SocketServer{
+		PingInterval: 25 * time.Second,
+		PingTimeout:  60 * time.Second,
+		tokens:       map[string]int64{},
+		conns:        map[int64]*socketConn{},
+		scripts:      map[string][]ScriptedEvent{},
+		changed:      make(chan struct{}),
+	}
+	s.Authorize = s.authorize
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveWs))
+	return s
+}
+
+// WsURL returns address to put into WssClient.BaseURL
+func (s *SocketServer) WsURL() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http") + "/socket.io/?EIO=3&transport=websocket"
+}
+
+// WssClient returns websocket client with given token pointed at the server
+func (s *SocketServer) WssClient(token string) *stex.WssClient {
+	w := stex.NewWssClient(token)
+	w.BaseURL = s.WsURL()
+	return w
+}
+
+// Close disconnects all clients and shuts the server down
+func (s *SocketServer) Close() {
+	s.Disconnect()
+	s.Server.Close()
+}
+
+// AddToken registers bearer token of the user for private channels
+func (s *SocketServer) AddToken(token string, userId int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[token] = userId
+}
+
+func (s *SocketServer) authorize(token, channel string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userId, ok := s.tokens[token]
+	if !ok {
+		return false
+	}
+
+	if m := userChannelRe.FindStringSubmatch(channel); m != nil {
+		return m[1] == strconv.FormatInt(userId, 10)
+	}
+	return true
+}
+
+// Script sets events sent to every connection right after it subscribes to the channel
+func (s *SocketServer) Script(channel string, events ...ScriptedEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scripts[channel] = events
+}
+
+// Push sends event to all connections subscribed to the channel and returns the number of them
+func (s *SocketServer) Push(channel, event string, data interface{}) (int, error) {
+	msg, err := encodeEvent(channel, event, data)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	conns := []*socketConn{}
+	for _, c := range s.conns {
+		if _, ok := c.channels[channel]; ok {
+			conns = append(conns, c)
+		}
+	}
+	s.mu.Unlock()
+
+	n := 0
+	for _, c := range conns {
+		if c.write(msg) == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Subscriptions returns channels subscribed by connected clients
+func (s *SocketServer) Subscriptions() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := []Subscription{}
+	for _, c := range s.conns {
+		for ch, token := range c.channels {
+			res = append(res, Subscription{Conn: c.id, Channel: ch, Token: token})
+		}
+	}
+	return res
+}
+
+// subscribers returns number of connections subscribed to the channel and the change notification
+func (s *SocketServer) subscribers(channel string) (int, chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, c := range s.conns {
+		if _, ok := c.channels[channel]; ok {
+			n++
+		}
+	}
+	return n, s.changed
+}
+
+// WaitSubscribed blocks until at least n connections are subscribed to the channel
+func (s *SocketServer) WaitSubscribed(ctx context.Context, channel string, n int) error {
+	for {
+		count, changed := s.subscribers(channel)
+		if count >= n {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Connections returns number of connected clients
+func (s *SocketServer) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.conns)
+}
+
+// Disconnect drops all connections without close handshake and returns the number of them
+func (s *SocketServer) Disconnect() int {
+	s.mu.Lock()
+	conns := []*socketConn{}
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.ws.Close()
+	}
+	return len(conns)
+}
+
+// DelayPongs delays answers to client pings
+func (s *SocketServer) DelayPongs(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pongDelay = d
+}
+
+// DropPongs stops answering client pings, so the client read timeout fires
+func (s *SocketServer) DropPongs(drop bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dropPongs = drop
+}
+
+// notify wakes WaitSubscribed callers, must be called with mu held
+func (s *SocketServer) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *SocketServer) serveWs(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("transport") != "websocket" {
+		http.Error(w, "only websocket transport is supported", http.StatusBadRequest)
+		return
+	}
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.seq++
+	c := &socketConn{
+		id:       s.seq,
+		ws:       ws,
+		closed:   make(chan struct{}),
+		channels: map[string]string{},
+	}
+	s.conns[c.id] = c
+	s.notify()
+	s.mu.Unlock()
+
+	defer func() {
+		ws.Close()
+		close(c.closed)
+
+		s.mu.Lock()
+		delete(s.conns, c.id)
+		s.notify()
+		s.mu.Unlock()
+	}()
+
+	header, _ := json.Marshal(map[string]interface{}{
+		"sid":          fmt.Sprintf("sid%d", c.id),
+		"upgrades":     []string{},
+		"pingInterval": int(s.PingInterval / time.Millisecond),
+		"pingTimeout":  int(s.PingTimeout / time.Millisecond),
+	})
+	if c.write("0"+string(header)) != nil || c.write("40") != nil {
+		return
+	}
+
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		msg := string(data)
+		switch {
+		case msg == "1":
+			return
+		case strings.HasPrefix(msg, "2"):
+			s.pong(c, "3"+msg[1:])
+		case strings.HasPrefix(msg, "42"):
+			s.handleEmit(c, msg[2:])
+		}
+	}
+}
+
+func (s *SocketServer) pong(c *socketConn, msg string) {
+	s.mu.Lock()
+	delay, drop := s.pongDelay, s.dropPongs
+	s.mu.Unlock()
+
+	if drop {
+		return
+	}
+	if delay <= 0 {
+		c.write(msg)
+		return
+	}
+
+	go func() {
+		select {
+		case <-time.After(delay):
+			c.write(msg)
+		case <-c.closed:
+		}
+	}()
+}
+
+type subscribeRequest struct {
+	Channel string `json:"channel"`
+	Auth    struct {
+		Headers struct {
+			Authorization string `json:"Authorization"`
+		} `json:"headers"`
+	} `json:"auth"`
+}
+
+func (s *SocketServer) handleEmit(c *socketConn, payload string) {
+	// ack id may precede the array
+	if idx := strings.IndexByte(payload, '['); idx > 0 {
+		payload = payload[idx:]
+	}
+
+	args := []json.RawMessage{}
+	if err := json.Unmarshal([]byte(payload), &args); err != nil || len(args) < 2 {
+		return
+	}
+
+	var event string
+	if err := json.Unmarshal(args[0], &event); err != nil {
+		return
+	}
+
+	req := subscribeRequest{}
+	if err := json.Unmarshal(args[1], &req); err != nil || req.Channel == "" {
+		return
+	}
+
+	switch event {
+	case "subscribe":
+		token := strings.TrimPrefix(req.Auth.Headers.Authorization, "Bearer ")
+		if strings.HasPrefix(req.Channel, "private-") && !s.Authorize(token, req.Channel) {
+			msg, _ := encodeEvent(req.Channel, "subscription_error", map[string]int{"status": http.StatusForbidden})
+			c.write(msg)
+			return
+		}
+
+		s.mu.Lock()
+		c.channels[req.Channel] = token
+		script := s.scripts[req.Channel]
+		s.notify()
+		s.mu.Unlock()
+
+		if len(script) > 0 {
+			go s.play(c, req.Channel, script)
+		}
+
+	case "unsubscribe":
+		s.mu.Lock()
+		delete(c.channels, req.Channel)
+		s.notify()
+		s.mu.Unlock()
+	}
+}
+
+func (s *SocketServer) play(c *socketConn, channel string, script []ScriptedEvent) {
+	for _, e := range script {
+		if e.Delay > 0 {
+			select {
+			case <-time.After(e.Delay):
+			case <-c.closed:
+				return
+			}
+		}
+
+		msg, err := encodeEvent(channel, e.Event, e.Data)
+		if err != nil {
+			continue
+		}
+		if c.write(msg) != nil {
+			return
+		}
+	}
+}
+
+func (c *socketConn) write(msg string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.ws.WriteMessage(websocket.TextMessage, []byte(msg))
+}
+
+// encodeEvent builds socket.io emit in STEX form: 42["event","channel",data]
+func encodeEvent(channel, event string, data interface{}) (string, error) {
+	if event != "subscription_error" && !strings.Contains(event, `\`) {
+		event = `App\Events\` + event
+	}
+
+	name, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	ch, err := json.Marshal(channel)
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	return "42[" + string(name) + "," + string(ch) + "," + string(body) + "]", nil
+}
@@ -0,0 +1,215 @@
+package stextest
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// socketClient reads messages of a raw connection in background, a timed out read breaks gorilla connections
+type socketClient struct {
+	ws   *websocket.Conn
+	msgs chan string
+	err  chan error
+}
+
+// dialSocket connects to s like socket.io client does and reads the handshake
+func dialSocket(t *testing.T, s *SocketServer) *socketClient {
+	ws, _, err := websocket.DefaultDialer.Dial(s.WsURL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &socketClient{ws: ws, msgs: make(chan string, 16), err: make(chan error, 1)}
+	go func() {
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				c.err <- err
+				return
+			}
+			c.msgs <- string(data)
+		}
+	}()
+
+	open := c.read(t, time.Second)
+	if !strings.HasPrefix(open, "0") {
+		t.Fatalf("open packet = %q", open)
+	}
+	header := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(open[1:]), &header); err != nil || header["pingInterval"] != float64(25000) {
+		t.Fatalf("handshake = %q, %v", open, err)
+	}
+	if connect := c.read(t, time.Second); connect != "40" {
+		t.Fatalf("connect packet = %q", connect)
+	}
+	return c
+}
+
+// read returns the next message or "" when none arrives within timeout
+func (c *socketClient) read(t *testing.T, timeout time.Duration) string {
+	select {
+	case msg := <-c.msgs:
+		return msg
+	case err := <-c.err:
+		t.Fatal(err)
+	case <-time.After(timeout):
+	}
+	return ""
+}
+
+func (c *socketClient) write(t *testing.T, msg string) {
+	if err := c.ws.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *socketClient) emit(t *testing.T, event, channel, token string) {
+	req := subscribeRequest{Channel: channel}
+	req.Auth.Headers.Authorization = "Bearer " + token
+	args, _ := json.Marshal([]interface{}{event, req})
+	c.write(t, "42"+string(args))
+}
+
+func TestSocketServerSubscriptions(t *testing.T) {
+	s := NewSocketServer()
+	defer s.Close()
+	s.AddToken("token", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn := dialSocket(t, s)
+	defer conn.ws.Close()
+
+	// Other users' private channels and unknown tokens are rejected
+	for _, sub := range []struct{ channel, token string }{
+		{"private-trade_u2c1", "token"},
+		{"private-trade_u1c1", "unknown"},
+	} {
+		conn.emit(t, "subscribe", sub.channel, sub.token)
+		want := `42["subscription_error","` + sub.channel + `",{"status":403}]`
+		if msg := conn.read(t, time.Second); msg != want {
+			t.Errorf("subscribe %s with %s = %q, want %q", sub.channel, sub.token, msg, want)
+		}
+	}
+
+	conn.emit(t, "subscribe", "private-trade_u1c1", "token")
+	conn.emit(t, "subscribe", "rate", "")
+	if err := s.WaitSubscribed(ctx, "rate", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WaitSubscribed(ctx, "private-trade_u1c1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if subs := s.Subscriptions(); len(subs) != 2 {
+		t.Errorf("subscriptions = %+v", subs)
+	}
+
+	n, err := s.Push("rate", "Ticker", map[string]int{"id": 1})
+	if err != nil || n != 1 {
+		t.Fatalf("Push() = %d, %v", n, err)
+	}
+	if msg := conn.read(t, time.Second); msg != `42["App\\Events\\Ticker","rate",{"id":1}]` {
+		t.Errorf("pushed event = %q", msg)
+	}
+
+	conn.emit(t, "unsubscribe", "rate", "")
+	waitSocket(t, "unsubscribe", func() bool { return len(s.Subscriptions()) == 1 })
+	if n, _ = s.Push("rate", EventTicker, nil); n != 0 {
+		t.Errorf("Push() after unsubscribe reached %d connections", n)
+	}
+}
+
+func TestSocketServerScript(t *testing.T) {
+	s := NewSocketServer()
+	defer s.Close()
+
+	s.Script("buy_data1",
+		ScriptedEvent{Event: "GlassRowChanged", Data: map[string]string{"price": "1"}},
+		ScriptedEvent{Event: EventGlassRowChanged, Data: map[string]string{"price": "2"}, Delay: 100 * time.Millisecond},
+	)
+
+	conn := dialSocket(t, s)
+	defer conn.ws.Close()
+
+	start := time.Now()
+	conn.emit(t, "subscribe", "buy_data1", "")
+	for _, price := range []string{"1", "2"} {
+		want := `42["App\\Events\\GlassRowChanged","buy_data1",{"price":"` + price + `"}]`
+		if msg := conn.read(t, time.Second); msg != want {
+			t.Errorf("scripted event = %q, want %q", msg, want)
+		}
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("delayed event came after %s", d)
+	}
+}
+
+func TestSocketServerPongs(t *testing.T) {
+	s := NewSocketServer()
+	defer s.Close()
+
+	conn := dialSocket(t, s)
+	defer conn.ws.Close()
+
+	ping := func() {
+		conn.write(t, "2")
+	}
+
+	ping()
+	if msg := conn.read(t, time.Second); msg != "3" {
+		t.Errorf("pong = %q", msg)
+	}
+
+	s.DelayPongs(150 * time.Millisecond)
+	ping()
+	if msg := conn.read(t, 50*time.Millisecond); msg != "" {
+		t.Errorf("delayed pong came early: %q", msg)
+	}
+	if msg := conn.read(t, time.Second); msg != "3" {
+		t.Errorf("delayed pong = %q", msg)
+	}
+
+	s.DelayPongs(0)
+	s.DropPongs(true)
+	ping()
+	if msg := conn.read(t, 200*time.Millisecond); msg != "" {
+		t.Errorf("dropped pong = %q", msg)
+	}
+}
+
+func TestSocketServerDisconnect(t *testing.T) {
+	s := NewSocketServer()
+	defer s.Close()
+
+	conn := dialSocket(t, s)
+	defer conn.ws.Close()
+	conn.emit(t, "subscribe", "rate", "")
+	waitSocket(t, "subscribe", func() bool { return len(s.Subscriptions()) == 1 })
+
+	if n := s.Disconnect(); n != 1 {
+		t.Errorf("Disconnect() = %d", n)
+	}
+	select {
+	case <-conn.err:
+	case msg := <-conn.msgs:
+		t.Errorf("message %q after Disconnect", msg)
+	case <-time.After(time.Second):
+		t.Error("connection is open after Disconnect")
+	}
+	waitSocket(t, "connection removed", func() bool { return s.Connections() == 0 && len(s.Subscriptions()) == 0 })
+}
+
+func waitSocket(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,379 @@
+package stex
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy define what a stream does with a message when its buffer is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for the consumer, stalling the websocket connection and every other channel of it
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest buffered message, it is the default policy
+	OverflowDropOldest
+	// OverflowDropNewest discards the message that does not fit
+	OverflowDropNewest
+	// OverflowDisconnect closes the stream and releases its subscription
+	OverflowDisconnect
+)
+
+const defaultStreamBufferSize = 100
+
+// eventStream delivers messages of a channel service to a typed Go channel
+type eventStream struct {
+	// out is chan T of the service message type
+	out     reflect.Value
+	policy  OverflowPolicy
+	dropped uint64
+
+	done chan struct{}
+	once sync.Once
+
+	// mu guards out against sends after it is closed
+	mu     sync.Mutex
+	closed bool
+
+	// rmu serialises release of the subscription between start, close and Unsubscribe of the service.
+	// The subscription is released once, after the service subscribed and the stream is closed.
+	rmu      sync.Mutex
+	release  func() error
+	started  bool
+	released bool
+	err      error
+}
+
+// newEventStream makes chan T of msgType with given buffer size, release unsubscribes the service
+func newEventStream(msgType reflect.Type, size *int, policy *OverflowPolicy, release func() error) *eventStream {
+	n := defaultStreamBufferSize
+	if size != nil && *size > 0 {
+		n = *size
+	}
+
+	st := &eventStream{
+		out:     reflect.MakeChan(reflect.ChanOf(reflect.BothDir, msgType), n),
+		policy:  OverflowDropOldest,
+		done:    make(chan struct{}),
+		release: release,
+	}
+	if policy != nil {
+		st.policy = *policy
+	}
+	return st
+}
+
+// push is called on the socket goroutine
+func (st *eventStream) push(msg interface{}) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.closed {
+		return
+	}
+
+	v := reflect.ValueOf(msg)
+	if st.out.TrySend(v) {
+		return
+	}
+
+	switch st.policy {
+	case OverflowDropNewest:
+		atomic.AddUint64(&st.dropped, 1)
+
+	case OverflowDropOldest:
+		for !st.out.TrySend(v) {
+			if _, ok := st.out.TryRecv(); ok {
+				atomic.AddUint64(&st.dropped, 1)
+			}
+		}
+
+	case OverflowDisconnect:
+		atomic.AddUint64(&st.dropped, 1)
+		go st.close()
+
+	default:
+		reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectSend, Chan: st.out, Send: v},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(st.done)},
+		})
+	}
+}
+
+// start is called after the service subscribed. It closes the stream when ctx is done
+// or the connection of w is lost for good. A stream closed while subscribing is released here.
+func (st *eventStream) start(ctx context.Context, w *WssClient) {
+	st.rmu.Lock()
+	st.started = true
+	st.rmu.Unlock()
+
+	select {
+	case <-st.done:
+		st.finish()
+		return
+	default:
+	}
+
+	closed := w.closed()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-closed:
+		case <-st.done:
+		}
+		st.close()
+	}()
+}
+
+// close closes the channel and releases the subscription, it returns the error of the release
+func (st *eventStream) close() error {
+	st.once.Do(func() {
+		close(st.done)
+
+		st.mu.Lock()
+		st.closed = true
+		st.out.Close()
+		st.mu.Unlock()
+	})
+
+	return st.finish()
+}
+
+// finish releases the subscription if the service subscribed and it was not released yet
+func (st *eventStream) finish() error {
+	st.rmu.Lock()
+	defer st.rmu.Unlock()
+
+	if !st.started || st.released {
+		return st.err
+	}
+	st.released = true
+	st.err = st.release()
+	return st.err
+}
+
+// droppedCount returns number of messages discarded by the overflow policy
+func (st *eventStream) droppedCount() uint64 {
+	if st == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&st.dropped)
+}
+
+// streamConfig keeps Stream settings of a channel service, the services embed it
+type streamConfig struct {
+	buffer_size *int
+	overflow    *OverflowPolicy
+	stream      *eventStream
+}
+
+// Dropped returns number of messages discarded by Stream overflow policy
+func (c *streamConfig) Dropped() uint64 {
+	return c.stream.droppedCount()
+}
+
+// open makes the stream of msg type, handle installs the service callback pushing to it, do subscribes
+// and release unsubscribes the service. It returns chan of msg type.
+// A service with OnMessage callback can not stream, the callback would be replaced.
+func (c *streamConfig) open(ctx context.Context, w *WssClient, msg interface{}, callback bool, handle func(push func(interface{})), do func() error, release func() error) (interface{}, error) {
+	if callback && c.stream == nil {
+		return nil, fmt.Errorf("stream can not be combined with OnMessage")
+	}
+
+	st := newEventStream(reflect.TypeOf(msg), c.buffer_size, c.overflow, release)
+	handle(st.push)
+	c.stream = st
+
+	err := do()
+	if err != nil {
+		c.stream = nil
+		return nil, err
+	}
+
+	st.start(ctx, w)
+
+	return st.out.Interface(), nil
+}
+
+/****************************************************************************************************************************************************/
+
+// Stream subscribes like Do and delivers messages to the returned channel instead of OnMessage callback,
+// it fails if OnMessage was set. The channel is closed when ctx is done, the connection is lost for good,
+// the overflow policy disconnects it or Unsubscribe is called.
+func (s *WebsocketRateChannelService) Stream(ctx context.Context) (<-chan RateMessage, error) {
+	out, err := s.open(ctx, s.c, RateMessage{}, s.f != nil, func(push func(interface{})) {
+		s.f = func(_ string, msg RateMessage) {
+			push(msg)
+		}
+	}, s.Do, s.unsubscribe)
+	if err != nil {
+		return nil, err
+	}
+
+	return out.(chan RateMessage), nil
+}
+
+// BufferSize sets Stream channel capacity, default is 100
+func (s *WebsocketRateChannelService) BufferSize(size int) *WebsocketRateChannelService {
+	s.buffer_size = &size
+	return s
+}
+
+// Overflow sets what Stream does when the consumer falls behind, default is OverflowDropOldest
+func (s *WebsocketRateChannelService) Overflow(policy OverflowPolicy) *WebsocketRateChannelService {
+	s.overflow = &policy
+	return s
+}
+
+/****************************************************************************************************************************************************/
+
+// Stream subscribes like Do and delivers messages to the returned channel instead of OnMessage callback,
+// it fails if OnMessage was set. The channel is closed when ctx is done, the connection is lost for good,
+// the overflow policy disconnects it or Unsubscribe is called.
+func (s *WebsocketGlassRowChangedService) Stream(ctx context.Context) (<-chan Order, error) {
+	out, err := s.open(ctx, s.c, Order{}, s.f != nil, func(push func(interface{})) {
+		s.f = func(_ TradeType, msg Order) {
+			push(msg)
+		}
+	}, s.Do, s.unsubscribe)
+	if err != nil {
+		return nil, err
+	}
+
+	return out.(chan Order), nil
+}
+
+// BufferSize sets Stream channel capacity, default is 100
+func (s *WebsocketGlassRowChangedService) BufferSize(size int) *WebsocketGlassRowChangedService {
+	s.buffer_size = &size
+	return s
+}
+
+// Overflow sets what Stream does when the consumer falls behind, default is OverflowDropOldest
+func (s *WebsocketGlassRowChangedService) Overflow(policy OverflowPolicy) *WebsocketGlassRowChangedService {
+	s.overflow = &policy
+	return s
+}
+
+/****************************************************************************************************************************************************/
+
+// Stream subscribes like Do and delivers messages to the returned channel instead of OnMessage callback,
+// it fails if OnMessage was set. The channel is closed when ctx is done, the connection is lost for good,
+// the overflow policy disconnects it or Unsubscribe is called.
+func (s *WebsocketUserOrderFillChannelService) Stream(ctx context.Context) (<-chan TradeOrder, error) {
+	out, err := s.open(ctx, s.c, TradeOrder{}, s.f != nil, func(push func(interface{})) {
+		s.f = func(_ string, msg TradeOrder) {
+			push(msg)
+		}
+	}, s.Do, s.unsubscribe)
+	if err != nil {
+		return nil, err
+	}
+
+	return out.(chan TradeOrder), nil
+}
+
+// BufferSize sets Stream channel capacity, default is 100
+func (s *WebsocketUserOrderFillChannelService) BufferSize(size int) *WebsocketUserOrderFillChannelService {
+	s.buffer_size = &size
+	return s
+}
+
+// Overflow sets what Stream does when the consumer falls behind, default is OverflowDropOldest
+func (s *WebsocketUserOrderFillChannelService) Overflow(policy OverflowPolicy) *WebsocketUserOrderFillChannelService {
+	s.overflow = &policy
+	return s
+}
+
+/****************************************************************************************************************************************************/
+
+// Stream subscribes like Do and delivers messages to the returned channel instead of OnMessage callback,
+// it fails if OnMessage was set. The channel is closed when ctx is done, the connection is lost for good,
+// the overflow policy disconnects it or Unsubscribe is called.
+func (s *WebsocketUserOrderDeletedChannelService) Stream(ctx context.Context) (<-chan DeleteOrder, error) {
+	out, err := s.open(ctx, s.c, DeleteOrder{}, s.f != nil, func(push func(interface{})) {
+		s.f = func(_ string, msg DeleteOrder) {
+			push(msg)
+		}
+	}, s.Do, s.unsubscribe)
+	if err != nil {
+		return nil, err
+	}
+
+	return out.(chan DeleteOrder), nil
+}
+
+// BufferSize sets Stream channel capacity, default is 100
+func (s *WebsocketUserOrderDeletedChannelService) BufferSize(size int) *WebsocketUserOrderDeletedChannelService {
+	s.buffer_size = &size
+	return s
+}
+
+// Overflow sets what Stream does when the consumer falls behind, default is OverflowDropOldest
+func (s *WebsocketUserOrderDeletedChannelService) Overflow(policy OverflowPolicy) *WebsocketUserOrderDeletedChannelService {
+	s.overflow = &policy
+	return s
+}
+
+/****************************************************************************************************************************************************/
+
+// Stream subscribes like Do and delivers messages to the returned channel instead of OnMessage callback,
+// it fails if OnMessage was set. The channel is closed when ctx is done, the connection is lost for good,
+// the overflow policy disconnects it or Unsubscribe is called.
+func (s *WebsocketUserOrderUpdateChannelService) Stream(ctx context.Context) (<-chan UpdateOrder, error) {
+	out, err := s.open(ctx, s.c, UpdateOrder{}, s.f != nil, func(push func(interface{})) {
+		s.f = func(_ OrderType, msg UpdateOrder) {
+			push(msg)
+		}
+	}, s.Do, s.unsubscribe)
+	if err != nil {
+		return nil, err
+	}
+
+	return out.(chan UpdateOrder), nil
+}
+
+// BufferSize sets Stream channel capacity, default is 100
+func (s *WebsocketUserOrderUpdateChannelService) BufferSize(size int) *WebsocketUserOrderUpdateChannelService {
+	s.buffer_size = &size
+	return s
+}
+
+// Overflow sets what Stream does when the consumer falls behind, default is OverflowDropOldest
+func (s *WebsocketUserOrderUpdateChannelService) Overflow(policy OverflowPolicy) *WebsocketUserOrderUpdateChannelService {
+	s.overflow = &policy
+	return s
+}
+
+/****************************************************************************************************************************************************/
+
+// Stream subscribes like Do and delivers messages to the returned channel instead of OnMessage callback,
+// it fails if OnMessage was set. The channel is closed when ctx is done, the connection is lost for good,
+// the overflow policy disconnects it or Unsubscribe is called.
+func (s *WebsocketUserBalanceUpdateChannelService) Stream(ctx context.Context) (<-chan UpdateBalance, error) {
+	out, err := s.open(ctx, s.c, UpdateBalance{}, s.f != nil, func(push func(interface{})) {
+		s.f = func(_ string, msg UpdateBalance) {
+			push(msg)
+		}
+	}, s.Do, s.unsubscribe)
+	if err != nil {
+		return nil, err
+	}
+
+	return out.(chan UpdateBalance), nil
+}
+
+// BufferSize sets Stream channel capacity, default is 100
+func (s *WebsocketUserBalanceUpdateChannelService) BufferSize(size int) *WebsocketUserBalanceUpdateChannelService {
+	s.buffer_size = &size
+	return s
+}
+
+// Overflow sets what Stream does when the consumer falls behind, default is OverflowDropOldest
+func (s *WebsocketUserBalanceUpdateChannelService) Overflow(policy OverflowPolicy) *WebsocketUserBalanceUpdateChannelService {
+	s.overflow = &policy
+	return s
+}
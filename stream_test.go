@@ -0,0 +1,168 @@
+package stex_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+	"github.com/vladivolo/stex-api/stextest"
+)
+
+func rateEvents(n int) []stextest.ScriptedEvent {
+	res := []stextest.ScriptedEvent{}
+	for i := 1; i <= n; i++ {
+		res = append(res, stextest.ScriptedEvent{Event: stextest.EventTicker, Data: map[string]interface{}{"id": i}})
+	}
+	return res
+}
+
+// waitUnsubscribed waits until the client has no subscriptions left
+func waitUnsubscribed(t *testing.T, w *stex.WssClient) {
+	deadline := time.Now().Add(5 * time.Second)
+	for len(w.Subscriptions()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("subscriptions are not released: %+v", w.Subscriptions())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStreamOverflow(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *stex.OverflowPolicy
+		want    []int
+		closed  bool
+		dropped uint64
+	}{
+		{name: "default drops oldest", want: []int{4, 5}, dropped: 3},
+		{name: "drop newest", policy: policy(stex.OverflowDropNewest), want: []int{1, 2}, dropped: 3},
+		{name: "disconnect", policy: policy(stex.OverflowDisconnect), want: []int{1, 2}, closed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sock := stextest.NewSocketServer()
+			defer sock.Close()
+			// Events arrive right after the subscription, before Stream returns
+			sock.Script("rate", rateEvents(5)...)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			w, err := sock.WssClient("").Do(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := stex.NewWebsocketRateChannelService(w).BufferSize(2)
+			if tt.policy != nil {
+				s.Overflow(*tt.policy)
+			}
+			ch, err := s.Stream(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.closed {
+				// The stream closed while subscribing still releases its subscription
+				waitUnsubscribed(t, w)
+			} else {
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			got := []int{}
+			for len(got) < len(tt.want) {
+				select {
+				case msg, ok := <-ch:
+					if !ok {
+						t.Fatalf("stream closed after %v", got)
+					}
+					got = append(got, msg.Id)
+				case <-ctx.Done():
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+
+			if tt.closed {
+				if _, ok := <-ch; ok {
+					t.Error("stream is not closed")
+				}
+				return
+			}
+			if d := s.Dropped(); d != tt.dropped {
+				t.Errorf("dropped = %d, want %d", d, tt.dropped)
+			}
+		})
+	}
+}
+
+func policy(p stex.OverflowPolicy) *stex.OverflowPolicy {
+	return &p
+}
+
+func TestStreamUnsubscribe(t *testing.T) {
+	sock := stextest.NewSocketServer()
+	defer sock.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	w, err := sock.WssClient("").Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := stex.NewWebsocketRateChannelService(w)
+	ch, err := s.Stream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sock.WaitSubscribed(ctx, "rate", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("unexpected message")
+		}
+	case <-ctx.Done():
+		t.Fatal("Unsubscribe does not close the stream")
+	}
+	if subs := w.Subscriptions(); len(subs) != 0 {
+		t.Errorf("subscriptions = %+v", subs)
+	}
+
+	// Repeated Unsubscribe and the context end do not release twice
+	s.Unsubscribe()
+	cancel()
+}
+
+func TestStreamWithOnMessage(t *testing.T) {
+	sock := stextest.NewSocketServer()
+	defer sock.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	w, err := sock.WssClient("").Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The callback is not replaced silently
+	s := stex.NewWebsocketRateChannelService(w).OnMessage(func(string, stex.RateMessage) {})
+	if _, err = s.Stream(ctx); err == nil {
+		t.Error("Stream of a service with OnMessage succeeded")
+	}
+	if subs := w.Subscriptions(); len(subs) != 0 {
+		t.Errorf("subscriptions = %+v", subs)
+	}
+}
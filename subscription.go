@@ -0,0 +1,290 @@
+package stex
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	ws "github.com/vladivolo/golang-socketio"
+)
+
+// WssSubscription define active channel subscription of WssClient
+type WssSubscription struct {
+	Channel string
+	// Private subscriptions are sent with bearer token
+	Private bool
+	// Refs is the number of Subscribe calls not yet matched by Unsubscribe
+	Refs int
+}
+
+type wsSubscription struct {
+	channel string
+	auth    bool
+	refs    int
+}
+
+// wsHandler is a handler of event method from one channel, empty channel receives events
+// of channels without own handlers of the method
+type wsHandler struct {
+	id      int64
+	method  string
+	channel string
+	f       reflect.Value
+	arg     reflect.Type
+}
+
+// Subscribe joins channel, auth adds bearer token for private channels.
+// Register handlers of the channel with On before, events sent right after the subscription are lost otherwise.
+// Repeated subscriptions of a channel are reference counted, only the first one is sent.
+// In supervised mode the subscription is repeated after every reconnect.
+func (w *WssClient) Subscribe(channel string, auth bool) error {
+	token := ""
+	if auth {
+		var err error
+		token, err = w.accessToken(w.context())
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	if w.c == nil {
+		return fmt.Errorf("ws connection closed")
+	}
+
+	if s, ok := w.subs[channel]; ok {
+		s.refs++
+		return nil
+	}
+
+	err := w.emitSubscribe(w.c, channel, auth, token)
+	if err != nil {
+		return err
+	}
+
+	w.subs[channel] = &wsSubscription{channel: channel, auth: auth, refs: 1}
+	return nil
+}
+
+// Unsubscribe releases one subscription of channel. The last one leaves the channel
+// and removes its handlers.
+func (w *WssClient) Unsubscribe(channel string) error {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.unsubscribe(channel)
+}
+
+func (w *WssClient) unsubscribe(channel string) error {
+	s, ok := w.subs[channel]
+	if !ok {
+		return fmt.Errorf("channel %s not subscribed", channel)
+	}
+
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
+
+	delete(w.subs, channel)
+	for id, h := range w.handlers {
+		if h.channel == channel {
+			delete(w.handlers, id)
+		}
+	}
+
+	if w.c == nil {
+		return nil
+	}
+	return w.c.Emit("unsubscribe", map[string]interface{}{
+		"channel": channel,
+	})
+}
+
+// Subscriptions returns active subscriptions sorted by channel
+func (w *WssClient) Subscriptions() []WssSubscription {
+	w.Lock()
+	defer w.Unlock()
+
+	res := make([]WssSubscription, 0, len(w.subs))
+	for _, s := range w.subs {
+		res = append(res, WssSubscription{Channel: s.channel, Private: s.auth, Refs: s.refs})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Channel < res[j].Channel })
+	return res
+}
+
+// hasPrivateSubscriptions check if resubscription needs a token
+func (w *WssClient) hasPrivateSubscriptions() bool {
+	w.Lock()
+	defer w.Unlock()
+
+	for _, s := range w.subs {
+		if s.auth {
+			return true
+		}
+	}
+	return false
+}
+
+// emitSubscribe sends subscription, token is the bearer token of private channels
+func (w *WssClient) emitSubscribe(c *ws.Client, channel string, auth bool, token string) error {
+	auth_token := map[string]interface{}{}
+	if auth == true {
+		if token == "" {
+			return fmt.Errorf("token of private channel %s not init", channel)
+		}
+
+		auth_token = map[string]interface{}{
+			"headers": map[string]interface{}{
+				"Authorization": "Bearer " + token,
+			},
+		}
+	}
+
+	return c.Emit("subscribe", map[string]interface{}{
+		"channel": channel,
+		"auth":    auth_token,
+	})
+}
+
+// On registers handler of event method, f is func(*ws.Channel, T) like for socket.io client On.
+// With a channel the handler receives only events of that channel and is removed when the channel is unsubscribed.
+// Unlike C().On the handler survives reconnects in supervised mode.
+func (w *WssClient) On(method string, f interface{}, channels ...string) error {
+	channel := ""
+	if len(channels) > 0 {
+		channel = channels[0]
+	}
+
+	_, err := w.handle(method, channel, f)
+	return err
+}
+
+// handle registers handler and returns its id for removeHandler
+func (w *WssClient) handle(method, channel string, f interface{}) (int64, error) {
+	fv := reflect.ValueOf(f)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func || ft.NumIn() != 2 || ft.In(0) != reflect.TypeOf(&ws.Channel{}) {
+		return 0, fmt.Errorf("handler of %s must be func(*ws.Channel, T)", method)
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	if w.c == nil {
+		return 0, fmt.Errorf("ws connection closed")
+	}
+
+	w.handlerSeq++
+	h := &wsHandler{
+		id:      w.handlerSeq,
+		method:  method,
+		channel: channel,
+		f:       fv,
+		arg:     ft.In(1),
+	}
+
+	err := w.route(w.c, method, channel)
+	if err != nil {
+		return 0, err
+	}
+
+	w.handlers[h.id] = h
+	return h.id, nil
+}
+
+// removeHandler unregisters handler, unknown ids are ignored
+func (w *WssClient) removeHandler(id int64) {
+	w.Lock()
+	defer w.Unlock()
+
+	delete(w.handlers, id)
+}
+
+// route makes socket.io client c pass events of method from channel to dispatch.
+// The socket.io client only selects its handler by method and channel, w.handlers stays the single dispatch table.
+// Client On with a channel would also replace the catch-all handler of the method, so the channel route is
+// registered under the key the client looks channel handlers up with: method followed by lower case channel.
+func (w *WssClient) route(c *ws.Client, method, channel string) error {
+	key := method + "\x00" + channel
+	if w.routes[key] {
+		return nil
+	}
+
+	if channel != "" {
+		err := c.On(method+strings.ToLower(channel), func(h *ws.Channel, msg json.RawMessage) {
+			w.dispatch(h, method, channel, msg)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !w.routes[method+"\x00"] {
+		err := c.On(method, func(h *ws.Channel, msg json.RawMessage) {
+			w.dispatch(h, method, "", msg)
+		})
+		if err != nil {
+			return err
+		}
+		w.routes[method+"\x00"] = true
+	}
+
+	w.routes[key] = true
+	return nil
+}
+
+// dispatch decodes msg for every handler of method and channel and calls them in registration order.
+// Events of a channel without own handlers go to the handlers without channel.
+func (w *WssClient) dispatch(c *ws.Channel, method, channel string, msg json.RawMessage) {
+	w.Lock()
+	handlers := w.handlersOf(method, channel)
+	if len(handlers) == 0 && channel != "" {
+		handlers = w.handlersOf(method, "")
+	}
+	w.Unlock()
+
+	sort.Slice(handlers, func(i, j int) bool { return handlers[i].id < handlers[j].id })
+
+	for _, h := range handlers {
+		v := reflect.New(h.arg)
+		if err := json.Unmarshal(msg, v.Interface()); err != nil {
+			w.debug("%s %s: %s", method, channel, err)
+			continue
+		}
+		h.f.Call([]reflect.Value{reflect.ValueOf(c), v.Elem()})
+	}
+}
+
+// handlersOf returns handlers of method and channel, must be called with the lock held
+func (w *WssClient) handlersOf(method, channel string) []*wsHandler {
+	handlers := []*wsHandler{}
+	for _, h := range w.handlers {
+		if h.method == method && h.channel == channel {
+			handlers = append(handlers, h)
+		}
+	}
+	return handlers
+}
+
+// restore registers routes of stored handlers and repeats subscriptions with fresh token on client c
+func (w *WssClient) restore(c *ws.Client, token string) error {
+	w.routes = map[string]bool{}
+	for _, h := range w.handlers {
+		if err := w.route(c, h.method, h.channel); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range w.subs {
+		if err := w.emitSubscribe(c, s.channel, s.auth, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package stex_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ws "github.com/vladivolo/golang-socketio"
+	stex "github.com/vladivolo/stex-api"
+	"github.com/vladivolo/stex-api/stextest"
+)
+
+func TestWssClientRouting(t *testing.T) {
+	sock := stextest.NewSocketServer()
+	defer sock.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	w, err := sock.WssClient("").Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The scripted event is sent right after the subscription, the handler must already be there
+	sock.Script("buy_data1", stextest.ScriptedEvent{
+		Event: stextest.EventGlassRowChanged,
+		Data:  map[string]interface{}{"price": "0.02", "amount": "1", "amount2": "0.02", "count": 1},
+	})
+
+	rows := make(chan stex.Order, 4)
+	err = stex.NewWebsocketGlassRowChangedService(w).CurrencyPairId(1).TradeType(stex.TradeType_BUY).OnMessage(func(_ stex.TradeType, msg stex.Order) {
+		rows <- msg
+	}).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-rows:
+		if !msg.Price.Equal(stex.MustParseDecimal("0.02")) {
+			t.Errorf("row = %+v", msg)
+		}
+	case <-ctx.Done():
+		t.Fatal("event sent right after subscription is lost")
+	}
+
+	// A catch-all handler gets events of channels without own handlers only
+	other := make(chan stex.Order, 4)
+	err = w.On("App\\\\Events\\\\GlassRowChanged", func(_ *ws.Channel, msg stex.Order) {
+		other <- msg
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Subscribe("other_data2", false); err != nil {
+		t.Fatal(err)
+	}
+	// A second channel route must not replace the catch-all one
+	sell := stex.NewWebsocketGlassRowChangedService(w).CurrencyPairId(3).TradeType(stex.TradeType_SELL).OnMessage(func(_ stex.TradeType, msg stex.Order) {
+		rows <- msg
+	})
+	if err = sell.Do(); err != nil {
+		t.Fatal(err)
+	}
+	if err = sock.WaitSubscribed(ctx, "sell_data3", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	sock.Push("other_data2", stextest.EventGlassRowChanged, map[string]interface{}{"price": "0.03"})
+	sock.Push("buy_data1", stextest.EventGlassRowChanged, map[string]interface{}{"price": "0.01"})
+
+	select {
+	case msg := <-other:
+		if !msg.Price.Equal(stex.MustParseDecimal("0.03")) {
+			t.Errorf("catch-all got %+v", msg)
+		}
+	case <-ctx.Done():
+		t.Fatal("catch-all handler got nothing")
+	}
+	select {
+	case msg := <-rows:
+		if !msg.Price.Equal(stex.MustParseDecimal("0.01")) {
+			t.Errorf("channel handler got %+v", msg)
+		}
+	case <-ctx.Done():
+		t.Fatal("channel handler got nothing")
+	}
+
+	select {
+	case msg := <-other:
+		t.Errorf("catch-all got event of a channel with own handler: %+v", msg)
+	case msg := <-rows:
+		t.Errorf("unexpected event %+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err = sell.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	subs := w.Subscriptions()
+	if len(subs) != 2 {
+		t.Errorf("subscriptions after unsubscribe = %+v", subs)
+	}
+}
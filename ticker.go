@@ -16,16 +16,16 @@ type CurrencyPairTicker struct {
 	Symbol           string             `json:"symbol"`
 	GroupName        string             `json:"group_name"`
 	GroupId          int                `json:"group_id"`
-	Ask              string             `json:"ask"`
-	Bid              string             `json:"bid"`
-	Last             string             `json:"last"`
-	Low              string             `json:"low"`
-	High             string             `json:"high"`
-	Open             string             `json:"open"`
-	Volume           string             `json:"volume"`
-	VolumeQuote      string             `json:"volumeQuote"`
-	FiatsRate        map[string]float64 `json:"fiatsRate"`
-	Timestamp        int64              `json:"timestamp"`
+	Ask              Decimal            `json:"ask"`
+	Bid              Decimal            `json:"bid"`
+	Last             Decimal            `json:"last"`
+	Low              Decimal            `json:"low"`
+	High             Decimal            `json:"high"`
+	Open             Decimal            `json:"open"`
+	Volume           Decimal            `json:"volume"`
+	VolumeQuote      Decimal            `json:"volumeQuote"`
+	FiatsRate        map[string]Decimal `json:"fiatsRate"`
+	Timestamp        Time               `json:"timestamp"`
 }
 
 type CurrencyPairsTickerService struct {
@@ -0,0 +1,112 @@
+package stex
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeLocation is the time zone of STEX date strings without explicit zone like "2006-01-02 15:04:05"
+var TimeLocation = time.UTC
+
+// Numbers not less than this are milliseconds, smaller ones are seconds
+const unixMillisThreshold = 1e11
+
+var timeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999999",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"02.01.2006",
+	time.RFC1123Z,
+	time.RFC1123,
+	"Jan 2, 2006 15:04",
+	"Jan 2, 2006",
+	"2 January 2006 15:04",
+	"2 January 2006",
+}
+
+// Time define timestamp decoded from any form STEX uses: unix seconds or milliseconds,
+// quoted numbers and date strings. Raw keeps the value as it came, without quotes.
+// Strings that are not recognised as a date leave the time zero, are kept in Raw and set Invalid,
+// so one odd field does not fail decoding of the whole response.
+type Time struct {
+	time.Time
+	Raw string
+	// Invalid is set when Raw is not empty but can't be parsed as a time
+	Invalid bool
+}
+
+// NewTime wraps t
+func NewTime(t time.Time) Time {
+	return Time{Time: t}
+}
+
+// parseTime decodes unquoted value s
+func parseTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		if math.Abs(v) >= unixMillisThreshold {
+			ms := int64(v)
+			return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)).In(TimeLocation), true
+		}
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)).In(TimeLocation), true
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, TimeLocation); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// UnmarshalJSON accepts numbers, quoted numbers, date strings and null
+func (t *Time) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*t = Time{}
+		return nil
+	}
+
+	raw := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		s, err := strconv.Unquote(raw)
+		if err != nil {
+			return err
+		}
+		raw = s
+	}
+
+	tm, ok := parseTime(raw)
+	*t = Time{Time: tm, Raw: raw, Invalid: !ok && strings.TrimSpace(raw) != ""}
+	return nil
+}
+
+// MarshalJSON writes Raw as it came, otherwise unix seconds or null for zero time
+func (t Time) MarshalJSON() ([]byte, error) {
+	if t.Raw != "" {
+		if _, err := strconv.ParseFloat(t.Raw, 64); err == nil {
+			return []byte(t.Raw), nil
+		}
+		return []byte(strconv.Quote(t.Raw)), nil
+	}
+
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+
+	return []byte(strconv.FormatInt(t.Unix(), 10)), nil
+}
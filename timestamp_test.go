@@ -0,0 +1,76 @@
+package stex
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTimeUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		raw     string
+		invalid bool
+	}{
+		{in: `1577836800`, want: time.Unix(1577836800, 0), raw: "1577836800"},
+		{in: `"1577836800"`, want: time.Unix(1577836800, 0), raw: "1577836800"},
+		{in: `1577836800123`, want: time.Unix(1577836800, 123e6), raw: "1577836800123"},
+		{in: `1577836800.5`, want: time.Unix(1577836800, 5e8), raw: "1577836800.5"},
+		{in: `"2020-01-01 00:00:00"`, want: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), raw: "2020-01-01 00:00:00"},
+		{in: `"2020-01-01T03:00:00+03:00"`, want: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), raw: "2020-01-01T03:00:00+03:00"},
+		{in: `"2020-01-01"`, want: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), raw: "2020-01-01"},
+		{in: `"01.02.2020 10:30"`, want: time.Date(2020, 2, 1, 10, 30, 0, 0, time.UTC), raw: "01.02.2020 10:30"},
+		{in: `"Jan 2, 2020"`, want: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), raw: "Jan 2, 2020"},
+		{in: `null`},
+		{in: `""`},
+		{in: `"yesterday"`, raw: "yesterday", invalid: true},
+		{in: `"2020-13-45"`, raw: "2020-13-45", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var v struct {
+				T Time `json:"t"`
+			}
+			err := json.Unmarshal([]byte(`{"t":`+tt.in+`}`), &v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !v.T.Equal(tt.want) {
+				t.Errorf("time = %s, want %s", v.T.Time, tt.want)
+			}
+			if v.T.Raw != tt.raw {
+				t.Errorf("raw = %q, want %q", v.T.Raw, tt.raw)
+			}
+			if v.T.Invalid != tt.invalid {
+				t.Errorf("invalid = %v, want %v", v.T.Invalid, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestTimeMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Time
+		want string
+	}{
+		{name: "zero", in: Time{}, want: `null`},
+		{name: "new", in: NewTime(time.Unix(1577836800, 0)), want: `1577836800`},
+		{name: "raw number", in: Time{Raw: "1577836800123"}, want: `1577836800123`},
+		{name: "raw date", in: Time{Raw: "2020-01-01 00:00:00"}, want: `"2020-01-01 00:00:00"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("marshal = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
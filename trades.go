@@ -8,11 +8,11 @@ import (
 )
 
 type CurrencyPairTrades struct {
-	Id        int64  `json:"id"`
-	Price     string `json:"price"`
-	Amount    string `json:"amount"`
-	Type      string `json:"type"`
-	Timestamp int64  `json:"timestamp"`
+	Id        int64   `json:"id"`
+	Price     Decimal `json:"price"`
+	Amount    Decimal `json:"amount"`
+	Type      string  `json:"type"`
+	Timestamp Time    `json:"timestamp"`
 }
 
 type CurrencyPairTradesService struct {
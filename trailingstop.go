@@ -0,0 +1,569 @@
+package stex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type TrailingStopStatus string
+
+const (
+	TrailingStopActive TrailingStopStatus = "active"
+	// TrailingStopTriggered means the stop order was triggered or started filling, it is not moved anymore
+	TrailingStopTriggered TrailingStopStatus = "triggered"
+	TrailingStopDone      TrailingStopStatus = "done"
+	TrailingStopCancelled TrailingStopStatus = "cancelled"
+)
+
+// TrailingStopRequest define trailing stop to place
+type TrailingStopRequest struct {
+	CurrencyPairId int
+	// Type is STOP_LIMIT_SELL or STOP_LIMIT_BUY
+	Type   OrderType
+	Amount Decimal
+	// Distance of the trigger price from the best price, in the market currency or in percent when Percent is set
+	Distance Decimal
+	Percent  bool
+	// LimitOffset puts the limit price that much beyond the trigger price, lower for sells and higher for buys
+	LimitOffset Decimal
+}
+
+// TrailingStop define state of a trailing stop
+type TrailingStop struct {
+	Id int64
+	TrailingStopRequest
+	Status TrailingStopStatus
+
+	// BestPrice is the highest last price since placing for sells and the lowest for buys
+	BestPrice Decimal
+	LastPrice Decimal
+
+	// OrderId, TriggerPrice and Price are of the current order
+	OrderId      int64
+	TriggerPrice Decimal
+	Price        Decimal
+	// OrderIds of all orders placed, the last one is current
+	OrderIds []int64
+	// Filled is the amount filled by all orders
+	Filled Decimal
+
+	Created time.Time
+	Updated time.Time
+	// Replaced is the time the current order was placed
+	Replaced time.Time
+	// Error is the last error of placing or cancelling orders
+	Error string
+}
+
+type trailingStop struct {
+	TrailingStop
+
+	// fills of the replaced orders
+	filled_before Decimal
+	cancelling    bool
+}
+
+func (s *trailingStop) copy() *trailingStop {
+	res := *s
+	res.OrderIds = append([]int64{}, s.OrderIds...)
+	return &res
+}
+
+func (s *trailingStop) sell() bool {
+	return s.Type == OrderType_STOP_LIMIT_SELL
+}
+
+type trailPrice struct {
+	price    Decimal
+	received time.Time
+}
+
+// TrailingStopManager moves stop-limit orders after the price. The last price comes from the rate channel,
+// pairs without recent rate messages are polled with CurrencyPairTickerService.
+// A stop is moved by cancelling its order and, after the cancellation is confirmed, placing a new one
+// for the amount not filled, so fills made during the replacement are never doubled.
+type TrailingStopManager struct {
+	c       *Client
+	w       *WssClient
+	tracker *OrderTracker
+	source  PairInfoSource
+
+	min_interval  time.Duration
+	poll_interval time.Duration
+	f             func(TrailingStop)
+
+	// run serializes changes of stops and the requests made for them
+	run sync.Mutex
+
+	mu     sync.Mutex
+	seq    int64
+	stops  map[int64]*trailingStop
+	prices map[int]trailPrice
+	pairs  map[int]CurrencyPair
+
+	kick chan struct{}
+}
+
+// NewTrailingStopManager returns manager of the account of c. w must be connected, when it is nil
+// prices and orders are followed with REST only.
+func NewTrailingStopManager(c *Client, w *WssClient) *TrailingStopManager {
+	m := &TrailingStopManager{
+		c:             c,
+		w:             w,
+		source:        clientPairSource{c: c},
+		min_interval:  10 * time.Second,
+		poll_interval: 5 * time.Second,
+		stops:         map[int64]*trailingStop{},
+		prices:        map[int]trailPrice{},
+		pairs:         map[int]CurrencyPair{},
+		kick:          make(chan struct{}, 1),
+	}
+	m.tracker = NewOrderTracker(c, w).OnUpdate(func(TrackedOrder) { m.checkSoon() })
+	return m
+}
+
+// UserId sets user id, by default it is taken from ProfileInfoService
+func (m *TrailingStopManager) UserId(user_id int64) *TrailingStopManager {
+	m.tracker.UserId(user_id)
+	return m
+}
+
+// CurrencyPairIds sets pairs of the stops
+func (m *TrailingStopManager) CurrencyPairIds(pair_ids ...int) *TrailingStopManager {
+	m.tracker.CurrencyPairIds(pair_ids...)
+	return m
+}
+
+// ReconcileInterval sets period of REST checks of the orders, default is 30s
+func (m *TrailingStopManager) ReconcileInterval(interval time.Duration) *TrailingStopManager {
+	m.tracker.ReconcileInterval(interval)
+	return m
+}
+
+// Source sets where pair precision is loaded from, default is CurrencyPairInfoService
+func (m *TrailingStopManager) Source(source PairInfoSource) *TrailingStopManager {
+	m.source = source
+	return m
+}
+
+// MinInterval sets the shortest time between replacements of a stop order, default is 10s
+func (m *TrailingStopManager) MinInterval(interval time.Duration) *TrailingStopManager {
+	m.min_interval = interval
+	return m
+}
+
+// PollInterval sets how old the last price may get before the ticker is polled, default is 5s
+func (m *TrailingStopManager) PollInterval(interval time.Duration) *TrailingStopManager {
+	m.poll_interval = interval
+	return m
+}
+
+// OnUpdate sets callback called after every change of a stop.
+// It runs while stops are processed and must not call Place or Cancel.
+func (m *TrailingStopManager) OnUpdate(f func(TrailingStop)) *TrailingStopManager {
+	m.f = f
+	return m
+}
+
+// Do starts following prices and orders until ctx is cancelled
+func (m *TrailingStopManager) Do(ctx context.Context) error {
+	var rates <-chan RateMessage
+	if m.w != nil {
+		err := m.tracker.Do(ctx)
+		if err != nil {
+			return err
+		}
+
+		rates, err = NewWebsocketRateChannelService(m.w).Overflow(OverflowDropOldest).Stream(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(m.poll_interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-rates:
+				if !ok {
+					rates = nil
+					continue
+				}
+				if !m.setPrice(msg.Id, msg.LastPrice) {
+					continue
+				}
+			case <-m.kick:
+			case <-ticker.C:
+				m.poll(ctx, rates == nil)
+			}
+			m.check(ctx)
+		}
+	}()
+
+	return nil
+}
+
+// setPrice stores last price of pair, it reports if the pair has active stops
+func (m *TrailingStopManager) setPrice(pair_id int, price Decimal) bool {
+	if !price.IsPositive() {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prices[pair_id] = trailPrice{price: price, received: time.Now()}
+	for _, s := range m.stops {
+		if s.CurrencyPairId == pair_id && s.Status == TrailingStopActive {
+			return true
+		}
+	}
+	return false
+}
+
+// price returns last price of pair, it is polled when the rate channel has been silent for PollInterval
+func (m *TrailingStopManager) price(ctx context.Context, pair_id int) (Decimal, error) {
+	m.mu.Lock()
+	p, ok := m.prices[pair_id]
+	m.mu.Unlock()
+
+	if ok && time.Since(p.received) < m.poll_interval {
+		return p.price, nil
+	}
+
+	ticker, err := m.c.NewCurrencyPairTickerService().CurrencyPairId(pair_id).Do(ctx)
+	if err != nil {
+		if ok {
+			return p.price, nil
+		}
+		return Decimal{}, err
+	}
+
+	m.setPrice(pair_id, ticker.Last)
+	return ticker.Last, nil
+}
+
+// poll refreshes stale prices of pairs with active stops and, when rates are not streamed, order states
+func (m *TrailingStopManager) poll(ctx context.Context, rest bool) {
+	if rest {
+		if err := m.tracker.Reconcile(ctx); err != nil {
+			m.c.debug("trailing stop reconcile: %s", err)
+		}
+	}
+
+	pair_ids := map[int]bool{}
+	for _, s := range m.Stops() {
+		if s.Status == TrailingStopActive {
+			pair_ids[s.CurrencyPairId] = true
+		}
+	}
+
+	for pair_id := range pair_ids {
+		if _, err := m.price(ctx, pair_id); err != nil {
+			m.c.debug("trailing stop price of pair %d: %s", pair_id, err)
+		}
+	}
+}
+
+// pair returns cached pair
+func (m *TrailingStopManager) pair(ctx context.Context, pair_id int) (CurrencyPair, error) {
+	m.mu.Lock()
+	pair, ok := m.pairs[pair_id]
+	m.mu.Unlock()
+	if ok {
+		return pair, nil
+	}
+
+	res, err := m.source.PairInfo(ctx, pair_id)
+	if err != nil {
+		return CurrencyPair{}, err
+	}
+
+	m.mu.Lock()
+	m.pairs[pair_id] = *res
+	m.mu.Unlock()
+	return *res, nil
+}
+
+// Place places stop order at Distance from the last price and follows the price with it
+func (m *TrailingStopManager) Place(ctx context.Context, req TrailingStopRequest) (TrailingStop, error) {
+	if req.Type != OrderType_STOP_LIMIT_SELL && req.Type != OrderType_STOP_LIMIT_BUY {
+		return TrailingStop{}, fmt.Errorf("type must be STOP_LIMIT_SELL or STOP_LIMIT_BUY")
+	}
+	if !req.Amount.IsPositive() {
+		return TrailingStop{}, fmt.Errorf("amount must be positive")
+	}
+	if !req.Distance.IsPositive() || (req.Percent && !req.Distance.LessThan(NewDecimalFromInt(100))) {
+		return TrailingStop{}, fmt.Errorf("distance must be positive and below 100 percent")
+	}
+	if req.LimitOffset.IsNegative() {
+		return TrailingStop{}, fmt.Errorf("limit offset must not be negative")
+	}
+
+	price, err := m.price(ctx, req.CurrencyPairId)
+	if err != nil {
+		return TrailingStop{}, err
+	}
+
+	m.run.Lock()
+	defer m.run.Unlock()
+
+	s := &trailingStop{TrailingStop: TrailingStop{
+		TrailingStopRequest: req,
+		Status:              TrailingStopActive,
+		BestPrice:           price,
+		LastPrice:           price,
+		Created:             time.Now(),
+	}}
+
+	err = m.place(ctx, s)
+	if err != nil {
+		return TrailingStop{}, err
+	}
+
+	m.mu.Lock()
+	m.seq++
+	s.Id = m.seq
+	m.mu.Unlock()
+
+	m.put(s)
+	return s.TrailingStop, nil
+}
+
+// Cancel cancels order of stop id
+func (m *TrailingStopManager) Cancel(ctx context.Context, id int64) error {
+	m.run.Lock()
+	defer m.run.Unlock()
+
+	s, ok := m.stop(id)
+	if !ok {
+		return fmt.Errorf("trailing stop %d: %w", id, ErrNotFound)
+	}
+	if s.Status == TrailingStopDone || s.Status == TrailingStopCancelled {
+		return nil
+	}
+
+	s.Status = TrailingStopCancelled
+	var err error
+	if s.OrderId != 0 && !s.cancelling {
+		_, err = m.c.NewOrderDeleteService().OrderId(s.OrderId).Do(ctx)
+		if err != nil {
+			s.Error = err.Error()
+		}
+	}
+
+	m.put(s)
+	return err
+}
+
+// Stop returns state of stop id
+func (m *TrailingStopManager) Stop(id int64) (TrailingStop, bool) {
+	s, ok := m.stop(id)
+	if !ok {
+		return TrailingStop{}, false
+	}
+	return s.TrailingStop, true
+}
+
+func (m *TrailingStopManager) stop(id int64) (*trailingStop, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.stops[id]
+	if !ok {
+		return nil, false
+	}
+	return s.copy(), true
+}
+
+// Stops returns all stops sorted by id
+func (m *TrailingStopManager) Stops() []TrailingStop {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := []TrailingStop{}
+	for _, s := range m.stops {
+		res = append(res, s.copy().TrailingStop)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Id < res[j].Id })
+	return res
+}
+
+func (m *TrailingStopManager) checkSoon() {
+	select {
+	case m.kick <- struct{}{}:
+	default:
+	}
+}
+
+// check evaluates stops which are not finished
+func (m *TrailingStopManager) check(ctx context.Context) {
+	m.run.Lock()
+	defer m.run.Unlock()
+
+	m.mu.Lock()
+	stops := []*trailingStop{}
+	for _, s := range m.stops {
+		if s.Status == TrailingStopActive || s.Status == TrailingStopTriggered {
+			stops = append(stops, s.copy())
+		}
+	}
+	m.mu.Unlock()
+
+	for _, s := range stops {
+		if err := m.evaluate(ctx, s); err != nil {
+			m.c.debug("trailing stop %d: %s", s.Id, err)
+		}
+		m.put(s)
+	}
+}
+
+// put stores copy of s and reports the change
+func (m *TrailingStopManager) put(s *trailingStop) {
+	m.mu.Lock()
+	prev := m.stops[s.Id]
+	changed := true
+	if prev != nil {
+		s.Updated = prev.Updated
+		before, _ := json.Marshal(prev)
+		after, _ := json.Marshal(s)
+		changed = string(before) != string(after) || prev.cancelling != s.cancelling
+	}
+	if changed {
+		s.Updated = time.Now()
+	}
+	m.stops[s.Id] = s.copy()
+	m.mu.Unlock()
+
+	if changed && m.f != nil {
+		m.f(s.TrailingStop)
+	}
+}
+
+// evaluate follows the current order of s and moves it when the price went far enough
+func (m *TrailingStopManager) evaluate(ctx context.Context, s *trailingStop) error {
+	if s.OrderId != 0 {
+		if o, ok := m.tracker.Order(s.OrderId); ok {
+			s.Filled = s.filled_before.Add(o.FilledAmount)
+
+			switch {
+			case o.Status == OrderStatus_FINISHED:
+				s.Status = TrailingStopDone
+				return nil
+			case o.Status == OrderStatus_CANCELLED && s.cancelling:
+				// The order may fill until it is cancelled, the replacement waits for REST to confirm
+				// the cancellation and for the trades, so it is placed for the amount not filled
+				if !m.tracker.settled(o.Id) {
+					m.tracker.reconcileSoon()
+					return nil
+				}
+				s.filled_before = s.Filled
+				s.OrderId = 0
+				s.cancelling = false
+			case o.Status == OrderStatus_CANCELLED:
+				s.Status = TrailingStopCancelled
+				s.Error = "order was cancelled outside of the manager"
+				return nil
+			case o.FilledAmount.IsPositive() || (o.Type != "" && o.Type != s.Type):
+				s.Status = TrailingStopTriggered
+			}
+		}
+	}
+
+	if s.Status != TrailingStopActive {
+		return nil
+	}
+
+	price, err := m.price(ctx, s.CurrencyPairId)
+	if err != nil {
+		return err
+	}
+	s.LastPrice = price
+	if (s.sell() && price.GreaterThan(s.BestPrice)) || (!s.sell() && price.LessThan(s.BestPrice)) {
+		s.BestPrice = price
+	}
+
+	if s.OrderId == 0 {
+		if !s.Amount.Sub(s.Filled).IsPositive() {
+			s.Status = TrailingStopDone
+			return nil
+		}
+		return m.place(ctx, s)
+	}
+
+	if s.cancelling || time.Since(s.Replaced) < m.min_interval {
+		return nil
+	}
+
+	pair, err := m.pair(ctx, s.CurrencyPairId)
+	if err != nil {
+		return err
+	}
+	trigger, _ := s.levels(pair)
+	if (s.sell() && !trigger.GreaterThan(s.TriggerPrice)) || (!s.sell() && !trigger.LessThan(s.TriggerPrice)) {
+		return nil
+	}
+
+	_, err = m.c.NewOrderDeleteService().OrderId(s.OrderId).Do(ctx)
+	if err != nil {
+		s.Error = err.Error()
+		return err
+	}
+	s.cancelling = true
+	m.tracker.reconcileSoon()
+	return nil
+}
+
+// levels returns trigger and limit price of s at its best price rounded to the pair precision away from the price
+func (s *trailingStop) levels(pair CurrencyPair) (Decimal, Decimal) {
+	places := int32(pair.MarketPrecision)
+
+	distance := s.Distance
+	if s.Percent {
+		distance = s.BestPrice.Mul(s.Distance).Div(NewDecimalFromInt(100), analyticsPlaces)
+	}
+
+	if s.sell() {
+		trigger := s.BestPrice.Sub(distance).Floor(places)
+		return trigger, trigger.Sub(s.LimitOffset).Floor(places)
+	}
+	trigger := s.BestPrice.Add(distance).Ceil(places)
+	return trigger, trigger.Add(s.LimitOffset).Ceil(places)
+}
+
+// place creates stop order of s for the amount not filled yet
+func (m *TrailingStopManager) place(ctx context.Context, s *trailingStop) error {
+	pair, err := m.pair(ctx, s.CurrencyPairId)
+	if err != nil {
+		return err
+	}
+
+	trigger, price := s.levels(pair)
+	if !price.IsPositive() {
+		s.Error = "distance is larger than the price"
+		return fmt.Errorf("trailing stop price %s is not positive", price)
+	}
+
+	info, err := m.c.NewCreateOrderService().CurrencyPairId(s.CurrencyPairId).OrderType(s.Type).
+		Amount(s.Amount.Sub(s.Filled)).Price(price).TriggerPrice(trigger).Do(ctx)
+	if err != nil {
+		s.Error = err.Error()
+		return err
+	}
+
+	s.OrderId = info.Id
+	s.OrderIds = append(s.OrderIds, info.Id)
+	s.TriggerPrice = trigger
+	s.Price = price
+	s.Replaced = time.Now()
+	m.tracker.Track(*info)
+	return nil
+}
@@ -0,0 +1,167 @@
+package stex_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+	"github.com/vladivolo/stex-api/stextest"
+)
+
+func TestTrailingStopFollowsPrice(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	a := newTradingAccount(t, ctx)
+	defer a.close()
+
+	// Trades of the taker with another user make the last price, which is also pushed to the rate channel
+	other := a.srv.AddUser("other")
+	a.srv.SetBalance(other, "BTC", stex.MustParseDecimal("10"))
+	rate := func(price string) {
+		if _, err := a.srv.PlaceOrder(other, 1, stex.OrderType_BUY, stex.MustParseDecimal("0.1"), stex.MustParseDecimal(price), stex.Decimal{}); err != nil {
+			t.Fatal(err)
+		}
+		a.trade(t, stex.OrderType_SELL, "0.1", price)
+		if _, err := a.sock.Push("rate", stextest.EventTicker, map[string]interface{}{"id": 1, "lastPrice": price}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rate("0.02")
+
+	m := stex.NewTrailingStopManager(a.c, a.w).UserId(a.maker).CurrencyPairIds(1).
+		ReconcileInterval(20 * time.Millisecond).MinInterval(0).PollInterval(time.Minute)
+	if err := m.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.sock.WaitSubscribed(ctx, "rate", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.Place(ctx, stex.TrailingStopRequest{
+		CurrencyPairId: 1,
+		Type:           stex.OrderType_STOP_LIMIT_SELL,
+		Amount:         stex.MustParseDecimal("1"),
+		Distance:       stex.MustParseDecimal("0.002"),
+		LimitOffset:    stex.MustParseDecimal("0.001"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Status != stex.TrailingStopActive || !s.TriggerPrice.Equal(stex.MustParseDecimal("0.018")) || !s.Price.Equal(stex.MustParseDecimal("0.017")) {
+		t.Fatalf("placed stop = %+v", s)
+	}
+
+	// A rising price moves the stop after it
+	rate("0.025")
+	waitFor(t, "stop moved", func() bool {
+		s, _ = m.Stop(s.Id)
+		return len(s.OrderIds) == 2 && s.OrderId == s.OrderIds[1]
+	})
+	if !s.BestPrice.Equal(stex.MustParseDecimal("0.025")) || !s.TriggerPrice.Equal(stex.MustParseDecimal("0.023")) || !s.Price.Equal(stex.MustParseDecimal("0.022")) {
+		t.Errorf("moved stop = %+v", s)
+	}
+	open := a.openOrders(t, ctx)
+	if len(open) != 1 || open[0].Id != s.OrderId || !open[0].TriggerPrice.Equal(s.TriggerPrice) {
+		t.Errorf("open orders after move = %+v", open)
+	}
+
+	// A falling price does not
+	rate("0.024")
+	waitFor(t, "price received", func() bool {
+		s, _ = m.Stop(s.Id)
+		return s.LastPrice.Equal(stex.MustParseDecimal("0.024"))
+	})
+	if len(s.OrderIds) != 2 || !s.TriggerPrice.Equal(stex.MustParseDecimal("0.023")) {
+		t.Errorf("stop after price fall = %+v", s)
+	}
+
+	if err = m.Cancel(ctx, s.Id); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "stop cancelled", func() bool {
+		s, _ = m.Stop(s.Id)
+		return s.Status == stex.TrailingStopCancelled
+	})
+	if open = a.openOrders(t, ctx); len(open) != 0 {
+		t.Errorf("orders left in the book: %+v", open)
+	}
+}
+
+func TestTrailingStopPartialFillDuringReplacement(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	a := newTradingAccount(t, ctx)
+	defer a.close()
+
+	other := a.srv.AddUser("other")
+	a.srv.SetBalance(other, "BTC", stex.MustParseDecimal("10"))
+	trade := func(price string) {
+		if _, err := a.srv.PlaceOrder(other, 1, stex.OrderType_BUY, stex.MustParseDecimal("0.1"), stex.MustParseDecimal(price), stex.Decimal{}); err != nil {
+			t.Fatal(err)
+		}
+		a.trade(t, stex.OrderType_SELL, "0.1", price)
+	}
+	push := func(channel, event string, data interface{}) {
+		if _, err := a.sock.Push(channel, event, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	trade("0.02")
+	push("rate", stextest.EventTicker, map[string]interface{}{"id": 1, "lastPrice": "0.02"})
+
+	// REST reconciliation runs only when the manager asks for it
+	m := stex.NewTrailingStopManager(a.c, a.w).UserId(a.maker).CurrencyPairIds(1).
+		ReconcileInterval(time.Hour).MinInterval(0).PollInterval(time.Minute)
+	if err := m.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	deletes := fmt.Sprintf("private-del_order_u%dc1", a.maker)
+	for _, channel := range []string{"rate", deletes} {
+		if err := a.sock.WaitSubscribed(ctx, channel, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := m.Place(ctx, stex.TrailingStopRequest{
+		CurrencyPairId: 1,
+		Type:           stex.OrderType_STOP_LIMIT_SELL,
+		Amount:         stex.MustParseDecimal("1"),
+		Distance:       stex.MustParseDecimal("0.002"),
+		LimitOffset:    stex.MustParseDecimal("0.001"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := s.OrderId
+
+	// The stop triggers and fills partially before the manager learns about it
+	trade("0.018")
+	a.trade(t, stex.OrderType_BUY, "0.4", "0.017")
+
+	// A rising price makes the manager cancel the order. REST fails to confirm it once
+	// and the websocket reports the cancellation without the fill.
+	a.c.RetryPolicy = fastRetryPolicy(1)
+	a.srv.InjectFault(stextest.Fault{Method: "GET", Path: "/trading/order/", Status: 500, Count: 1})
+	push("rate", stextest.EventTicker, map[string]interface{}{"id": 1, "lastPrice": "0.025"})
+	waitFor(t, "order cancelled", func() bool {
+		return len(a.openOrders(t, ctx)) == 0
+	})
+	push(deletes, stextest.EventUserOrderDeleted, map[string]interface{}{
+		"id": first, "user_id": a.maker, "currency_pair_id": 1, "status": stex.OrderStatus_CANCELLED,
+	})
+	trade("0.025")
+
+	waitFor(t, "stop replaced", func() bool {
+		s, _ = m.Stop(s.Id)
+		return len(s.OrderIds) == 2
+	})
+	if !s.Filled.Equal(stex.MustParseDecimal("0.4")) || !s.TriggerPrice.Equal(stex.MustParseDecimal("0.023")) {
+		t.Errorf("replaced stop = %+v", s)
+	}
+	open := a.openOrders(t, ctx)
+	if len(open) != 1 || open[0].Id != s.OrderId || !open[0].InitialAmount.Equal(stex.MustParseDecimal("0.6")) {
+		t.Errorf("open orders after replacement = %+v", open)
+	}
+}
@@ -0,0 +1,311 @@
+package stex
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+type UserEventType string
+
+const (
+	UserEventFill         UserEventType = "fill"
+	UserEventOrderUpdate  UserEventType = "order_update"
+	UserEventOrderDeleted UserEventType = "order_deleted"
+	UserEventBalance      UserEventType = "balance"
+)
+
+// UserEvent define one event of UserDataStream, exactly one of Fill, Update, Delete and Balance is set
+type UserEvent struct {
+	// Seq numbers events of the stream in the order they were received, starting from 1
+	Seq      uint64
+	Type     UserEventType
+	Received time.Time
+
+	// CurrencyPairId is 0 for balance events
+	CurrencyPairId int
+	// OrderId is set for order updates and deletions, for fills it is the id of the user's order
+	OrderId int64
+	// OrderType is set for fills and order updates, of a fill that names the other user of the trade
+	// only the side of the user's order is known, BUY or SELL
+	OrderType OrderType
+	// WalletId is set for balance events
+	WalletId int64
+
+	Fill    *TradeOrder
+	Update  *UpdateOrder
+	Delete  *DeleteOrder
+	Balance *UpdateBalance
+}
+
+// userService is a channel service of UserDataStream
+type userService interface {
+	Do() error
+	Unsubscribe() error
+}
+
+// UserDataStream merges fills, order updates, order deletions of given pairs and balance changes
+// of all wallets into one ordered stream
+type UserDataStream struct {
+	c *Client
+	w *WssClient
+
+	user_id     *int64
+	pair_ids    []int
+	wallet_ids  []int64
+	order_types []OrderType
+
+	buffer_size *int
+	overflow    *OverflowPolicy
+
+	mu       sync.Mutex
+	services []userService
+	stream   *eventStream
+
+	// seqMu keeps sequence numbers in the order events are sent to the stream
+	seqMu sync.Mutex
+	seq   uint64
+}
+
+// NewUserDataStream returns stream of the account of c, w must be connected
+func NewUserDataStream(c *Client, w *WssClient) *UserDataStream {
+	return &UserDataStream{c: c, w: w}
+}
+
+// UserId sets user id, by default it is taken from ProfileInfoService
+func (s *UserDataStream) UserId(user_id int64) *UserDataStream {
+	s.user_id = &user_id
+	return s
+}
+
+// CurrencyPairIds sets pairs of order events
+func (s *UserDataStream) CurrencyPairIds(pair_ids ...int) *UserDataStream {
+	s.pair_ids = pair_ids
+	return s
+}
+
+// WalletIds sets wallets of balance events, by default all wallets from ProfileWalletListService are used
+func (s *UserDataStream) WalletIds(wallet_ids ...int64) *UserDataStream {
+	s.wallet_ids = wallet_ids
+	return s
+}
+
+// OrderTypes sets order types of order update events, default is BUY and SELL
+func (s *UserDataStream) OrderTypes(order_types ...OrderType) *UserDataStream {
+	s.order_types = order_types
+	return s
+}
+
+// BufferSize sets Stream channel capacity, default is 100
+func (s *UserDataStream) BufferSize(size int) *UserDataStream {
+	s.buffer_size = &size
+	return s
+}
+
+// Overflow sets what Stream does when the consumer falls behind, default is OverflowDropOldest
+func (s *UserDataStream) Overflow(policy OverflowPolicy) *UserDataStream {
+	s.overflow = &policy
+	return s
+}
+
+// Dropped returns number of events discarded by Stream overflow policy
+func (s *UserDataStream) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stream.droppedCount()
+}
+
+// Stream subscribes to all channels of the account and delivers their events to the returned channel.
+// The channel is closed when ctx is done, the connection is lost for good or the overflow policy disconnects it.
+func (s *UserDataStream) Stream(ctx context.Context) (<-chan UserEvent, error) {
+	if len(s.pair_ids) == 0 {
+		return nil, fmt.Errorf("pair_ids not init")
+	}
+
+	user_id, wallet_ids, err := s.account(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order_types := s.order_types
+	if len(order_types) == 0 {
+		order_types = []OrderType{OrderType_BUY, OrderType_SELL}
+	}
+
+	st := newEventStream(reflect.TypeOf(UserEvent{}), s.buffer_size, s.overflow, s.unsubscribe)
+	s.mu.Lock()
+	s.stream = st
+	s.mu.Unlock()
+
+	s.seqMu.Lock()
+	s.seq = 0
+	s.seqMu.Unlock()
+
+	err = s.subscribeAll(user_id, wallet_ids, order_types)
+	if err != nil {
+		s.unsubscribe()
+		st.close()
+		return nil, err
+	}
+
+	st.start(ctx, s.w)
+
+	return st.out.Interface().(chan UserEvent), nil
+}
+
+// fillOrder returns id and type of the order of user_id in fill. User id and order type of a fill
+// describe the same order, so when the fill names another user the user's order is on the opposite side.
+func fillOrder(user_id int64, msg TradeOrder) (int64, OrderType) {
+	if msg.UserId == user_id {
+		if orderTypeBuy(msg.OrderType) {
+			return msg.BuyOrderId, msg.OrderType
+		}
+		return msg.SellOrderId, msg.OrderType
+	}
+
+	if orderTypeBuy(msg.OrderType) {
+		return msg.SellOrderId, OrderType_SELL
+	}
+	return msg.BuyOrderId, OrderType_BUY
+}
+
+// subscribeAll subscribes to the channels of the account, services subscribed so far are kept on error
+func (s *UserDataStream) subscribeAll(user_id int64, wallet_ids []int64, order_types []OrderType) error {
+	var err error
+	for _, pair_id := range s.pair_ids {
+		err = s.subscribe(NewWebsocketUserOrderFillChannelService(s.w).UserId(user_id).CurrencyPairId(pair_id).
+			OnMessage(func(_ string, msg TradeOrder) {
+				order_id, order_type := fillOrder(user_id, msg)
+				s.push(UserEvent{
+					Type:           UserEventFill,
+					CurrencyPairId: msg.CurrencyPairId,
+					OrderId:        order_id,
+					OrderType:      order_type,
+					Fill:           &msg,
+				})
+			}))
+		if err != nil {
+			return err
+		}
+
+		for _, order_type := range order_types {
+			err = s.subscribe(NewWebsocketUserOrderUpdateChannelService(s.w).UserId(user_id).CurrencyPairId(pair_id).
+				OrderType(order_type).OnMessage(func(order_type OrderType, msg UpdateOrder) {
+				s.push(UserEvent{
+					Type:           UserEventOrderUpdate,
+					CurrencyPairId: msg.CurrencyPairId,
+					OrderId:        msg.Id,
+					OrderType:      order_type,
+					Update:         &msg,
+				})
+			}))
+			if err != nil {
+				return err
+			}
+		}
+
+		err = s.subscribe(NewWebsocketUserOrderDeletedChannelService(s.w).UserId(user_id).CurrencyPairId(pair_id).
+			OnMessage(func(_ string, msg DeleteOrder) {
+				s.push(UserEvent{
+					Type:           UserEventOrderDeleted,
+					CurrencyPairId: msg.CurrencyPairId,
+					OrderId:        msg.Id,
+					Delete:         &msg,
+				})
+			}))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, wallet_id := range wallet_ids {
+		wallet_id := wallet_id
+		err = s.subscribe(NewWebsocketUserBalanceUpdateChannelService(s.w).WalletId(wallet_id).
+			OnMessage(func(_ string, msg UpdateBalance) {
+				s.push(UserEvent{
+					Type:     UserEventBalance,
+					WalletId: wallet_id,
+					Balance:  &msg,
+				})
+			}))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// account returns user id and wallet ids, asking REST API for those not set
+func (s *UserDataStream) account(ctx context.Context) (int64, []int64, error) {
+	var user_id int64
+	if s.user_id != nil {
+		user_id = *s.user_id
+	} else {
+		info, err := s.c.NewProfileInfoService().Do(ctx)
+		if err != nil {
+			return 0, nil, err
+		}
+		user_id = info.UserId
+	}
+
+	if s.wallet_ids != nil {
+		return user_id, s.wallet_ids, nil
+	}
+
+	wallets, err := s.c.NewProfileWalletListService().Do(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	wallet_ids := make([]int64, 0, len(wallets))
+	for _, w := range wallets {
+		wallet_ids = append(wallet_ids, w.Id)
+	}
+	return user_id, wallet_ids, nil
+}
+
+// subscribe runs Do of service and keeps it to be unsubscribed with the stream
+func (s *UserDataStream) subscribe(service userService) error {
+	err := service.Do()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.services = append(s.services, service)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *UserDataStream) unsubscribe() error {
+	s.mu.Lock()
+	services := s.services
+	s.services = nil
+	s.mu.Unlock()
+
+	var res error
+	for _, service := range services {
+		if err := service.Unsubscribe(); err != nil && res == nil {
+			res = err
+		}
+	}
+	return res
+}
+
+// push numbers ev and sends it to the stream
+func (s *UserDataStream) push(ev UserEvent) {
+	s.mu.Lock()
+	st := s.stream
+	s.mu.Unlock()
+
+	s.seqMu.Lock()
+	defer s.seqMu.Unlock()
+
+	s.seq++
+	ev.Seq = s.seq
+	ev.Received = time.Now()
+	st.push(ev)
+}
@@ -0,0 +1,105 @@
+package stex_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+	"github.com/vladivolo/stex-api/stextest"
+)
+
+// limitedTokenSource returns a token the first n times and fails afterwards
+type limitedTokenSource struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (s *limitedTokenSource) Token(ctx context.Context) (*stex.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.n == 0 {
+		return nil, errors.New("token expired")
+	}
+	s.n--
+	return &stex.Token{AccessToken: "token"}, nil
+}
+
+func TestUserDataStreamFill(t *testing.T) {
+	sock := stextest.NewSocketServer()
+	defer sock.Close()
+	sock.AddToken("token", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	w, err := sock.WssClient("token").Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := stex.NewUserDataStream(nil, w).UserId(1).CurrencyPairIds(1).WalletIds(7).Stream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel := "private-trade_u1c1"
+	if err = sock.WaitSubscribed(ctx, channel, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fill names the order of its user, when it is the other user of the trade the own order is on the other side
+	fills := []struct {
+		user_id    int64
+		order_type stex.OrderType
+		want       int64
+		want_type  stex.OrderType
+	}{
+		{1, stex.OrderType_SELL, 20, stex.OrderType_SELL},
+		{1, stex.OrderType_BUY, 10, stex.OrderType_BUY},
+		{1, stex.OrderType_STOP_LIMIT_BUY, 10, stex.OrderType_STOP_LIMIT_BUY},
+		{2, stex.OrderType_BUY, 20, stex.OrderType_SELL},
+		{2, stex.OrderType_STOP_LIMIT_SELL, 10, stex.OrderType_BUY},
+	}
+	for _, f := range fills {
+		sock.Push(channel, stextest.EventUserOrderFillCreated, map[string]interface{}{
+			"user_id": f.user_id, "currency_pair_id": 1, "buy_order_id": 10, "sell_order_id": 20,
+			"price": "0.02", "amount": "1", "order_type": f.order_type,
+		})
+	}
+
+	for _, f := range fills {
+		select {
+		case ev := <-ch:
+			if ev.Type != stex.UserEventFill || ev.OrderType != f.want_type || ev.OrderId != f.want {
+				t.Errorf("fill of user %d %s = %+v, want order %d %s", f.user_id, f.order_type, ev, f.want, f.want_type)
+			}
+		case <-ctx.Done():
+			t.Fatal("no fill event")
+		}
+	}
+}
+
+func TestUserDataStreamSubscribeError(t *testing.T) {
+	sock := stextest.NewSocketServer()
+	defer sock.Close()
+	sock.AddToken("token", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	w := sock.WssClient("")
+	// Fills and BUY updates subscribe, SELL updates fail
+	w.TokenSource = &limitedTokenSource{n: 2}
+	if _, err := w.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := stex.NewUserDataStream(nil, w).UserId(1).CurrencyPairIds(1).WalletIds(7).Stream(ctx)
+	if err == nil {
+		t.Fatal("Stream succeeded with a failing subscription")
+	}
+	if subs := w.Subscriptions(); len(subs) != 0 {
+		t.Errorf("subscriptions left after the error: %+v", subs)
+	}
+}
@@ -0,0 +1,227 @@
+package stex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrPairInactive is matched by errors.Is when an order is rejected because its pair is delisted or not active
+var ErrPairInactive = errors.New("stex: currency pair is not active")
+
+// PairInfoSource provides trading rules of currency pairs
+type PairInfoSource interface {
+	PairInfo(ctx context.Context, pair_id int) (*CurrencyPair, error)
+}
+
+// clientPairSource asks CurrencyPairInfoService every time
+type clientPairSource struct {
+	c *Client
+}
+
+func (s clientPairSource) PairInfo(ctx context.Context, pair_id int) (*CurrencyPair, error) {
+	return s.c.NewCurrencyPairInfoService().PairId(pair_id).Do(ctx)
+}
+
+// OrderRequest define order checked by OrderValidator
+type OrderRequest struct {
+	CurrencyPairId int       `json:"currency_pair_id"`
+	Type           OrderType `json:"type"`
+	Amount         Decimal   `json:"amount"`
+	Price          Decimal   `json:"price"`
+	// TriggerPrice is set for stop-limit orders only
+	TriggerPrice *Decimal `json:"trigger_price,omitempty"`
+}
+
+// OrderValidationError define order rejected before it was sent.
+// It matches ErrInvalidAmount, ErrInvalidPrice or ErrPairInactive with errors.Is.
+type OrderValidationError struct {
+	CurrencyPairId int
+	// Field is "amount", "price", "trigger_price", "type" or "pair"
+	Field  string
+	Value  Decimal
+	Limit  Decimal
+	Reason string
+}
+
+func (e *OrderValidationError) Error() string {
+	msg := fmt.Sprintf("<OrderValidationError> pair=%d, field=%s", e.CurrencyPairId, e.Field)
+	if e.Field != "pair" && e.Field != "type" {
+		msg += ", value=" + e.Value.String()
+	}
+	return msg + ": " + e.Reason
+}
+
+func (e *OrderValidationError) Is(target error) bool {
+	switch e.Field {
+	case "amount":
+		return target == ErrInvalidAmount
+	case "price", "trigger_price":
+		return target == ErrInvalidPrice
+	case "pair":
+		return target == ErrPairInactive
+	}
+	return false
+}
+
+type cachedPair struct {
+	pair    CurrencyPair
+	fetched time.Time
+}
+
+// OrderValidator checks orders against trading rules of their pair before they are sent.
+// Set it as Client.Validator to check every CreateOrderService request.
+type OrderValidator struct {
+	source PairInfoSource
+	round  bool
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	pairs map[int]cachedPair
+}
+
+// NewOrderValidator returns validator loading pairs with CurrencyPairInfoService of c
+func NewOrderValidator(c *Client) *OrderValidator {
+	return &OrderValidator{
+		source: clientPairSource{c: c},
+		ttl:    10 * time.Minute,
+		pairs:  map[int]cachedPair{},
+	}
+}
+
+// Source sets where pairs are loaded from
+func (v *OrderValidator) Source(source PairInfoSource) *OrderValidator {
+	v.source = source
+	return v
+}
+
+// AutoRound makes the validator round amount and prices to the pair precision instead of rejecting them.
+// Amounts are rounded down, buy prices down and sell prices up.
+func (v *OrderValidator) AutoRound(round bool) *OrderValidator {
+	v.round = round
+	return v
+}
+
+// TTL sets how long loaded pairs are kept, default is 10 minutes
+func (v *OrderValidator) TTL(ttl time.Duration) *OrderValidator {
+	v.ttl = ttl
+	return v
+}
+
+// pair returns cached pair or loads it
+func (v *OrderValidator) pair(ctx context.Context, pair_id int) (*CurrencyPair, error) {
+	v.mu.Lock()
+	p, ok := v.pairs[pair_id]
+	v.mu.Unlock()
+
+	if ok && time.Since(p.fetched) < v.ttl {
+		return &p.pair, nil
+	}
+
+	pair, err := v.source.PairInfo(ctx, pair_id)
+	if err != nil {
+		return nil, err
+	}
+
+	v.mu.Lock()
+	v.pairs[pair_id] = cachedPair{pair: *pair, fetched: time.Now()}
+	v.mu.Unlock()
+
+	return pair, nil
+}
+
+// Validate checks order against rules of its pair and returns it, rounded if AutoRound is on
+func (v *OrderValidator) Validate(ctx context.Context, order OrderRequest) (OrderRequest, error) {
+	pair, err := v.pair(ctx, order.CurrencyPairId)
+	if err != nil {
+		return order, err
+	}
+
+	return v.check(pair, order)
+}
+
+func (v *OrderValidator) check(pair *CurrencyPair, order OrderRequest) (OrderRequest, error) {
+	fail := func(field string, value, limit Decimal, format string, args ...interface{}) (OrderRequest, error) {
+		return order, &OrderValidationError{
+			CurrencyPairId: order.CurrencyPairId,
+			Field:          field,
+			Value:          value,
+			Limit:          limit,
+			Reason:         fmt.Sprintf(format, args...),
+		}
+	}
+
+	if pair.Delisted {
+		return fail("pair", Decimal{}, Decimal{}, "pair %s is delisted", pair.Symbol)
+	}
+	if !pair.Active {
+		return fail("pair", Decimal{}, Decimal{}, "pair %s is not active", pair.Symbol)
+	}
+
+	buy := order.Type == OrderType_BUY || order.Type == OrderType_STOP_LIMIT_BUY
+	if !buy && order.Type != OrderType_SELL && order.Type != OrderType_STOP_LIMIT_SELL {
+		return fail("type", Decimal{}, Decimal{}, "unknown order type %q", order.Type)
+	}
+
+	amountPlaces := int32(pair.CurrencyPrecision)
+	pricePlaces := int32(pair.MarketPrecision)
+
+	// Amount must be a whole number of steps, a step is AmountMultiplier units of the last digit
+	step := NewDecimal(1, amountPlaces)
+	if pair.AmountMultiplier > 1 {
+		step = step.Mul(NewDecimalFromInt(int64(pair.AmountMultiplier)))
+	}
+
+	if v.round {
+		order.Amount = order.Amount.Div(step, analyticsPlaces).Floor(0).Mul(step).Normalize()
+		if buy {
+			order.Price = order.Price.Floor(pricePlaces)
+		} else {
+			order.Price = order.Price.Ceil(pricePlaces)
+		}
+		if order.TriggerPrice != nil {
+			trigger := order.TriggerPrice.Round(pricePlaces)
+			order.TriggerPrice = &trigger
+		}
+	}
+
+	if !order.Amount.IsPositive() {
+		return fail("amount", order.Amount, Decimal{}, "amount must be positive")
+	}
+	if order.Amount.Normalize().Scale() > amountPlaces {
+		return fail("amount", order.Amount, Decimal{}, "amount has more than %d digits after the point", amountPlaces)
+	}
+	if order.Amount.Div(step, analyticsPlaces).Normalize().Scale() > 0 {
+		return fail("amount", order.Amount, step, "amount is not a multiple of %s", step.Normalize())
+	}
+	if order.Amount.LessThan(pair.MinOrderAmount) {
+		return fail("amount", order.Amount, pair.MinOrderAmount, "amount is below minimum %s", pair.MinOrderAmount)
+	}
+
+	minPrice := pair.MinSellPrice
+	if buy {
+		minPrice = pair.MinBuyPrice
+	}
+	if !order.Price.IsPositive() {
+		return fail("price", order.Price, minPrice, "price must be positive")
+	}
+	if order.Price.Normalize().Scale() > pricePlaces {
+		return fail("price", order.Price, Decimal{}, "price has more than %d digits after the point", pricePlaces)
+	}
+	if order.Price.LessThan(minPrice) {
+		return fail("price", order.Price, minPrice, "price is below minimum %s", minPrice)
+	}
+
+	if order.TriggerPrice != nil {
+		if !order.TriggerPrice.IsPositive() {
+			return fail("trigger_price", *order.TriggerPrice, Decimal{}, "trigger price must be positive")
+		}
+		if order.TriggerPrice.Normalize().Scale() > pricePlaces {
+			return fail("trigger_price", *order.TriggerPrice, Decimal{}, "trigger price has more than %d digits after the point", pricePlaces)
+		}
+	}
+
+	return order, nil
+}
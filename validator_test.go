@@ -0,0 +1,118 @@
+package stex
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type staticPairSource map[int]CurrencyPair
+
+func (s staticPairSource) PairInfo(ctx context.Context, pair_id int) (*CurrencyPair, error) {
+	p, ok := s[pair_id]
+	if !ok {
+		return nil, errors.New("no pair")
+	}
+	return &p, nil
+}
+
+func TestOrderValidator(t *testing.T) {
+	pairs := staticPairSource{
+		1: {Id: 1, Symbol: "ETH_BTC", Active: true, CurrencyPrecision: 3, MarketPrecision: 4, AmountMultiplier: 5,
+			MinOrderAmount: MustParseDecimal("0.01"), MinBuyPrice: MustParseDecimal("0.001"), MinSellPrice: MustParseDecimal("0.002")},
+		2: {Id: 2, Symbol: "OLD_BTC", Active: true, Delisted: true},
+	}
+
+	tests := []struct {
+		name    string
+		round   bool
+		order   OrderRequest
+		want    OrderRequest
+		wantErr error
+		// wantField is the field of OrderValidationError
+		wantField string
+	}{
+		{
+			name:  "valid",
+			order: OrderRequest{CurrencyPairId: 1, Type: OrderType_BUY, Amount: MustParseDecimal("0.015"), Price: MustParseDecimal("0.0021")},
+		},
+		{
+			name:    "too many digits",
+			order:   OrderRequest{CurrencyPairId: 1, Type: OrderType_BUY, Amount: MustParseDecimal("0.0151"), Price: MustParseDecimal("0.0021")},
+			wantErr: ErrInvalidAmount,
+		},
+		{
+			name:    "not a multiple of step",
+			order:   OrderRequest{CurrencyPairId: 1, Type: OrderType_BUY, Amount: MustParseDecimal("0.013"), Price: MustParseDecimal("0.0021")},
+			wantErr: ErrInvalidAmount,
+		},
+		{
+			name:    "below minimum amount",
+			order:   OrderRequest{CurrencyPairId: 1, Type: OrderType_BUY, Amount: MustParseDecimal("0.005"), Price: MustParseDecimal("0.0021")},
+			wantErr: ErrInvalidAmount,
+		},
+		{
+			name:    "below minimum sell price",
+			order:   OrderRequest{CurrencyPairId: 1, Type: OrderType_SELL, Amount: MustParseDecimal("0.015"), Price: MustParseDecimal("0.0015")},
+			wantErr: ErrInvalidPrice,
+		},
+		{
+			name:    "trigger price digits",
+			order:   OrderRequest{CurrencyPairId: 1, Type: OrderType_STOP_LIMIT_SELL, Amount: MustParseDecimal("0.015"), Price: MustParseDecimal("0.003"), TriggerPrice: decimalPtr("0.00305")},
+			wantErr: ErrInvalidPrice,
+		},
+		{
+			name:    "delisted pair",
+			order:   OrderRequest{CurrencyPairId: 2, Type: OrderType_BUY, Amount: MustParseDecimal("1"), Price: MustParseDecimal("1")},
+			wantErr: ErrPairInactive,
+		},
+		{
+			name:      "unknown type",
+			order:     OrderRequest{CurrencyPairId: 1, Type: OrderType("MARKET"), Amount: MustParseDecimal("0.015"), Price: MustParseDecimal("0.0021")},
+			wantField: "type",
+		},
+		{
+			name:  "rounded buy",
+			round: true,
+			order: OrderRequest{CurrencyPairId: 1, Type: OrderType_BUY, Amount: MustParseDecimal("0.0249"), Price: MustParseDecimal("0.00219")},
+			want:  OrderRequest{CurrencyPairId: 1, Type: OrderType_BUY, Amount: MustParseDecimal("0.02"), Price: MustParseDecimal("0.0021")},
+		},
+		{
+			name:  "rounded sell",
+			round: true,
+			order: OrderRequest{CurrencyPairId: 1, Type: OrderType_SELL, Amount: MustParseDecimal("0.0249"), Price: MustParseDecimal("0.00211")},
+			want:  OrderRequest{CurrencyPairId: 1, Type: OrderType_SELL, Amount: MustParseDecimal("0.02"), Price: MustParseDecimal("0.0022")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewOrderValidator(nil).Source(pairs).AutoRound(tt.round)
+			got, err := v.Validate(context.Background(), tt.order)
+			if tt.wantErr != nil || tt.wantField != "" {
+				var validationErr *OrderValidationError
+				if !errors.As(err, &validationErr) {
+					t.Fatalf("Validate() error = %v, want OrderValidationError", err)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+				}
+				if tt.wantField != "" && validationErr.Field != tt.wantField {
+					t.Errorf("Validate() error field = %q, want %q", validationErr.Field, tt.wantField)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.round && (!got.Amount.Equal(tt.want.Amount) || !got.Price.Equal(tt.want.Price)) {
+				t.Errorf("Validate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func decimalPtr(s string) *Decimal {
+	d := MustParseDecimal(s)
+	return &d
+}
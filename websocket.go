@@ -2,7 +2,6 @@ package stex
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"os"
 	"sync"
@@ -15,21 +14,74 @@ import (
 type WssClient struct {
 	sync.Mutex
 
-	APIKey    string
-	BaseURL   string
-	UserAgent string
-	Debug     bool
-	Logger    *log.Logger
+	APIKey  string
+	BaseURL string
+	// TokenSource provides bearer token for private channels instead of APIKey
+	TokenSource TokenSource
+	UserAgent   string
+	Debug       bool
+	Logger      *log.Logger
+	// Reconnect enables supervised mode: dropped connection is restored with backoff,
+	// subscriptions and handlers are registered again. Nil means no reconnects.
+	Reconnect *ReconnectPolicy
 
 	connected bool
 
 	onDisconnect func()
 	onError      func()
 	onConnection func()
+	onReconnect  func()
+	// reconnectHooks are internal listeners of reconnects, e.g. live order books
+	reconnectHooks map[int64]func()
+
+	// subscriptions and handlers made through Subscribe and On, restored on reconnect
+	subs       map[string]*wsSubscription
+	handlers   map[int64]*wsHandler
+	handlerSeq int64
+	// routes registered on the current socket.io client
+	routes map[string]bool
+	// done is closed when the connection made by Do is lost for good
+	done chan struct{}
+	// ctx is the context passed to Do, it bounds token requests of subscriptions
+	ctx context.Context
 
 	c *ws.Client
 }
 
+// ReconnectPolicy define backoff between attempts to restore websocket connection.
+// Attempts never stop until the context passed to WssClient.Do is cancelled.
+type ReconnectPolicy struct {
+	// Delay before the first attempt
+	InitialBackoff time.Duration
+	// Upper bound of the delay between attempts
+	MaxBackoff time.Duration
+	// Backoff growth factor between attempts
+	Multiplier float64
+	// Part of the delay (0..1) that is randomised
+	Jitter float64
+}
+
+// DefaultReconnectPolicy returns a policy with exponential backoff from 1s up to 30s
+func DefaultReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// backoff returns the delay before reconnect attempt number attempt
+func (p *ReconnectPolicy) backoff(attempt int) time.Duration {
+	rp := RetryPolicy{
+		InitialBackoff: p.InitialBackoff,
+		MaxBackoff:     p.MaxBackoff,
+		Multiplier:     p.Multiplier,
+		Jitter:         p.Jitter,
+	}
+	return rp.backoff(attempt)
+}
+
 func NewWssClient(APIKey string) *WssClient {
 	return &WssClient{
 		APIKey:    APIKey,
@@ -46,30 +98,47 @@ func (w *WssClient) debug(format string, v ...interface{}) {
 	}
 }
 
-func (w *WssClient) Subscribe(channel string, auth bool) error {
-	if w.c == nil {
-		return fmt.Errorf("ws connection closed")
+// accessToken returns bearer token from TokenSource if it is set, otherwise APIKey.
+// It may refresh the token over the network, so it must not be called with the lock held.
+func (w *WssClient) accessToken(ctx context.Context) (string, error) {
+	if w.TokenSource == nil {
+		return w.APIKey, nil
 	}
 
-	auth_token := map[string]interface{}{}
-	if auth == true {
-		auth_token = map[string]interface{}{
-			"headers": map[string]interface{}{
-				"Authorization": "Bearer " + w.APIKey,
-			},
-		}
+	t, err := w.TokenSource.Token(ctx)
+	if err != nil {
+		return "", err
 	}
 
-	return w.c.Emit("subscribe", map[string]interface{}{
-		"channel": channel,
-		"auth":    auth_token,
-	})
+	return t.AccessToken, nil
 }
 
 func (w *WssClient) C() *ws.Client {
+	w.Lock()
+	defer w.Unlock()
+
 	return w.c
 }
 
+// context returns the context passed to Do
+func (w *WssClient) context() context.Context {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.ctx == nil {
+		return context.Background()
+	}
+	return w.ctx
+}
+
+// closed returns channel closed when the connection is lost and will not be restored
+func (w *WssClient) closed() <-chan struct{} {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.done
+}
+
 func (w *WssClient) SetConnected(status bool) {
 	w.Lock()
 	defer w.Unlock()
@@ -88,9 +157,29 @@ func (w *WssClient) Do(ctx context.Context, opts ...RequestOption) (*WssClient,
 	w.Lock()
 	defer w.Unlock()
 
-	var err error
+	dropped := make(chan *ws.Client, 1)
+
+	c, err := w.dial(dropped)
+	if err != nil {
+		return nil, err
+	}
+	w.c = c
+
+	// A new connection starts with an empty registry, supervised reconnects keep it
+	w.subs = map[string]*wsSubscription{}
+	w.handlers = map[int64]*wsHandler{}
+	w.routes = map[string]bool{}
 
-	w.c, err = ws.Dial(
+	w.ctx = ctx
+	w.done = make(chan struct{})
+	go w.supervise(ctx, dropped, w.done)
+
+	return w, nil
+}
+
+// dial connects and registers system handlers, dropped receives the client when its connection is lost
+func (w *WssClient) dial(dropped chan *ws.Client) (*ws.Client, error) {
+	c, err := ws.Dial(
 		w.BaseURL,
 		&transport.WebsocketTransport{
 			PingInterval:   10 * time.Second,
@@ -106,7 +195,7 @@ func (w *WssClient) Do(ctx context.Context, opts ...RequestOption) (*WssClient,
 		return nil, err
 	}
 
-	err = w.c.On(ws.OnDisconnection, func(h *ws.Channel) {
+	err = c.On(ws.OnDisconnection, func(h *ws.Channel) {
 		w.debug("OnDisconnection")
 
 		w.SetConnected(false)
@@ -115,22 +204,29 @@ func (w *WssClient) Do(ctx context.Context, opts ...RequestOption) (*WssClient,
 			go w.onDisconnect()
 			//w.onDisconnect()
 		}
+
+		select {
+		case dropped <- c:
+		default:
+		}
 	})
 	if err != nil {
+		c.Close()
 		return nil, err
 	}
 
-	err = w.c.On(ws.OnError, func(h *ws.Channel) {
-		w.debug("OnError:", err)
+	err = c.On(ws.OnError, func(h *ws.Channel) {
+		w.debug("OnError")
 		if w.onError != nil {
 			w.onError()
 		}
 	})
 	if err != nil {
+		c.Close()
 		return nil, err
 	}
 
-	err = w.c.On(ws.OnConnection, func(h *ws.Channel) {
+	err = c.On(ws.OnConnection, func(h *ws.Channel) {
 		w.debug("OnConnection")
 
 		w.SetConnected(true)
@@ -141,22 +237,118 @@ func (w *WssClient) Do(ctx context.Context, opts ...RequestOption) (*WssClient,
 		}
 	})
 	if err != nil {
+		c.Close()
 		return nil, err
 	}
 
-	go func() {
+	return c, nil
+}
+
+// supervise closes connection when ctx is done and restores it after drops in supervised mode.
+// done is closed when the connection is lost for good.
+func (w *WssClient) supervise(ctx context.Context, dropped chan *ws.Client, done chan struct{}) {
+	finished := false
+	finish := func() {
+		if !finished {
+			finished = true
+			close(done)
+		}
+	}
+
+	for {
 		select {
 		case <-ctx.Done():
 			w.debug("Context Done()")
-			if w.c != nil {
-				w.c.Close()
-				w.c = nil
+			w.Lock()
+			c := w.c
+			w.c = nil
+			w.Unlock()
+
+			// Close runs disconnection handlers synchronously, so it must not hold the lock
+			if c != nil {
+				c.Close()
 			}
+			finish()
 			return
+
+		case c := <-dropped:
+			if c != w.C() {
+				continue
+			}
+			if w.Reconnect == nil {
+				finish()
+				continue
+			}
+			if !w.reconnect(ctx, dropped) {
+				continue
+			}
+			if w.onReconnect != nil {
+				go w.onReconnect()
+			}
+			w.Lock()
+			hooks := []func(){}
+			for _, f := range w.reconnectHooks {
+				hooks = append(hooks, f)
+			}
+			w.Unlock()
+			for _, f := range hooks {
+				go f()
+			}
+		}
+	}
+}
+
+// reconnect dials until success or ctx is done, then restores handlers and subscriptions.
+// Dial and token requests are made without the lock, so subscribers are not blocked by a slow network;
+// only the swap of the client and the restore run under it.
+func (w *WssClient) reconnect(ctx context.Context, dropped chan *ws.Client) bool {
+	for attempt := 1; ; attempt++ {
+		wait := w.Reconnect.backoff(attempt)
+		w.debug("reconnect attempt %d in %s", attempt, wait)
+		if !sleepContext(ctx, wait) {
+			return false
 		}
-	}()
 
-	return w, nil
+		c, err := w.dial(dropped)
+		if err != nil {
+			continue
+		}
+
+		token := ""
+		if w.hasPrivateSubscriptions() {
+			token, err = w.accessToken(ctx)
+			if err != nil {
+				w.debug("token for resubscription: %s", err)
+				c.Close()
+				continue
+			}
+		}
+
+		w.Lock()
+		old := w.c
+		w.c = c
+		err = w.restore(c, token)
+		w.Unlock()
+
+		if old != nil {
+			old.Close()
+		}
+		if err != nil {
+			w.debug("restore after reconnect: %s", err)
+			c.Close()
+			continue
+		}
+
+		// Forget drops of clients closed above, the new one is checked directly
+		select {
+		case <-dropped:
+		default:
+		}
+		if !c.IsAlive() {
+			continue
+		}
+		return true
+	}
 }
 
 func (w *WssClient) OnConnection(f func()) *WssClient {
@@ -174,6 +366,34 @@ func (w *WssClient) OnError(f func()) *WssClient {
 	return w
 }
 
+// OnReconnect sets hook called after the connection is restored and subscriptions are repeated,
+// e.g. to fetch order book snapshots again
+func (w *WssClient) OnReconnect(f func()) *WssClient {
+	w.onReconnect = f
+	return w
+}
+
+// addReconnectHook registers f to be called after every reconnect in addition to OnReconnect hook,
+// the returned func removes it
+func (w *WssClient) addReconnectHook(f func()) func() {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.reconnectHooks == nil {
+		w.reconnectHooks = map[int64]func(){}
+	}
+	w.handlerSeq++
+	id := w.handlerSeq
+	w.reconnectHooks[id] = f
+
+	return func() {
+		w.Lock()
+		defer w.Unlock()
+
+		delete(w.reconnectHooks, id)
+	}
+}
+
 func NewWebsocketRateChannelService(c *WssClient) *WebsocketRateChannelService {
 	return &WebsocketRateChannelService{c: c}
 }
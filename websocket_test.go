@@ -0,0 +1,110 @@
+package stex_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	stex "github.com/vladivolo/stex-api"
+	"github.com/vladivolo/stex-api/stextest"
+)
+
+type ctxKey struct{}
+
+// recordingTokenSource returns a fixed token and records the contexts it is asked with
+type recordingTokenSource struct {
+	mu    sync.Mutex
+	token string
+	ctxs  []context.Context
+}
+
+func (s *recordingTokenSource) Token(ctx context.Context) (*stex.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ctxs = append(s.ctxs, ctx)
+	return &stex.Token{AccessToken: s.token}, nil
+}
+
+func (s *recordingTokenSource) contexts() []context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]context.Context{}, s.ctxs...)
+}
+
+func TestWssClientReconnect(t *testing.T) {
+	sock := stextest.NewSocketServer()
+	defer sock.Close()
+	sock.AddToken("token", 1)
+
+	ts := &recordingTokenSource{token: "token"}
+	w := sock.WssClient("")
+	w.TokenSource = ts
+	w.Reconnect = &stex.ReconnectPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, Multiplier: 2}
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "do"), 10*time.Second)
+	defer cancel()
+
+	reconnected := make(chan struct{}, 1)
+	w.OnReconnect(func() {
+		reconnected <- struct{}{}
+	})
+	if _, err := w.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	balances := make(chan stex.UpdateBalance, 4)
+	err := stex.NewWebsocketUserBalanceUpdateChannelService(w).WalletId(7).OnMessage(func(_ string, msg stex.UpdateBalance) {
+		balances <- msg
+	}).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel := "private-balance_changed_w_7"
+	if err = sock.WaitSubscribed(ctx, channel, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := sock.Disconnect(); n != 1 {
+		t.Fatalf("disconnected %d clients", n)
+	}
+	select {
+	case <-reconnected:
+	case <-ctx.Done():
+		t.Fatal("not reconnected")
+	}
+	if err = sock.WaitSubscribed(ctx, channel, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Subscriptions are served while the client reconnects, the registry keeps the channel
+	if subs := w.Subscriptions(); len(subs) != 1 || subs[0].Channel != channel || !subs[0].Private {
+		t.Errorf("subscriptions = %+v", subs)
+	}
+
+	if _, err = sock.Push(channel, stextest.EventBalanceChanged, map[string]interface{}{"id": 7, "currency_code": "BTC", "balance": "1.5"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-balances:
+		if msg.Code != "BTC" || !msg.Balance.Equal(stex.MustParseDecimal("1.5")) {
+			t.Errorf("balance = %+v", msg)
+		}
+	case <-ctx.Done():
+		t.Fatal("no event after reconnect")
+	}
+
+	// Tokens of the subscription and of the resubscription are requested with the Do context
+	ctxs := ts.contexts()
+	if len(ctxs) < 2 {
+		t.Fatalf("token requested %d times, want at least 2", len(ctxs))
+	}
+	for _, c := range ctxs {
+		if c.Value(ctxKey{}) != "do" {
+			t.Error("token requested without the Do context")
+		}
+	}
+}
@@ -8,7 +8,7 @@ import (
 )
 
 type Withdrawal struct {
-	id          int64  `json:"id"`
+	Id          int64  `json:"id"`
 	Name        string `json:"name"`
 	StatusColor string `json:"color"`
 }
@@ -17,19 +17,19 @@ type WithdrawalAdv struct {
 	Id                 int64   `json:"id"`
 	CurrencyId         int     `json:"currency_id"`
 	CurrencyCode       string  `json:"currency_code"`
-	Amount             string  `json:"amount"`
-	Fee                string  `json:"fee"`
+	Amount             Decimal `json:"amount"`
+	Fee                Decimal `json:"fee"`
 	FeeCurrencyId      int     `json:"fee_currency_id"`
 	FeeCurrencyCode    string  `json:"fee_currency_code"`
 	WithdrawalStatusId int     `json:"withdrawal_status_id"`
 	Status             string  `json:"status"`
 	StatusColor        string  `json:"status_color"`
-	CreatedAt          string  `json:"created_at"`
-	CreatedTs          string  `json:"created_ts"`
-	UpdatedAt          string  `json:"updated_at"`
-	UpdatedTs          string  `json:"updated_ts"`
+	CreatedAt          Time    `json:"created_at"`
+	CreatedTs          Time    `json:"created_ts"`
+	UpdatedAt          Time    `json:"updated_at"`
+	UpdatedTs          Time    `json:"updated_ts"`
 	Txid               *string `json:"txid"`
-	withdrawal_address Address `json:"withdrawal_address"`
+	WithdrawalAddress  Address `json:"withdrawal_address"`
 }
 
 type WithdrawalStatusesService struct {
@@ -237,7 +237,7 @@ type ProfileWithdrawalCreateService struct {
 	c *Client
 
 	currency_id                  *int64
-	amount                       *float64
+	amount                       *Decimal
 	address                      *string
 	protocol_id                  *int
 	additional_address_parameter *string // If withdrawal address requires the payment ID or some key or destination tag etc pass it here
@@ -269,7 +269,7 @@ func (s *ProfileWithdrawalCreateService) Do(ctx context.Context, opts ...Request
 	}
 
 	if s.protocol_id != nil {
-		r.setParam("protocol_id", s.protocol_id)
+		r.setParam("protocol_id", *s.protocol_id)
 	}
 
 	if s.additional_address_parameter != nil {
@@ -299,7 +299,7 @@ func (s *ProfileWithdrawalCreateService) CurrencyId(id int64) *ProfileWithdrawal
 	return s
 }
 
-func (s *ProfileWithdrawalCreateService) Amount(amount float64) *ProfileWithdrawalCreateService {
+func (s *ProfileWithdrawalCreateService) Amount(amount Decimal) *ProfileWithdrawalCreateService {
 	s.amount = &amount
 	return s
 }